@@ -0,0 +1,34 @@
+package api
+
+import (
+	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Admin(e *echo.Echo) {
+	admin := auth.Require(auth.PermAdmin)
+	// The admin routes reach every store, so credentials bound to one are refused
+	unbound := auth.RequireUnbound()
+
+	// Export a snapshot of the catalog as an archive
+	e.GET("/admin/export", handlers.ExportCatalog, admin, unbound)
+
+	// Restore the catalog from an archive (?dry_run=true to only report the changes)
+	e.POST("/admin/restore", handlers.RestoreCatalog, admin, unbound)
+
+	// Fetch and change the log levels
+	e.GET("/admin/log/levels", handlers.FetchLogLevels, admin, unbound)
+	e.PUT("/admin/log/levels", handlers.UpdateLogLevel, admin, unbound)
+
+	// Manage the API keys
+	e.GET("/admin/api-keys", handlers.FetchAPIKeys, admin, unbound)
+	e.POST("/admin/api-keys", handlers.CreateAPIKey, admin, unbound)
+	e.DELETE("/admin/api-keys/:KeyID", handlers.RevokeAPIKey, admin, unbound)
+
+	// Manage the stores (tenants) and their catalogs
+	e.GET("/admin/stores", handlers.FetchStores, admin, unbound)
+	e.POST("/admin/stores", handlers.CreateStore, admin, unbound)
+	e.DELETE("/admin/stores/:storeId", handlers.DeleteStore, admin, unbound)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Categories(e *echo.Echo) {
+	read := auth.Require(auth.PermProduceRead)
+	write := auth.Require(auth.PermProduceWrite)
+	remove := auth.Require(auth.PermProduceDelete)
+
+	// Fetch the categories, or a category with its path and the categories under it
+	e.GET("/categories", handlers.FetchCategories, read)
+	e.GET("/categories/:CategoryID", handlers.FetchCategory, read)
+
+	// Add a category, or rename and move one
+	e.POST("/categories", handlers.CreateCategory, write)
+	e.PUT("/categories/:CategoryID", handlers.UpdateCategory, write)
+
+	// Delete a category with nothing in it
+	e.DELETE("/categories/:CategoryID", handlers.DeleteCategory, remove)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/produce_demo/backup"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RestoreMsg return structure - used by RestoreCatalog
+type RestoreMsg struct {
+	Err     string          `json:"Error,omitempty"`
+	Errors  []string        `json:"Errors,omitempty"`
+	DryRun  bool            `json:"Dry Run"`
+	Changes *backup.Changes `json:"Changes,omitempty"`
+}
+
+// Export a snapshot of every catalog, with the categories and suppliers they share, as an archive
+func ExportCatalog(c echo.Context) error {
+	filename := "produce-export-" + time.Now().UTC().Format("20060102T150405Z") + ".tar.gz"
+	c.Response().Header().Set(echo.HeaderContentType, "application/gzip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\""+filename+"\"")
+	c.Response().WriteHeader(http.StatusOK) // Returns 200
+
+	if err := backup.Export(c.Request().Context(), c.Response()); err != nil {
+		logger.ErrorContext(c.Request().Context(), "ExportCatalog - failed writing the archive", "error", err)
+		return err
+	}
+	return nil
+}
+
+// Restore every catalog, category, supplier and store from an archive in the request body
+// With ?dry_run=true the archive is validated and the changes reported but nothing is restored
+func RestoreCatalog(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	dryRun, err := strconv.ParseBool(c.QueryParam("dry_run"))
+	if err != nil && c.QueryParam("dry_run") != "" {
+		return c.JSON(http.StatusBadRequest, RestoreMsg{Err: "Bad dry_run"}) // Returns 400
+	}
+
+	// Read and validate the archive
+	archive, err := backup.Read(c.Request().Body)
+	var validationError *backup.ValidationError
+	if errors.As(err, &validationError) {
+		logger.InfoContext(c.Request().Context(), "RestoreCatalog - invalid archive", "error", err)
+		return c.JSON(http.StatusBadRequest, RestoreMsg{Err: "Invalid archive", Errors: validationError.Errors, DryRun: dryRun}) // Returns 400
+	}
+	if err != nil {
+		logger.InfoContext(c.Request().Context(), "RestoreCatalog - failed reading the archive", "error", err)
+		return c.JSON(http.StatusBadRequest, RestoreMsg{Err: "Failed to read archive", DryRun: dryRun}) // Returns 400
+	}
+
+	// Dry run
+	if dryRun {
+		changes, err := backup.Plan(c.Request().Context(), archive)
+		if err != nil {
+			return storeFailed(c, RestoreMsg{Err: cancelled, DryRun: true}, err) // Returns 503
+		}
+		return c.JSON(http.StatusOK, RestoreMsg{DryRun: true, Changes: &changes}) // Returns 200
+	}
+
+	// Final Return
+	changes, err := backup.Restore(c.Request().Context(), archive)
+	if err != nil {
+		return storeFailed(c, RestoreMsg{Err: cancelled}, err) // Returns 503
+	}
+	logger.InfoContext(c.Request().Context(), "RestoreCatalog - restored archive", "created", archive.Manifest.Created,
+		"added", len(changes.Added), "updated", len(changes.Updated), "removed", len(changes.Removed))
+	return c.JSON(http.StatusOK, RestoreMsg{Changes: &changes}) // Returns 200
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getAdminEcho() *echo.Echo {
+	e := getEcho()
+
+	// Export a snapshot of the catalog as an archive
+	e.GET("/admin/export", ExportCatalog)
+
+	// Restore the catalog from an archive
+	e.POST("/admin/restore", RestoreCatalog)
+
+	return e
+}
+
+// Test ExportCatalog and RestoreCatalog
+func TestExportRestoreCatalog(t *testing.T) {
+	e := getAdminEcho()
+
+	// Success condition - export
+	expected := http.StatusOK
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/admin/export", nil))
+
+	if expected != rec.Code || rec.Header().Get(echo.HeaderContentType) != "application/gzip" ||
+		!strings.HasPrefix(rec.Header().Get(echo.HeaderContentDisposition), "attachment; filename=\"produce-export-") {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) headers are (%v) \n", expected, rec.Code, rec.Header())
+	}
+	archive := rec.Body.Bytes()
+
+	// Change the catalog after the export
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.DELETE, "/produce/A12T-4GH7-QPL9-3N4M", nil))
+
+	// Success condition - dry run reports the change but doesn't make it
+	expectedBody := "{\"Dry Run\":true,\"Changes\":{\"Added\":[\"A12T-4GH7-QPL9-3N4M\"],\"Updated\":[],\"Removed\":[],\"Unchanged\":3}}\n"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.POST, "/admin/restore?dry_run=true", bytes.NewReader(archive)))
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected (%v) (%v) but got (%v) body is (%v) \n", expected, expectedBody, rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/produce/A12T-4GH7-QPL9-3N4M", nil))
+	if http.StatusNoContent != rec.Code {
+		t.Errorf("ERROR -- dry run restored the catalog - got (%v) body is (%v) \n", rec.Code, rec.Body)
+	}
+
+	// Success condition - restore
+	expectedBody = "{\"Dry Run\":false,\"Changes\":{\"Added\":[\"A12T-4GH7-QPL9-3N4M\"],\"Updated\":[],\"Removed\":[],\"Unchanged\":3}}\n"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.POST, "/admin/restore", bytes.NewReader(archive)))
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected (%v) (%v) but got (%v) body is (%v) \n", expected, expectedBody, rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/produce/A12T-4GH7-QPL9-3N4M", nil))
+	if http.StatusOK != rec.Code {
+		t.Errorf("ERROR -- restore did not restore the catalog - got (%v) body is (%v) \n", rec.Code, rec.Body)
+	}
+
+	// Failure condition - not an archive
+	expected = http.StatusBadRequest
+	expectedBody = "{\"Error\":\"Failed to read archive\",\"Dry Run\":false}\n"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.POST, "/admin/restore", strings.NewReader("produce")))
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected (%v) (%v) but got (%v) body is (%v) \n", expected, expectedBody, rec.Code, rec.Body)
+	}
+
+	// Failure condition - bad dry_run
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.POST, "/admin/restore?dry_run=maybe", bytes.NewReader(archive)))
+
+	if expected != rec.Code {
+		t.Errorf("ERROR -- expected (%v) but got (%v) body is (%v) \n", expected, rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Longest category name accepted
+const maxCategoryNameLength = 64
+
+// Category with where it sits in the tree
+type CategoryInfo struct {
+	db.Category
+	Path     []string `json:"Path,omitempty"`     // IDs from the top of the tree down to the category
+	Children []string `json:"Children,omitempty"` // IDs of the categories directly under it
+}
+
+// CategoryMsg return structure - used by the category handlers
+type CategoryMsg struct {
+	Err        string        `json:"Error,omitempty"`
+	Category   *CategoryInfo `json:"Category,omitempty"`
+	Categories []db.Category `json:"Categories,omitempty"`
+}
+
+// CategoryRequest body structure - used by CreateCategory and UpdateCategory
+type CategoryRequest struct {
+	ID     string `json:"ID"` // May be left out of an update
+	Name   string `json:"Name"`
+	Parent string `json:"Parent"` // Left out for a top-level category
+}
+
+// Category with its place in the tree
+func categoryInfo(c db.Category) *CategoryInfo {
+	path, _ := db.Categories.Path(c.ID)
+	return &CategoryInfo{Category: c, Path: path, Children: db.Categories.Children(c.ID)}
+}
+
+// Read and check a CategoryRequest - returns the error to send if it is bad
+func readCategoryRequest(c echo.Context) (CategoryRequest, string) {
+	defer c.Request().Body.Close()
+
+	var request CategoryRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return request, "Failed to unmarshal request body"
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || utf8.RuneCountInString(request.Name) > maxCategoryNameLength {
+		return request, "Name is required and may be up to 64 characters"
+	}
+	return request, ""
+}
+
+// Fetch every category, sorted by ID - each names its Parent
+func FetchCategories(c echo.Context) error {
+	categories := db.Categories.List()
+	if len(categories) == 0 {
+		return c.JSON(http.StatusNoContent, CategoryMsg{Err: "No categories found"}) // Returns 204
+	}
+	return c.JSON(http.StatusOK, CategoryMsg{Categories: categories}) // Returns 200
+}
+
+// Fetch a category with its path from the top of the tree and the categories under it
+func FetchCategory(c echo.Context) error {
+	category, err := db.Categories.Get(c.Param("CategoryID"))
+	if errors.Is(err, db.ErrCategoryNotFound) {
+		return c.JSON(http.StatusNotFound, CategoryMsg{Err: "Category not found"}) // Returns 404
+	}
+	return c.JSON(http.StatusOK, CategoryMsg{Category: categoryInfo(category)}) // Returns 200
+}
+
+// Create a category, under its Parent if it has one
+func CreateCategory(c echo.Context) error {
+	request, msg := readCategoryRequest(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, CategoryMsg{Err: msg}) // Returns 400
+	}
+	if !db.ValidCategoryID(request.ID) {
+		return c.JSON(http.StatusBadRequest, CategoryMsg{Err: "ID is required and may be up to 64 lower case letters, digits and dashes"}) // Returns 400
+	}
+
+	category, err := db.Categories.Create(db.Category{ID: request.ID, Name: request.Name, Parent: request.Parent})
+	switch {
+	case errors.Is(err, db.ErrCategoryExists):
+		return c.JSON(http.StatusConflict, CategoryMsg{Err: "Category " + request.ID + " already exists"}) // Returns 409
+	case errors.Is(err, db.ErrParentNotFound):
+		return c.JSON(http.StatusBadRequest, CategoryMsg{Err: "Parent " + request.Parent + " not found"}) // Returns 400
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "CreateCategory - failed to create the category", "error", err)
+		return c.JSON(http.StatusInternalServerError, CategoryMsg{Err: "Failed to create the category"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "CreateCategory - created", "category", category.ID, "parent", category.Parent)
+
+	// Final Return
+	c.Response().Header().Set(echo.HeaderLocation, "/categories/"+category.ID)
+	return c.JSON(http.StatusCreated, CategoryMsg{Category: categoryInfo(category)}) // Returns 201
+}
+
+// Rename a category and move it, with the categories under it, to its Parent
+// A category cannot be moved under itself or any category under it
+func UpdateCategory(c echo.Context) error {
+	id := c.Param("CategoryID")
+	request, msg := readCategoryRequest(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, CategoryMsg{Err: msg}) // Returns 400
+	}
+	if request.ID != "" && request.ID != id {
+		return c.JSON(http.StatusBadRequest, CategoryMsg{Err: "ID does not match"}) // Returns 400
+	}
+
+	category, err := db.Categories.Update(db.Category{ID: id, Name: request.Name, Parent: request.Parent})
+	switch {
+	case errors.Is(err, db.ErrCategoryNotFound):
+		return c.JSON(http.StatusNotFound, CategoryMsg{Err: "Category not found"}) // Returns 404
+	case errors.Is(err, db.ErrParentNotFound):
+		return c.JSON(http.StatusBadRequest, CategoryMsg{Err: "Parent " + request.Parent + " not found"}) // Returns 400
+	case errors.Is(err, db.ErrCategoryCycle):
+		return c.JSON(http.StatusConflict, CategoryMsg{Err: "Category " + id + " cannot be moved under itself"}) // Returns 409
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "UpdateCategory - failed to update the category", "error", err)
+		return c.JSON(http.StatusInternalServerError, CategoryMsg{Err: "Failed to update the category"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "UpdateCategory - updated", "category", category.ID, "parent", category.Parent)
+
+	// Final Return
+	return c.JSON(http.StatusOK, CategoryMsg{Category: categoryInfo(category)}) // Returns 200
+}
+
+// Delete a category with no categories or Produce in it
+func DeleteCategory(c echo.Context) error {
+	category, err := db.Categories.Delete(c.Param("CategoryID"))
+	switch {
+	case errors.Is(err, db.ErrCategoryNotFound):
+		return c.JSON(http.StatusNotFound, CategoryMsg{Err: "Category not found"}) // Returns 404
+	case errors.Is(err, db.ErrCategoryInUse):
+		return c.JSON(http.StatusConflict, CategoryMsg{Err: "Category " + c.Param("CategoryID") + " has categories or produce in it"}) // Returns 409
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "DeleteCategory - failed to delete the category", "error", err)
+		return c.JSON(http.StatusInternalServerError, CategoryMsg{Err: "Failed to delete the category"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "DeleteCategory - deleted", "category", category.ID)
+
+	// Final Return
+	return c.JSON(http.StatusOK, CategoryMsg{Category: &CategoryInfo{Category: category}}) // Returns 200
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getCategoryEcho() *echo.Echo {
+	e := echo.New()
+
+	e.GET("/categories", FetchCategories)
+	e.GET("/categories/:CategoryID", FetchCategory)
+	e.POST("/categories", CreateCategory)
+	e.PUT("/categories/:CategoryID", UpdateCategory)
+	e.DELETE("/categories/:CategoryID", DeleteCategory)
+	e.GET("/produce", FetchProduce)
+	e.PUT("/produce/:ProduceCode", UpdateProduce)
+
+	return e
+}
+
+// categoryTestStruct
+type categoryTS struct {
+	method   string
+	target   string
+	body     string
+	expected int
+}
+
+// categoryTestStructs: test cases, run in order
+var categoryTSs = []categoryTS{
+	{echo.GET, "/categories", "", http.StatusNoContent},
+	{echo.POST, "/categories", "{\"ID\": \"fruit\", \"Name\": \"Fruit\"}", http.StatusCreated},
+	{echo.POST, "/categories", "{\"ID\": \"stone-fruit\", \"Name\": \"Stone Fruit\", \"Parent\": \"fruit\"}", http.StatusCreated},
+	{echo.POST, "/categories", "{\"ID\": \"veg\", \"Name\": \"Vegetables\"}", http.StatusCreated},
+	{echo.POST, "/categories", "{\"ID\": \"fruit\", \"Name\": \"Fruit\"}", http.StatusConflict},
+	{echo.POST, "/categories", "{\"ID\": \"nut\", \"Name\": \"Nut\", \"Parent\": \"none\"}", http.StatusBadRequest},
+	{echo.POST, "/categories", "{\"ID\": \"Nut\", \"Name\": \"Nut\"}", http.StatusBadRequest},
+	{echo.POST, "/categories", "{\"ID\": \"nut\", \"Name\": \" \"}", http.StatusBadRequest},
+	{echo.POST, "/categories", "{", http.StatusBadRequest},
+	{echo.GET, "/categories", "", http.StatusOK},
+	{echo.GET, "/categories/stone-fruit", "", http.StatusOK},
+	{echo.GET, "/categories/nut", "", http.StatusNotFound},
+	{echo.PUT, "/categories/fruit", "{\"Name\": \"Fruit\", \"Parent\": \"stone-fruit\"}", http.StatusConflict},
+	{echo.PUT, "/categories/fruit", "{\"Name\": \"Fruit\", \"Parent\": \"none\"}", http.StatusBadRequest},
+	{echo.PUT, "/categories/fruit", "{\"ID\": \"veg\", \"Name\": \"Fruit\"}", http.StatusBadRequest},
+	{echo.PUT, "/categories/nut", "{\"Name\": \"Nut\"}", http.StatusNotFound},
+	{echo.PUT, "/categories/fruit", "{\"Name\": \"Fresh Fruit\", \"Parent\": \"veg\"}", http.StatusOK},
+	{echo.GET, "/produce?category=fruit", "", http.StatusOK},
+	{echo.GET, "/produce?category=nut", "", http.StatusBadRequest},
+	{echo.DELETE, "/categories/fruit", "", http.StatusConflict},
+	{echo.DELETE, "/categories/stone-fruit", "", http.StatusConflict},
+	{echo.DELETE, "/categories/nut", "", http.StatusNotFound},
+}
+
+// Test categories can be created, moved and deleted, and Produce fetched by category
+func TestCategories(t *testing.T) {
+	e := getCategoryEcho()
+	ctx := context.Background()
+	plum := common.Produce{ProduceCode: "CATG-1111-2222-3333", Name: "Plum", UnitPrice: "0.99", Category: "stone-fruit"}
+	defer func() {
+		db.Default.Delete(ctx, plum.ProduceCode)
+		for _, id := range []string{"stone-fruit", "fruit", "veg"} {
+			db.Categories.Delete(id)
+		}
+	}()
+
+	for i, tt := range categoryTSs {
+		if i == 4 {
+			// Produce in a category only once it exists
+			if _, err := db.Default.Add(ctx, plum); err != nil {
+				t.Fatal(err)
+			}
+		}
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v %v %v) expected (%v) but got (%v) (%v)\n", tt.method, tt.target, tt.body, tt.expected, rec.Code, rec.Body)
+		}
+	}
+
+	// A moved category carries the categories under it
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/categories/stone-fruit", nil))
+	msg := CategoryMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if msg.Category == nil || strings.Join(msg.Category.Path, "/") != "veg/fruit/stone-fruit" {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", "veg/fruit/stone-fruit", rec.Body)
+	}
+
+	// Fetching a category includes the categories under it
+	for target, expected := range map[string]int{"/produce?category=veg": 1, "/produce?category=stone-fruit": 1} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, target, nil))
+		fetched := FetchMsg{}
+		json.Unmarshal(rec.Body.Bytes(), &fetched)
+		if fetched.Produce == nil || len(*fetched.Produce) != expected || (*fetched.Produce)[0].ProduceCode != plum.ProduceCode {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", target, plum.ProduceCode, rec.Body)
+		}
+	}
+
+	// A PUT without a Category keeps it, and one with an empty Category takes it out
+	for _, tt := range []struct {
+		body     string
+		expected string
+	}{
+		{"{\"Name\": \"Plum\", \"Unit Price\": \"1.09\"}", "stone-fruit"},
+		{"{\"Name\": \"Plum\", \"Unit Price\": \"1.09\", \"Category\": \"\"}", ""},
+	} {
+		req := httptest.NewRequest(echo.PUT, "/produce/"+plum.ProduceCode, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if p, _ := db.Default.Get(ctx, plum.ProduceCode); rec.Code != http.StatusOK || p.Category != tt.expected {
+			t.Errorf("ERROR -- for (%v) expected (%v) (%v) but got (%v) (%v)\n", tt.body, http.StatusOK, tt.expected, rec.Code, p.Category)
+		}
+	}
+
+	// Once empty it can be deleted
+	db.Default.Delete(ctx, plum.ProduceCode)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.DELETE, "/categories/stone-fruit", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", http.StatusOK, rec.Code, rec.Body)
+	}
+}
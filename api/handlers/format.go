@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/produce_demo/common"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// Response formats supported by FetchProduce and FetchProduceByProduceCode
+const (
+	formatJSON   = "json"
+	formatCSV    = "csv"
+	formatXML    = "xml"
+	formatYAML   = "yaml"
+	formatNDJSON = "ndjson"
+)
+
+// Content-Type returned for each format
+var formatContentTypes = map[string]string{
+	formatJSON:   echo.MIMEApplicationJSONCharsetUTF8,
+	formatCSV:    "text/csv; charset=UTF-8",
+	formatXML:    echo.MIMEApplicationXMLCharsetUTF8,
+	formatYAML:   "application/yaml; charset=UTF-8",
+	formatNDJSON: "application/x-ndjson; charset=UTF-8",
+}
+
+// Media types (from the Accept header) and the format each selects
+var mediaTypeFormats = map[string]string{
+	"*/*":                  formatJSON,
+	"application/*":        formatJSON,
+	"application/json":     formatJSON,
+	"text/csv":             formatCSV,
+	"application/csv":      formatCSV,
+	"application/xml":      formatXML,
+	"text/xml":             formatXML,
+	"application/yaml":     formatYAML,
+	"application/x-yaml":   formatYAML,
+	"text/yaml":            formatYAML,
+	"text/x-yaml":          formatYAML,
+	"application/x-ndjson": formatNDJSON,
+	"application/ndjson":   formatNDJSON,
+}
+
+// Values accepted by ?format= and the format each selects
+var queryFormats = map[string]string{
+	"json":   formatJSON,
+	"csv":    formatCSV,
+	"xml":    formatXML,
+	"yaml":   formatYAML,
+	"yml":    formatYAML,
+	"ndjson": formatNDJSON,
+}
+
+// CSV header - the same column names as the JSON tags on common.Produce
+var produceColumns = []string{"Produce Code", "Name", "Unit Price", "Category"}
+
+// Determine the response format for a request:
+//   ?format= wins if present - an unknown value is reported as not ok
+//   otherwise the supported media type in Accept with the highest quality
+//   otherwise JSON
+// The response is marked as varying with Accept, whatever it turns out to be, so caches keep each format apart
+func negotiateFormat(c echo.Context) (string, bool) {
+	c.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	if f := c.QueryParam("format"); f != "" {
+		format, ok := queryFormats[strings.ToLower(f)]
+		return format, ok
+	}
+
+	format := formatJSON
+	bestQuality := 0.0
+	for _, part := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		f, ok := mediaTypeFormats[mediaType]
+		if !ok {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality > bestQuality { // NOTE: ties keep the first listed
+			format, bestQuality = f, quality
+		}
+	}
+	return format, true
+}
+
+// Render a list of Produce in the negotiated format
+func renderProduce(c echo.Context, format string, code int, produceList []common.Produce) error {
+	switch format {
+	case formatCSV:
+		c.Response().Header().Set(echo.HeaderContentType, formatContentTypes[format])
+		c.Response().WriteHeader(code)
+		w := csv.NewWriter(c.Response())
+		w.Write(produceColumns)
+		for _, p := range produceList {
+			w.Write([]string{p.ProduceCode, p.Name, p.UnitPrice, p.Category})
+		}
+		w.Flush()
+		return w.Error()
+	case formatXML:
+		return c.XML(code, FetchMsg{Produce: &produceList})
+	case formatYAML:
+		b, err := yaml.Marshal(FetchMsg{Produce: &produceList})
+		if err != nil {
+			return err
+		}
+		return c.Blob(code, formatContentTypes[format], b)
+	case formatNDJSON:
+		c.Response().Header().Set(echo.HeaderContentType, formatContentTypes[format])
+		c.Response().WriteHeader(code)
+		enc := json.NewEncoder(c.Response())
+		for _, p := range produceList {
+			if err := enc.Encode(p); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return c.JSON(code, FetchMsg{Produce: &produceList})
+	}
+}
+
+// Standard return for an unknown ?format=
+func unsupportedFormat(c echo.Context) error {
+	return c.JSON(http.StatusNotAcceptable, FetchMsg{Err: "Unsupported format"}) // Returns 406
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// fetchFormatTestStruct
+type ffTS struct {
+	url          string // Request URL
+	accept       string // Accept header
+	expected     int    // Expected status
+	expectedType string // Expected Content-Type prefix
+	expectedBody string // Expected body
+}
+
+// fetchFormatTestStructs: test cases
+var ffTSs = []ffTS{
+	{"/produce/A12T-4GH7-QPL9-3N4M", "", http.StatusOK, "application/json",
+		"{\"Produce\":[{\"Produce Code\":\"A12T-4GH7-QPL9-3N4M\",\"Name\":\"Lettuce\",\"Unit Price\":\"3.46\"}]}\n"},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "text/csv", http.StatusOK, "text/csv",
+		"Produce Code,Name,Unit Price,Category\nA12T-4GH7-QPL9-3N4M,Lettuce,3.46,\n"},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "application/xml", http.StatusOK, "application/xml",
+		"<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<ProduceList><Produce><ProduceCode>A12T-4GH7-QPL9-3N4M</ProduceCode><Name>Lettuce</Name><UnitPrice>3.46</UnitPrice></Produce></ProduceList>"},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "application/yaml", http.StatusOK, "application/yaml",
+		"Produce:\n    - Produce Code: A12T-4GH7-QPL9-3N4M\n      Name: Lettuce\n      Unit Price: \"3.46\"\n"},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "application/x-ndjson", http.StatusOK, "application/x-ndjson",
+		"{\"Produce Code\":\"A12T-4GH7-QPL9-3N4M\",\"Name\":\"Lettuce\",\"Unit Price\":\"3.46\"}\n"},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "text/html, text/csv;q=0.5, application/yaml;q=0.9", http.StatusOK, "application/yaml", ""},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "text/html", http.StatusOK, "application/json", ""},
+	{"/produce/A12T-4GH7-QPL9-3N4M", "text/csv;q=0", http.StatusOK, "application/json", ""},
+	{"/produce/A12T-4GH7-QPL9-3N4M?format=CSV", "application/xml", http.StatusOK, "text/csv", ""},
+	{"/produce/A12T-4GH7-QPL9-3N4M?format=yml", "", http.StatusOK, "application/yaml", ""},
+	{"/produce/A12T-4GH7-QPL9-3N4M?format=pdf", "", http.StatusNotAcceptable, "application/json",
+		"{\"Error\":\"Unsupported format\"}\n"},
+	{"/produce?format=ndjson", "", http.StatusOK, "application/x-ndjson", ""},
+	{"/produce?format=pdf", "", http.StatusNotAcceptable, "application/json", ""},
+}
+
+// Test content negotiation on FetchProduce and FetchProduceByProduceCode
+func TestFetchProduceFormats(t *testing.T) {
+	e := getEcho()
+	for _, tt := range ffTSs {
+		req := httptest.NewRequest(echo.GET, tt.url, nil)
+		if tt.accept != "" {
+			req.Header.Set(echo.HeaderAccept, tt.accept)
+		}
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v) Accept (%v) expected (%v) but got (%v) body is (%v) \n", tt.url, tt.accept, tt.expected, rec.Code, rec.Body)
+		}
+		if contentType := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(contentType, tt.expectedType) {
+			t.Errorf("ERROR -- for (%v) Accept (%v) expected Content-Type (%v) but got (%v) \n", tt.url, tt.accept, tt.expectedType, contentType)
+		}
+		if vary := rec.Header().Get(echo.HeaderVary); vary != echo.HeaderAccept {
+			t.Errorf("ERROR -- for (%v) Accept (%v) expected Vary (%v) but got (%v) \n", tt.url, tt.accept, echo.HeaderAccept, vary)
+		}
+		if tt.expectedBody != "" && tt.expectedBody != rec.Body.String() {
+			t.Errorf("ERROR -- for (%v) Accept (%v) expected body (%q) but got (%q) \n", tt.url, tt.accept, tt.expectedBody, rec.Body.String())
+		}
+	}
+}
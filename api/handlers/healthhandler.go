@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"example.com/produce_demo/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HealthMsg return structure - used by Healthz and Readyz
+type HealthMsg struct {
+	Status string                   `json:"Status"`
+	Checks map[string]health.Result `json:"Checks,omitempty"`
+}
+
+// Report the process is alive
+func Healthz(c echo.Context) error {
+	return c.JSON(http.StatusOK, HealthMsg{Status: health.StatusOK}) // Returns 200
+}
+
+// Report whether every health check passes
+func Readyz(c echo.Context) error {
+	ready, results := health.Ready(c.Request().Context())
+	if !ready {
+		logger.WarnContext(c.Request().Context(), "Readyz - not ready", "checks", results)
+		return c.JSON(http.StatusServiceUnavailable, HealthMsg{Status: health.StatusFail, Checks: results}) // Returns 503
+	}
+	return c.JSON(http.StatusOK, HealthMsg{Status: health.StatusOK, Checks: results}) // Returns 200
+}
+
+// Report the detailed status of the process
+// The status code follows readiness so /status can also serve as a probe
+func FetchStatus(c echo.Context) error {
+	status := health.Current(c.Request().Context())
+	if status.Status != health.StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, status) // Returns 503
+	}
+	return c.JSON(http.StatusOK, status) // Returns 200
+}
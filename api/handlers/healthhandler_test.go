@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"example.com/produce_demo/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getHealthEcho() *echo.Echo {
+	e := echo.New()
+
+	e.GET("/healthz", Healthz)
+	e.GET("/readyz", Readyz)
+	e.GET("/status", FetchStatus)
+
+	return e
+}
+
+// Test Healthz, Readyz and FetchStatus with passing and failing checks
+func TestHealth(t *testing.T) {
+	e := getHealthEcho()
+
+	// healthTestStruct
+	type healthTS struct {
+		target       string
+		expected     int
+		expectedBody string
+	}
+	// The store and imports register their own checks
+	for _, tt := range []healthTS{
+		{"/healthz", http.StatusOK, "{\"Status\":\"ok\"}\n"},
+		{"/readyz", http.StatusOK, ""},
+		{"/status", http.StatusOK, ""},
+	} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, tt.target, nil))
+		if tt.expected != rec.Code || (tt.expectedBody != "" && tt.expectedBody != rec.Body.String()) {
+			t.Errorf("ERROR -- for (%v) expected (%v) (%v) but got (%v) body is (%v) \n", tt.target, tt.expected, tt.expectedBody, rec.Code, rec.Body)
+		}
+	}
+
+	// Status carries the checks and statistics
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/status", nil))
+	var status health.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("ERROR -- failed to decode (%v) (%v)\n", rec.Body, err)
+	}
+	if status.Checks["store"].Status != health.StatusOK || status.Checks["imports"].Status != health.StatusOK ||
+		status.Stats["store"] == nil || status.Stats["imports"] == nil || status.Version == "" || status.Build.GoVersion == "" {
+		t.Errorf("ERROR -- unexpected status (%+v)\n", status)
+	}
+
+	// A failing check fails readiness but not liveness
+	health.Register("test", func(ctx context.Context) error { return errors.New("test failure") })
+	defer health.Unregister("test")
+
+	expectedBody := "{\"Status\":\"fail\",\"Checks\":{"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/readyz", nil))
+	if http.StatusServiceUnavailable != rec.Code || rec.Body.String()[:len(expectedBody)] != expectedBody {
+		t.Errorf("ERROR -- expected (%v) (%v) but got (%v) body is (%v) \n", http.StatusServiceUnavailable, expectedBody, rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/status", nil))
+	if http.StatusServiceUnavailable != rec.Code {
+		t.Errorf("ERROR -- expected (%v) but got (%v) body is (%v) \n", http.StatusServiceUnavailable, rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/healthz", nil))
+	if http.StatusOK != rec.Code {
+		t.Errorf("ERROR -- expected (%v) but got (%v) body is (%v) \n", http.StatusOK, rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"example.com/produce_demo/importer"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ImportMsg return structure - used by SubmitImport and FetchImport
+type ImportMsg struct {
+	Err    string        `json:"Error,omitempty"`
+	Import *importer.Job `json:"Import,omitempty"`
+}
+
+// Queue a CSV or NDJSON file to be imported in the background
+// The file is either the request body or the "file" field of a multipart form
+func SubmitImport(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	var r io.Reader = c.Request().Body
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+
+	// Multipart form upload
+	if strings.HasPrefix(contentType, echo.MIMEMultipartForm) {
+		fh, err := c.FormFile("file")
+		if limit, ok := overBodyLimit(err); ok {
+			return bodyTooLarge(c, limit) // Returns 413
+		}
+		if err != nil {
+			logger.InfoContext(c.Request().Context(), "SubmitImport - failed reading the file from the form", "error", err)
+			return c.JSON(http.StatusBadRequest, ImportMsg{Err: "Failed to read file"}) // Returns 400
+		}
+		f, err := fh.Open()
+		if err != nil {
+			logger.ErrorContext(c.Request().Context(), "SubmitImport - failed opening the file from the form", "error", err)
+			return c.JSON(http.StatusBadRequest, ImportMsg{Err: "Failed to read file"}) // Returns 400
+		}
+		defer f.Close()
+		r = f
+		contentType = uploadContentType(fh)
+	}
+
+	job, err := importer.Submit(catalog(c), catalogStoreID(c), r, contentType)
+	if limit, ok := overBodyLimit(err); ok {
+		return bodyTooLarge(c, limit) // Returns 413
+	}
+	if errors.Is(err, importer.ErrUnsupportedType) {
+		return c.JSON(http.StatusUnsupportedMediaType, ImportMsg{Err: "Unsupported import type"}) // Returns 415
+	}
+	if errors.Is(err, importer.ErrQueueFull) {
+		return c.JSON(http.StatusServiceUnavailable, ImportMsg{Err: "Import queue is full"}) // Returns 503
+	}
+	if errors.Is(err, importer.ErrShuttingDown) {
+		return c.JSON(http.StatusServiceUnavailable, ImportMsg{Err: "Server is shutting down"}) // Returns 503
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "SubmitImport - failed to queue the import", "error", err)
+		return c.JSON(http.StatusInternalServerError, ImportMsg{Err: "Internal Error detected"}) // Returns 500
+	}
+
+	// Final Return
+	c.Response().Header().Set(echo.HeaderLocation, "/imports/"+job.ID)
+	return c.JSON(http.StatusAccepted, ImportMsg{Import: &job}) // Returns 202
+}
+
+// Content-Type of an uploaded file - falls back to the file extension when the
+// client didn't send a usable type (curl -F sends application/octet-stream)
+func uploadContentType(fh *multipart.FileHeader) string {
+	contentType := fh.Header.Get(echo.HeaderContentType)
+	if importer.Supported(contentType) {
+		return contentType
+	}
+	switch strings.ToLower(filepath.Ext(fh.Filename)) {
+	case ".csv":
+		return importer.MIMECSV
+	case ".ndjson", ".jsonl":
+		return importer.MIMENDJSON
+	}
+	return contentType
+}
+
+// Fetch the progress of an import
+func FetchImport(c echo.Context) error {
+	job, ok := importer.Lookup(c.Param("ImportID"))
+	if !ok || !inCallerStore(c, job.Store) {
+		return c.JSON(http.StatusNotFound, ImportMsg{Err: "Import not found"}) // Returns 404
+	}
+
+	// Final Return
+	return c.JSON(http.StatusOK, ImportMsg{Import: &job}) // Returns 200
+}
+
+// Rejection report columns
+var rejectionColumns = []string{"Line", "Produce Code", "Name", "Unit Price", "Errors"}
+
+// Download the rejected lines of an import as CSV
+func FetchImportRejections(c echo.Context) error {
+	importID := c.Param("ImportID")
+	if job, ok := importer.Lookup(importID); !ok || !inCallerStore(c, job.Store) {
+		return c.JSON(http.StatusNotFound, ImportMsg{Err: "Import not found"}) // Returns 404
+	}
+	rejections, ok := importer.Rejections(importID)
+	if !ok {
+		return c.JSON(http.StatusNotFound, ImportMsg{Err: "Import not found"}) // Returns 404
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, formatContentTypes[formatCSV])
+	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\"import-"+importID+"-rejections.csv\"")
+	c.Response().WriteHeader(http.StatusOK) // Returns 200
+
+	w := csv.NewWriter(c.Response())
+	w.Write(rejectionColumns)
+	for _, o := range rejections {
+		w.Write([]string{strconv.Itoa(o.Line), o.Produce.ProduceCode, o.Produce.Name, o.Produce.UnitPrice, strings.Join(o.Errors, "; ")})
+	}
+	w.Flush()
+	return w.Error()
+}
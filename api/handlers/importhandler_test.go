@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/importer"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getImportEcho() *echo.Echo {
+	e := getEcho()
+
+	// Queue a file of Produce to be imported in the background
+	e.POST("/imports", SubmitImport)
+
+	// Fetch the progress of an import
+	e.GET("/imports/:ImportID", FetchImport)
+
+	// Download the rejected lines of an import
+	e.GET("/imports/:ImportID/rejections", FetchImportRejections)
+
+	return e
+}
+
+// Helper function to wait for an import to finish
+func waitForImport(t *testing.T, e *echo.Echo, location string) importer.Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, location, nil))
+
+		var msg ImportMsg
+		if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &msg) != nil || msg.Import == nil {
+			t.Fatalf("ERROR -- fetching (%v) got (%v) body is (%v) \n", location, rec.Code, rec.Body)
+		}
+		if msg.Import.Status == importer.JobCompleted || msg.Import.Status == importer.JobFailed {
+			return *msg.Import
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("ERROR -- import (%v) did not finish\n", location)
+	return importer.Job{}
+}
+
+// Test SubmitImport, FetchImport and FetchImportRejections
+func TestImports(t *testing.T) {
+	e := getImportEcho()
+
+	// Success condition - CSV body
+	expected := http.StatusAccepted
+	req := httptest.NewRequest(echo.POST, "/imports", strings.NewReader("Produce Code,Name,Unit Price\nIMPT-1111-2222-3333,Pizza Pie,200.6\nIMPT-1111-2222-4444, Celery,.45\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	location := rec.Header().Get(echo.HeaderLocation)
+	if expected != rec.Code || !strings.HasPrefix(location, "/imports/") {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) Location (%v) body is (%v) \n", expected, rec.Code, location, rec.Body)
+	}
+
+	job := waitForImport(t, e, location)
+	if job.Status != importer.JobCompleted || job.Added != 1 || job.Rejected != 1 {
+		t.Errorf("ERROR -- unexpected finished import (%+v)\n", job)
+	}
+
+	// Success condition - rejection report
+	expectedBody := "Line,Produce Code,Name,Unit Price,Errors\n3,IMPT-1111-2222-4444,\" Celery\",.45,Detected error for Produce Name ( Celery)\n"
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, location+"/rejections", nil))
+
+	if http.StatusOK != rec.Code || expectedBody != rec.Body.String() || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentDisposition), "attachment") {
+		t.Errorf("ERROR -- expected (%v) but got (%v) body is (%q) \n", expectedBody, rec.Code, rec.Body.String())
+	}
+
+	// Success condition - multipart upload typed by file extension
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, _ := w.CreateFormFile("file", "price_list.ndjson")
+	part.Write([]byte("{\"Produce Code\": \"IMPT-1111-2222-5555\", \"Name\": \"Corn\", \"Unit Price\": \".5\"}\n"))
+	w.Close()
+	req = httptest.NewRequest(echo.POST, "/imports", body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) body is (%v) \n", expected, rec.Code, rec.Body)
+	}
+	job = waitForImport(t, e, rec.Header().Get(echo.HeaderLocation))
+	if job.Status != importer.JobCompleted || job.Added != 1 || job.Rejected != 0 {
+		t.Errorf("ERROR -- unexpected finished import (%+v)\n", job)
+	}
+
+	// Failure condition - unsupported type
+	expected = http.StatusUnsupportedMediaType
+	req = httptest.NewRequest(echo.POST, "/imports", strings.NewReader("[]"))
+	req.Header.Set(echo.HeaderContentType, "application/json")
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code {
+		t.Errorf("ERROR -- expected (%v) but got (%v) body is (%v) \n", expected, rec.Code, rec.Body)
+	}
+
+	// Failure condition - multipart form without a file
+	expected = http.StatusBadRequest
+	body = &bytes.Buffer{}
+	w = multipart.NewWriter(body)
+	w.WriteField("name", "value")
+	w.Close()
+	req = httptest.NewRequest(echo.POST, "/imports", body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code {
+		t.Errorf("ERROR -- expected (%v) but got (%v) body is (%v) \n", expected, rec.Code, rec.Body)
+	}
+
+	// Failure condition - unknown import
+	expected = http.StatusNotFound
+	for _, url := range []string{"/imports/nope", "/imports/nope/rejections"} {
+		rec = httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.GET, url, nil))
+
+		if expected != rec.Code {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) body is (%v) \n", url, expected, rec.Code, rec.Body)
+		}
+	}
+
+	// Clean up
+	for _, produceCode := range []string{"IMPT-1111-2222-3333", "IMPT-1111-2222-5555"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.DELETE, "/produce/"+produceCode, nil))
+	}
+}
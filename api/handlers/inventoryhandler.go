@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Most days ahead expiring lots may be looked for
+const maxExpiringDays = 365
+
+// InventoryMsg return structure - used by the inventory handlers
+type InventoryMsg struct {
+	Err       string          `json:"Error,omitempty"`
+	Stock     []db.StockLevel `json:"Stock,omitempty"`
+	Lots      *[]db.Lot       `json:"Lots,omitempty"`
+	Movements *[]db.Movement  `json:"Movements,omitempty"`
+}
+
+// ConsumeRequest body structure - used by ConsumeStock
+type ConsumeRequest struct {
+	Lines          []db.ConsumeLine `json:"Lines"`
+	Reference      string           `json:"Reference"`       // What the stock went to, such as a sale
+	IncludeExpired bool             `json:"Include Expired"` // Take from lots past their Best Before, such as for spoilage
+}
+
+// Fetch the quantity on hand of every Produce item with stock, sorted by Produce Code
+func FetchInventory(c echo.Context) error {
+	levels := catalog(c).Inventory().Levels()
+	if len(levels) == 0 {
+		return c.JSON(http.StatusNoContent, InventoryMsg{Err: "No stock found"}) // Returns 204
+	}
+	return c.JSON(http.StatusOK, InventoryMsg{Stock: levels}) // Returns 200
+}
+
+// Fetch the movements into and out of stock, oldest first - ?produce_code= only fetches those of one Produce item
+func FetchMovements(c echo.Context) error {
+	produceCode := c.QueryParam("produce_code")
+	if produceCode != "" && !common.ValidateProduceCode(produceCode) {
+		return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Bad Produce Code"}) // Returns 400
+	}
+	movements := catalog(c).Inventory().Movements(produceCode)
+	return c.JSON(http.StatusOK, InventoryMsg{Movements: &movements}) // Returns 200
+}
+
+// Fetch the lots stock was received in, by Produce Code in the order they are consumed
+// ?produce_code= only fetches those of one Produce item
+func FetchLots(c echo.Context) error {
+	produceCode := c.QueryParam("produce_code")
+	if produceCode != "" && !common.ValidateProduceCode(produceCode) {
+		return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Bad Produce Code"}) // Returns 400
+	}
+	lots := catalog(c).Inventory().Lots(produceCode)
+	return c.JSON(http.StatusOK, InventoryMsg{Lots: &lots}) // Returns 200
+}
+
+// Fetch the lots with stock remaining that are best before ?days= days from today or sooner,
+// already expired included, soonest first
+func FetchExpiringLots(c echo.Context) error {
+	days, err := strconv.Atoi(c.QueryParam("days"))
+	if err != nil || days < 0 || days > maxExpiringDays {
+		return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "days is required and may be 0 to " + strconv.Itoa(maxExpiringDays)}) // Returns 400
+	}
+	date := time.Now().UTC().AddDate(0, 0, days).Format(db.DateLayout)
+	lots := catalog(c).Inventory().Expiring(date)
+	return c.JSON(http.StatusOK, InventoryMsg{Lots: &lots}) // Returns 200
+}
+
+// Take stock out first-expiry-first-out, such as for a sale or spoilage - lots past their Best
+// Before are only taken with "Include Expired"
+func ConsumeStock(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	var request ConsumeRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	if len(request.Lines) == 0 {
+		return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Lines are required"}) // Returns 400
+	}
+	if len(request.Lines) > limits.MaxBatchItems {
+		return batchTooLarge(c, "") // Returns 413
+	}
+	for _, line := range request.Lines {
+		if !common.ValidateProduceCode(line.ProduceCode) {
+			return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Detected error for Produce Code (" + line.ProduceCode + ")"}) // Returns 400
+		}
+		if line.Quantity <= 0 {
+			return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Quantity of " + line.ProduceCode + " must be positive"}) // Returns 400
+		}
+	}
+	request.Reference = strings.TrimSpace(request.Reference)
+	if utf8.RuneCountInString(request.Reference) > maxNoteLength {
+		return c.JSON(http.StatusBadRequest, InventoryMsg{Err: "Reference may be up to " + strconv.Itoa(maxNoteLength) + " characters"}) // Returns 400
+	}
+
+	movements, err := catalog(c).Inventory().Consume(request.Lines, request.Reference, request.IncludeExpired)
+	switch {
+	case errors.Is(err, db.ErrInsufficientStock):
+		return c.JSON(http.StatusConflict, InventoryMsg{Err: "Not enough stock on hand"}) // Returns 409
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "ConsumeStock - failed to save the stock", "error", err)
+		return c.JSON(http.StatusInternalServerError, InventoryMsg{Err: "Failed to save the stock"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "ConsumeStock - consumed", "lines", len(request.Lines), "movements", len(movements))
+
+	// Final Return
+	return c.JSON(http.StatusOK, InventoryMsg{Movements: &movements}) // Returns 200
+}
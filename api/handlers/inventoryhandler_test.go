@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Test stock is received in lots, listed by expiry and consumed first-expiry-first-out
+func TestLots(t *testing.T) {
+	store := db.New([]common.Produce{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"}})
+	db.Suppliers.Create(db.Supplier{ID: "orchard", Name: "Orchard Farms"})
+	defer db.Suppliers.Delete("orchard")
+	e := getOrderEcho(store)
+	e.GET("/inventory/lots", FetchLots)
+	e.GET("/inventory/lots/expiring", FetchExpiringLots)
+	e.POST("/inventory/consume", ConsumeStock)
+	day := func(days int) string { return time.Now().UTC().AddDate(0, 0, days).Format(db.DateLayout) }
+
+	tests := []struct {
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 10}]}", http.StatusCreated},
+		{echo.POST, "/purchase-orders/PO-000001/submit", "", http.StatusOK},
+		{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 4, \"Best Before\": \"tomorrow\"}]}", http.StatusBadRequest},
+		{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 4, \"Harvested\": \"" + day(0) + "\", \"Best Before\": \"" + day(-1) + "\"}]}", http.StatusBadRequest},
+		{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 6, \"Lot Number\": \"A-1\", \"Best Before\": \"" + day(30) + "\", \"Origin\": \"Yakima\"}," +
+			"{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 4, \"Lot Number\": \"B-1\", \"Harvested\": \"" + day(-5) + "\", \"Best Before\": \"" + day(2) + "\"}]}", http.StatusOK},
+		{echo.GET, "/inventory/lots/expiring?days=7", "", http.StatusOK},
+		{echo.GET, "/inventory/lots/expiring?days=-1", "", http.StatusBadRequest},
+		{echo.GET, "/inventory/lots/expiring", "", http.StatusBadRequest},
+		{echo.GET, "/inventory/lots?produce_code=TQ4C", "", http.StatusBadRequest},
+		{echo.POST, "/inventory/consume", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 11}]}", http.StatusConflict},
+		{echo.POST, "/inventory/consume", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 0}]}", http.StatusBadRequest},
+		{echo.POST, "/inventory/consume", "{\"Lines\": []}", http.StatusBadRequest},
+		{echo.POST, "/inventory/consume", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 5}], \"Reference\": \"sale 1\"}", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v %v %v) expected (%v) but got (%v) (%v)\n", tt.method, tt.target, tt.body, tt.expected, rec.Code, rec.Body)
+		}
+	}
+
+	// B-1 expires first so was used up before A-1
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/inventory/lots?produce_code=tq4c-vv6t-75zx-1rmr", nil))
+	msg := InventoryMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if msg.Lots == nil || len(*msg.Lots) != 2 || (*msg.Lots)[0].LotNumber != "B-1" || (*msg.Lots)[0].Remaining != 0 ||
+		(*msg.Lots)[1].Remaining != 5 || (*msg.Lots)[1].Origin != "Yakima" || (*msg.Lots)[1].Reference != "PO-000001" {
+		t.Errorf("ERROR -- expected B-1 used up and 5 left in A-1 but got (%v)\n", rec.Body)
+	}
+
+	// Only lots with stock remaining are expiring
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/inventory/lots/expiring?days=30", nil))
+	msg = InventoryMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if msg.Lots == nil || len(*msg.Lots) != 1 || (*msg.Lots)[0].LotNumber != "A-1" {
+		t.Errorf("ERROR -- expected A-1 expiring but got (%v)\n", rec.Body)
+	}
+
+	// Stock past its Best Before is only taken when asked for
+	for _, tt := range []struct {
+		method   string
+		target   string
+		body     string
+		expected int
+	}{
+		{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 2}]}", http.StatusCreated},
+		{echo.POST, "/purchase-orders/PO-000002/submit", "", http.StatusOK},
+		{echo.POST, "/purchase-orders/PO-000002/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 2, \"Lot Number\": \"C-1\", \"Best Before\": \"" + day(-1) + "\"}]}", http.StatusOK},
+		{echo.POST, "/inventory/consume", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 6}]}", http.StatusConflict},
+		{echo.POST, "/inventory/consume", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 2}], \"Reference\": \"spoilage\", \"Include Expired\": true}", http.StatusOK},
+	} {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code || (strings.Contains(tt.body, "spoilage") && !strings.Contains(rec.Body.String(), `"Lot":"C-1"`)) {
+			t.Errorf("ERROR -- for (%v %v %v) expected (%v) but got (%v) (%v)\n", tt.method, tt.target, tt.body, tt.expected, rec.Code, rec.Body)
+		}
+	}
+}
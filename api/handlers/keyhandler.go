@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Longest API key name accepted
+const maxKeyNameLength = 64
+
+// APIKeyMsg return structure - used by FetchAPIKeys, CreateAPIKey and RevokeAPIKey
+type APIKeyMsg struct {
+	Err    string     `json:"Error,omitempty"`
+	Key    *auth.Key  `json:"Key,omitempty"`
+	APIKey string     `json:"API Key,omitempty"` // Only returned when the key is created
+	Keys   []auth.Key `json:"Keys,omitempty"`
+}
+
+// APIKeyRequest body structure - used by CreateAPIKey
+type APIKeyRequest struct {
+	Name  string   `json:"Name"`
+	Roles []string `json:"Roles"`
+	Store string   `json:"Store"` // Tenant the key is bound to - empty for any
+}
+
+// Fetch every managed API key - the keys themselves are never returned
+func FetchAPIKeys(c echo.Context) error {
+	return c.JSON(http.StatusOK, APIKeyMsg{Keys: auth.Keys.List()}) // Returns 200
+}
+
+// Create an API key with the given roles, optionally bound to a store - the response is the only time the key is shown
+func CreateAPIKey(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	var request APIKeyRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, APIKeyMsg{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || utf8.RuneCountInString(request.Name) > maxKeyNameLength {
+		return c.JSON(http.StatusBadRequest, APIKeyMsg{Err: "Name is required and may be up to 64 characters"}) // Returns 400
+	}
+
+	if len(request.Roles) == 0 {
+		return c.JSON(http.StatusBadRequest, APIKeyMsg{Err: "Roles are required"}) // Returns 400
+	}
+	for _, role := range request.Roles {
+		if !auth.KnownRole(role) {
+			return c.JSON(http.StatusBadRequest, APIKeyMsg{Err: "Unknown role " + role + " - roles are " + strings.Join(auth.RoleNames(), ", ")}) // Returns 400
+		}
+	}
+
+	if request.Store != "" {
+		if _, _, err := db.Tenants.Get(request.Store); err != nil {
+			return c.JSON(http.StatusBadRequest, APIKeyMsg{Err: "Unknown store " + request.Store}) // Returns 400
+		}
+	}
+
+	key, secret, err := auth.Keys.Create(request.Name, request.Roles, request.Store)
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "CreateAPIKey - failed to create the key", "error", err)
+		return c.JSON(http.StatusInternalServerError, APIKeyMsg{Err: "Failed to create the key"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "CreateAPIKey - created", "keyID", key.ID, "name", key.Name, "roles", key.Roles, "store", key.Store)
+
+	// Final Return
+	return c.JSON(http.StatusCreated, APIKeyMsg{Key: &key, APIKey: secret}) // Returns 201
+}
+
+// Revoke an API key by its ID - requests using it are refused from now on
+func RevokeAPIKey(c echo.Context) error {
+	key, err := auth.Keys.Revoke(c.Param("KeyID"))
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		return c.JSON(http.StatusNotFound, APIKeyMsg{Err: "API key not found"}) // Returns 404
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "RevokeAPIKey - failed to revoke the key", "error", err)
+		return c.JSON(http.StatusInternalServerError, APIKeyMsg{Err: "Failed to revoke the key"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "RevokeAPIKey - revoked", "keyID", key.ID, "name", key.Name)
+
+	// Final Return
+	return c.JSON(http.StatusOK, APIKeyMsg{Key: &key}) // Returns 200
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getKeyEcho() *echo.Echo {
+	e := echo.New()
+
+	e.GET("/admin/api-keys", FetchAPIKeys)
+	e.POST("/admin/api-keys", CreateAPIKey)
+	e.DELETE("/admin/api-keys/:KeyID", RevokeAPIKey)
+
+	return e
+}
+
+// createKeyTestStruct
+type createKeyTS struct {
+	body     string
+	expected int
+}
+
+// createKeyTestStructs: test cases
+var createKeyTSs = []createKeyTS{
+	{"{\"Name\": \"ci\", \"Roles\": [\"buyer\"]}", http.StatusCreated},
+	{"{\"Name\": \"  \", \"Roles\": [\"buyer\"]}", http.StatusBadRequest},
+	{"{\"Name\": \"ci\"}", http.StatusBadRequest},
+	{"{\"Name\": \"ci\", \"Roles\": [\"buyer\", \"owner\"]}", http.StatusBadRequest},
+	{"{\"Name\": \"" + strings.Repeat("k", 65) + "\"}", http.StatusBadRequest},
+	{"{", http.StatusBadRequest},
+}
+
+// Test API keys can be created, listed and revoked, and only authenticate while they exist
+func TestAPIKeys(t *testing.T) {
+	e := getKeyEcho()
+
+	created := []APIKeyMsg{}
+	for _, tt := range createKeyTSs {
+		req := httptest.NewRequest(echo.POST, "/admin/api-keys", strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) (%v)\n", tt.body, tt.expected, rec.Code, rec.Body)
+		}
+		if rec.Code == http.StatusCreated {
+			msg := APIKeyMsg{}
+			json.Unmarshal(rec.Body.Bytes(), &msg)
+			created = append(created, msg)
+		}
+	}
+	if len(created) != 1 || created[0].Key == nil || created[0].APIKey == "" {
+		t.Fatalf("ERROR -- expected a created key but got (%v)\n", created)
+	}
+	key := *created[0].Key
+
+	// Listed without the key itself
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/admin/api-keys", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), key.ID) || strings.Contains(rec.Body.String(), created[0].APIKey) {
+		t.Errorf("ERROR -- expected (%v) listed but got (%v) (%v)\n", key.ID, rec.Code, rec.Body)
+	}
+	if k, ok := auth.Keys.Lookup(created[0].APIKey); !ok || k.ID != key.ID || len(k.Roles) != 1 || k.Roles[0] != "buyer" {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", key, k, ok)
+	}
+
+	// Revoked once
+	for _, expected := range []int{http.StatusOK, http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.DELETE, "/admin/api-keys/"+key.ID, nil))
+		if rec.Code != expected {
+			t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", expected, rec.Code, rec.Body)
+		}
+	}
+	if _, ok := auth.Keys.Lookup(created[0].APIKey); ok {
+		t.Errorf("ERROR -- expected the revoked key to be refused\n")
+	}
+}
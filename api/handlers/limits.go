@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/importer"
+	"example.com/produce_demo/problem"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Limits on what one request may ask of the server
+type Limits struct {
+	MaxBatchItems    int // Most Produce one POST /produce may add
+	MaxConcurrentOps int // Most store operations one request runs at the same time
+}
+
+// Limits applied - set from the configuration
+var limits = Limits{MaxBatchItems: 1000, MaxConcurrentOps: 8}
+
+// Set the limits on requests - a limit that is not positive is left as it was
+func SetLimits(l Limits) {
+	if l.MaxBatchItems > 0 {
+		limits.MaxBatchItems = l.MaxBatchItems
+	}
+	if l.MaxConcurrentOps > 0 {
+		limits.MaxConcurrentOps = l.MaxConcurrentOps
+	}
+}
+
+// Returned by a decoder when a streamed batch has more than MaxBatchItems lines
+var errBatchTooLarge = errors.New("batch too large")
+
+// Refuse request bodies larger than max bytes with a 413 problem - routes in larger, by path,
+// have their own limit instead
+// A body that claims to be smaller but is not fails when read past max - handlers report
+// that with bodyTooLarge
+func BodyLimit(max int64, larger map[string]int64) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			limit, ok := larger[c.Path()]
+			if !ok {
+				limit = max
+			}
+			if c.Request().ContentLength > limit {
+				return bodyTooLarge(c, limit) // Returns 413
+			}
+			c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, limit)
+			return next(c)
+		}
+	}
+}
+
+// Limit of the body that err came from reading past, if it did
+func overBodyLimit(err error) (int64, bool) {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return maxBytesError.Limit, true
+	}
+	return 0, false
+}
+
+// Respond to a body over limit bytes
+func bodyTooLarge(c echo.Context, limit int64) error {
+	logger.InfoContext(c.Request().Context(), "request body over the limit", "path", c.Path(), "limit", limit)
+	return problem.Write(c, http.StatusRequestEntityTooLarge, "Request body is over the limit of "+strconv.FormatInt(limit, 10)+" bytes") // Returns 413
+}
+
+// Respond to a batch with more than MaxBatchItems Produce
+func batchTooLarge(c echo.Context, detail string) error {
+	logger.InfoContext(c.Request().Context(), "batch over the limit", "path", c.Path(), "limit", limits.MaxBatchItems)
+	return problem.Write(c, http.StatusRequestEntityTooLarge, "Batch is over the limit of "+strconv.Itoa(limits.MaxBatchItems)+" items"+detail) // Returns 413
+}
+
+// Decoder that reads the whole batch before giving out its first Record, so a batch of more than
+// max Records, or one that cannot be read to the end, fails before any of it is added
+type limitedDecoder struct {
+	dec     importer.Decoder
+	max     int
+	records []importer.Record
+	err     error // Returned once the records are given out - io.EOF unless the batch failed
+	read    bool
+}
+
+func (d *limitedDecoder) Next() (importer.Record, error) {
+	if !d.read {
+		d.read = true
+		if d.err = d.readAll(); d.err != io.EOF {
+			d.records = nil
+		}
+	}
+	if len(d.records) == 0 {
+		return importer.Record{}, d.err
+	}
+	rec := d.records[0]
+	d.records = d.records[1:]
+	return rec, nil
+}
+
+// Read every Record of the batch - errBatchTooLarge once there are more than max
+func (d *limitedDecoder) readAll() error {
+	for {
+		rec, err := d.dec.Next()
+		if err != nil {
+			return err
+		}
+		if len(d.records) == d.max {
+			return errBatchTooLarge
+		}
+		d.records = append(d.records, rec)
+	}
+}
+
+// Run op on every item of produceList with at most MaxConcurrentOps running at once
+// Returns the error of each item in order
+func forEachLimited(produceList []common.Produce, op func(common.Produce) error) []error {
+	errs := make([]error, len(produceList))
+	workers := min(limits.MaxConcurrentOps, len(produceList))
+	next := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = op(produceList[i])
+			}
+		}()
+	}
+	for i := range produceList {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+	"example.com/produce_demo/importer"
+	"example.com/produce_demo/problem"
+
+	"github.com/labstack/echo/v4"
+)
+
+// limitTestStruct
+type limitTS struct {
+	method        string
+	target        string
+	contentType   string
+	body          string
+	contentLength bool // Send the Content-Length - otherwise the body is only found too large when read
+	expected      int
+	detail        string // Expected in the problem's detail
+}
+
+// limitTestStructs: bodies over 128 bytes and batches over 2 items are refused
+var limitTSs = []limitTS{
+	{echo.POST, "/produce", echo.MIMEApplicationJSON, "[" + strings.Repeat(" ", 200) + "]", true, http.StatusRequestEntityTooLarge, "128 bytes"},
+	{echo.POST, "/produce", echo.MIMEApplicationJSON, "[" + strings.Repeat(" ", 200) + "]", false, http.StatusRequestEntityTooLarge, "128 bytes"},
+	{echo.POST, "/produce", "application/x-ndjson", strings.Repeat("\n", 200), false, http.StatusRequestEntityTooLarge, "128 bytes"},
+	{echo.PUT, "/produce/LMTS-1111-2222-3333", echo.MIMEApplicationJSON, "{" + strings.Repeat(" ", 200) + "}", false, http.StatusRequestEntityTooLarge, "128 bytes"},
+	{echo.POST, "/produce", echo.MIMEApplicationJSON, "[{},{},{}]", true, http.StatusRequestEntityTooLarge, "limit of 2 items"},
+	{echo.POST, "/produce", "text/csv", "LMTS-1111-2222-3333,Kale,1.99\nLMTS-1111-2222-4444,Leek,.99\nLMTS-1111-2222-5555,Corn,.5\n", true,
+		http.StatusRequestEntityTooLarge, "limit of 2 items"},
+}
+
+// Test bodies and batches over the limits get 413 problems
+func TestLimits(t *testing.T) {
+	saved := limits
+	defer func() { limits = saved }()
+	SetLimits(Limits{MaxBatchItems: 2})
+
+	e := echo.New()
+	e.Use(BodyLimit(128, nil))
+	e.POST("/produce", AddProduce)
+	e.PUT("/produce/:ProduceCode", UpdateProduce)
+
+	for i, tt := range limitTSs {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, tt.contentType)
+		if !tt.contentLength {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		p := problem.Problem{}
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		if rec.Code != tt.expected || rec.Header().Get(echo.HeaderContentType) != problem.MIMEApplicationProblemJSON || !strings.Contains(p.Detail, tt.detail) {
+			t.Errorf("ERROR -- for #%d expected (%v) (%v) but got (%v) (%v)\n", i, tt.expected, tt.detail, rec.Code, rec.Body)
+		}
+	}
+
+	// Nothing of a streamed batch over the limit was added
+	for _, produceCode := range []string{"LMTS-1111-2222-3333", "LMTS-1111-2222-4444", "LMTS-1111-2222-5555"} {
+		if _, err := db.Default.Get(context.Background(), produceCode); !errors.Is(err, db.ErrNotFound) {
+			t.Errorf("ERROR -- expected (%v) not added but got (%v)\n", produceCode, err)
+		}
+	}
+
+	// Nor of one that could not be read to the end
+	req := httptest.NewRequest(echo.POST, "/produce", strings.NewReader("LMTS-1111-2222-3333,Kale,1.99\n"+strings.Repeat(" ", 200)))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if _, err := db.Default.Get(context.Background(), "LMTS-1111-2222-3333"); rec.Code != http.StatusRequestEntityTooLarge || !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("ERROR -- expected (%v) and nothing added but got (%v) (%v)\n", http.StatusRequestEntityTooLarge, rec.Code, err)
+	}
+}
+
+// Test uploads to /imports have their own limit, however they are sent
+func TestImportLimit(t *testing.T) {
+	e := echo.New()
+	e.Use(BodyLimit(16, map[string]int64{"/imports": 256}))
+	e.POST("/imports", SubmitImport)
+
+	csv := "Produce Code,Name,Unit Price\n" + strings.Repeat("LMTS-1111-2222-3333,Lettuce,1.00\n", 10)
+	form := &bytes.Buffer{}
+	w := multipart.NewWriter(form)
+	part, _ := w.CreateFormFile("file", "price_list.csv")
+	part.Write([]byte(csv))
+	w.Close()
+
+	for i, tt := range []struct {
+		body          string
+		contentType   string
+		contentLength bool
+	}{
+		{csv, importer.MIMECSV, true},
+		{csv, importer.MIMECSV, false},
+		{form.String(), w.FormDataContentType(), false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/imports", strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, tt.contentType)
+		if !tt.contentLength {
+			req.ContentLength = -1
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "limit of 256 bytes") {
+			t.Errorf("ERROR -- for #%d expected (%v) but got (%v) (%v)\n", i, http.StatusRequestEntityTooLarge, rec.Code, rec.Body)
+		}
+	}
+
+	// Within the import limit, though over the body limit
+	req := httptest.NewRequest(http.MethodPost, "/imports", strings.NewReader("Produce Code,Name,Unit Price\n"))
+	req.Header.Set(echo.HeaderContentType, importer.MIMECSV)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", http.StatusAccepted, rec.Code, rec.Body)
+	}
+}
+
+// Test store operations run no more than MaxConcurrentOps at once, reporting each error in order
+func TestForEachLimited(t *testing.T) {
+	saved := limits
+	defer func() { limits = saved }()
+	SetLimits(Limits{MaxConcurrentOps: 3})
+
+	produceList := make([]common.Produce, 20)
+	for i := range produceList {
+		produceList[i].Name = strings.Repeat("A", i)
+	}
+	var running, most atomic.Int32
+	errs := forEachLimited(produceList, func(p common.Produce) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for m := most.Load(); n > m && !most.CompareAndSwap(m, n); m = most.Load() {
+		}
+		time.Sleep(time.Millisecond)
+		if len(p.Name)%2 == 1 {
+			return errors.New(p.Name)
+		}
+		return nil
+	})
+
+	if most.Load() > 3 {
+		t.Errorf("ERROR -- expected at most (3) at once but got (%v)\n", most.Load())
+	}
+	for i, err := range errs {
+		if (i%2 == 1) != (err != nil) || (err != nil && err.Error() != produceList[i].Name) {
+			t.Errorf("ERROR -- for #%d expected the error of its item but got (%v)\n", i, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"example.com/produce_demo/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+var logger = logging.For("handlers")
+
+// LogLevelsMsg return structure - used by FetchLogLevels and UpdateLogLevel
+type LogLevelsMsg struct {
+	Err      string            `json:"Error,omitempty"`
+	Level    string            `json:"Level,omitempty"`    // Level of packages without their own
+	Packages map[string]string `json:"Packages,omitempty"` // Packages with their own level
+}
+
+// LogLevelRequest body structure - used by UpdateLogLevel
+type LogLevelRequest struct {
+	Package string `json:"Package"` // Empty to set the default level
+	Level   string `json:"Level"`   // Empty to return the package to the default level
+}
+
+// Fetch the log levels
+func FetchLogLevels(c echo.Context) error {
+	return c.JSON(http.StatusOK, currentLogLevels()) // Returns 200
+}
+
+// Change the default log level or the level of one package
+func UpdateLogLevel(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	var request LogLevelRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, LogLevelsMsg{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	request.Package = strings.TrimSpace(request.Package)
+
+	if request.Level == "" {
+		if request.Package == "" {
+			return c.JSON(http.StatusBadRequest, LogLevelsMsg{Err: "Level is required for the default level"}) // Returns 400
+		}
+		logging.ResetLevel(request.Package)
+	} else {
+		level, err := logging.ParseLevel(request.Level)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, LogLevelsMsg{Err: "Bad Level"}) // Returns 400
+		}
+		logging.SetLevel(request.Package, level)
+	}
+	logger.InfoContext(c.Request().Context(), "UpdateLogLevel - changed", "pkg", request.Package, "level", request.Level)
+
+	// Final Return
+	return c.JSON(http.StatusOK, currentLogLevels()) // Returns 200
+}
+
+func currentLogLevels() LogLevelsMsg {
+	level, packageLevels := logging.Levels()
+	msg := LogLevelsMsg{Level: strings.ToLower(level.String()), Packages: map[string]string{}}
+	for pkg, l := range packageLevels {
+		msg.Packages[pkg] = strings.ToLower(l.String())
+	}
+	return msg
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getLogEcho() *echo.Echo {
+	e := echo.New()
+
+	e.GET("/admin/log/levels", FetchLogLevels)
+	e.PUT("/admin/log/levels", UpdateLogLevel)
+
+	return e
+}
+
+// logLevelTestStruct
+type logLevelTS struct {
+	body         string
+	expected     int
+	expectedBody string
+}
+
+// logLevelTestStructs: test cases - each applied after the one before
+var logLevelTSs = []logLevelTS{
+	{"{\"Package\": \"db\", \"Level\": \"debug\"}", http.StatusOK, "{\"Level\":\"info\",\"Packages\":{\"db\":\"debug\"}}\n"},
+	{"{\"Level\": \"WARN\"}", http.StatusOK, "{\"Level\":\"warn\",\"Packages\":{\"db\":\"debug\"}}\n"},
+	{"{\"Package\": \"db\"}", http.StatusOK, "{\"Level\":\"warn\"}\n"},
+	{"{\"Level\": \"loud\"}", http.StatusBadRequest, "{\"Error\":\"Bad Level\"}\n"},
+	{"{}", http.StatusBadRequest, "{\"Error\":\"Level is required for the default level\"}\n"},
+	{"{", http.StatusBadRequest, "{\"Error\":\"Failed to unmarshal request body\"}\n"},
+}
+
+// Test the log levels can be changed at runtime
+func TestUpdateLogLevel(t *testing.T) {
+	e := getLogEcho()
+	level, packageLevels := logging.Levels()
+	defer func() {
+		logging.SetLevel("", level)
+		logging.ResetLevel("db")
+		for pkg, l := range packageLevels {
+			logging.SetLevel(pkg, l)
+		}
+	}()
+	logging.SetLevel("", slog.LevelInfo)
+
+	for _, tt := range logLevelTSs {
+		req := httptest.NewRequest(echo.PUT, "/admin/log/levels", strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code || tt.expectedBody != rec.Body.String() {
+			t.Errorf("ERROR -- for (%v) expected (%v) (%v) but got (%v) (%v)\n", tt.body, tt.expected, tt.expectedBody, rec.Code, rec.Body)
+		}
+	}
+
+	// The change is applied
+	if logging.Level("importer") != slog.LevelWarn {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", slog.LevelWarn, logging.Level("importer"))
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/admin/log/levels", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "{\"Level\":\"warn\"}\n" {
+		t.Errorf("ERROR -- unexpected levels (%v) (%v)\n", rec.Code, rec.Body)
+	}
+}
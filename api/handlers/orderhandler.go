@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Longest receipt note, lot number and origin accepted
+const (
+	maxNoteLength      = 256
+	maxLotNumberLength = 64
+	maxOriginLength    = 64
+)
+
+// OrderMsg return structure - used by the purchase order handlers
+type OrderMsg struct {
+	Err    string             `json:"Error,omitempty"`
+	Order  *db.PurchaseOrder  `json:"Order,omitempty"`
+	Orders []db.PurchaseOrder `json:"Orders,omitempty"`
+}
+
+// OrderLineRequest is a line of an OrderRequest
+type OrderLineRequest struct {
+	ProduceCode string `json:"Produce Code"`
+	Quantity    int    `json:"Quantity"`
+	Cost        string `json:"Cost"` // Left out for the supplier's cost, if it sells the Produce
+}
+
+// OrderRequest body structure - used by CreateOrder and UpdateOrder
+type OrderRequest struct {
+	Supplier string             `json:"Supplier"`
+	Lines    []OrderLineRequest `json:"Lines"`
+}
+
+// ReceiveRequest body structure - used by ReceiveOrder
+type ReceiveRequest struct {
+	Lines []db.ReceiptLine `json:"Lines"`
+	Note  string           `json:"Note"`
+	Close bool             `json:"Close"` // Set to receive no more, recording any shortfall as a discrepancy
+}
+
+// Read and check an OrderRequest against the supplier and the request's catalog
+// Returns the lines to order, or the status and error to send if it is bad
+func readOrderRequest(c echo.Context) (string, []db.OrderLine, int, string) {
+	defer c.Request().Body.Close()
+
+	var request OrderRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return "", nil, http.StatusBadRequest, "Failed to unmarshal request body"
+	}
+	if _, err := db.Suppliers.Get(request.Supplier); err != nil {
+		return "", nil, http.StatusBadRequest, "Supplier " + request.Supplier + " not found"
+	}
+	if len(request.Lines) == 0 {
+		return "", nil, http.StatusBadRequest, "Lines are required"
+	}
+	if len(request.Lines) > limits.MaxBatchItems {
+		return "", nil, http.StatusRequestEntityTooLarge, ""
+	}
+
+	lines := make([]db.OrderLine, 0, len(request.Lines))
+	seen := map[string]bool{}
+	for _, line := range request.Lines {
+		produceCode := strings.ToUpper(line.ProduceCode)
+		if !common.ValidateProduceCode(produceCode) {
+			return "", nil, http.StatusBadRequest, "Detected error for Produce Code (" + line.ProduceCode + ")"
+		}
+		if seen[produceCode] {
+			return "", nil, http.StatusBadRequest, "Produce Code " + produceCode + " is on more than one line"
+		}
+		seen[produceCode] = true
+		if line.Quantity <= 0 {
+			return "", nil, http.StatusBadRequest, "Quantity of " + produceCode + " must be positive"
+		}
+		if _, err := catalog(c).Get(c.Request().Context(), produceCode); errors.Is(err, db.ErrNotFound) {
+			return "", nil, http.StatusBadRequest, "Produce " + produceCode + " not found"
+		} else if err != nil {
+			return "", nil, http.StatusServiceUnavailable, cancelled
+		}
+		cost := line.Cost
+		if cost == "" {
+			if item, err := db.Suppliers.Item(request.Supplier, produceCode); err == nil {
+				cost = item.Cost
+			}
+		} else if !common.ValidatePrice(cost) {
+			return "", nil, http.StatusBadRequest, "Detected error for Cost (" + cost + ")"
+		} else {
+			cost = common.FixPrice(cost)
+		}
+		lines = append(lines, db.OrderLine{ProduceCode: produceCode, Ordered: line.Quantity, Cost: cost})
+	}
+	return request.Supplier, lines, 0, ""
+}
+
+// Check and tidy a line of a ReceiveRequest - returns the error to send if it is bad
+func checkReceiptLine(line *db.ReceiptLine) string {
+	if line.Quantity <= 0 {
+		return "Quantity of " + line.ProduceCode + " must be positive"
+	}
+	line.LotNumber = strings.TrimSpace(line.LotNumber)
+	if utf8.RuneCountInString(line.LotNumber) > maxLotNumberLength {
+		return "Lot Number may be up to " + strconv.Itoa(maxLotNumberLength) + " characters"
+	}
+	line.Origin = strings.TrimSpace(line.Origin)
+	if utf8.RuneCountInString(line.Origin) > maxOriginLength {
+		return "Origin may be up to " + strconv.Itoa(maxOriginLength) + " characters"
+	}
+	for _, date := range [][2]string{{"Harvested", line.Harvested}, {"Best Before", line.BestBefore}} {
+		if _, err := time.Parse(db.DateLayout, date[1]); date[1] != "" && err != nil {
+			return date[0] + " must be a date as YYYY-MM-DD"
+		}
+	}
+	if line.Harvested != "" && line.BestBefore != "" && line.BestBefore < line.Harvested {
+		return "Best Before must not be before Harvested"
+	}
+	return ""
+}
+
+// Respond to a bad OrderRequest
+func badOrderRequest(c echo.Context, status int, msg string) error {
+	if status == http.StatusRequestEntityTooLarge {
+		return batchTooLarge(c, "") // Returns 413
+	}
+	return c.JSON(status, OrderMsg{Err: msg}) // Returns 400 or 503
+}
+
+// Respond to a purchase order operation that failed
+func orderFailed(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, db.ErrOrderNotFound):
+		return c.JSON(http.StatusNotFound, OrderMsg{Err: "Purchase order not found"}) // Returns 404
+	case errors.Is(err, db.ErrOrderStatus):
+		order, _ := catalog(c).Inventory().Order(c.Param("OrderID"))
+		return c.JSON(http.StatusConflict, OrderMsg{Err: "Purchase order is " + order.Status}) // Returns 409
+	case errors.Is(err, db.ErrSupplierNotFound):
+		return c.JSON(http.StatusBadRequest, OrderMsg{Err: "Supplier not found"}) // Returns 400
+	case errors.Is(err, db.ErrNotOrdered):
+		return c.JSON(http.StatusBadRequest, OrderMsg{Err: "Produce is not on the purchase order"}) // Returns 400
+	case errors.Is(err, db.ErrLotConflict):
+		return c.JSON(http.StatusConflict, OrderMsg{Err: "Lot was received before with other dates or origin"}) // Returns 409
+	}
+	logger.ErrorContext(c.Request().Context(), "purchase order operation failed", "path", c.Path(), "error", err)
+	return c.JSON(http.StatusInternalServerError, OrderMsg{Err: "Failed to save the purchase order"}) // Returns 500
+}
+
+// Fetch the purchase orders, sorted by ID - ?status= only fetches orders with that status
+func FetchOrders(c echo.Context) error {
+	status := c.QueryParam("status")
+	switch status {
+	case "", db.OrderDraft, db.OrderSubmitted, db.OrderPartiallyReceived, db.OrderReceived, db.OrderCancelled:
+	default:
+		return c.JSON(http.StatusBadRequest, OrderMsg{Err: "Bad Status"}) // Returns 400
+	}
+	orders := catalog(c).Inventory().Orders(status)
+	if len(orders) == 0 {
+		return c.JSON(http.StatusNoContent, OrderMsg{Err: "No purchase orders found"}) // Returns 204
+	}
+	return c.JSON(http.StatusOK, OrderMsg{Orders: orders}) // Returns 200
+}
+
+// Fetch a purchase order with its receipts and discrepancies
+func FetchOrder(c echo.Context) error {
+	order, err := catalog(c).Inventory().Order(c.Param("OrderID"))
+	if err != nil {
+		return orderFailed(c, err)
+	}
+	return c.JSON(http.StatusOK, OrderMsg{Order: &order}) // Returns 200
+}
+
+// Create a draft purchase order from a supplier for Produce in the catalog
+func CreateOrder(c echo.Context) error {
+	supplier, lines, status, msg := readOrderRequest(c)
+	if status != 0 {
+		return badOrderRequest(c, status, msg) // Returns 400, 413 or 503
+	}
+
+	order, err := catalog(c).Inventory().CreateOrder(supplier, lines)
+	if err != nil {
+		return orderFailed(c, err)
+	}
+	logger.InfoContext(c.Request().Context(), "CreateOrder - created", "order", order.ID, "supplier", supplier, "lines", len(lines))
+
+	// Final Return
+	c.Response().Header().Set(echo.HeaderLocation, strings.TrimSuffix(c.Request().URL.Path, "/")+"/"+order.ID)
+	return c.JSON(http.StatusCreated, OrderMsg{Order: &order}) // Returns 201
+}
+
+// Replace the supplier and lines of a draft purchase order
+func UpdateOrder(c echo.Context) error {
+	supplier, lines, status, msg := readOrderRequest(c)
+	if status != 0 {
+		return badOrderRequest(c, status, msg) // Returns 400, 413 or 503
+	}
+
+	order, err := catalog(c).Inventory().UpdateOrder(c.Param("OrderID"), supplier, lines)
+	if err != nil {
+		return orderFailed(c, err)
+	}
+	logger.InfoContext(c.Request().Context(), "UpdateOrder - updated", "order", order.ID, "supplier", supplier, "lines", len(lines))
+	return c.JSON(http.StatusOK, OrderMsg{Order: &order}) // Returns 200
+}
+
+// Submit a draft purchase order to its supplier
+func SubmitOrder(c echo.Context) error {
+	order, err := catalog(c).Inventory().SubmitOrder(c.Param("OrderID"))
+	if err != nil {
+		return orderFailed(c, err)
+	}
+	logger.InfoContext(c.Request().Context(), "SubmitOrder - submitted", "order", order.ID)
+	return c.JSON(http.StatusOK, OrderMsg{Order: &order}) // Returns 200
+}
+
+// Cancel a purchase order nothing has been received against
+func CancelOrder(c echo.Context) error {
+	order, err := catalog(c).Inventory().CancelOrder(c.Param("OrderID"))
+	if err != nil {
+		return orderFailed(c, err)
+	}
+	logger.InfoContext(c.Request().Context(), "CancelOrder - cancelled", "order", order.ID)
+	return c.JSON(http.StatusOK, OrderMsg{Order: &order}) // Returns 200
+}
+
+// Receive a delivery against a submitted purchase order, adding it to the stock on hand
+func ReceiveOrder(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	var request ReceiveRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, OrderMsg{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	if len(request.Lines) == 0 && !request.Close {
+		return c.JSON(http.StatusBadRequest, OrderMsg{Err: "Lines are required unless closing"}) // Returns 400
+	}
+	if len(request.Lines) > limits.MaxBatchItems {
+		return batchTooLarge(c, "") // Returns 413
+	}
+	for i, line := range request.Lines {
+		if msg := checkReceiptLine(&request.Lines[i]); msg != "" {
+			logger.InfoContext(c.Request().Context(), "ReceiveOrder - bad line", "produce_code", line.ProduceCode, "error", msg)
+			return c.JSON(http.StatusBadRequest, OrderMsg{Err: msg}) // Returns 400
+		}
+	}
+	request.Note = strings.TrimSpace(request.Note)
+	if utf8.RuneCountInString(request.Note) > maxNoteLength {
+		return c.JSON(http.StatusBadRequest, OrderMsg{Err: "Note may be up to " + strconv.Itoa(maxNoteLength) + " characters"}) // Returns 400
+	}
+
+	order, err := catalog(c).Inventory().ReceiveOrder(c.Param("OrderID"), request.Lines, request.Note, request.Close)
+	if err != nil {
+		return orderFailed(c, err)
+	}
+	logger.InfoContext(c.Request().Context(), "ReceiveOrder - received", "order", order.ID, "status", order.Status, "lines", len(request.Lines), "discrepancies", len(order.Discrepancies))
+	return c.JSON(http.StatusOK, OrderMsg{Order: &order}) // Returns 200
+}
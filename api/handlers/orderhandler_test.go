@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getOrderEcho(store *db.Store) *echo.Echo {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(catalogKey, store)
+			return next(c)
+		}
+	})
+
+	e.GET("/purchase-orders", FetchOrders)
+	e.GET("/purchase-orders/:OrderID", FetchOrder)
+	e.POST("/purchase-orders", CreateOrder)
+	e.PUT("/purchase-orders/:OrderID", UpdateOrder)
+	e.POST("/purchase-orders/:OrderID/submit", SubmitOrder)
+	e.POST("/purchase-orders/:OrderID/cancel", CancelOrder)
+	e.POST("/purchase-orders/:OrderID/receive", ReceiveOrder)
+	e.GET("/inventory", FetchInventory)
+	e.GET("/inventory/movements", FetchMovements)
+
+	return e
+}
+
+// orderTestStruct
+type orderTS struct {
+	method   string
+	target   string
+	body     string
+	expected int
+}
+
+// orderTestStructs: test cases, run in order
+var orderTSs = []orderTS{
+	{echo.GET, "/purchase-orders", "", http.StatusNoContent},
+	{echo.GET, "/inventory", "", http.StatusNoContent},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 10}]}", http.StatusCreated},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"hill\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 10}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": []}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"NONE-1111-2222-3333\", \"Quantity\": 1}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C\", \"Quantity\": 1}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 0}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 1}, {\"Produce Code\": \"tq4c-vv6t-75zx-1rmr\", \"Quantity\": 1}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 1, \"Cost\": \"one\"}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders", "{", http.StatusBadRequest},
+	{echo.PUT, "/purchase-orders/PO-000001", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 12}, {\"Produce Code\": \"E5T6-9UI3-TH15-QR88\", \"Quantity\": 4, \"Cost\": \"$.9\"}]}", http.StatusOK},
+	{echo.PUT, "/purchase-orders/PO-000009", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 12}]}", http.StatusNotFound},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 1}]}", http.StatusConflict},
+	{echo.POST, "/purchase-orders/PO-000001/submit", "", http.StatusOK},
+	{echo.POST, "/purchase-orders/PO-000001/submit", "", http.StatusConflict},
+	{echo.PUT, "/purchase-orders/PO-000001", "{\"Supplier\": \"orchard\", \"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 1}]}", http.StatusConflict},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"YRT6-72AS-K736-L4AR\", \"Quantity\": 1}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": -1}]}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": []}", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 8, \"Lot Number\": \"L-1\", \"Origin\": \"Yakima\"}], \"Note\": \"first truck\"}", http.StatusOK},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"TQ4C-VV6T-75ZX-1RMR\", \"Quantity\": 1, \"Lot Number\": \"L-1\", \"Origin\": \"Wenatchee\"}]}", http.StatusConflict},
+	{echo.GET, "/purchase-orders?status=partially%20received", "", http.StatusOK},
+	{echo.GET, "/purchase-orders?status=lost", "", http.StatusBadRequest},
+	{echo.POST, "/purchase-orders/PO-000001/cancel", "", http.StatusConflict},
+	{echo.POST, "/purchase-orders/PO-000001/receive", "{\"Lines\": [{\"Produce Code\": \"E5T6-9UI3-TH15-QR88\", \"Quantity\": 4}], \"Close\": true}", http.StatusOK},
+	{echo.GET, "/purchase-orders/PO-000001", "", http.StatusOK},
+	{echo.GET, "/purchase-orders/PO-000009", "", http.StatusNotFound},
+	{echo.GET, "/inventory", "", http.StatusOK},
+	{echo.GET, "/inventory/movements?produce_code=TQ4C", "", http.StatusBadRequest},
+}
+
+// Test purchase orders are created, submitted and received into stock with their discrepancies
+func TestPurchaseOrders(t *testing.T) {
+	store := db.New([]common.Produce{
+		{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+		{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
+	})
+	db.Suppliers.Create(db.Supplier{ID: "orchard", Name: "Orchard Farms"})
+	db.Suppliers.SetItem(db.SupplierItem{Supplier: "orchard", ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Cost: "1.25"})
+	defer db.Suppliers.Delete("orchard")
+	e := getOrderEcho(store)
+
+	for _, tt := range orderTSs {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v %v %v) expected (%v) but got (%v) (%v)\n", tt.method, tt.target, tt.body, tt.expected, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/purchase-orders/PO-000001", nil))
+	msg := OrderMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if msg.Order == nil || msg.Order.Status != db.OrderReceived || msg.Order.Lines[0].Cost != "1.25" || msg.Order.Lines[1].Cost != "0.90" ||
+		len(msg.Order.Discrepancies) != 1 || msg.Order.Discrepancies[0].Difference != -4 {
+		t.Errorf("ERROR -- expected PO-000001 received 4 short but got (%v)\n", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/inventory/movements?produce_code=tq4c-vv6t-75zx-1rmr", nil))
+	inventory := InventoryMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &inventory)
+	if inventory.Movements == nil || len(*inventory.Movements) != 1 || (*inventory.Movements)[0].Quantity != 8 {
+		t.Errorf("ERROR -- expected a receipt of 8 but got (%v)\n", rec.Body)
+	}
+	if onHand := store.Inventory().OnHand("E5T6-9UI3-TH15-QR88"); onHand != 4 {
+		t.Errorf("ERROR -- expected (%v) on hand but got (%v)\n", 4, onHand)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"example.com/produce_demo/common"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Largest page accepted by ?limit=
+const maxPageSize = 1000
+
+// Read the paging parameters:
+//
+//	?limit= - the most Produce to return (0 when not paging)
+//	?after= - only return Produce with a Produce Code after this one
+func pageParams(c echo.Context) (int, string, bool) {
+	limit := 0
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return 0, "", false
+		}
+	}
+	return limit, strings.ToUpper(c.QueryParam("after")), true
+}
+
+// Sort produceList by Produce Code and cut out the requested page
+// If more Produce follow the page, a Link header to the next page is set
+func paginate(c echo.Context, produceList []common.Produce, limit int, after string) []common.Produce {
+	sort.Slice(produceList, func(i, j int) bool {
+		return strings.ToUpper(produceList[i].ProduceCode) < strings.ToUpper(produceList[j].ProduceCode)
+	})
+
+	start := sort.Search(len(produceList), func(i int) bool {
+		return strings.ToUpper(produceList[i].ProduceCode) > after
+	})
+	produceList = produceList[start:]
+	if limit == 0 || len(produceList) <= limit {
+		return produceList
+	}
+
+	produceList = produceList[:limit]
+	query := c.Request().URL.Query()
+	query.Set("limit", strconv.Itoa(limit))
+	query.Set("after", strings.ToUpper(produceList[limit-1].ProduceCode))
+	next := url.URL{Path: c.Request().URL.Path, RawQuery: query.Encode()}
+	c.Response().Header().Set("Link", "<"+next.String()+">; rel=\"next\"")
+	return produceList
+}
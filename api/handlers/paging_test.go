@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// pagingTestStruct
+type pgTS struct {
+	url          string // Request URL
+	expected     int    // Expected status
+	expectedBody string // Expected body
+	expectedLink string // Expected Link header
+}
+
+// pagingTestStructs: test cases
+var pgTSs = []pgTS{
+	{"/produce?limit=2", http.StatusOK,
+		"{\"Produce\":[{\"Produce Code\":\"A12T-4GH7-QPL9-3N4M\",\"Name\":\"Lettuce\",\"Unit Price\":\"3.46\"},{\"Produce Code\":\"E5T6-9UI3-TH15-QR88\",\"Name\":\"Peach\",\"Unit Price\":\"2.99\"}]}\n",
+		"</produce?after=E5T6-9UI3-TH15-QR88&limit=2>; rel=\"next\""},
+	{"/produce?limit=2&after=e5t6-9ui3-th15-qr88", http.StatusOK,
+		"{\"Produce\":[{\"Produce Code\":\"TQ4C-VV6T-75ZX-1RMR\",\"Name\":\"Gala Apple\",\"Unit Price\":\"3.59\"},{\"Produce Code\":\"YRT6-72AS-K736-L4AR\",\"Name\":\"Green Pepper\",\"Unit Price\":\"0.79\"}]}\n",
+		""},
+	{"/produce?limit=3&format=csv", http.StatusOK,
+		"Produce Code,Name,Unit Price,Category\nA12T-4GH7-QPL9-3N4M,Lettuce,3.46,\nE5T6-9UI3-TH15-QR88,Peach,2.99,\nTQ4C-VV6T-75ZX-1RMR,Gala Apple,3.59,\n",
+		"</produce?after=TQ4C-VV6T-75ZX-1RMR&format=csv&limit=3>; rel=\"next\""},
+	{"/produce?after=TQ4C-VV6T-75ZX-1RMR&format=csv", http.StatusOK,
+		"Produce Code,Name,Unit Price,Category\nYRT6-72AS-K736-L4AR,Green Pepper,0.79,\n", ""},
+	{"/produce?after=YRT6-72AS-K736-L4AR", http.StatusNoContent, "", ""},
+	{"/produce?limit=0", http.StatusBadRequest, "{\"Error\":\"Bad limit\"}\n", ""},
+	{"/produce?limit=1001", http.StatusBadRequest, "{\"Error\":\"Bad limit\"}\n", ""},
+	{"/produce?limit=two", http.StatusBadRequest, "{\"Error\":\"Bad limit\"}\n", ""},
+}
+
+// Test paging on FetchProduce
+func TestFetchProducePaging(t *testing.T) {
+	e := getEcho()
+	for _, tt := range pgTSs {
+		req := httptest.NewRequest(echo.GET, tt.url, nil)
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) body is (%v) \n", tt.url, tt.expected, rec.Code, rec.Body)
+		}
+		if tt.expectedBody != "" && tt.expectedBody != rec.Body.String() {
+			t.Errorf("ERROR -- for (%v) expected body (%q) but got (%q) \n", tt.url, tt.expectedBody, rec.Body.String())
+		}
+		if link := rec.Header().Get("Link"); tt.expectedLink != link {
+			t.Errorf("ERROR -- for (%v) expected Link (%v) but got (%v) \n", tt.url, tt.expectedLink, link)
+		}
+	}
+}
@@ -1,54 +1,87 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
-	"log"
+	"encoding/xml"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
+	"strings"
 
 	"example.com/produce_demo/common"
 	"example.com/produce_demo/db"
+	"example.com/produce_demo/importer"
+	"example.com/produce_demo/logging"
+	"example.com/produce_demo/metrics"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // FetchMsg return structure - used by FetchProduce and FetchProduceByProduceCode
 type FetchMsg struct {
-	Err     string            `json:"Error,omitempty"`
-	Produce *[]common.Produce `json:"Produce,omitempty"`
+	XMLName xml.Name          `json:"-" yaml:"-" xml:"ProduceList"`
+	Err     string            `json:"Error,omitempty" yaml:"Error,omitempty" xml:"Error,omitempty"`
+	Produce *[]common.Produce `json:"Produce,omitempty" yaml:"Produce,omitempty" xml:"Produce,omitempty"`
 }
 
 // Fetch all Produce concurrently
+// Produce is sorted by Produce Code and may be paged with ?limit= and ?after=
+// ?category= only fetches Produce in the category or a category under it
 func FetchProduce(c echo.Context) error {
 
+	// Determine the response format
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return unsupportedFormat(c) // Returns 406
+	}
+
+	// Get and Validate paging
+	limit, after, ok := pageParams(c)
+	if !ok {
+		logger.InfoContext(c.Request().Context(), "FetchProduce - bad limit", "limit", c.QueryParam("limit"))
+		return c.JSON(http.StatusBadRequest, FetchMsg{Err: "Bad limit"}) // Returns 400
+	}
+
+	// Get and Validate the category
+	var categories map[string]bool
+	if category := c.QueryParam("category"); category != "" {
+		var err error
+		if categories, err = db.Categories.Descendants(category); err != nil {
+			logger.InfoContext(c.Request().Context(), "FetchProduce - unknown category", "category", category)
+			return c.JSON(http.StatusBadRequest, FetchMsg{Err: "Bad Category"}) // Returns 400
+		}
+	}
+
 	// Fetch rows
-	outputChannel := make(chan common.Result, 1)
-	go db.Fetch(outputChannel)
-
-	// Process Results
-	errorString := ""
-	produceList := []common.Produce{}
-	for p := range outputChannel {
-		if p.Count != 1 || p.Err != "" {
-			errorString = errorString + p.Err
-		} else {
-			produceList = append(produceList, p.Prod)
+	produceList, err := catalog(c).List(c.Request().Context())
+	if err != nil {
+		return storeFailed(c, FetchMsg{Err: cancelled}, err) // Returns 503
+	}
+	if categories != nil {
+		inCategory := produceList[:0]
+		for _, p := range produceList {
+			if categories[p.Category] {
+				inCategory = append(inCategory, p)
+			}
 		}
+		produceList = inCategory
 	}
 
-	log.Printf("FetchProduce - produceList is (%v)\n", produceList)
+	produceList = paginate(c, produceList, limit, after)
+
+	logger.DebugContext(c.Request().Context(), "FetchProduce - fetched", "count", len(produceList))
 
 	// Handle No rows found
 	if len(produceList) == 0 {
 		return c.JSON(http.StatusNoContent, FetchMsg{Err: "No produce found"}) // Returns 204
 	}
-	// Handle Errors
-	if errorString != "" { // Unreachable code - fetch only sets errorString if no rows returned
-		return c.JSON(http.StatusInternalServerError, FetchMsg{Err: "Internal Error detected"}) // Returns 500
-	}
 
 	// Final Return
-	return c.JSON(http.StatusOK, FetchMsg{Produce: &produceList}) // Returns 200
+	return renderProduce(c, format, http.StatusOK, produceList) // Returns 200
 }
 
 // Fetch Produce by ProduceCode
@@ -57,41 +90,36 @@ func FetchProduceByProduceCode(c echo.Context) error {
 	// Get and Validate Param
 	produceCode := c.Param("ProduceCode")
 	if !common.ValidateProduceCode(produceCode) {
-		log.Printf("FetchProduceByProduceCode - failed with produceCode(%v)\n", produceCode)
+		logger.InfoContext(c.Request().Context(), "FetchProduceByProduceCode - bad produce code", "produceCode", produceCode)
 		return c.JSON(http.StatusBadRequest, FetchMsg{Err: "Bad Produce Code"}) // Returns 400
 	}
 
-	// Fetch Rows
-	outputChannel := make(chan common.Result, 1)
-	go db.FetchByProduceCode(produceCode, outputChannel)
-
-	// Process Results
-	errorString := ""
-	produceList := []common.Produce{}
-	for p := range outputChannel {
-		if p.Count != 1 || p.Err != "" {
-			errorString = errorString + p.Err
-		} else {
-			produceList = append(produceList, p.Prod)
-		}
+	// Determine the response format
+	format, ok := negotiateFormat(c)
+	if !ok {
+		return unsupportedFormat(c) // Returns 406
 	}
 
-	log.Printf("FetchProduceByProduceCode - produceList is (%v)\n", produceList)
+	// Fetch Row
+	produce, err := catalog(c).Get(c.Request().Context(), produceCode)
 
 	// Handle Errors
-	if len(produceList) == 0 {
+	if errors.Is(err, db.ErrNotFound) {
 		return c.JSON(http.StatusNoContent, FetchMsg{Err: "No produce found"}) // Returns 204
 	}
-	if errorString != "" { // Unreachable code - fetch only sets errorString if no rows returned
-		return c.JSON(http.StatusInternalServerError, FetchMsg{Err: "Internal Error detected"}) // Returns 500
+	if err != nil {
+		return storeFailed(c, FetchMsg{Err: cancelled}, err) // Returns 503
 	}
 
+	logger.DebugContext(c.Request().Context(), "FetchProduceByProduceCode - fetched", "produce", produce)
+
 	// Final Return
-	return c.JSON(http.StatusOK, FetchMsg{Produce: &produceList}) // Returns 200
+	return renderProduce(c, format, http.StatusOK, []common.Produce{produce}) // Returns 200
 }
 
 // Return Structures for addProduceCall - used for both success and failure conditions
 type ErrorProduce struct {
+	Line    int             `json:"Line,omitempty"` // Source line for streamed (CSV/NDJSON) adds
 	Produce *common.Produce `json:"Produce,omitempty"`
 	Errors  []string        `json:"Errors"`
 }
@@ -104,7 +132,10 @@ type ReturnAdd struct {
 // For a list of produce - run common.ValidateProduce on each:
 //   Valid produce is added to the validProduceList
 //   Invalid produce is added (along with error) to RejectedProduce
-func getValidProduceList(produceList []common.Produce) ([]common.Produce, []ErrorProduce) {
+func getValidProduceList(ctx context.Context, produceList []common.Produce) ([]common.Produce, []ErrorProduce) {
+	_, span := tracer.Start(ctx, "ValidateProduce", trace.WithAttributes(attribute.Int("produce.count", len(produceList))))
+	defer span.End()
+
 	rejectedProduce := []ErrorProduce{}
 	validProduceList := []common.Produce{}
 
@@ -117,6 +148,7 @@ func getValidProduceList(produceList []common.Produce) ([]common.Produce, []Erro
 			validProduceList = append(validProduceList, p)
 		}
 	}
+	span.SetAttributes(attribute.Int("produce.rejected", len(rejectedProduce)))
 	return validProduceList, rejectedProduce
 }
 
@@ -124,17 +156,27 @@ func getValidProduceList(produceList []common.Produce) ([]common.Produce, []Erro
 func AddProduce(c echo.Context) error {
 	defer c.Request().Body.Close()
 
+	// CSV and NDJSON bodies are streamed a line at a time
+	if dec := importer.NewDecoder(c.Request().Header.Get(echo.HeaderContentType), c.Request().Body); dec != nil {
+		return addProduceStream(c, &limitedDecoder{dec: dec, max: limits.MaxBatchItems})
+	}
+
 	var produceList []common.Produce // NOTE: Here we just need a variable to bind to
 
 	// Ready the body of the POST - fail if we can't read it
-	b, err := ioutil.ReadAll(c.Request().Body)
+	b, err := io.ReadAll(c.Request().Body)
+	if limit, ok := overBodyLimit(err); ok {
+		return bodyTooLarge(c, limit) // Returns 413
+	}
 	if err != nil {
-		log.Printf("AddProduce - Failed reading the request body for AddProduce: %s\n", err)
+		logger.ErrorContext(c.Request().Context(), "AddProduce - failed reading the request body", "error", err)
 		errProduce := ErrorProduce{Errors: []string{"Failed to read request body"}}
 		return c.JSON(http.StatusBadRequest, ReturnAdd{RejectedProduce: []ErrorProduce{errProduce}}) // Returns 400
 	}
 
-	log.Printf("AddProduce - Body is (%v)\n", string(b))
+	if logger.Enabled(c.Request().Context(), slog.LevelDebug) {
+		logger.DebugContext(c.Request().Context(), "AddProduce - request body", "body", logging.Body(b))
+	}
 
 	// Unmarshal the body into a productList
 	err = json.Unmarshal(b, &produceList)
@@ -145,34 +187,52 @@ func AddProduce(c echo.Context) error {
 		err = json.Unmarshal(b, &produce)
 		if err != nil {
 			// Okay, give up.
-			log.Printf("AddProduce - Failed unmarshalling in AddProduce: %s\n", err)
+			logger.InfoContext(c.Request().Context(), "AddProduce - failed unmarshalling the request body", "error", err)
+			metrics.RejectedItems.WithLabelValues(importer.ReasonParse).Inc()
 			errProduce := ErrorProduce{Errors: []string{"Failed to unmarshal request body"}}
 			return c.JSON(http.StatusBadRequest, ReturnAdd{RejectedProduce: []ErrorProduce{errProduce}}) // Returns 400
 		}
 		produceList = append(produceList, produce)
 	}
+	if len(produceList) > limits.MaxBatchItems {
+		return batchTooLarge(c, "") // Returns 413
+	}
 
 	// getValidProduce
-	validProduceList, rejectedProduceList := getValidProduceList(produceList)
+	validProduceList, rejectedProduceList := getValidProduceList(c.Request().Context(), produceList)
+	metrics.RejectedItems.WithLabelValues(importer.ReasonValidation).Add(float64(len(rejectedProduceList)))
 
-	// Attempt to add validProduce
+	// Attempt to add validProduce concurrently
 	addedProduceList := []common.Produce{}
 	if len(validProduceList) > 0 {
-		outputChannel := make(chan common.Result, 2)
-		for _, p := range validProduceList {
-			go db.Add(p, outputChannel)
-		}
+		ctx := c.Request().Context()
+		store := catalog(c)
+		addErrors := forEachLimited(validProduceList, func(p common.Produce) error {
+			_, err := store.Add(ctx, p)
+			return err
+		})
 
 		// Get the results
-		var r common.Result
-		for _, _ = range validProduceList {
-			r = <-outputChannel
-			if r.Err != "" {
-				rejectedProduceList = append(rejectedProduceList, ErrorProduce{Produce: &r.Prod, Errors: []string{r.Err}})
-			} else {
-				addedProduceList = append(addedProduceList, r.Prod)
+		for i, err := range addErrors {
+			switch {
+			case err == nil:
+				addedProduceList = append(addedProduceList, validProduceList[i])
+			case errors.Is(err, db.ErrExists):
+				metrics.RejectedItems.WithLabelValues(importer.ReasonExists).Inc()
+				errText := strings.ToUpper(validProduceList[i].ProduceCode) + " already exists"
+				rejectedProduceList = append(rejectedProduceList, ErrorProduce{Produce: &validProduceList[i], Errors: []string{errText}})
+			case errors.Is(err, db.ErrQuota):
+				metrics.RejectedItems.WithLabelValues(importer.ReasonQuota).Inc()
+				rejectedProduceList = append(rejectedProduceList, ErrorProduce{Produce: &validProduceList[i], Errors: []string{storeFull}})
+			case errors.Is(err, db.ErrCategoryNotFound): // Deleted since the Produce was validated
+				metrics.RejectedItems.WithLabelValues(importer.ReasonValidation).Inc()
+				errText := "Produce Category (" + validProduceList[i].Category + ") not found"
+				rejectedProduceList = append(rejectedProduceList, ErrorProduce{Produce: &validProduceList[i], Errors: []string{errText}})
+			default:
+				return storeFailed(c, ReturnAdd{Produce: addedProduceList, RejectedProduce: []ErrorProduce{{Errors: []string{cancelled}}}}, err) // Returns 503
 			}
 		}
+		auditAdded(c, addedProduceList)
 
 		// Handle Errors
 		if len(rejectedProduceList) != 0 {
@@ -193,6 +253,136 @@ func AddProduce(c echo.Context) error {
 	return c.JSON(http.StatusOK, ReturnAdd{Produce: addedProduceList}) // Returns 200
 }
 
+// Add Produce from a streamed (CSV/NDJSON) body
+// Each line is validated and added once the whole body is read - rejections carry the source line number
+func addProduceStream(c echo.Context, dec importer.Decoder) error {
+	addedProduceList := []common.Produce{}
+	rejectedProduceList := []ErrorProduce{}
+	attempted := false // Did any line reach db.Add
+
+	ctx, span := tracer.Start(c.Request().Context(), "importer.Import")
+	defer span.End()
+	err := importer.Import(ctx, catalog(c), dec, func(o importer.Outcome) {
+		if o.Reason == "" {
+			addedProduceList = append(addedProduceList, o.Produce)
+			attempted = true
+			return
+		}
+		errProduce := ErrorProduce{Line: o.Line, Errors: o.Errors}
+		if o.Reason != importer.ReasonParse {
+			errProduce.Produce = &o.Produce
+		}
+		if o.Reason == importer.ReasonExists || o.Reason == importer.ReasonQuota {
+			attempted = true
+		}
+		rejectedProduceList = append(rejectedProduceList, errProduce)
+	})
+	span.SetAttributes(attribute.Int("produce.added", len(addedProduceList)), attribute.Int("produce.rejected", len(rejectedProduceList)))
+	auditAdded(c, addedProduceList)
+	if errors.Is(err, errBatchTooLarge) {
+		return batchTooLarge(c, "") // Returns 413
+	}
+	if limit, ok := overBodyLimit(err); ok {
+		return bodyTooLarge(c, limit) // Returns 413
+	}
+	if err != nil {
+		span.RecordError(err)
+		logger.ErrorContext(c.Request().Context(), "AddProduce - failed reading the request body", "error", err)
+		rejectedProduceList = append(rejectedProduceList, ErrorProduce{Errors: []string{"Failed to read request body"}})
+	}
+
+	// Handle Errors
+	if len(rejectedProduceList) != 0 {
+		if attempted {
+			return c.JSON(http.StatusPartialContent, ReturnAdd{Produce: addedProduceList, RejectedProduce: rejectedProduceList}) //Returns 206
+		}
+		return c.JSON(http.StatusBadRequest, ReturnAdd{RejectedProduce: rejectedProduceList}) // Returns 400
+	}
+
+	// Final Return
+	return c.JSON(http.StatusOK, ReturnAdd{Produce: addedProduceList}) // Returns 200
+}
+
+// Log the Produce Codes added - the record carries the principal who added them
+func auditAdded(c echo.Context, addedProduceList []common.Produce) {
+	if len(addedProduceList) == 0 {
+		return
+	}
+	produceCodes := make([]string, len(addedProduceList))
+	for i, p := range addedProduceList {
+		produceCodes[i] = p.ProduceCode
+	}
+	logger.InfoContext(c.Request().Context(), "AddProduce - added", "count", len(produceCodes), "produceCodes", produceCodes)
+}
+
+// UpdateReturn structure - used by UpdateProduce
+type UpdateReturn struct {
+	Err     string          `json:"Error,omitempty"`
+	Errors  []string        `json:"Errors,omitempty"`
+	Produce *common.Produce `json:"Produce,omitempty"`
+}
+
+// Update Produce by ProduceCode concurrently
+// The body is a Produce - its Produce Code may be left out but must otherwise match the URL
+func UpdateProduce(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	// Get and Validate Param
+	produceCode := c.Param("ProduceCode")
+	if !common.ValidateProduceCode(produceCode) {
+		logger.InfoContext(c.Request().Context(), "UpdateProduce - bad produce code", "produceCode", produceCode)
+		return c.JSON(http.StatusBadRequest, UpdateReturn{Err: "Bad Produce Code"}) // Returns 400
+	}
+
+	// Unmarshal and Validate the body
+	var body struct {
+		common.Produce
+		Category *string `json:"Category"` // Left out to keep the Produce's category, empty for none
+	}
+	if err := json.NewDecoder(c.Request().Body).Decode(&body); err != nil {
+		if limit, ok := overBodyLimit(err); ok {
+			return bodyTooLarge(c, limit) // Returns 413
+		}
+		logger.InfoContext(c.Request().Context(), "UpdateProduce - failed unmarshalling the request body", "error", err)
+		return c.JSON(http.StatusBadRequest, UpdateReturn{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	produce := body.Produce
+	if produce.ProduceCode == "" {
+		produce.ProduceCode = produceCode
+	}
+	if !strings.EqualFold(produce.ProduceCode, produceCode) {
+		return c.JSON(http.StatusBadRequest, UpdateReturn{Err: "Produce Code does not match"}) // Returns 400
+	}
+	if body.Category != nil {
+		produce.Category = *body.Category
+	} else if existing, err := catalog(c).Get(c.Request().Context(), produceCode); err == nil {
+		produce.Category = existing.Category
+	}
+	if ok, validProduceError := common.ValidateProduce(produce); !ok {
+		return c.JSON(http.StatusBadRequest, UpdateReturn{Err: "Invalid Produce", Errors: validProduceError, Produce: &produce}) // Returns 400
+	}
+
+	// Update Row
+	updated, err := catalog(c).Update(c.Request().Context(), produce)
+	if errors.Is(err, db.ErrCategoryNotFound) { // Deleted since the Produce was validated
+		validProduceError := []string{"Produce Category (" + produce.Category + ") not found"}
+		return c.JSON(http.StatusBadRequest, UpdateReturn{Err: "Invalid Produce", Errors: validProduceError, Produce: &produce}) // Returns 400
+	}
+
+	// Handle Errors
+	if errors.Is(err, db.ErrNotFound) {
+		logger.InfoContext(c.Request().Context(), "UpdateProduce - not updated", "error", err)
+		return c.JSON(http.StatusNotFound, UpdateReturn{Err: "Produce not found"}) // Returns 404
+	}
+	if err != nil {
+		return storeFailed(c, UpdateReturn{Err: cancelled}, err) // Returns 503
+	}
+	logger.InfoContext(c.Request().Context(), "UpdateProduce - updated", "produceCode", updated.ProduceCode)
+
+	// Final Return
+	return c.JSON(http.StatusOK, UpdateReturn{Produce: &updated}) // Returns 200
+}
+
 // DeleteReturn structure - used by DeleteProduce
 type DeleteReturn struct {
 	Msg string `json:"Msg,omitempty"`
@@ -205,23 +395,22 @@ func DeleteProduce(c echo.Context) error {
 	// Get and Validate Param
 	produceCode := c.Param("ProduceCode")
 	if !common.ValidateProduceCode(produceCode) {
-		log.Printf("DeleteProduce - failed with produceCode(%v)\n", produceCode)
+		logger.InfoContext(c.Request().Context(), "DeleteProduce - bad produce code", "produceCode", produceCode)
 		return c.JSON(http.StatusBadRequest, DeleteReturn{Err: "Bad Produce Code"}) // Return 400
 	}
 
 	// Delete Row
-	outputChannel := make(chan common.Result, 2)
-	go db.Delete(produceCode, outputChannel)
-
-	// Get the results
-	var r common.Result
-	r = <-outputChannel
+	_, err := catalog(c).Delete(c.Request().Context(), produceCode)
 
 	// Handle Errors
-	if r.Err != "" {
-		log.Printf("DeleteProduce - Detected Error (%s)\n", r.Err)
+	if errors.Is(err, db.ErrNotFound) {
+		logger.InfoContext(c.Request().Context(), "DeleteProduce - not deleted", "error", err)
 		return c.JSON(http.StatusNotFound, DeleteReturn{Err: "Produce not found"}) // Returns 404
 	}
+	if err != nil {
+		return storeFailed(c, DeleteReturn{Err: cancelled}, err) // Returns 503
+	}
+	logger.InfoContext(c.Request().Context(), "DeleteProduce - deleted", "produceCode", produceCode)
 
 	// Final Return
 	return c.JSON(http.StatusOK, DeleteReturn{Msg: "Produce " + produceCode + " deleted"}) // Returns 200
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"log"
 	"net/http"
@@ -8,7 +9,15 @@ import (
 	"strings"
 	"testing"
 
+	"example.com/produce_demo/importer"
+	"example.com/produce_demo/metrics"
+
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 func getEcho() *echo.Echo {
@@ -17,6 +26,9 @@ func getEcho() *echo.Echo {
 	// Add a new Produce item to Inventory
 	e.POST("/produce", AddProduce)
 
+	// Update a Produce item in Inventory
+	e.PUT("/produce/:ProduceCode", UpdateProduce)
+
 	// Delete Produce item from Inventory
 	e.DELETE("/produce/:ProduceCode", DeleteProduce)
 
@@ -186,6 +198,117 @@ func TestAddProduce(t *testing.T) {
 	}
 }
 
+// Test AddProduce with streamed (CSV/NDJSON) bodies
+func TestAddProduceStream(t *testing.T) {
+	e := getEcho()
+
+	// Success condition - CSV
+	expected := http.StatusOK
+	expectedBody := "{\"Produce\":[{\"Produce Code\":\"CSVA-1111-2222-3333\",\"Name\":\"Pizza Pie\",\"Unit Price\":\"200.6\"}]}\n"
+	req := httptest.NewRequest(echo.POST, "/produce", strings.NewReader("Produce Code,Name,Unit Price\nCSVA-1111-2222-3333,Pizza Pie,200.6\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec := httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected(%v) received(%v) expectedBody(%v) receivedBody (%v) \n", expected, rec.Code, expectedBody, rec.Body)
+	}
+
+	// Failure condition - NDJSON with an add, a duplicate, a bad line and an invalid Produce
+	expected = http.StatusPartialContent
+	expectedBody = "{\"Produce\":[{\"Produce Code\":\"CSVA-1111-2222-4444\",\"Name\":\"Celery\",\"Unit Price\":\".45\"}]," +
+		"\"Rejected Produce\":[{\"Line\":2,\"Produce\":{\"Produce Code\":\"CSVA-1111-2222-3333\",\"Name\":\"Pizza Pie\",\"Unit Price\":\"200.6\"},\"Errors\":[\"CSVA-1111-2222-3333 already exists\"]}," +
+		"{\"Line\":3,\"Errors\":[\"Failed to unmarshal line\"]}," +
+		"{\"Line\":4,\"Produce\":{\"Produce Code\":\"CSVA-1111-2222-5555\",\"Name\":\" Corn\",\"Unit Price\":\".5\"},\"Errors\":[\"Detected error for Produce Name ( Corn)\"]}]}\n"
+	req = httptest.NewRequest(echo.POST, "/produce", strings.NewReader(
+		"{\"Produce Code\": \"CSVA-1111-2222-4444\", \"Name\": \"Celery\", \"Unit Price\": \".45\"}\n"+
+			"{\"Produce Code\": \"CSVA-1111-2222-3333\", \"Name\": \"Pizza Pie\", \"Unit Price\": \"200.6\"}\n"+
+			"{\"Produce Code\": \n"+
+			"{\"Produce Code\": \"CSVA-1111-2222-5555\", \"Name\": \" Corn\", \"Unit Price\": \".5\"}\n"))
+	req.Header.Set(echo.HeaderContentType, "application/x-ndjson")
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected(%v) received(%v) expectedBody(%v) receivedBody (%v) \n", expected, rec.Code, expectedBody, rec.Body)
+	}
+
+	// Failure condition - nothing reached the db
+	expected = http.StatusBadRequest
+	expectedBody = "{\"Rejected Produce\":[{\"Line\":1,\"Errors\":[\"Expected 3 or 4 fields\"]}]}\n"
+	req = httptest.NewRequest(echo.POST, "/produce", strings.NewReader("CSVA-1111-2222-6666,Corn\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected(%v) received(%v) expectedBody(%v) receivedBody (%v) \n", expected, rec.Code, expectedBody, rec.Body)
+	}
+
+	// Failure condition - bad body
+	expected = http.StatusBadRequest
+	expectedBody = "{\"Rejected Produce\":[{\"Errors\":[\"Failed to read request body\"]}]}\n"
+	req = httptest.NewRequest(echo.POST, "/produce", errReader(0))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	rec = httptest.NewRecorder()
+
+	e.ServeHTTP(rec, req)
+
+	if expected != rec.Code || expectedBody != rec.Body.String() {
+		t.Errorf("ERROR -- expected(%v) received(%v) expectedBody(%v) receivedBody (%v) \n", expected, rec.Code, expectedBody, rec.Body)
+	}
+
+	// Clean up
+	for _, produceCode := range []string{"CSVA-1111-2222-3333", "CSVA-1111-2222-4444"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.DELETE, "/produce/"+produceCode, nil))
+	}
+}
+
+// Test Update Produce
+func TestUpdateProduce(t *testing.T) {
+	e := getEcho()
+
+	// updateProduceTestStruct
+	type upTS struct {
+		url          string
+		body         string
+		expected     int
+		expectedBody string
+	}
+
+	// updateProduceTestStructs: test cases
+	var upTSs = []upTS{
+		{"/produce/e5t6-9ui3-TH15-QR88", "{\"Name\": \"White Peach\", \"Unit Price\": \"3.19\"}", http.StatusOK,
+			"{\"Produce\":{\"Produce Code\":\"e5t6-9ui3-TH15-QR88\",\"Name\":\"White Peach\",\"Unit Price\":\"3.19\"}}\n"},
+		{"/produce/E5T6-9UI3-TH15-QR88", "{\"Produce Code\": \"E5T6-9UI3-TH15-QR88\", \"Name\": \"Peach\", \"Unit Price\": \"2.99\"}", http.StatusOK,
+			"{\"Produce\":{\"Produce Code\":\"E5T6-9UI3-TH15-QR88\",\"Name\":\"Peach\",\"Unit Price\":\"2.99\"}}\n"},
+		{"/produce/ZZZZ-9UI3-TH15-QR88", "{\"Name\": \"Peach\", \"Unit Price\": \"2.99\"}", http.StatusNotFound,
+			"{\"Error\":\"Produce not found\"}\n"},
+		{"/produce/-E5T6-9UI3-TH15-QR88", "{\"Name\": \"Peach\", \"Unit Price\": \"2.99\"}", http.StatusBadRequest,
+			"{\"Error\":\"Bad Produce Code\"}\n"},
+		{"/produce/E5T6-9UI3-TH15-QR88", "{\"Name\": \"Peach\", ", http.StatusBadRequest,
+			"{\"Error\":\"Failed to unmarshal request body\"}\n"},
+		{"/produce/E5T6-9UI3-TH15-QR88", "{\"Produce Code\": \"A12T-4GH7-QPL9-3N4M\", \"Name\": \"Peach\", \"Unit Price\": \"2.99\"}", http.StatusBadRequest,
+			"{\"Error\":\"Produce Code does not match\"}\n"},
+		{"/produce/E5T6-9UI3-TH15-QR88", "{\"Name\": \" Peach\", \"Unit Price\": \"2.999\"}", http.StatusBadRequest,
+			"{\"Error\":\"Invalid Produce\",\"Errors\":[\"Detected error for Produce Name ( Peach)\",\"Detected error for Produce Unit Price (2.999)\"],\"Produce\":{\"Produce Code\":\"E5T6-9UI3-TH15-QR88\",\"Name\":\" Peach\",\"Unit Price\":\"2.999\"}}\n"},
+	}
+
+	for _, tt := range upTSs {
+		req := httptest.NewRequest(echo.PUT, tt.url, strings.NewReader(tt.body))
+		rec := httptest.NewRecorder()
+
+		e.ServeHTTP(rec, req)
+
+		if tt.expected != rec.Code || tt.expectedBody != rec.Body.String() {
+			t.Errorf("ERROR -- for (%v) expected(%v) received(%v) expectedBody(%v) receivedBody (%v) \n", tt.url, tt.expected, rec.Code, tt.expectedBody, rec.Body)
+		}
+	}
+}
+
 // Test Delete Produce
 func TestDeleteProduce(t *testing.T) {
 	// Success condition
@@ -272,3 +395,93 @@ func TestFetchProduceOnEmptyDB(t *testing.T) {
 	}
 	log.Printf("**TestFetchProduceOnEmptyDB** - Status is (%v) Body is (%v)\n", rec.Code, rec.Body)
 }
+
+// Test rejected items are counted by reason
+func TestAddProduceRejectionMetrics(t *testing.T) {
+	e := getEcho()
+	count := func(reason string) float64 {
+		return testutil.ToFloat64(metrics.RejectedItems.WithLabelValues(reason))
+	}
+	parse, validation, exists := count(importer.ReasonParse), count(importer.ReasonValidation), count(importer.ReasonExists)
+
+	existing := "{\"Produce Code\": \"MTRC-1111-2222-5555\", \"Name\": \"Leek\", \"Unit Price\": \".89\"}"
+	req := httptest.NewRequest(echo.POST, "/produce", strings.NewReader(existing))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	defer e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.DELETE, "/produce/MTRC-1111-2222-5555", nil))
+
+	body := "[" + existing + ", {\"Produce Code\": \"-MTRC-1111-2222-3333\", \"Name\": \"Kale\", \"Unit Price\": \"1.99\"}]"
+	req = httptest.NewRequest(echo.POST, "/produce", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(echo.POST, "/produce", strings.NewReader("{"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	req = httptest.NewRequest(echo.POST, "/produce", strings.NewReader("MTRC-1111-2222-4444,Kale\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	if count(importer.ReasonParse) != parse+2 || count(importer.ReasonValidation) != validation+1 || count(importer.ReasonExists) != exists+1 {
+		t.Errorf("ERROR -- expected parse +2, validation +1 and exists +1 but got (%v) (%v) (%v)\n",
+			count(importer.ReasonParse)-parse, count(importer.ReasonValidation)-validation, count(importer.ReasonExists)-exists)
+	}
+}
+
+// Test AddProduce traces its validation and each db.add of the fan-out as children of the request's span
+func TestAddProduceSpans(t *testing.T) {
+	e := getEcho()
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "POST /produce")
+	body := "[{\"Produce Code\": \"SPAN-1111-2222-3333\", \"Name\": \"Kale\", \"Unit Price\": \"1.99\"}, " +
+		"{\"Produce Code\": \"SPAN-1111-2222-4444\", \"Name\": \"Leek\", \"Unit Price\": \".89\"}, " +
+		"{\"Produce Code\": \"-SPAN-1111-2222-5555\", \"Name\": \"Okra\", \"Unit Price\": \"2.49\"}]"
+	req := httptest.NewRequest(echo.POST, "/produce", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	parent.End()
+	for _, produceCode := range []string{"SPAN-1111-2222-3333", "SPAN-1111-2222-4444"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(echo.DELETE, "/produce/"+produceCode, nil))
+	}
+
+	counts := map[string]int{}
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == parent.SpanContext().SpanID() {
+			counts[span.Name()]++
+		}
+	}
+	if counts["ValidateProduce"] != 1 || counts["db.add"] != 2 {
+		t.Errorf("ERROR -- expected 1 ValidateProduce and 2 db.add child spans but got (%v)\n", counts)
+	}
+}
+
+// Test requests whose context is done are not served by the store
+func TestProduceCancelled(t *testing.T) {
+	e := getEcho()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tt := range []struct {
+		method string
+		target string
+		body   string
+	}{
+		{echo.GET, "/produce", ""},
+		{echo.GET, "/produce/A12T-4GH7-QPL9-3N4M", ""},
+		{echo.POST, "/produce", "{\"Produce Code\": \"CNCL-1111-2222-3333\", \"Name\": \"Kale\", \"Unit Price\": \"1.99\"}"},
+		{echo.PUT, "/produce/A12T-4GH7-QPL9-3N4M", "{\"Name\": \"Lettuce\", \"Unit Price\": \"9.99\"}"},
+		{echo.DELETE, "/produce/A12T-4GH7-QPL9-3N4M", ""},
+	} {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)).WithContext(ctx)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "Request cancelled") {
+			t.Errorf("ERROR -- for (%v %v) expected (%v) but got (%v) (%v)\n", tt.method, tt.target, http.StatusServiceUnavailable, rec.Code, rec.Body)
+		}
+	}
+}
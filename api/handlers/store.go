@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/db"
+	"example.com/produce_demo/problem"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("example.com/produce_demo/api/handlers")
+
+// Error for a store operation abandoned because the request was cancelled or timed out
+const cancelled = "Request cancelled"
+
+// Error for Produce refused because the store's quota is used up
+const storeFull = "Store is full"
+
+// Keys of the request's catalog and the ID of its tenant in the echo.Context
+const (
+	catalogKey = "catalog"
+	storeIDKey = "storeID"
+)
+
+// Respond to a store operation that failed other than by ErrNotFound or ErrExists - the
+// request's context is done, so the client has gone or its deadline passed
+func storeFailed(c echo.Context, msg interface{}, err error) error {
+	logger.InfoContext(c.Request().Context(), "store operation abandoned", "path", c.Path(), "error", err)
+	return c.JSON(http.StatusServiceUnavailable, msg) // Returns 503
+}
+
+// Choose the catalog a request works on: the tenant named by the :storeId path parameter,
+// otherwise the tenant the principal is bound to, otherwise db.Default
+// A principal bound to one tenant is refused any other
+func SelectStore(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		p, _ := auth.FromContext(ctx)
+		storeID := c.Param("storeId")
+		if storeID == "" {
+			storeID = p.Store
+		}
+		if storeID == "" {
+			c.Set(catalogKey, db.Default)
+			return next(c)
+		}
+		if p.Store != "" && p.Store != storeID {
+			logger.InfoContext(ctx, "SelectStore - forbidden", "store", storeID, "boundStore", p.Store)
+			return problem.Write(c, http.StatusForbidden, "Credentials are for store "+p.Store) // Returns 403
+		}
+
+		_, store, err := db.Tenants.Get(storeID)
+		if errors.Is(err, db.ErrTenantNotFound) {
+			return problem.Write(c, http.StatusNotFound, "Store "+storeID+" not found") // Returns 404
+		}
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("produce.store", storeID))
+		c.Set(catalogKey, store)
+		c.Set(storeIDKey, storeID)
+		return next(c)
+	}
+}
+
+// Catalog chosen for the request by SelectStore - db.Default on routes without it
+func catalog(c echo.Context) *db.Store {
+	if store, ok := c.Get(catalogKey).(*db.Store); ok {
+		return store
+	}
+	return db.Default
+}
+
+// ID of the tenant whose catalog SelectStore chose - empty for db.Default
+func catalogStoreID(c echo.Context) string {
+	storeID, _ := c.Get(storeIDKey).(string)
+	return storeID
+}
+
+// Reports whether the request's principal may see what was done in the tenant storeID's
+// catalog - a principal bound to a store sees only its own
+func inCallerStore(c echo.Context, storeID string) bool {
+	p, _ := auth.FromContext(c.Request().Context())
+	return p.Store == "" || p.Store == storeID
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Longest supplier name, contact and SKU accepted
+const (
+	maxSupplierNameLength = 64
+	maxContactLength      = 256
+	maxSKULength          = 64
+)
+
+// SupplierMsg return structure - used by the supplier handlers
+type SupplierMsg struct {
+	Err       string             `json:"Error,omitempty"`
+	Supplier  *db.Supplier       `json:"Supplier,omitempty"`
+	Suppliers []db.Supplier      `json:"Suppliers,omitempty"`
+	Item      *db.SupplierItem   `json:"Item,omitempty"`
+	Items     *[]db.SupplierItem `json:"Items,omitempty"`
+}
+
+// SupplierRequest body structure - used by CreateSupplier and UpdateSupplier
+type SupplierRequest struct {
+	ID           string `json:"ID"` // May be left out of an update
+	Name         string `json:"Name"`
+	Contact      string `json:"Contact"`
+	LeadTimeDays int    `json:"Lead Time Days"`
+}
+
+// SupplierItemRequest body structure - used by SetSupplierItem
+type SupplierItemRequest struct {
+	SKU  string `json:"SKU"`
+	Cost string `json:"Cost"`
+}
+
+// Read and check a SupplierRequest - returns the error to send if it is bad
+func readSupplierRequest(c echo.Context) (SupplierRequest, string) {
+	defer c.Request().Body.Close()
+
+	var request SupplierRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return request, "Failed to unmarshal request body"
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || utf8.RuneCountInString(request.Name) > maxSupplierNameLength {
+		return request, "Name is required and may be up to 64 characters"
+	}
+	request.Contact = strings.TrimSpace(request.Contact)
+	if utf8.RuneCountInString(request.Contact) > maxContactLength {
+		return request, "Contact may be up to 256 characters"
+	}
+	if request.LeadTimeDays < 0 {
+		return request, "Lead Time Days must not be negative"
+	}
+	return request, ""
+}
+
+// Fetch every supplier, sorted by ID
+func FetchSuppliers(c echo.Context) error {
+	suppliers := db.Suppliers.List()
+	if len(suppliers) == 0 {
+		return c.JSON(http.StatusNoContent, SupplierMsg{Err: "No suppliers found"}) // Returns 204
+	}
+	return c.JSON(http.StatusOK, SupplierMsg{Suppliers: suppliers}) // Returns 200
+}
+
+// Fetch a supplier
+func FetchSupplier(c echo.Context) error {
+	supplier, err := db.Suppliers.Get(c.Param("SupplierID"))
+	if errors.Is(err, db.ErrSupplierNotFound) {
+		return c.JSON(http.StatusNotFound, SupplierMsg{Err: "Supplier not found"}) // Returns 404
+	}
+	return c.JSON(http.StatusOK, SupplierMsg{Supplier: &supplier}) // Returns 200
+}
+
+// Create a supplier
+func CreateSupplier(c echo.Context) error {
+	request, msg := readSupplierRequest(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: msg}) // Returns 400
+	}
+	if !db.ValidSupplierID(request.ID) {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "ID is required and may be up to 32 lower case letters, digits and dashes"}) // Returns 400
+	}
+
+	supplier, err := db.Suppliers.Create(db.Supplier{ID: request.ID, Name: request.Name, Contact: request.Contact, LeadTimeDays: request.LeadTimeDays})
+	switch {
+	case errors.Is(err, db.ErrSupplierExists):
+		return c.JSON(http.StatusConflict, SupplierMsg{Err: "Supplier " + request.ID + " already exists"}) // Returns 409
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "CreateSupplier - failed to create the supplier", "error", err)
+		return c.JSON(http.StatusInternalServerError, SupplierMsg{Err: "Failed to create the supplier"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "CreateSupplier - created", "supplier", supplier.ID)
+
+	// Final Return
+	c.Response().Header().Set(echo.HeaderLocation, "/suppliers/"+supplier.ID)
+	return c.JSON(http.StatusCreated, SupplierMsg{Supplier: &supplier}) // Returns 201
+}
+
+// Change a supplier's Name, Contact and Lead Time Days
+func UpdateSupplier(c echo.Context) error {
+	id := c.Param("SupplierID")
+	request, msg := readSupplierRequest(c)
+	if msg != "" {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: msg}) // Returns 400
+	}
+	if request.ID != "" && request.ID != id {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "ID does not match"}) // Returns 400
+	}
+
+	supplier, err := db.Suppliers.Update(db.Supplier{ID: id, Name: request.Name, Contact: request.Contact, LeadTimeDays: request.LeadTimeDays})
+	switch {
+	case errors.Is(err, db.ErrSupplierNotFound):
+		return c.JSON(http.StatusNotFound, SupplierMsg{Err: "Supplier not found"}) // Returns 404
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "UpdateSupplier - failed to update the supplier", "error", err)
+		return c.JSON(http.StatusInternalServerError, SupplierMsg{Err: "Failed to update the supplier"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "UpdateSupplier - updated", "supplier", supplier.ID)
+
+	// Final Return
+	return c.JSON(http.StatusOK, SupplierMsg{Supplier: &supplier}) // Returns 200
+}
+
+// Delete a supplier and the items it sells - refused while a store has open purchase orders from it
+func DeleteSupplier(c echo.Context) error {
+	supplier, err := db.Suppliers.Delete(c.Param("SupplierID"))
+	switch {
+	case errors.Is(err, db.ErrSupplierNotFound):
+		return c.JSON(http.StatusNotFound, SupplierMsg{Err: "Supplier not found"}) // Returns 404
+	case errors.Is(err, db.ErrSupplierInUse):
+		return c.JSON(http.StatusConflict, SupplierMsg{Err: "Supplier " + c.Param("SupplierID") + " has open purchase orders"}) // Returns 409
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "DeleteSupplier - failed to delete the supplier", "error", err)
+		return c.JSON(http.StatusInternalServerError, SupplierMsg{Err: "Failed to delete the supplier"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "DeleteSupplier - deleted", "supplier", supplier.ID)
+
+	// Final Return
+	return c.JSON(http.StatusOK, SupplierMsg{Supplier: &supplier}) // Returns 200
+}
+
+// Fetch the items a supplier sells, sorted by Produce Code
+func FetchSupplierItems(c echo.Context) error {
+	supplier, err := db.Suppliers.Get(c.Param("SupplierID"))
+	if errors.Is(err, db.ErrSupplierNotFound) {
+		return c.JSON(http.StatusNotFound, SupplierMsg{Err: "Supplier not found"}) // Returns 404
+	}
+	items := db.Suppliers.ItemsFrom(supplier.ID)
+	return c.JSON(http.StatusOK, SupplierMsg{Supplier: &supplier, Items: &items}) // Returns 200
+}
+
+// Add or replace the item with the Produce Code a supplier sells, with their SKU and Cost
+func SetSupplierItem(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	produceCode := c.Param("ProduceCode")
+	if !common.ValidateProduceCode(produceCode) {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "Detected error for Produce Code (" + produceCode + ")"}) // Returns 400
+	}
+	var request SupplierItemRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	request.SKU = strings.TrimSpace(request.SKU)
+	if utf8.RuneCountInString(request.SKU) > maxSKULength {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "SKU may be up to 64 characters"}) // Returns 400
+	}
+	if !common.ValidatePrice(request.Cost) {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "Detected error for Cost (" + request.Cost + ")"}) // Returns 400
+	}
+
+	item, err := db.Suppliers.SetItem(db.SupplierItem{Supplier: c.Param("SupplierID"), ProduceCode: produceCode, SKU: request.SKU, Cost: common.FixPrice(request.Cost)})
+	switch {
+	case errors.Is(err, db.ErrSupplierNotFound):
+		return c.JSON(http.StatusNotFound, SupplierMsg{Err: "Supplier not found"}) // Returns 404
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "SetSupplierItem - failed to set the item", "error", err)
+		return c.JSON(http.StatusInternalServerError, SupplierMsg{Err: "Failed to set the item"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "SetSupplierItem - set", "supplier", item.Supplier, "produce_code", item.ProduceCode)
+
+	// Final Return
+	return c.JSON(http.StatusOK, SupplierMsg{Item: &item}) // Returns 200
+}
+
+// Stop a supplier selling the item with the Produce Code
+func DeleteSupplierItem(c echo.Context) error {
+	item, err := db.Suppliers.DeleteItem(c.Param("SupplierID"), c.Param("ProduceCode"))
+	switch {
+	case errors.Is(err, db.ErrSupplierItemNotFound):
+		return c.JSON(http.StatusNotFound, SupplierMsg{Err: "Item not found"}) // Returns 404
+	case err != nil:
+		logger.ErrorContext(c.Request().Context(), "DeleteSupplierItem - failed to delete the item", "error", err)
+		return c.JSON(http.StatusInternalServerError, SupplierMsg{Err: "Failed to delete the item"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "DeleteSupplierItem - deleted", "supplier", item.Supplier, "produce_code", item.ProduceCode)
+
+	// Final Return
+	return c.JSON(http.StatusOK, SupplierMsg{Item: &item}) // Returns 200
+}
+
+// Fetch the suppliers selling the Produce Code with their items, sorted by supplier
+func FetchProduceSuppliers(c echo.Context) error {
+	produceCode := c.Param("ProduceCode")
+	if !common.ValidateProduceCode(produceCode) {
+		return c.JSON(http.StatusBadRequest, SupplierMsg{Err: "Detected error for Produce Code (" + produceCode + ")"}) // Returns 400
+	}
+	items := db.Suppliers.ItemsFor(produceCode)
+	suppliers := []db.Supplier{}
+	for _, item := range items {
+		if supplier, err := db.Suppliers.Get(item.Supplier); err == nil {
+			suppliers = append(suppliers, supplier)
+		}
+	}
+	return c.JSON(http.StatusOK, SupplierMsg{Suppliers: suppliers, Items: &items}) // Returns 200
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getSupplierEcho() *echo.Echo {
+	e := echo.New()
+
+	e.GET("/suppliers", FetchSuppliers)
+	e.GET("/suppliers/:SupplierID", FetchSupplier)
+	e.POST("/suppliers", CreateSupplier)
+	e.PUT("/suppliers/:SupplierID", UpdateSupplier)
+	e.DELETE("/suppliers/:SupplierID", DeleteSupplier)
+	e.GET("/suppliers/:SupplierID/items", FetchSupplierItems)
+	e.PUT("/suppliers/:SupplierID/items/:ProduceCode", SetSupplierItem)
+	e.DELETE("/suppliers/:SupplierID/items/:ProduceCode", DeleteSupplierItem)
+	e.GET("/produce/:ProduceCode/suppliers", FetchProduceSuppliers)
+
+	return e
+}
+
+// supplierTestStruct
+type supplierTS struct {
+	method   string
+	target   string
+	body     string
+	expected int
+}
+
+// supplierTestStructs: test cases, run in order
+var supplierTSs = []supplierTS{
+	{echo.GET, "/suppliers", "", http.StatusNoContent},
+	{echo.POST, "/suppliers", "{\"ID\": \"orchard\", \"Name\": \"Orchard Farms\", \"Lead Time Days\": 3}", http.StatusCreated},
+	{echo.POST, "/suppliers", "{\"ID\": \"valley\", \"Name\": \"Valley Growers\", \"Contact\": \"orders@valley.example.com\"}", http.StatusCreated},
+	{echo.POST, "/suppliers", "{\"ID\": \"orchard\", \"Name\": \"Again\"}", http.StatusConflict},
+	{echo.POST, "/suppliers", "{\"ID\": \"Hill\", \"Name\": \"Hill\"}", http.StatusBadRequest},
+	{echo.POST, "/suppliers", "{\"ID\": \"hill\", \"Name\": \"\"}", http.StatusBadRequest},
+	{echo.POST, "/suppliers", "{\"ID\": \"hill\", \"Name\": \"Hill\", \"Lead Time Days\": -1}", http.StatusBadRequest},
+	{echo.POST, "/suppliers", "{", http.StatusBadRequest},
+	{echo.GET, "/suppliers", "", http.StatusOK},
+	{echo.GET, "/suppliers/orchard", "", http.StatusOK},
+	{echo.GET, "/suppliers/hill", "", http.StatusNotFound},
+	{echo.PUT, "/suppliers/orchard", "{\"Name\": \"Orchard Farms\", \"Lead Time Days\": 5}", http.StatusOK},
+	{echo.PUT, "/suppliers/orchard", "{\"ID\": \"valley\", \"Name\": \"Orchard Farms\"}", http.StatusBadRequest},
+	{echo.PUT, "/suppliers/hill", "{\"Name\": \"Hill\"}", http.StatusNotFound},
+	{echo.PUT, "/suppliers/orchard/items/TQ4C-VV6T-75ZX-1RMR", "{\"SKU\": \"GALA\", \"Cost\": \"$1.2\"}", http.StatusOK},
+	{echo.PUT, "/suppliers/valley/items/tq4c-vv6t-75zx-1rmr", "{\"SKU\": \"V-100\", \"Cost\": \"1.10\"}", http.StatusOK},
+	{echo.PUT, "/suppliers/orchard/items/E5T6-9UI3-TH15-QR88", "{\"Cost\": \"0.90\"}", http.StatusOK},
+	{echo.PUT, "/suppliers/orchard/items/TQ4C", "{\"Cost\": \"1.00\"}", http.StatusBadRequest},
+	{echo.PUT, "/suppliers/orchard/items/TQ4C-VV6T-75ZX-1RMR", "{\"Cost\": \"one\"}", http.StatusBadRequest},
+	{echo.PUT, "/suppliers/hill/items/TQ4C-VV6T-75ZX-1RMR", "{\"Cost\": \"1.00\"}", http.StatusNotFound},
+	{echo.GET, "/suppliers/orchard/items", "", http.StatusOK},
+	{echo.GET, "/suppliers/hill/items", "", http.StatusNotFound},
+	{echo.GET, "/produce/TQ4C-VV6T-75ZX-1RMR/suppliers", "", http.StatusOK},
+	{echo.GET, "/produce/TQ4C/suppliers", "", http.StatusBadRequest},
+	{echo.DELETE, "/suppliers/valley/items/E5T6-9UI3-TH15-QR88", "", http.StatusNotFound},
+}
+
+// Test suppliers and the items they sell can be kept, and found by supplier or by Produce Code
+func TestSuppliers(t *testing.T) {
+	e := getSupplierEcho()
+	defer func() {
+		for _, id := range []string{"orchard", "valley"} {
+			db.Suppliers.Delete(id)
+		}
+	}()
+
+	for _, tt := range supplierTSs {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v %v %v) expected (%v) but got (%v) (%v)\n", tt.method, tt.target, tt.body, tt.expected, rec.Code, rec.Body)
+		}
+	}
+
+	// Both suppliers sell Gala Apples, at their own SKU and cost
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/produce/tq4c-vv6t-75zx-1rmr/suppliers", nil))
+	msg := SupplierMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if len(msg.Suppliers) != 2 || msg.Suppliers[0].LeadTimeDays != 5 || msg.Items == nil || len(*msg.Items) != 2 ||
+		(*msg.Items)[0].Cost != "1.20" || (*msg.Items)[1].SKU != "V-100" {
+		t.Errorf("ERROR -- expected orchard and valley but got (%v)\n", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/suppliers/orchard/items", nil))
+	msg = SupplierMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if msg.Items == nil || len(*msg.Items) != 2 {
+		t.Errorf("ERROR -- expected 2 items from orchard but got (%v)\n", rec.Body)
+	}
+
+	// A supplier with an open purchase order in any store cannot be deleted
+	if _, err := db.Tenants.Create(db.Tenant{ID: "supplier-test", Name: "Supplier Test"}); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Tenants.Delete("supplier-test")
+	_, store, _ := db.Tenants.Get("supplier-test")
+	order, _ := store.Inventory().CreateOrder("orchard", []db.OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 1}})
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.DELETE, "/suppliers/orchard", nil))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", http.StatusConflict, rec.Code, rec.Body)
+	}
+	store.Inventory().CancelOrder(order.ID)
+
+	// Deleting the supplier deletes its items
+	for _, target := range []string{"/suppliers/orchard/items/E5T6-9UI3-TH15-QR88", "/suppliers/orchard"} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(echo.DELETE, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) (%v)\n", target, http.StatusOK, rec.Code, rec.Body)
+		}
+	}
+	if items := db.Suppliers.ItemsFor("TQ4C-VV6T-75ZX-1RMR"); len(items) != 1 || items[0].Supplier != "valley" {
+		t.Errorf("ERROR -- expected only valley's item but got (%v)\n", items)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Longest store name accepted
+const maxStoreNameLength = 64
+
+// Quota of a store created without one - set from the configuration
+var defaultMaxProduce = 0
+
+// Set the quota of stores created without one - 0 for no limit
+func SetDefaultMaxProduce(n int) {
+	defaultMaxProduce = n
+}
+
+// Store with the number of Produce in its catalog
+type StoreInfo struct {
+	db.Tenant
+	Rows int `json:"Rows"`
+}
+
+// StoreMsg return structure - used by FetchStores, CreateStore and DeleteStore
+type StoreMsg struct {
+	Err    string      `json:"Error,omitempty"`
+	Store  *StoreInfo  `json:"Store,omitempty"`
+	Stores []StoreInfo `json:"Stores,omitempty"`
+}
+
+// StoreRequest body structure - used by CreateStore
+type StoreRequest struct {
+	ID         string `json:"ID"`
+	Name       string `json:"Name"`
+	MaxProduce *int   `json:"Max Produce"` // Left out for the configured quota, 0 for no limit
+}
+
+// Fetch every store
+func FetchStores(c echo.Context) error {
+	stores := []StoreInfo{}
+	for _, t := range db.Tenants.List() {
+		if _, store, err := db.Tenants.Get(t.ID); err == nil {
+			stores = append(stores, StoreInfo{Tenant: t, Rows: store.Len()})
+		}
+	}
+	return c.JSON(http.StatusOK, StoreMsg{Stores: stores}) // Returns 200
+}
+
+// Create a store with an empty catalog served under /stores/(ID)/produce
+func CreateStore(c echo.Context) error {
+	defer c.Request().Body.Close()
+
+	var request StoreRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, StoreMsg{Err: "Failed to unmarshal request body"}) // Returns 400
+	}
+	if !db.ValidTenantID(request.ID) {
+		return c.JSON(http.StatusBadRequest, StoreMsg{Err: "ID is required and may be up to 32 lower case letters, digits and dashes"}) // Returns 400
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || utf8.RuneCountInString(request.Name) > maxStoreNameLength {
+		return c.JSON(http.StatusBadRequest, StoreMsg{Err: "Name is required and may be up to 64 characters"}) // Returns 400
+	}
+	maxProduce := defaultMaxProduce
+	if request.MaxProduce != nil {
+		maxProduce = *request.MaxProduce
+	}
+	if maxProduce < 0 {
+		return c.JSON(http.StatusBadRequest, StoreMsg{Err: "Max Produce must not be negative"}) // Returns 400
+	}
+
+	tenant, err := db.Tenants.Create(db.Tenant{ID: request.ID, Name: request.Name, MaxProduce: maxProduce})
+	if errors.Is(err, db.ErrTenantExists) {
+		return c.JSON(http.StatusConflict, StoreMsg{Err: "Store " + request.ID + " already exists"}) // Returns 409
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "CreateStore - failed to create the store", "error", err)
+		return c.JSON(http.StatusInternalServerError, StoreMsg{Err: "Failed to create the store"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "CreateStore - created", "store", tenant.ID, "name", tenant.Name, "maxProduce", tenant.MaxProduce)
+
+	// Final Return
+	c.Response().Header().Set(echo.HeaderLocation, "/stores/"+tenant.ID+"/produce")
+	return c.JSON(http.StatusCreated, StoreMsg{Store: &StoreInfo{Tenant: tenant}}) // Returns 201
+}
+
+// Delete a store, its catalog and the API keys bound to it
+func DeleteStore(c echo.Context) error {
+	_, store, err := db.Tenants.Get(c.Param("storeId"))
+	if errors.Is(err, db.ErrTenantNotFound) {
+		return c.JSON(http.StatusNotFound, StoreMsg{Err: "Store not found"}) // Returns 404
+	}
+	rows := store.Len()
+
+	// NOTE: keys go first so a store later created with the same ID can't inherit them
+	revoked, err := auth.Keys.RevokeStore(c.Param("storeId"))
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "DeleteStore - failed to revoke the store's API keys", "error", err)
+		return c.JSON(http.StatusInternalServerError, StoreMsg{Err: "Failed to delete the store"}) // Returns 500
+	}
+
+	tenant, err := db.Tenants.Delete(c.Param("storeId"))
+	if errors.Is(err, db.ErrTenantNotFound) {
+		return c.JSON(http.StatusNotFound, StoreMsg{Err: "Store not found"}) // Returns 404
+	}
+	if err != nil {
+		logger.ErrorContext(c.Request().Context(), "DeleteStore - failed to delete the store", "error", err)
+		return c.JSON(http.StatusInternalServerError, StoreMsg{Err: "Failed to delete the store"}) // Returns 500
+	}
+	logger.InfoContext(c.Request().Context(), "DeleteStore - deleted", "store", tenant.ID, "rows", rows, "revokedKeys", len(revoked))
+
+	// Final Return
+	return c.JSON(http.StatusOK, StoreMsg{Store: &StoreInfo{Tenant: tenant, Rows: rows}}) // Returns 200
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/db"
+
+	"github.com/labstack/echo/v4"
+)
+
+func getStoreEcho() *echo.Echo {
+	e := echo.New()
+
+	e.GET("/admin/stores", FetchStores)
+	e.POST("/admin/stores", CreateStore)
+	e.DELETE("/admin/stores/:storeId", DeleteStore)
+	e.POST("/admin/api-keys", CreateAPIKey)
+
+	return e
+}
+
+// createStoreTestStruct
+type createStoreTS struct {
+	body       string
+	expected   int
+	maxProduce int
+}
+
+// createStoreTestStructs: test cases
+var createStoreTSs = []createStoreTS{
+	{"{\"ID\": \"store-1\", \"Name\": \"First\"}", http.StatusCreated, 50},
+	{"{\"ID\": \"store-2\", \"Name\": \"Second\", \"Max Produce\": 0}", http.StatusCreated, 0},
+	{"{\"ID\": \"store-1\", \"Name\": \"Again\"}", http.StatusConflict, 0},
+	{"{\"ID\": \"Store-3\", \"Name\": \"Third\"}", http.StatusBadRequest, 0},
+	{"{\"ID\": \"store-3\", \"Name\": \" \"}", http.StatusBadRequest, 0},
+	{"{\"ID\": \"store-3\", \"Name\": \"Third\", \"Max Produce\": -1}", http.StatusBadRequest, 0},
+	{"{", http.StatusBadRequest, 0},
+}
+
+// Test stores can be created with the configured quota or their own, listed and deleted
+func TestStores(t *testing.T) {
+	SetDefaultMaxProduce(50)
+	defer SetDefaultMaxProduce(0)
+	e := getStoreEcho()
+
+	for _, tt := range createStoreTSs {
+		req := httptest.NewRequest(echo.POST, "/admin/stores", strings.NewReader(tt.body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) (%v)\n", tt.body, tt.expected, rec.Code, rec.Body)
+		}
+		if rec.Code == http.StatusCreated {
+			msg := StoreMsg{}
+			json.Unmarshal(rec.Body.Bytes(), &msg)
+			if msg.Store == nil || msg.Store.MaxProduce != tt.maxProduce {
+				t.Errorf("ERROR -- for (%v) expected a quota of (%v) but got (%v)\n", tt.body, tt.maxProduce, rec.Body)
+			}
+		}
+	}
+
+	// Keys may only be bound to stores that exist
+	for store, expected := range map[string]int{"store-1": http.StatusCreated, "store-9": http.StatusBadRequest} {
+		req := httptest.NewRequest(echo.POST, "/admin/api-keys", strings.NewReader("{\"Name\": \"till\", \"Roles\": [\"cashier\"], \"Store\": \""+store+"\"}"))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) (%v)\n", store, expected, rec.Code, rec.Body)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/admin/stores", nil))
+	msg := StoreMsg{}
+	json.Unmarshal(rec.Body.Bytes(), &msg)
+	if rec.Code != http.StatusOK || len(msg.Stores) != 2 || msg.Stores[0].ID != "store-1" || msg.Stores[1].ID != "store-2" {
+		t.Errorf("ERROR -- expected store-1 and store-2 listed but got (%v) (%v)\n", rec.Code, rec.Body)
+	}
+
+	for _, id := range []string{"store-1", "store-2"} {
+		for _, expected := range []int{http.StatusOK, http.StatusNotFound} {
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, httptest.NewRequest(echo.DELETE, "/admin/stores/"+id, nil))
+			if rec.Code != expected {
+				t.Errorf("ERROR -- for (%v) expected (%v) but got (%v) (%v)\n", id, expected, rec.Code, rec.Body)
+			}
+		}
+	}
+	if tenants := db.Tenants.List(); len(tenants) != 0 {
+		t.Errorf("ERROR -- expected no stores but got (%v)\n", tenants)
+	}
+
+	// The key bound to store-1 went with it, so a new store-1 doesn't inherit it
+	for _, k := range auth.Keys.List() {
+		if k.Store == "store-1" {
+			t.Errorf("ERROR -- expected the keys of store-1 revoked but got (%v)\n", k)
+		}
+	}
+}
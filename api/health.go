@@ -0,0 +1,18 @@
+package api
+
+import (
+	"example.com/produce_demo/api/handlers"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Health(e *echo.Echo) {
+	// Liveness - the process is up
+	e.GET("/healthz", handlers.Healthz)
+
+	// Readiness - every registered health check passes
+	e.GET("/readyz", handlers.Readyz)
+
+	// Version, uptime, build info, checks and statistics
+	e.GET("/status", handlers.FetchStatus)
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Imports(e *echo.Echo) {
+	read := auth.Require(auth.PermProduceRead)
+	write := auth.Require(auth.PermProduceWrite)
+
+	// Queue a file of Produce to be imported in the background into the default catalog, or the
+	// one of the store the credentials are bound to
+	e.POST("/imports", handlers.SubmitImport, write, handlers.SelectStore)
+
+	// Fetch the progress of an import
+	e.GET("/imports/:ImportID", handlers.FetchImport, read)
+
+	// Download the rejected lines of an import
+	e.GET("/imports/:ImportID/rejections", handlers.FetchImportRejections, read)
+}
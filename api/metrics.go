@@ -0,0 +1,12 @@
+package api
+
+import (
+	"example.com/produce_demo/metrics"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Metrics(e *echo.Echo) {
+	// Prometheus metrics
+	e.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+}
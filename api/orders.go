@@ -0,0 +1,46 @@
+package api
+
+import (
+	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+func PurchaseOrders(e *echo.Echo) {
+	// The default catalog's stock, or that of the store the credentials are bound to
+	orderRoutes(e.Group("/purchase-orders"), e.Group("/inventory"))
+
+	// The stock of a store
+	orderRoutes(e.Group("/stores/:storeId/purchase-orders"), e.Group("/stores/:storeId/inventory"))
+}
+
+// Routes of a catalog's purchase orders and stock - the permission is checked before the catalog is chosen
+func orderRoutes(orders *echo.Group, inventory *echo.Group) {
+	read := auth.Require(auth.PermProduceRead)
+	write := auth.Require(auth.PermProduceWrite)
+
+	// Fetch the purchase orders, or one with its receipts and discrepancies
+	orders.GET("", handlers.FetchOrders, read, handlers.SelectStore)
+	orders.GET("/:OrderID", handlers.FetchOrder, read, handlers.SelectStore)
+
+	// Create a draft purchase order, or change one
+	orders.POST("", handlers.CreateOrder, write, handlers.SelectStore)
+	orders.PUT("/:OrderID", handlers.UpdateOrder, write, handlers.SelectStore)
+
+	// Submit, cancel and receive a purchase order
+	orders.POST("/:OrderID/submit", handlers.SubmitOrder, write, handlers.SelectStore)
+	orders.POST("/:OrderID/cancel", handlers.CancelOrder, write, handlers.SelectStore)
+	orders.POST("/:OrderID/receive", handlers.ReceiveOrder, write, handlers.SelectStore)
+
+	// Fetch the stock on hand and the movements into and out of it
+	inventory.GET("", handlers.FetchInventory, read, handlers.SelectStore)
+	inventory.GET("/movements", handlers.FetchMovements, read, handlers.SelectStore)
+
+	// Fetch the lots stock was received in, or those expiring within ?days=
+	inventory.GET("/lots", handlers.FetchLots, read, handlers.SelectStore)
+	inventory.GET("/lots/expiring", handlers.FetchExpiringLots, read, handlers.SelectStore)
+
+	// Take stock out, first-expiry-first-out
+	inventory.POST("/consume", handlers.ConsumeStock, write, handlers.SelectStore)
+}
@@ -2,20 +2,37 @@ package api
 
 import (
 	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
 
 	"github.com/labstack/echo/v4"
 )
 
 func Produce(e *echo.Echo) {
+	// The default catalog, or the one of the store the credentials are bound to
+	produceRoutes(e.Group("/produce"))
+
+	// The catalog of a store
+	produceRoutes(e.Group("/stores/:storeId/produce"))
+}
+
+// Routes of a catalog - the permission is checked before the catalog is chosen
+func produceRoutes(g *echo.Group) {
+	read := auth.Require(auth.PermProduceRead)
+	write := auth.Require(auth.PermProduceWrite)
+	remove := auth.Require(auth.PermProduceDelete)
+
 	// Add a new Produce item to Inventory
-	e.POST("/produce", handlers.AddProduce)
+	g.POST("", handlers.AddProduce, write, handlers.SelectStore)
+
+	// Update a Produce item in Inventory
+	g.PUT("/:ProduceCode", handlers.UpdateProduce, write, handlers.SelectStore)
 
 	// Delete Produce item from Inventory
-	e.DELETE("/produce/:ProduceCode", handlers.DeleteProduce)
+	g.DELETE("/:ProduceCode", handlers.DeleteProduce, remove, handlers.SelectStore)
 
 	// Fetch all Produce items from Inventory
-	e.GET("/produce", handlers.FetchProduce)
+	g.GET("", handlers.FetchProduce, read, handlers.SelectStore)
 
 	// Fetch a Produce item from Inventory by Produce Code
-	e.GET("/produce/:ProduceCode", handlers.FetchProduceByProduceCode)
+	g.GET("/:ProduceCode", handlers.FetchProduceByProduceCode, read, handlers.SelectStore)
 }
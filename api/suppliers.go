@@ -0,0 +1,34 @@
+package api
+
+import (
+	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
+
+	"github.com/labstack/echo/v4"
+)
+
+func Suppliers(e *echo.Echo) {
+	read := auth.Require(auth.PermProduceRead)
+	// Suppliers are shared by every store, so only admins not bound to one change them
+	admin := auth.Require(auth.PermAdmin)
+	unbound := auth.RequireUnbound()
+
+	// Fetch the suppliers, or a supplier
+	e.GET("/suppliers", handlers.FetchSuppliers, read)
+	e.GET("/suppliers/:SupplierID", handlers.FetchSupplier, read)
+
+	// Add a supplier, or change one
+	e.POST("/suppliers", handlers.CreateSupplier, admin, unbound)
+	e.PUT("/suppliers/:SupplierID", handlers.UpdateSupplier, admin, unbound)
+
+	// Delete a supplier and the items it sells
+	e.DELETE("/suppliers/:SupplierID", handlers.DeleteSupplier, admin, unbound)
+
+	// Fetch, set and delete the items a supplier sells
+	e.GET("/suppliers/:SupplierID/items", handlers.FetchSupplierItems, read)
+	e.PUT("/suppliers/:SupplierID/items/:ProduceCode", handlers.SetSupplierItem, admin, unbound)
+	e.DELETE("/suppliers/:SupplierID/items/:ProduceCode", handlers.DeleteSupplierItem, admin, unbound)
+
+	// Fetch the suppliers selling a Produce item
+	e.GET("/produce/:ProduceCode/suppliers", handlers.FetchProduceSuppliers, read)
+}
@@ -0,0 +1,218 @@
+// Authentication of API requests
+//
+// A request carries one credential:
+//   - Authorization: Bearer with a configured static token or a JWT signed with the HMAC secret
+//     or a key in the JWKS file
+//   - X-API-Key with a configured static key or a key created through the admin endpoints
+//
+// or, failing those, a TLS client certificate the server verified
+//
+// The principal it identifies is added to the request's context for handlers to audit:
+//
+//	if p, ok := auth.FromContext(ctx); ok {
+//		logger.InfoContext(ctx, "deleted", "by", p.Subject)
+//	}
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// JWT claim holding the principal's roles unless Options.RolesClaim names another
+const DefaultRolesClaim = "roles"
+
+// JWT claim holding the store the principal is bound to unless Options.StoreClaim names another
+const DefaultStoreClaim = "store"
+
+// Authentication methods
+const (
+	MethodToken  = "token"   // A static bearer token from the configuration
+	MethodAPIKey = "api_key" // A static or managed API key
+	MethodJWT    = "jwt"     // A JWT bearer token
+	MethodCert   = "cert"    // A verified TLS client certificate
+)
+
+// Prefix of a static API key or token given as its SHA-256 hash rather than in the clear
+const hashPrefix = "sha256:"
+
+// Returned by Authenticate
+var (
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal is who made a request
+type Principal struct {
+	Subject string         `json:"Subject"`          // Key ID, "token-N"/"api-key-N" for the Nth static credential, the JWT's sub claim or the certificate's common name
+	Method  string         `json:"Method"`           // MethodToken, MethodAPIKey, MethodJWT or MethodCert
+	Roles   []string       `json:"Roles"`            // Grant the principal's permissions
+	Store   string         `json:"Store,omitempty"`  // Tenant whose catalog the principal is bound to - empty for any
+	Claims  map[string]any `json:"Claims,omitempty"` // Claims of a JWT
+}
+
+type principalKey struct{}
+
+// Context carrying the principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// Principal carried by ctx, if the request was authenticated
+func FromContext(ctx context.Context) (Principal, bool) {
+	if ctx == nil {
+		return Principal{}, false
+	}
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// What credentials are accepted
+type Options struct {
+	Tokens    []string  // Static bearer tokens - in the clear or sha256:<hex>
+	APIKeys   []string  // Static API keys - in the clear or sha256:<hex>
+	Keys      *KeyStore // Managed API keys, if any
+	JWTSecret string    // HMAC secret for HS256, HS384 and HS512 JWTs
+	JWKSFile  string    // JSON Web Key Set of the RSA and EC keys for RS*, PS* and ES* JWTs
+	Issuer    string    // Required iss claim of JWTs, if set
+	Audience  string    // Required aud claim of JWTs, if set
+
+	StaticRoles []string // Roles of the static tokens and API keys
+	RolesClaim  string   // JWT claim holding the roles - an array or a space separated string
+	StoreClaim  string   // JWT claim holding the tenant the principal is bound to
+
+	ClientCerts bool // Accept TLS client certificates verified by the server
+}
+
+// Authenticator checks the credentials of requests
+type Authenticator struct {
+	tokens  [][]byte // SHA-256 hashes
+	apiKeys [][]byte // SHA-256 hashes
+	keys    *KeyStore
+	jwt     *jwtVerifier
+	static  []string // Roles of the static tokens and API keys
+	certs   bool
+}
+
+// Create an Authenticator for options, reading its JWKS file
+func New(options Options) (*Authenticator, error) {
+	a := &Authenticator{keys: options.Keys, static: options.StaticRoles, certs: options.ClientCerts}
+	var err error
+	if a.tokens, err = hashes("token", options.Tokens); err != nil {
+		return nil, err
+	}
+	if a.apiKeys, err = hashes("API key", options.APIKeys); err != nil {
+		return nil, err
+	}
+	if options.JWTSecret != "" || options.JWKSFile != "" {
+		if a.jwt, err = newJWTVerifier(options); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Hashes of static credentials given in the clear or as sha256:<hex>
+func hashes(kind string, secrets []string) ([][]byte, error) {
+	hashed := make([][]byte, 0, len(secrets))
+	for i, secret := range secrets {
+		if h, ok := strings.CutPrefix(secret, hashPrefix); ok {
+			b, err := hex.DecodeString(h)
+			if err != nil || len(b) != sha256.Size {
+				return nil, errors.New(kind + " " + strconv.Itoa(i+1) + " is not sha256: followed by 64 hex digits")
+			}
+			hashed = append(hashed, b)
+			continue
+		}
+		hashed = append(hashed, hash(secret))
+	}
+	return hashed, nil
+}
+
+func hash(secret string) []byte {
+	h := sha256.Sum256([]byte(secret))
+	return h[:]
+}
+
+// SHA-256 hash of a secret as configured for a static token or API key
+func HashSecret(secret string) string {
+	return hashPrefix + hex.EncodeToString(hash(secret))
+}
+
+// Index of the hash of secret in hashed, or -1
+// Every hash is compared, in constant time, so the time taken does not depend on which matched
+func match(hashed [][]byte, secret string) int {
+	h := hash(secret)
+	found := -1
+	for i, candidate := range hashed {
+		if subtle.ConstantTimeCompare(candidate, h) == 1 {
+			found = i
+		}
+	}
+	return found
+}
+
+// Identify who sent r from its Authorization or X-API-Key header, otherwise its client certificate
+// Returns ErrNoCredentials if it has none, otherwise ErrInvalidCredentials if they are not accepted
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" { // NOTE: auth schemes are case insensitive
+			return Principal{}, ErrInvalidCredentials
+		}
+		if i := match(a.tokens, token); i >= 0 {
+			return Principal{Subject: "token-" + strconv.Itoa(i+1), Method: MethodToken, Roles: a.static}, nil
+		}
+		if a.jwt != nil && looksLikeJWT(token) {
+			return a.jwt.verify(token)
+		}
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		if i := match(a.apiKeys, key); i >= 0 {
+			return Principal{Subject: "api-key-" + strconv.Itoa(i+1), Method: MethodAPIKey, Roles: a.static}, nil
+		}
+		if a.keys != nil {
+			if k, ok := a.keys.Lookup(key); ok {
+				return Principal{Subject: k.ID, Method: MethodAPIKey, Roles: k.Roles, Store: k.Store}, nil
+			}
+		}
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	if a.certs && r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		return certPrincipal(r.TLS.VerifiedChains[0][0])
+	}
+	return Principal{}, ErrNoCredentials
+}
+
+// Principal for a verified client certificate
+// The subject is its common name, or its first DNS name or email address, and its roles are the
+// organizational units (OU) of its subject
+func certPrincipal(cert *x509.Certificate) (Principal, error) {
+	subject := cert.Subject.CommonName
+	if subject == "" && len(cert.DNSNames) != 0 {
+		subject = cert.DNSNames[0]
+	}
+	if subject == "" && len(cert.EmailAddresses) != 0 {
+		subject = cert.EmailAddresses[0]
+	}
+	if subject == "" {
+		logger.Debug("certPrincipal - rejected a certificate without a subject")
+		return Principal{}, ErrInvalidCredentials
+	}
+	return Principal{Subject: subject, Method: MethodCert, Roles: cert.Subject.OrganizationalUnit}, nil
+}
+
+// A JWT is three dot separated parts
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
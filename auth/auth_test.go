@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// Write a JWKS file with the public keys and return its path
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	set := map[string][]map[string]string{"keys": {
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+	}}
+	b, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Sign claims with method and key, naming the key kid
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// authenticateTestStruct
+type authenticateTS struct {
+	name     string
+	headers  map[string]string
+	subject  string // Expected subject - empty when rejected
+	method   string
+	expected error
+}
+
+// Test each kind of credential is accepted or rejected
+func TestAuthenticate(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	keys := NewKeyStore()
+	managed, managedSecret, _ := keys.Create("ci", []string{"buyer"}, "")
+	revoked, revokedSecret, _ := keys.Create("old", []string{"buyer"}, "")
+	keys.Revoke(revoked.ID)
+
+	a, err := New(Options{
+		Tokens:    []string{"token-one", HashSecret("token-two")},
+		APIKeys:   []string{HashSecret("key-one")},
+		Keys:      keys,
+		JWTSecret: testSecret,
+		JWKSFile:  writeJWKS(t, rsaKey, ecKey),
+		Issuer:    "https://issuer.example.com",
+		Audience:  "produce_demo",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "alice", "iss": "https://issuer.example.com", "aud": "produce_demo", "exp": now.Add(time.Hour).Unix(), "iat": now.Unix()}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+	bearer := func(token string) map[string]string { return map[string]string{"Authorization": "Bearer " + token} }
+
+	authenticateTSs := []authenticateTS{
+		{"no credentials", nil, "", "", ErrNoCredentials},
+		{"static token", bearer("token-one"), "token-1", MethodToken, nil},
+		{"hashed static token", bearer("token-two"), "token-2", MethodToken, nil},
+		{"wrong token", bearer("token-three"), "", "", ErrInvalidCredentials},
+		{"lower case bearer", map[string]string{"Authorization": "bearer token-one"}, "token-1", MethodToken, nil},
+		{"upper case bearer", map[string]string{"Authorization": "BEARER token-one"}, "token-1", MethodToken, nil},
+		{"not bearer", map[string]string{"Authorization": "Basic dG9rZW4tb25l"}, "", "", ErrInvalidCredentials},
+		{"no token", map[string]string{"Authorization": "Bearer"}, "", "", ErrInvalidCredentials},
+		{"hashed static key", map[string]string{"X-API-Key": "key-one"}, "api-key-1", MethodAPIKey, nil},
+		{"hash is not the key", map[string]string{"X-API-Key": HashSecret("key-one")}, "", "", ErrInvalidCredentials},
+		{"managed key", map[string]string{"X-API-Key": managedSecret}, managed.ID, MethodAPIKey, nil},
+		{"revoked key", map[string]string{"X-API-Key": revokedSecret}, "", "", ErrInvalidCredentials},
+		{"HMAC JWT", bearer(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(nil))), "alice", MethodJWT, nil},
+		{"HMAC JWT wrong secret", bearer(sign(t, jwt.SigningMethodHS256, "", []byte("x"+testSecret), claims(nil))), "", "", ErrInvalidCredentials},
+		{"RSA JWT", bearer(sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(nil))), "alice", MethodJWT, nil},
+		{"EC JWT", bearer(sign(t, jwt.SigningMethodES256, "ec-1", ecKey, claims(nil))), "alice", MethodJWT, nil},
+		{"RSA JWT unknown key", bearer(sign(t, jwt.SigningMethodRS256, "rsa-1", otherKey, claims(nil))), "", "", ErrInvalidCredentials},
+		{"RSA JWT unknown kid", bearer(sign(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, claims(nil))), "", "", ErrInvalidCredentials},
+		{"encryption key", bearer(sign(t, jwt.SigningMethodRS256, "enc-1", rsaKey, claims(nil))), "", "", ErrInvalidCredentials},
+		{"expired", bearer(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"exp": now.Add(-time.Hour).Unix()}))), "", "", ErrInvalidCredentials},
+		{"no expiry", bearer(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"exp": nil}))), "", "", ErrInvalidCredentials},
+		{"wrong issuer", bearer(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"iss": "https://evil.example.com"}))), "", "", ErrInvalidCredentials},
+		{"wrong audience", bearer(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"aud": "other"}))), "", "", ErrInvalidCredentials},
+		{"no subject", bearer(sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), claims(jwt.MapClaims{"sub": nil}))), "", "", ErrInvalidCredentials},
+		{"alg none", bearer(sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, claims(nil))), "", "", ErrInvalidCredentials},
+	}
+
+	for _, tt := range authenticateTSs {
+		req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		p, err := a.Authenticate(req)
+		if !errors.Is(err, tt.expected) || p.Subject != tt.subject || p.Method != tt.method {
+			t.Errorf("ERROR -- for (%v) expected (%v %v) (%v) but got (%v %v) (%v)\n", tt.name, tt.subject, tt.method, tt.expected, p.Subject, p.Method, err)
+		}
+	}
+}
+
+// Test verified client certificates identify principals when enabled, after the headers
+func TestAuthenticateCert(t *testing.T) {
+	state := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	till := &x509.Certificate{Subject: pkix.Name{CommonName: "till-7", OrganizationalUnit: []string{"cashier"}}}
+	unnamed := &x509.Certificate{DNSNames: []string{"pos.example.com"}}
+
+	certs, _ := New(Options{ClientCerts: true, Tokens: []string{"token-one"}})
+	noCerts, _ := New(Options{Tokens: []string{"token-one"}})
+	for _, tt := range []struct {
+		name     string
+		a        *Authenticator
+		tls      *tls.ConnectionState
+		headers  map[string]string
+		subject  string
+		expected error
+	}{
+		{"certificate", certs, state(till), nil, "till-7", nil},
+		{"DNS name", certs, state(unnamed), nil, "pos.example.com", nil},
+		{"no subject", certs, state(&x509.Certificate{}), nil, "", ErrInvalidCredentials},
+		{"unverified", certs, &tls.ConnectionState{PeerCertificates: []*x509.Certificate{till}}, nil, "", ErrNoCredentials},
+		{"headers first", certs, state(till), map[string]string{"Authorization": "Bearer token-one"}, "token-1", nil},
+		{"not enabled", noCerts, state(till), nil, "", ErrNoCredentials},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+		req.TLS = tt.tls
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		p, err := tt.a.Authenticate(req)
+		if !errors.Is(err, tt.expected) || p.Subject != tt.subject {
+			t.Errorf("ERROR -- for (%v) expected (%v) (%v) but got (%v) (%v)\n", tt.name, tt.subject, tt.expected, p.Subject, err)
+		}
+		if tt.name == "certificate" && (p.Method != MethodCert || !reflect.DeepEqual(p.Roles, []string{"cashier"})) {
+			t.Errorf("ERROR -- expected (%v [cashier]) but got (%v %v)\n", MethodCert, p.Method, p.Roles)
+		}
+	}
+}
+
+// Test bad JWKS files and static secrets are refused
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, jwks := range []string{
+		`{"keys": []}`,
+		`{"keys": [{"kty": "oct", "kid": "1", "k": "c2VjcmV0"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "1", "n": "!!", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "1", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": [`,
+	} {
+		path := filepath.Join(dir, "jwks.json")
+		os.WriteFile(path, []byte(jwks), 0o644)
+		if _, err := New(Options{JWKSFile: path}); err == nil {
+			t.Errorf("ERROR -- expected an error for (%v)\n", jwks)
+		}
+	}
+	if _, err := New(Options{APIKeys: []string{"sha256:1234"}}); err == nil {
+		t.Errorf("ERROR -- expected an error for a short hash\n")
+	}
+}
+
+// Test the key store keeps hashes, not keys, in its file
+func TestKeyStoreFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	keys := NewKeyStore()
+	if err := keys.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	first, firstSecret, _ := keys.Create("first", []string{"cashier"}, "")
+	second, secondSecret, _ := keys.Create("second", []string{"cashier"}, "")
+	keys.Revoke(first.ID)
+	if _, err := keys.Revoke(first.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrKeyNotFound, err)
+	}
+
+	b, _ := os.ReadFile(path)
+	if len(secondSecret) != len(keyPrefix)+64 || !json.Valid(b) ||
+		strings.Contains(string(b), firstSecret) || strings.Contains(string(b), secondSecret) {
+		t.Errorf("ERROR -- unexpected key file (%s)\n", b)
+	}
+
+	reopened := NewKeyStore()
+	if err := reopened.Open(path); err != nil {
+		t.Fatal(err)
+	}
+	if k, ok := reopened.Lookup(secondSecret); !ok || !reflect.DeepEqual(k, second) {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", second, k, ok)
+	}
+	if _, ok := reopened.Lookup(firstSecret); ok {
+		t.Errorf("ERROR -- expected the revoked key to be refused\n")
+	}
+	if list := reopened.List(); len(list) != 1 || !reflect.DeepEqual(list[0], second) {
+		t.Errorf("ERROR -- expected ([%v]) but got (%v)\n", second, list)
+	}
+
+	// Only the keys bound to a store are revoked with it
+	till, tillSecret, _ := reopened.Create("till", []string{"cashier"}, "north")
+	if revoked, err := reopened.RevokeStore("north"); err != nil || len(revoked) != 1 || !reflect.DeepEqual(revoked[0], till) {
+		t.Errorf("ERROR -- expected ([%v]) but got (%v) (%v)\n", till, revoked, err)
+	}
+	if revoked, err := reopened.RevokeStore(""); err != nil || len(revoked) != 0 {
+		t.Errorf("ERROR -- expected nothing revoked but got (%v) (%v)\n", revoked, err)
+	}
+	if _, ok := reopened.Lookup(tillSecret); ok {
+		t.Errorf("ERROR -- expected the store's key to be refused\n")
+	}
+	if _, ok := reopened.Lookup(secondSecret); !ok {
+		t.Errorf("ERROR -- expected the unbound key to be kept\n")
+	}
+}
+
+// Test the middleware puts the principal in the request context and refuses everyone else
+func TestMiddleware(t *testing.T) {
+	a, _ := New(Options{Tokens: []string{"token-one"}})
+	e := echo.New()
+	e.Use(Middleware(a, func(c echo.Context) bool { return c.Path() == "/healthz" }))
+	e.GET("/whoami", func(c echo.Context) error {
+		p, ok := FromContext(c.Request().Context())
+		if !ok {
+			return c.String(http.StatusInternalServerError, "no principal")
+		}
+		return c.String(http.StatusOK, p.Subject)
+	})
+	e.GET("/healthz", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodGet, "/whoami", nil)
+	req.Header.Set("Authorization", "Bearer token-one")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != "token-1" {
+		t.Errorf("ERROR -- expected (200 token-1) but got (%v %v)\n", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/whoami", nil))
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(echo.HeaderWWWAuthenticate) == "" {
+		t.Errorf("ERROR -- expected (401) with a challenge but got (%v) (%v)\n", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("ERROR -- expected (200) but got (%v)\n", rec.Code)
+	}
+}
+
+// Test roles grant their permissions and nothing else
+func TestRoles(t *testing.T) {
+	defer SetRoles(nil)
+	if err := SetRoles(map[string][]string{"cashier": {"produce:sell"}}); err == nil {
+		t.Errorf("ERROR -- expected an error for an unknown permission\n")
+	}
+	if err := SetRoles(map[string][]string{"cashier": {PermProduceRead}, "stocker": {PermProduceWrite}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		roles      []string
+		permission string
+		expected   bool
+	}{
+		{[]string{"cashier"}, PermProduceRead, true},
+		{[]string{"cashier"}, PermProduceWrite, false},
+		{[]string{"cashier", "stocker"}, PermProduceWrite, true},
+		{[]string{"manager"}, PermProduceRead, false}, // No longer a role
+		{nil, PermProduceRead, false},
+	} {
+		if got := (Principal{Roles: tt.roles}).Can(tt.permission); got != tt.expected {
+			t.Errorf("ERROR -- for (%v %v) expected (%v) but got (%v)\n", tt.roles, tt.permission, tt.expected, got)
+		}
+	}
+	if names := RoleNames(); strings.Join(names, ",") != "cashier,stocker" || !KnownRole("stocker") || KnownRole("manager") {
+		t.Errorf("ERROR -- expected (cashier,stocker) but got (%v)\n", names)
+	}
+
+	// JWT roles may be an array or a space separated string, in the configured claim
+	a, _ := New(Options{JWTSecret: testSecret, RolesClaim: "groups"})
+	for _, groups := range []any{[]string{"cashier", "stocker"}, "cashier stocker"} {
+		token := sign(t, jwt.SigningMethodHS256, "", []byte(testSecret), jwt.MapClaims{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix(), "groups": groups})
+		req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		p, err := a.Authenticate(req)
+		if err != nil || strings.Join(p.Roles, ",") != "cashier,stocker" {
+			t.Errorf("ERROR -- for (%v) expected (cashier,stocker) but got (%v) (%v)\n", groups, p.Roles, err)
+		}
+	}
+}
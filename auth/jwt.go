@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Clock skew allowed when checking exp, nbf and iat
+const leeway = 30 * time.Second
+
+// Checks JWTs against an HMAC secret and the public keys of a JWKS file
+type jwtVerifier struct {
+	parser     *jwt.Parser
+	rolesClaim string
+	storeClaim string
+	secret     []byte
+	keys       map[string]crypto.PublicKey // By kid
+}
+
+func newJWTVerifier(options Options) (*jwtVerifier, error) {
+	v := &jwtVerifier{keys: map[string]crypto.PublicKey{}, rolesClaim: options.RolesClaim}
+	if v.rolesClaim == "" {
+		v.rolesClaim = DefaultRolesClaim
+	}
+	if v.storeClaim = options.StoreClaim; v.storeClaim == "" {
+		v.storeClaim = DefaultStoreClaim
+	}
+	methods := []string{}
+	if options.JWTSecret != "" {
+		v.secret = []byte(options.JWTSecret)
+		methods = append(methods, "HS256", "HS384", "HS512")
+	}
+	if options.JWKSFile != "" {
+		keys, err := ReadJWKS(options.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		methods = append(methods, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512")
+	}
+
+	parserOptions := []jwt.ParserOption{jwt.WithValidMethods(methods), jwt.WithExpirationRequired(), jwt.WithLeeway(leeway), jwt.WithIssuedAt()}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+	v.parser = jwt.NewParser(parserOptions...)
+	return v, nil
+}
+
+// Principal for a valid token - ErrInvalidCredentials otherwise
+func (v *jwtVerifier) verify(token string) (Principal, error) {
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.key); err != nil {
+		logger.Debug("verify - rejected a JWT", "error", err)
+		return Principal{}, ErrInvalidCredentials
+	}
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		logger.Debug("verify - rejected a JWT without a subject")
+		return Principal{}, ErrInvalidCredentials
+	}
+	store, _ := claims[v.storeClaim].(string)
+	return Principal{Subject: subject, Method: MethodJWT, Roles: claimRoles(claims[v.rolesClaim]), Store: store, Claims: claims}, nil
+}
+
+// Roles in a claim that is an array of strings or a space separated string
+func claimRoles(claim any) []string {
+	roles := []string{}
+	switch claim := claim.(type) {
+	case string:
+		roles = strings.Fields(claim)
+	case []any:
+		for _, role := range claim {
+			if role, ok := role.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
+
+// Key to check token's signature with - the secret for HMAC, otherwise the JWKS key named by its kid
+func (v *jwtVerifier) key(token *jwt.Token) (any, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		return v.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key with kid (%s)", kid)
+	}
+	switch key.(type) {
+	case *rsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+			return nil, fmt.Errorf("key (%s) is RSA but the token is %s", kid, token.Method.Alg())
+		}
+	case *ecdsa.PublicKey:
+		if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+			return nil, fmt.Errorf("key (%s) is EC but the token is %s", kid, token.Method.Alg())
+		}
+	}
+	return key, nil
+}
+
+// A JSON Web Key - only the members of RSA and EC public keys are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Read the RSA and EC public keys of the JSON Web Key Set at path, by kid
+// Keys for uses other than signatures are skipped
+func ReadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, errors.New(path + ": " + err.Error())
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %d (%s): %w", path, i+1, k.Kid, err)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("%s: key %d: kid (%s) is used twice", path, i+1, k.Kid)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New(path + ": no signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64Int(k.N)
+		if err != nil {
+			return nil, errors.New("bad n")
+		}
+		e, err := base64Int(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("bad e")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported crv (%s)", k.Crv)
+		}
+		x, errX := base64Int(k.X)
+		y, errY := base64Int(k.Y)
+		if errX != nil || errY != nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New("bad x or y")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported kty (%s)", k.Kty)
+	}
+}
+
+// Big-endian unsigned integer encoded as unpadded base64url
+func base64Int(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("bad integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of every managed API key, so leaked keys are easy to spot
+const keyPrefix = "pdk_"
+
+// Returned by KeyStore.Revoke
+var ErrKeyNotFound = errors.New("API key not found")
+
+// Keys is the store of managed API keys used by the admin endpoints
+var Keys = NewKeyStore()
+
+// Key describes a managed API key - the key itself is only known when it is created
+type Key struct {
+	ID      string    `json:"ID"`
+	Name    string    `json:"Name"`
+	Roles   []string  `json:"Roles"`
+	Store   string    `json:"Store,omitempty"` // Tenant the key is bound to - empty for any
+	Created time.Time `json:"Created"`
+}
+
+// A key as it is kept - only the SHA-256 hash of the secret is stored
+type storedKey struct {
+	Key
+	Hash string `json:"Hash"`
+}
+
+// KeyStore holds managed API keys, optionally kept in a file
+type KeyStore struct {
+	mutex  *sync.RWMutex
+	keys   map[string]storedKey // By ID
+	byHash map[string]string    // ID by hash
+	path   string               // File written after every change - empty to keep the keys in memory
+}
+
+// Create an empty KeyStore held in memory
+func NewKeyStore() *KeyStore {
+	return &KeyStore{mutex: &sync.RWMutex{}, keys: map[string]storedKey{}, byHash: map[string]string{}}
+}
+
+// Keep the keys in the file at path, replacing the current keys with those in the file if it exists
+func (s *KeyStore) Open(path string) error {
+	stored := []storedKey{}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &stored); err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys = map[string]storedKey{}
+	s.byHash = map[string]string{}
+	for _, k := range stored {
+		s.keys[k.ID] = k
+		s.byHash[k.Hash] = k.ID
+	}
+	s.path = path
+	return s.save()
+}
+
+// Create a key named name with roles, bound to store if it is set
+// Returns its description and the key, which is not kept
+func (s *KeyStore) Create(name string, roles []string, store string) (Key, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, "", err
+	}
+	secret := keyPrefix + hex.EncodeToString(b)
+	id := make([]byte, 6)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, "", err
+	}
+
+	k := storedKey{
+		Key:  Key{ID: "key-" + hex.EncodeToString(id), Name: name, Roles: roles, Store: store, Created: time.Now().UTC().Truncate(time.Second)},
+		Hash: hex.EncodeToString(hash(secret)),
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.keys[k.ID] = k
+	s.byHash[k.Hash] = k.ID
+	if err := s.save(); err != nil {
+		delete(s.keys, k.ID)
+		delete(s.byHash, k.Hash)
+		return Key{}, "", err
+	}
+	return k.Key, secret, nil
+}
+
+// Every key, oldest first
+func (s *KeyStore) List() []Key {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	keys := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k.Key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].Created.Before(keys[j].Created)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys
+}
+
+// Revoke the key with id - returns what was revoked, or ErrKeyNotFound
+func (s *KeyStore) Revoke(id string) (Key, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return Key{}, ErrKeyNotFound
+	}
+	delete(s.keys, id)
+	delete(s.byHash, k.Hash)
+	if err := s.save(); err != nil {
+		s.keys[id] = k
+		s.byHash[k.Hash] = id
+		return Key{}, err
+	}
+	return k.Key, nil
+}
+
+// Revoke every key bound to store - returns what was revoked, oldest first
+// Keys bound to no store are left alone
+func (s *KeyStore) RevokeStore(store string) ([]Key, error) {
+	if store == "" {
+		return nil, nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	revoked := []storedKey{}
+	for id, k := range s.keys {
+		if k.Store == store {
+			revoked = append(revoked, k)
+			delete(s.keys, id)
+			delete(s.byHash, k.Hash)
+		}
+	}
+	if len(revoked) == 0 {
+		return nil, nil
+	}
+	if err := s.save(); err != nil {
+		for _, k := range revoked {
+			s.keys[k.ID] = k
+			s.byHash[k.Hash] = k.ID
+		}
+		return nil, err
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		if !revoked[i].Created.Equal(revoked[j].Created) {
+			return revoked[i].Created.Before(revoked[j].Created)
+		}
+		return revoked[i].ID < revoked[j].ID
+	})
+	keys := make([]Key, 0, len(revoked))
+	for _, k := range revoked {
+		keys = append(keys, k.Key)
+	}
+	return keys, nil
+}
+
+// Key whose secret is secret, if there is one
+// Keys are found by the hash of secret so the time taken reveals nothing about the keys
+func (s *KeyStore) Lookup(secret string) (Key, bool) {
+	if !strings.HasPrefix(secret, keyPrefix) {
+		return Key{}, false
+	}
+	h := hex.EncodeToString(hash(secret))
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	id, ok := s.byHash[h]
+	if !ok {
+		return Key{}, false
+	}
+	return s.keys[id].Key, true
+}
+
+// Write the keys to the file, if there is one - the mutex must be held
+func (s *KeyStore) save() error {
+	if s.path == "" {
+		return nil
+	}
+	stored := make([]storedKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		stored = append(stored, k)
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].ID < stored[j].ID })
+	b, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(s.path, b)
+}
+
+// Write b to path through a temporary file, so the file is never left half written
+// The file is only readable by its owner
+func writeFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+strings.TrimPrefix(filepath.Base(path), ".")+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
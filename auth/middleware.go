@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"example.com/produce_demo/logging"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var logger = logging.For("auth")
+
+// Require credentials accepted by a on every request that skip does not pass
+// The principal is added to the request's context, its logs and its span
+func Middleware(a *Authenticator, skip func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skip != nil && skip(c) {
+				return next(c)
+			}
+			ctx := c.Request().Context()
+			p, err := a.Authenticate(c.Request())
+			if err != nil {
+				if errors.Is(err, ErrInvalidCredentials) {
+					logger.InfoContext(ctx, "Middleware - rejected credentials", "remote", c.RealIP())
+				}
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="produce_demo"`)
+				return c.JSON(http.StatusUnauthorized, map[string]string{"Error": "Unauthorized"}) // Returns 401
+			}
+
+			ctx = logging.WithPrincipal(WithPrincipal(ctx, p), p.Subject)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("enduser.id", p.Subject), attribute.String("enduser.auth_method", p.Method))
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"example.com/produce_demo/problem"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Permissions
+const (
+	PermProduceRead   = "produce:read"   // Fetch produce
+	PermProduceWrite  = "produce:write"  // Add, update and import produce
+	PermProduceDelete = "produce:delete" // Delete produce
+	PermAdmin         = "admin"          // Export, restore, log levels and API keys
+)
+
+// Every permission
+var Permissions = []string{PermProduceRead, PermProduceWrite, PermProduceDelete, PermAdmin}
+
+// Permissions of each role unless SetRoles is given others
+func DefaultRoles() map[string][]string {
+	return map[string][]string{
+		"cashier": {PermProduceRead},
+		"buyer":   {PermProduceRead, PermProduceWrite},
+		"manager": {PermProduceRead, PermProduceWrite, PermProduceDelete},
+		"admin":   {PermProduceRead, PermProduceWrite, PermProduceDelete, PermAdmin},
+	}
+}
+
+var (
+	rolesMutex = &sync.RWMutex{}
+	roles      = permissionSets(DefaultRoles())
+)
+
+func permissionSets(roleMap map[string][]string) map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(roleMap))
+	for role, permissions := range roleMap {
+		sets[role] = map[string]bool{}
+		for _, permission := range permissions {
+			sets[role][permission] = true
+		}
+	}
+	return sets
+}
+
+// Replace the permissions of every role - nil restores DefaultRoles
+func SetRoles(roleMap map[string][]string) error {
+	if roleMap == nil {
+		roleMap = DefaultRoles()
+	}
+	for role, permissions := range roleMap {
+		if strings.TrimSpace(role) == "" {
+			return fmt.Errorf("role names must not be blank")
+		}
+		for _, permission := range permissions {
+			if !knownPermission(permission) {
+				return fmt.Errorf("role %s: unknown permission (%s)", role, permission)
+			}
+		}
+	}
+	rolesMutex.Lock()
+	defer rolesMutex.Unlock()
+	roles = permissionSets(roleMap)
+	return nil
+}
+
+func knownPermission(permission string) bool {
+	for _, p := range Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether role has been given permissions
+func KnownRole(role string) bool {
+	rolesMutex.RLock()
+	defer rolesMutex.RUnlock()
+	_, ok := roles[role]
+	return ok
+}
+
+// Names of the roles, sorted
+func RoleNames() []string {
+	rolesMutex.RLock()
+	defer rolesMutex.RUnlock()
+	names := make([]string, 0, len(roles))
+	for role := range roles {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reports whether any of p's roles has permission
+// Roles that are not known grant nothing
+func (p Principal) Can(permission string) bool {
+	rolesMutex.RLock()
+	defer rolesMutex.RUnlock()
+	for _, role := range p.Roles {
+		if roles[role][permission] {
+			return true
+		}
+	}
+	return false
+}
+
+// Refuse requests whose principal lacks permission with a 403 problem
+// Requests without a principal pass - they were let through because authentication is off
+func Require(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := FromContext(c.Request().Context())
+			if !ok || p.Can(permission) {
+				return next(c)
+			}
+			logger.InfoContext(c.Request().Context(), "Require - forbidden", "permission", permission, "roles", p.Roles)
+			return problem.Write(c, http.StatusForbidden, "The "+permission+" permission is required") // Returns 403
+		}
+	}
+}
+
+// Refuse requests whose principal is bound to a store with a 403 problem - for routes that
+// reach beyond one store's catalog, such as the server wide admin routes
+// Requests without a principal pass - they were let through because authentication is off
+func RequireUnbound() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := FromContext(c.Request().Context())
+			if !ok || p.Store == "" {
+				return next(c)
+			}
+			logger.InfoContext(c.Request().Context(), "RequireUnbound - forbidden", "boundStore", p.Store)
+			return problem.Write(c, http.StatusForbidden, "Credentials bound to store "+p.Store+" may not be used here") // Returns 403
+		}
+	}
+}
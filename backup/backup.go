@@ -0,0 +1,636 @@
+// Catalog export and restore archives
+//
+// An archive is a gzipped tar file holding:
+//
+//	manifest.json            - the archive format Version, when it was Created and the Counts of each section
+//	produce.json             - every Produce in the default catalog
+//	inventory.json           - the movements, purchase orders and lots of the default catalog
+//	categories.json          - the categories shared by every catalog
+//	suppliers.json           - the suppliers shared by every catalog
+//	supplier-items.json      - the items each supplier sells
+//	stores.json              - the stores (tenants)
+//	stores/<ID>/produce.json   - every Produce in a store's catalog
+//	stores/<ID>/inventory.json - the movements, purchase orders and lots of a store's catalog
+//
+// Version 1 archives hold only manifest.json and produce.json, and restore only the default catalog
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+	"example.com/produce_demo/logging"
+)
+
+var logger = logging.For("backup")
+
+// Archive format written by Export
+// Bump this (and migrate older versions in Read) when the archive layout changes
+const FormatVersion = 2
+
+// Archive member names - each store's members are under storesDir
+const (
+	manifestName      = "manifest.json"
+	produceName       = "produce.json"
+	inventoryName     = "inventory.json"
+	categoriesName    = "categories.json"
+	suppliersName     = "suppliers.json"
+	supplierItemsName = "supplier-items.json"
+	storesName        = "stores.json"
+	storesDir         = "stores/"
+)
+
+// Largest archive member Read will accept
+const maxMemberBytes = 512 * 1024 * 1024
+
+// Manifest describes an archive
+type Manifest struct {
+	Version int            `json:"Version"`
+	Created time.Time      `json:"Created"`
+	Counts  map[string]int `json:"Counts"`
+}
+
+// A decoded archive
+type Archive struct {
+	Manifest      Manifest
+	Produce       []common.Produce     // Default catalog
+	Inventory     db.InventorySnapshot // Of the default catalog
+	Categories    []db.Category
+	Suppliers     []db.Supplier
+	SupplierItems []db.SupplierItem
+	Stores        []Store
+}
+
+// Store is a tenant in an archive with its catalog
+type Store struct {
+	db.Tenant
+	Produce   []common.Produce
+	Inventory db.InventorySnapshot
+}
+
+// What a restore changes - Produce Codes of each kind of change to the default catalog, and of
+// each store's catalog in Stores
+type Changes struct {
+	Added         []string           `json:"Added"`
+	Updated       []string           `json:"Updated"`
+	Removed       []string           `json:"Removed"`
+	Unchanged     int                `json:"Unchanged"`
+	Stores        map[string]Changes `json:"Stores,omitempty"`
+	StoresAdded   []string           `json:"Stores Added,omitempty"`
+	StoresRemoved []string           `json:"Stores Removed,omitempty"`
+}
+
+// ValidationError lists everything wrong with an archive
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid archive: " + strings.Join(e.Errors, "; ")
+}
+
+// Write a snapshot of every catalog, with the categories and suppliers they share, to w as an archive
+// Each catalog is consistent in itself
+func Export(ctx context.Context, w io.Writer) error {
+	a, err := current(ctx)
+	if err != nil {
+		return err
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	members := []struct {
+		name string
+		v    interface{}
+	}{
+		{manifestName, a.Manifest},
+		{produceName, a.Produce},
+		{inventoryName, a.Inventory},
+		{categoriesName, a.Categories},
+		{suppliersName, a.Suppliers},
+		{supplierItemsName, a.SupplierItems},
+		{storesName, tenants(a.Stores)},
+	}
+	for _, s := range a.Stores {
+		members = append(members, struct {
+			name string
+			v    interface{}
+		}{storesDir + s.ID + "/" + produceName, s.Produce}, struct {
+			name string
+			v    interface{}
+		}{storesDir + s.ID + "/" + inventoryName, s.Inventory})
+	}
+	for _, m := range members {
+		if err := writeMember(tw, m.name, a.Manifest.Created, m.v); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// Everything an archive holds as it is now
+func current(ctx context.Context) (*Archive, error) {
+	produceList, err := db.Default.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{
+		Produce:       produceList,
+		Inventory:     db.Default.Inventory().Snapshot(),
+		Categories:    db.Categories.List(),
+		Suppliers:     db.Suppliers.List(),
+		SupplierItems: db.Suppliers.Items(),
+		Stores:        []Store{},
+	}
+	for _, t := range db.Tenants.List() {
+		t, store, err := db.Tenants.Get(t.ID)
+		if err != nil {
+			continue // Deleted since it was listed
+		}
+		produceList, err := store.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		a.Stores = append(a.Stores, Store{Tenant: t, Produce: produceList, Inventory: store.Inventory().Snapshot()})
+	}
+	a.Manifest = Manifest{Version: FormatVersion, Created: time.Now().UTC(), Counts: counts(a)}
+	return a, nil
+}
+
+// Counts of each section of an archive - purchase orders, movements and lots of every catalog
+func counts(a *Archive) map[string]int {
+	c := map[string]int{
+		"Produce":         len(a.Produce),
+		"Categories":      len(a.Categories),
+		"Suppliers":       len(a.Suppliers),
+		"Supplier Items":  len(a.SupplierItems),
+		"Stores":          len(a.Stores),
+		"Purchase Orders": len(a.Inventory.Orders),
+		"Movements":       len(a.Inventory.Movements),
+		"Lots":            len(a.Inventory.Lots),
+	}
+	for _, s := range a.Stores {
+		c["Purchase Orders"] += len(s.Inventory.Orders)
+		c["Movements"] += len(s.Inventory.Movements)
+		c["Lots"] += len(s.Inventory.Lots)
+	}
+	return c
+}
+
+// Tenants of stores
+func tenants(stores []Store) []db.Tenant {
+	list := make([]db.Tenant, 0, len(stores))
+	for _, s := range stores {
+		list = append(list, s.Tenant)
+	}
+	return list
+}
+
+// Write v as a JSON archive member
+func writeMember(tw *tar.Writer, name string, modTime time.Time, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = tw.Write(b)
+	return err
+}
+
+// Read and validate an archive
+// A *ValidationError is returned if the archive was read but its contents are not valid
+func Read(r io.Reader) (*Archive, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	a := &Archive{}
+	var listed []db.Tenant
+	storeProduce := map[string][]common.Produce{}
+	storeInventory := map[string]db.InventorySnapshot{}
+	have := map[string]bool{}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case manifestName:
+			err = readMember(tr, &a.Manifest)
+		case produceName:
+			err = readMember(tr, &a.Produce)
+		case inventoryName:
+			err = readMember(tr, &a.Inventory)
+		case categoriesName:
+			err = readMember(tr, &a.Categories)
+		case suppliersName:
+			err = readMember(tr, &a.Suppliers)
+		case supplierItemsName:
+			err = readMember(tr, &a.SupplierItems)
+		case storesName:
+			err = readMember(tr, &listed)
+		default:
+			id, name, ok := strings.Cut(strings.TrimPrefix(hdr.Name, storesDir), "/")
+			switch {
+			case !strings.HasPrefix(hdr.Name, storesDir) || !ok:
+			case name == produceName:
+				produceList := []common.Produce{}
+				err = readMember(tr, &produceList)
+				storeProduce[id] = produceList
+			case name == inventoryName:
+				inventory := db.InventorySnapshot{}
+				err = readMember(tr, &inventory)
+				storeInventory[id] = inventory
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		have[hdr.Name] = true
+	}
+
+	if !have[manifestName] {
+		return nil, &ValidationError{Errors: []string{"Missing " + manifestName}}
+	}
+	if a.Manifest.Version < 1 || a.Manifest.Version > FormatVersion {
+		return nil, &ValidationError{Errors: []string{fmt.Sprintf("Unsupported archive version (%d)", a.Manifest.Version)}}
+	}
+	required := []string{produceName}
+	if a.Manifest.Version >= 2 {
+		required = append(required, inventoryName, categoriesName, suppliersName, supplierItemsName, storesName)
+		for _, t := range listed {
+			required = append(required, storesDir+t.ID+"/"+produceName, storesDir+t.ID+"/"+inventoryName)
+		}
+	}
+	missing := []string{}
+	for _, name := range required {
+		if !have[name] {
+			missing = append(missing, "Missing "+name)
+		}
+	}
+	if len(missing) != 0 {
+		return nil, &ValidationError{Errors: missing}
+	}
+
+	a.Stores = []Store{}
+	for _, t := range listed {
+		a.Stores = append(a.Stores, Store{Tenant: t, Produce: storeProduce[t.ID], Inventory: storeInventory[t.ID]})
+		delete(storeProduce, t.ID)
+		delete(storeInventory, t.ID)
+	}
+	errs := validate(a)
+	for id := range storeProduce {
+		errs = append(errs, "Store "+id+" is not in "+storesName)
+	}
+	for id := range storeInventory {
+		if _, ok := storeProduce[id]; !ok {
+			errs = append(errs, "Store "+id+" is not in "+storesName)
+		}
+	}
+	if len(errs) != 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	return a, nil
+}
+
+// Decode a JSON archive member
+func readMember(r io.Reader, v interface{}) error {
+	return json.NewDecoder(io.LimitReader(r, maxMemberBytes)).Decode(v)
+}
+
+// Check every section is valid and refers only to what the archive holds: the Category of each
+// Produce, the parent of each category, the supplier of each item and purchase order, and the
+// Produce Code of each lot. A version 1 archive's Produce is in the categories served
+func validate(a *Archive) []string {
+	if a.Manifest.Version == 1 {
+		errs := validateCatalog("", a.Produce, db.Categories.Exists)
+		if n, ok := a.Manifest.Counts["Produce"]; ok && n != len(a.Produce) {
+			errs = append(errs, fmt.Sprintf("Manifest Produce count (%d) does not match the archive (%d)", n, len(a.Produce)))
+		}
+		return errs
+	}
+
+	categories := map[string]db.Category{}
+	errs := []string{}
+	for _, c := range a.Categories {
+		if !db.ValidCategoryID(c.ID) {
+			errs = append(errs, "Bad Category ID ("+c.ID+")")
+		}
+		if _, ok := categories[c.ID]; ok {
+			errs = append(errs, "Duplicate Category ("+c.ID+")")
+		}
+		categories[c.ID] = c
+	}
+	for _, c := range a.Categories {
+		if _, ok := categories[c.Parent]; c.Parent != "" && !ok {
+			errs = append(errs, "Category "+c.ID+" has an unknown Parent ("+c.Parent+")")
+			continue
+		}
+		for parent, steps := c.Parent, 0; parent != ""; parent, steps = categories[parent].Parent, steps+1 {
+			if parent == c.ID || steps > len(categories) {
+				errs = append(errs, "Category "+c.ID+" is its own ancestor")
+				break
+			}
+		}
+	}
+	categoryExists := func(id string) bool {
+		_, ok := categories[id]
+		return ok
+	}
+
+	suppliers := map[string]bool{}
+	for _, s := range a.Suppliers {
+		if !db.ValidSupplierID(s.ID) {
+			errs = append(errs, "Bad Supplier ID ("+s.ID+")")
+		}
+		if suppliers[s.ID] {
+			errs = append(errs, "Duplicate Supplier ("+s.ID+")")
+		}
+		suppliers[s.ID] = true
+	}
+	items := map[string]bool{}
+	for _, item := range a.SupplierItems {
+		key := item.Supplier + " " + strings.ToUpper(item.ProduceCode)
+		switch {
+		case !suppliers[item.Supplier]:
+			errs = append(errs, "Supplier Item "+item.ProduceCode+" has an unknown Supplier ("+item.Supplier+")")
+		case !common.ValidateProduceCode(item.ProduceCode):
+			errs = append(errs, "Supplier Item of "+item.Supplier+" has a bad Produce Code ("+item.ProduceCode+")")
+		case !common.ValidatePrice(item.Cost):
+			errs = append(errs, "Supplier Item "+key+" has a bad Cost ("+item.Cost+")")
+		case items[key]:
+			errs = append(errs, "Duplicate Supplier Item ("+key+")")
+		}
+		items[key] = true
+	}
+
+	errs = append(errs, validateCatalog("", a.Produce, categoryExists)...)
+	errs = append(errs, validateInventory("", a.Inventory, a.Produce, suppliers)...)
+	stores := map[string]bool{}
+	for _, s := range a.Stores {
+		prefix := "Store " + s.ID + ": "
+		if !db.ValidTenantID(s.ID) {
+			errs = append(errs, "Bad Store ID ("+s.ID+")")
+		}
+		if stores[s.ID] {
+			errs = append(errs, "Duplicate Store ("+s.ID+")")
+		}
+		stores[s.ID] = true
+		if s.MaxProduce < 0 {
+			errs = append(errs, prefix+"Max Produce must not be negative")
+		}
+		errs = append(errs, validateCatalog(prefix, s.Produce, categoryExists)...)
+		errs = append(errs, validateInventory(prefix, s.Inventory, s.Produce, suppliers)...)
+	}
+
+	expected := counts(a)
+	sections := make([]string, 0, len(a.Manifest.Counts))
+	for section := range a.Manifest.Counts {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	for _, section := range sections {
+		if n := a.Manifest.Counts[section]; n != expected[section] {
+			errs = append(errs, fmt.Sprintf("Manifest %s count (%d) does not match the archive (%d)", section, n, expected[section]))
+		}
+	}
+	return errs
+}
+
+// Check every Produce of a catalog is valid, in a category that exists, and Produce Codes are unique
+func validateCatalog(prefix string, produceList []common.Produce, categoryExists func(string) bool) []string {
+	errs := []string{}
+	seen := map[string]bool{}
+	for _, p := range produceList {
+		if ok, validProduceError := common.ValidateProduceIn(p, categoryExists); !ok {
+			for _, e := range validProduceError {
+				errs = append(errs, prefix+e)
+			}
+			continue
+		}
+		key := strings.ToUpper(p.ProduceCode)
+		if seen[key] {
+			errs = append(errs, prefix+"Duplicate Produce Code ("+p.ProduceCode+")")
+		}
+		seen[key] = true
+	}
+	return errs
+}
+
+// Check the purchase orders of an inventory are from suppliers in the archive, and each lot is of
+// Produce on the purchase order it was received against - or in the catalog, if it has none
+func validateInventory(prefix string, inv db.InventorySnapshot, produceList []common.Produce, suppliers map[string]bool) []string {
+	errs := []string{}
+	orders := map[string]db.PurchaseOrder{}
+	for _, o := range inv.Orders {
+		if _, ok := orders[o.ID]; ok {
+			errs = append(errs, prefix+"Duplicate purchase order ("+o.ID+")")
+		}
+		orders[o.ID] = o
+		if !suppliers[o.Supplier] {
+			errs = append(errs, prefix+"Purchase order "+o.ID+" has an unknown Supplier ("+o.Supplier+")")
+		}
+		switch o.Status {
+		case db.OrderDraft, db.OrderSubmitted, db.OrderPartiallyReceived, db.OrderReceived, db.OrderCancelled:
+		default:
+			errs = append(errs, prefix+"Purchase order "+o.ID+" has a bad Status ("+o.Status+")")
+		}
+	}
+
+	catalog := map[string]bool{}
+	for _, p := range produceList {
+		catalog[strings.ToUpper(p.ProduceCode)] = true
+	}
+	lots := map[string]bool{}
+	for _, lot := range inv.Lots {
+		produceCode := strings.ToUpper(lot.ProduceCode)
+		name := "Lot " + lot.LotNumber + " of " + lot.ProduceCode
+		if lots[produceCode+" "+lot.LotNumber] {
+			errs = append(errs, prefix+"Duplicate "+name)
+		}
+		lots[produceCode+" "+lot.LotNumber] = true
+		if lot.Remaining < 0 || lot.Remaining > lot.Quantity {
+			errs = append(errs, prefix+name+" has a bad Remaining ("+fmt.Sprint(lot.Remaining)+")")
+		}
+		if lot.Reference == "" {
+			if !catalog[produceCode] {
+				errs = append(errs, prefix+name+" is not of Produce in the catalog")
+			}
+			continue
+		}
+		o, ok := orders[lot.Reference]
+		if !ok {
+			errs = append(errs, prefix+name+" has an unknown purchase order ("+lot.Reference+")")
+			continue
+		}
+		onOrder := false
+		for _, line := range o.Lines {
+			onOrder = onOrder || strings.ToUpper(line.ProduceCode) == produceCode
+		}
+		if !onOrder {
+			errs = append(errs, prefix+name+" is not of Produce on purchase order "+o.ID)
+		}
+	}
+	return errs
+}
+
+// What restoring the archive would change, without changing anything
+func Plan(ctx context.Context, a *Archive) (Changes, error) {
+	produceList, err := db.Default.List(ctx)
+	if err != nil {
+		return Changes{}, err
+	}
+	changes := diff(produceList, a.Produce)
+	if a.Manifest.Version == 1 {
+		return changes, nil
+	}
+
+	changes.Stores = map[string]Changes{}
+	archived := map[string]bool{}
+	for _, s := range a.Stores {
+		archived[s.ID] = true
+		var produceList []common.Produce
+		if _, store, err := db.Tenants.Get(s.ID); err == nil {
+			if produceList, err = store.List(ctx); err != nil {
+				return Changes{}, err
+			}
+		} else {
+			changes.StoresAdded = append(changes.StoresAdded, s.ID)
+		}
+		changes.Stores[s.ID] = diff(produceList, s.Produce)
+	}
+	for _, t := range db.Tenants.List() {
+		if !archived[t.ID] {
+			changes.StoresRemoved = append(changes.StoresRemoved, t.ID)
+		}
+	}
+	return changes, nil
+}
+
+// Replace the catalogs, categories and suppliers with the archive's contents - stores not in the
+// archive are deleted. If that fails part way, what was there before is put back
+func Restore(ctx context.Context, a *Archive) (Changes, error) {
+	if a.Manifest.Version == 1 {
+		produceList, err := db.Default.Replace(ctx, a.Produce)
+		if err != nil {
+			return Changes{}, err
+		}
+		return diff(produceList, a.Produce), nil
+	}
+
+	before, err := current(ctx)
+	if err != nil {
+		return Changes{}, err
+	}
+	changes, err := restore(ctx, a)
+	if err != nil {
+		if _, undoErr := restore(context.WithoutCancel(ctx), before); undoErr != nil {
+			logger.ErrorContext(ctx, "Restore - failed to put back what was there before", "error", undoErr)
+		}
+		return Changes{}, err
+	}
+	return changes, nil
+}
+
+// Replace everything with the contents of a version 2 or later archive
+func restore(ctx context.Context, a *Archive) (Changes, error) {
+	if err := db.Categories.Replace(a.Categories); err != nil {
+		return Changes{}, err
+	}
+	if err := db.Suppliers.Replace(a.Suppliers, a.SupplierItems); err != nil {
+		return Changes{}, err
+	}
+	produceList, err := db.Default.Replace(ctx, a.Produce)
+	if err != nil {
+		return Changes{}, err
+	}
+	changes := diff(produceList, a.Produce)
+	if err := db.Default.Inventory().Replace(a.Inventory); err != nil {
+		return Changes{}, err
+	}
+
+	changes.Stores = map[string]Changes{}
+	archived := map[string]bool{}
+	for _, s := range a.Stores {
+		archived[s.ID] = true
+		if _, _, err := db.Tenants.Get(s.ID); err != nil {
+			changes.StoresAdded = append(changes.StoresAdded, s.ID)
+		}
+		if _, err := db.Tenants.Put(s.Tenant); err != nil {
+			return Changes{}, err
+		}
+		_, store, err := db.Tenants.Get(s.ID)
+		if err != nil {
+			return Changes{}, err
+		}
+		produceList, err := store.Replace(ctx, s.Produce)
+		if err != nil {
+			return Changes{}, err
+		}
+		changes.Stores[s.ID] = diff(produceList, s.Produce)
+		if err := store.Inventory().Replace(s.Inventory); err != nil {
+			return Changes{}, err
+		}
+	}
+	for _, t := range db.Tenants.List() {
+		if archived[t.ID] {
+			continue
+		}
+		if _, err := db.Tenants.Delete(t.ID); err != nil {
+			return Changes{}, err
+		}
+		changes.StoresRemoved = append(changes.StoresRemoved, t.ID)
+	}
+	return changes, nil
+}
+
+// Changes needed to turn the old catalog into the new one
+func diff(oldList []common.Produce, newList []common.Produce) Changes {
+	changes := Changes{Added: []string{}, Updated: []string{}, Removed: []string{}}
+
+	oldRows := map[string]common.Produce{}
+	for _, p := range oldList {
+		oldRows[strings.ToUpper(p.ProduceCode)] = p
+	}
+	for _, p := range newList {
+		key := strings.ToUpper(p.ProduceCode)
+		old, ok := oldRows[key]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, key)
+		case old != p:
+			changes.Updated = append(changes.Updated, key)
+		default:
+			changes.Unchanged++
+		}
+		delete(oldRows, key)
+	}
+	for _, p := range oldList { // NOTE: only rows not in newList are left in oldRows
+		key := strings.ToUpper(p.ProduceCode)
+		if _, ok := oldRows[key]; ok {
+			changes.Removed = append(changes.Removed, key)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,304 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+)
+
+var seedRows = []common.Produce{
+	{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+	{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
+	{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+	{ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
+}
+
+// Helper function to build an archive
+func buildArchive(t *testing.T, manifest interface{}, produceList interface{}) *bytes.Buffer {
+	b := &bytes.Buffer{}
+	gw := gzip.NewWriter(b)
+	tw := tar.NewWriter(gw)
+	if manifest != nil {
+		if err := writeMember(tw, manifestName, time.Now(), manifest); err != nil {
+			t.Fatalf("ERROR -- writing manifest (%v)\n", err)
+		}
+	}
+	if produceList != nil {
+		if err := writeMember(tw, produceName, time.Now(), produceList); err != nil {
+			t.Fatalf("ERROR -- writing produce (%v)\n", err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return b
+}
+
+// Verify an exported archive reads back the same catalog
+func TestExportRead(t *testing.T) {
+	db.Replace(seedRows)
+
+	b := &bytes.Buffer{}
+	if err := Export(context.Background(), b); err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+
+	a, err := Read(b)
+	if err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+	if a.Manifest.Version != FormatVersion || a.Manifest.Counts["Produce"] != len(seedRows) {
+		t.Errorf("ERROR -- unexpected manifest (%+v)\n", a.Manifest)
+	}
+	if !reflect.DeepEqual(seedRows, a.Produce) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", seedRows, a.Produce)
+	}
+}
+
+// Put back an empty default inventory, no categories, suppliers or stores, and seedRows
+func reset() {
+	db.Categories.Replace(nil)
+	db.Suppliers.Replace(nil, nil)
+	db.Default.Inventory().Replace(db.InventorySnapshot{})
+	for _, tenant := range db.Tenants.List() {
+		db.Tenants.Delete(tenant.ID)
+	}
+	db.Replace(seedRows)
+}
+
+// Verify an archive of every catalog, with its categories, suppliers and stock, restores on an
+// instance that has none of them
+func TestExportRestoreAll(t *testing.T) {
+	reset()
+	t.Cleanup(reset)
+	ctx := context.Background()
+	if _, err := db.Categories.Create(db.Category{ID: "fruit", Name: "Fruit"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Categories.Create(db.Category{ID: "stone-fruit", Name: "Stone Fruit", Parent: "fruit"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Suppliers.Create(db.Supplier{ID: "orchard", Name: "Orchard Farms"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Suppliers.SetItem(db.SupplierItem{Supplier: "orchard", ProduceCode: "E5T6-9UI3-TH15-QR88", Cost: "1.25"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Default.Update(ctx, common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99", Category: "stone-fruit"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Tenants.Create(db.Tenant{ID: "north", Name: "North", MaxProduce: 10}); err != nil {
+		t.Fatal(err)
+	}
+	_, north, _ := db.Tenants.Get("north")
+	if _, err := north.Add(ctx, common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "3.19", Category: "stone-fruit"}); err != nil {
+		t.Fatal(err)
+	}
+	order, err := north.Inventory().CreateOrder("orchard", []db.OrderLine{{ProduceCode: "E5T6-9UI3-TH15-QR88", Ordered: 10, Cost: "1.25"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	north.Inventory().SubmitOrder(order.ID)
+	if _, err := north.Inventory().ReceiveOrder(order.ID, []db.ReceiptLine{{ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: 6, LotNumber: "L-1", BestBefore: "2031-01-01"}}, "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := current(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err := Export(ctx, b); err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+	a, err := Read(b)
+	if err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+	expectedCounts := map[string]int{"Produce": 4, "Categories": 2, "Suppliers": 1, "Supplier Items": 1, "Stores": 1, "Purchase Orders": 1, "Movements": 1, "Lots": 1}
+	if !reflect.DeepEqual(expectedCounts, a.Manifest.Counts) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", expectedCounts, a.Manifest.Counts)
+	}
+
+	reset()
+	changes, err := Restore(ctx, a)
+	if err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+	if !reflect.DeepEqual([]string{"north"}, changes.StoresAdded) || len(changes.Stores["north"].Added) != 1 || !reflect.DeepEqual([]string{"E5T6-9UI3-TH15-QR88"}, changes.Updated) {
+		t.Errorf("ERROR -- unexpected changes (%+v)\n", changes)
+	}
+	restored, err := current(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported.Manifest, restored.Manifest = Manifest{}, Manifest{}
+	expected, _ := json.Marshal(exported)
+	got, _ := json.Marshal(restored)
+	if !bytes.Equal(expected, got) {
+		t.Errorf("ERROR -- expected (%s) but got (%s)\n", expected, got)
+	}
+
+	// Stores not in the archive are removed
+	db.Tenants.Create(db.Tenant{ID: "south", Name: "South"})
+	changes, _ = Plan(ctx, a)
+	if !reflect.DeepEqual([]string{"south"}, changes.StoresRemoved) || len(changes.StoresAdded) != 0 {
+		t.Errorf("ERROR -- Plan expected (%v) removed but got (%+v)\n", "south", changes)
+	}
+	Restore(ctx, a)
+	if _, _, err := db.Tenants.Get("south"); !errors.Is(err, db.ErrTenantNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", db.ErrTenantNotFound, err)
+	}
+}
+
+// Helper function to build a version 2 archive of a, with manifest counts that match it
+func buildArchiveV2(t *testing.T, a *Archive) *bytes.Buffer {
+	a.Manifest = Manifest{Version: 2, Counts: counts(a)}
+	b := &bytes.Buffer{}
+	gw := gzip.NewWriter(b)
+	tw := tar.NewWriter(gw)
+	members := map[string]interface{}{
+		manifestName:      a.Manifest,
+		produceName:       a.Produce,
+		inventoryName:     a.Inventory,
+		categoriesName:    a.Categories,
+		suppliersName:     a.Suppliers,
+		supplierItemsName: a.SupplierItems,
+		storesName:        tenants(a.Stores),
+	}
+	for _, s := range a.Stores {
+		members[storesDir+s.ID+"/"+produceName] = s.Produce
+		members[storesDir+s.ID+"/"+inventoryName] = s.Inventory
+	}
+	for name, v := range members {
+		if err := writeMember(tw, name, time.Now(), v); err != nil {
+			t.Fatalf("ERROR -- writing %s (%v)\n", name, err)
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return b
+}
+
+// readTestStruct
+type rTS struct {
+	name           string
+	archive        func(t *testing.T) *bytes.Buffer
+	expectedErrors []string // nil when the archive could not be read at all
+}
+
+// readTestStructs: test cases
+var rTSs = []rTS{
+	{"not gzip", func(t *testing.T) *bytes.Buffer { return bytes.NewBufferString("produce") }, nil},
+	{"missing manifest", func(t *testing.T) *bytes.Buffer { return buildArchive(t, nil, seedRows) },
+		[]string{"Missing manifest.json"}},
+	{"missing produce", func(t *testing.T) *bytes.Buffer { return buildArchive(t, Manifest{Version: 1}, nil) },
+		[]string{"Missing produce.json"}},
+	{"newer version", func(t *testing.T) *bytes.Buffer {
+		return buildArchive(t, Manifest{Version: FormatVersion + 1}, seedRows)
+	},
+		[]string{"Unsupported archive version (3)"}},
+	{"bad produce", func(t *testing.T) *bytes.Buffer { return buildArchive(t, Manifest{Version: 1}, "produce") }, nil},
+	{"invalid produce", func(t *testing.T) *bytes.Buffer {
+		return buildArchive(t, Manifest{Version: 1, Counts: map[string]int{"Produce": 4}}, []common.Produce{
+			{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+			{ProduceCode: "a12t-4gh7-qpl9-3n4m", Name: "Lettuce", UnitPrice: "3.46"},
+			{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: " Peach", UnitPrice: "2.99"},
+		})
+	}, []string{
+		"Duplicate Produce Code (a12t-4gh7-qpl9-3n4m)",
+		"Detected error for Produce Name ( Peach)",
+		"Manifest Produce count (4) does not match the archive (3)",
+	}},
+	{"missing members", func(t *testing.T) *bytes.Buffer { return buildArchive(t, Manifest{Version: 2}, seedRows) }, []string{
+		"Missing inventory.json", "Missing categories.json", "Missing suppliers.json", "Missing supplier-items.json", "Missing stores.json",
+	}},
+	{"bad references", func(t *testing.T) *bytes.Buffer {
+		return buildArchiveV2(t, &Archive{
+			Produce:       []common.Produce{{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46", Category: "greens"}},
+			Categories:    []db.Category{{ID: "fruit", Name: "Fruit", Parent: "plants"}},
+			SupplierItems: []db.SupplierItem{{Supplier: "orchard", ProduceCode: "A12T-4GH7-QPL9-3N4M", Cost: "1.00"}},
+			Stores: []Store{{Tenant: db.Tenant{ID: "north", Name: "North"}, Inventory: db.InventorySnapshot{
+				Orders: []db.PurchaseOrder{{ID: "PO-000001", Supplier: "orchard", Status: db.OrderReceived, Lines: []db.OrderLine{{ProduceCode: "E5T6-9UI3-TH15-QR88", Ordered: 1}}}},
+				Lots: []db.Lot{
+					{ProduceCode: "A12T-4GH7-QPL9-3N4M", LotNumber: "L-1", Quantity: 1, Remaining: 1, Reference: "PO-000001"},
+					{ProduceCode: "A12T-4GH7-QPL9-3N4M", LotNumber: "L-2", Quantity: 1, Remaining: 2},
+				},
+			}}},
+		})
+	}, []string{
+		"Category fruit has an unknown Parent (plants)",
+		"Supplier Item A12T-4GH7-QPL9-3N4M has an unknown Supplier (orchard)",
+		"Produce Category (greens) not found",
+		"Store north: Purchase order PO-000001 has an unknown Supplier (orchard)",
+		"Store north: Lot L-1 of A12T-4GH7-QPL9-3N4M is not of Produce on purchase order PO-000001",
+		"Store north: Lot L-2 of A12T-4GH7-QPL9-3N4M has a bad Remaining (2)",
+		"Store north: Lot L-2 of A12T-4GH7-QPL9-3N4M is not of Produce in the catalog",
+	}},
+}
+
+// Verify Read rejects bad archives
+func TestReadErrors(t *testing.T) {
+	for _, tt := range rTSs {
+		_, err := Read(tt.archive(t))
+		if err == nil {
+			t.Errorf("ERROR -- for (%v) expected an error\n", tt.name)
+			continue
+		}
+		var validationError *ValidationError
+		isValidationError := errors.As(err, &validationError)
+		if tt.expectedErrors == nil && isValidationError {
+			t.Errorf("ERROR -- for (%v) expected a read error but got (%v)\n", tt.name, err)
+		}
+		if tt.expectedErrors != nil && (!isValidationError || !reflect.DeepEqual(tt.expectedErrors, validationError.Errors)) {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", tt.name, tt.expectedErrors, err)
+		}
+	}
+}
+
+// Verify Plan reports changes without making them and Restore makes them
+func TestPlanRestore(t *testing.T) {
+	db.Replace(seedRows)
+
+	restoreRows := []common.Produce{
+		{ProduceCode: "a12t-4gh7-qpl9-3n4m", Name: "Lettuce", UnitPrice: "3.46"},
+		{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "3.19"},
+		{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+		{ProduceCode: "AAAA-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"},
+	}
+	a, err := Read(buildArchive(t, Manifest{Version: 1}, restoreRows))
+	if err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+	expected := Changes{
+		Added:     []string{"AAAA-1111-2222-3333"},
+		Updated:   []string{"A12T-4GH7-QPL9-3N4M", "E5T6-9UI3-TH15-QR88"},
+		Removed:   []string{"YRT6-72AS-K736-L4AR"},
+		Unchanged: 1,
+	}
+
+	changes, _ := Plan(context.Background(), a)
+	if !reflect.DeepEqual(expected, changes) {
+		t.Errorf("ERROR -- Plan expected (%+v) but got (%+v)\n", expected, changes)
+	}
+	if rows := db.Snapshot(); !reflect.DeepEqual(seedRows, rows) {
+		t.Errorf("ERROR -- Plan changed the catalog to (%v)\n", rows)
+	}
+
+	changes, _ = Restore(context.Background(), a)
+	if !reflect.DeepEqual(expected, changes) {
+		t.Errorf("ERROR -- Restore expected (%+v) but got (%+v)\n", expected, changes)
+	}
+	rows := db.Snapshot()
+	if len(rows) != len(restoreRows) || rows[0] != restoreRows[0] {
+		t.Errorf("ERROR -- Restore expected (%v) but got (%v)\n", restoreRows, rows)
+	}
+}
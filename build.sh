@@ -9,6 +9,9 @@
 #go build routers/router.go
 #go run main.go
 
+# To build the command-line client
+#go build -o producectl ./cmd/producectl
+
 # To build the container
 #! /bin/bash
 #docker build -t produce_demo .
@@ -0,0 +1,202 @@
+// Go client for the Produce Demo API
+//
+// Every method takes a context.Context - cancelling it abandons the request (and any retries).
+// Errors reported by the server are returned as *Error and match the Err* values with errors.Is:
+//
+//	if errors.Is(err, client.ErrNotFound) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Server used when none is configured
+const DefaultServer = "http://127.0.0.1:8080"
+
+// Media types for request bodies
+const (
+	mimeJSON   = "application/json"
+	MIMECSV    = "text/csv"
+	MIMENDJSON = "application/x-ndjson"
+)
+
+// Default retry policy
+const (
+	DefaultMaxRetries   = 3
+	DefaultRetryWait    = 100 * time.Millisecond
+	DefaultRetryMaxWait = 5 * time.Second
+)
+
+// Client calls a Produce Demo server
+// Token (a bearer token) and APIKey are sent with every request when set
+//
+// Idempotent requests (GET, PUT, DELETE) that fail with a network error or a 429, 502, 503
+// or 504 are retried up to MaxRetries times.  The wait before each retry starts at RetryWait
+// and doubles (with jitter) up to RetryMaxWait - a server's Retry-After is used instead when given.
+type Client struct {
+	Server       string
+	Token        string
+	APIKey       string
+	HTTPClient   *http.Client
+	MaxRetries   int
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+}
+
+// Create a Client for the server (DefaultServer if empty) with the default retry policy
+func New(server string) *Client {
+	if server == "" {
+		server = DefaultServer
+	}
+	return &Client{
+		Server:       strings.TrimRight(server, "/"),
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		MaxRetries:   DefaultMaxRetries,
+		RetryWait:    DefaultRetryWait,
+		RetryMaxWait: DefaultRetryMaxWait,
+	}
+}
+
+// A request body - bytes can be resent on a retry, a stream can't
+type body struct {
+	contentType string
+	b           []byte
+	r           io.Reader
+}
+
+// JSON request body
+func jsonBody(v interface{}) (*body, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return &body{contentType: mimeJSON, b: b}, nil
+}
+
+// Send a request with the configured credentials, retrying as the retry policy allows
+func (c *Client) do(ctx context.Context, method string, path string, reqBody *body) (*http.Response, error) {
+	retryable := method == http.MethodGet || method == http.MethodPut || method == http.MethodDelete
+	if reqBody != nil && reqBody.r != nil {
+		retryable = false
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, method, path, reqBody)
+		if !retryable || attempt >= c.MaxRetries || ctx.Err() != nil || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		wait := c.backoff(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Send a single request
+func (c *Client) send(ctx context.Context, method string, path string, reqBody *body) (*http.Response, error) {
+	var r io.Reader
+	if reqBody != nil {
+		r = reqBody.r
+		if reqBody.b != nil {
+			r = bytes.NewReader(reqBody.b)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.Server+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", reqBody.contentType)
+	}
+	req.Header.Set("Accept", mimeJSON)
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// Reports whether a failed attempt is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Wait before retry number attempt (from 0): RetryWait doubled each attempt, capped at
+// RetryMaxWait, less up to half for jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.RetryWait
+	for i := 0; i < attempt && wait < c.RetryMaxWait; i++ {
+		wait *= 2
+	}
+	if c.RetryMaxWait > 0 && wait > c.RetryMaxWait {
+		wait = c.RetryMaxWait
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return wait - time.Duration(rand.Int63n(int64(wait)/2+1))
+}
+
+// Parse a Retry-After header - either seconds or an HTTP date
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Decode a successful JSON response into v (if not nil), or return the server's error
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errorFrom(resp)
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
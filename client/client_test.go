@@ -0,0 +1,128 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/common"
+	router "example.com/produce_demo/routers"
+)
+
+// Helper function to check an error is an *Error with the status code
+func verifyStatus(t *testing.T, function string, expected int, err error) {
+	var clientError *Error
+	if !errors.As(err, &clientError) || clientError.StatusCode != expected {
+		t.Errorf("ERROR -- for (%v) expected status (%v) but got (%v)\n", function, expected, err)
+	}
+}
+
+// Test the Client against a server
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+	c := New(server.URL + "/")
+	ctx := context.Background()
+
+	// List
+	produceList, err := c.ListAll(ctx)
+	if err != nil || len(produceList) != 4 {
+		t.Errorf("ERROR -- ListAll expected 4 produce but got (%v) (%v)\n", produceList, err)
+	}
+
+	// Get
+	p, err := c.Get(ctx, "a12t-4gh7-qpl9-3n4m")
+	if err != nil || p.Name != "Lettuce" {
+		t.Errorf("ERROR -- Get expected Lettuce but got (%v) (%v)\n", p, err)
+	}
+	_, err = c.Get(ctx, "ZZZZ-4GH7-QPL9-3N4M")
+	verifyStatus(t, "Get", http.StatusNotFound, err)
+	_, err = c.Get(ctx, "-ZZZZ-4GH7-QPL9-3N4M")
+	verifyStatus(t, "Get", http.StatusBadRequest, err)
+
+	// Add
+	result, err := c.AddBatch(ctx, []common.Produce{
+		{ProduceCode: "CLNT-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"},
+		{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"}})
+	if err != nil || len(result.Added) != 1 || len(result.Rejected) != 1 ||
+		result.Rejected[0].Errors[0] != "A12T-4GH7-QPL9-3N4M already exists" {
+		t.Errorf("ERROR -- AddBatch expected 1 added and 1 rejected but got (%+v) (%v)\n", result, err)
+	}
+	result, err = c.AddFrom(ctx, MIMECSV, strings.NewReader("CLNT-1111-2222-4444,Celery\n"))
+	if err != nil || len(result.Added) != 0 || len(result.Rejected) != 1 || result.Rejected[0].Line != 1 {
+		t.Errorf("ERROR -- AddFrom expected 1 rejected but got (%+v) (%v)\n", result, err)
+	}
+
+	p, err = c.Add(ctx, common.Produce{ProduceCode: "CLNT-1111-2222-4444", Name: "Celery", UnitPrice: ".45"})
+	if err != nil || p.Name != "Celery" {
+		t.Errorf("ERROR -- Add expected Celery but got (%v) (%v)\n", p, err)
+	}
+	_, err = c.Add(ctx, common.Produce{ProduceCode: "CLNT-1111-2222-4444", Name: "Celery", UnitPrice: ".45"})
+	if !errors.Is(err, ErrBadRequest) || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("ERROR -- Add expected (%v) but got (%v)\n", ErrBadRequest, err)
+	}
+	if err = c.Delete(ctx, "CLNT-1111-2222-4444"); err != nil {
+		t.Errorf("ERROR -- Delete got (%v)\n", err)
+	}
+
+	// Update
+	p, err = c.Update(ctx, common.Produce{ProduceCode: "CLNT-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "199.99"})
+	if err != nil || p.UnitPrice != "199.99" {
+		t.Errorf("ERROR -- Update expected 199.99 but got (%v) (%v)\n", p, err)
+	}
+	_, err = c.Update(ctx, common.Produce{ProduceCode: "CLNT-1111-2222-3333", Name: " Pizza Pie", UnitPrice: "199.99"})
+	verifyStatus(t, "Update", http.StatusBadRequest, err)
+
+	// Delete
+	if err = c.Delete(ctx, "CLNT-1111-2222-3333"); err != nil {
+		t.Errorf("ERROR -- Delete got (%v)\n", err)
+	}
+	verifyStatus(t, "Delete", http.StatusNotFound, c.Delete(ctx, "CLNT-1111-2222-3333"))
+
+	// Import
+	job, err := c.Import(ctx, MIMENDJSON, strings.NewReader("{\"Produce Code\": \"CLNT-1111-2222-5555\", \"Name\": \"Corn\", \"Unit Price\": \".5\"}\n"))
+	if err != nil || job.ID == "" {
+		t.Errorf("ERROR -- Import got (%+v) (%v)\n", job, err)
+	}
+	if _, err = c.ImportStatus(ctx, job.ID); err != nil {
+		t.Errorf("ERROR -- ImportStatus got (%v)\n", err)
+	}
+	_, err = c.ImportStatus(ctx, "nope")
+	verifyStatus(t, "ImportStatus", http.StatusNotFound, err)
+	_, err = c.Import(ctx, "application/json", strings.NewReader("[]"))
+	verifyStatus(t, "Import", http.StatusUnsupportedMediaType, err)
+
+	// Export
+	b := &bytes.Buffer{}
+	if err = c.Export(ctx, b); err != nil || b.Len() == 0 {
+		t.Errorf("ERROR -- Export got (%v) bytes (%v)\n", b.Len(), err)
+	}
+}
+
+// Test a success without the Produce or Import asked for is an error, not a panic
+func TestBadResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	_, err := c.Update(ctx, common.Produce{ProduceCode: "CLNT-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "199.99"})
+	if !errors.Is(err, ErrBadResponse) {
+		t.Errorf("ERROR -- Update expected (%v) but got (%v)\n", ErrBadResponse, err)
+	}
+	_, err = c.Import(ctx, MIMECSV, strings.NewReader("CLNT-1111-2222-5555,Corn,.5\n"))
+	if !errors.Is(err, ErrBadResponse) {
+		t.Errorf("ERROR -- Import expected (%v) but got (%v)\n", ErrBadResponse, err)
+	}
+	_, err = c.ImportStatus(ctx, "1")
+	if !errors.Is(err, ErrBadResponse) {
+		t.Errorf("ERROR -- ImportStatus expected (%v) but got (%v)\n", ErrBadResponse, err)
+	}
+}
@@ -0,0 +1,77 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Kinds of error reported by the server - match an *Error with errors.Is
+var (
+	ErrBadRequest      = errors.New("bad request")         // 400
+	ErrUnauthorized    = errors.New("unauthorized")        // 401
+	ErrForbidden       = errors.New("forbidden")           // 403
+	ErrNotFound        = errors.New("not found")           // 404 (and a fetch with no produce)
+	ErrNotAcceptable   = errors.New("not acceptable")      // 406
+	ErrTooLarge        = errors.New("request too large")   // 413
+	ErrUnsupportedType = errors.New("unsupported type")    // 415
+	ErrRateLimited     = errors.New("rate limited")        // 429
+	ErrUnavailable     = errors.New("service unavailable") // 503
+	ErrServer          = errors.New("server error")        // Any 5xx, 503 included
+)
+
+// Returned when the server succeeds without sending what was asked for
+var ErrBadResponse = errors.New("bad response")
+
+// Error kind for each status code
+var statusErrors = map[int]error{
+	http.StatusBadRequest:            ErrBadRequest,
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrForbidden,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusNotAcceptable:         ErrNotAcceptable,
+	http.StatusRequestEntityTooLarge: ErrTooLarge,
+	http.StatusUnsupportedMediaType:  ErrUnsupportedType,
+	http.StatusTooManyRequests:       ErrRateLimited,
+	http.StatusServiceUnavailable:    ErrUnavailable,
+}
+
+// Error is returned when the server responds with an error status
+type Error struct {
+	StatusCode int
+	Message    string   // The server's "Error" (or the HTTP status text)
+	Errors     []string // Any detailed "Errors"
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+	if len(e.Errors) != 0 {
+		msg += ": " + strings.Join(e.Errors, "; ")
+	}
+	return msg
+}
+
+// Match the Err* kind for the status code - and ErrServer for any 5xx
+func (e *Error) Is(target error) bool {
+	if target == ErrServer {
+		return e.StatusCode >= 500 && e.StatusCode <= 599
+	}
+	kind, ok := statusErrors[e.StatusCode]
+	return ok && kind == target
+}
+
+// Build an *Error from an error response
+func errorFrom(resp *http.Response) error {
+	var msg struct {
+		Err    string   `json:"Error"`
+		Errors []string `json:"Errors"`
+	}
+	json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&msg)
+	if msg.Err == "" {
+		msg.Err = http.StatusText(resp.StatusCode)
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: msg.Err, Errors: msg.Errors}
+}
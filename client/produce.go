@@ -0,0 +1,312 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/produce_demo/common"
+)
+
+// Produce per page when ListOptions.Limit is not set
+const DefaultPageSize = 100
+
+// A Produce the server did not add, and why
+// Line is set for CSV/NDJSON adds, Produce is nil if the input could not be parsed
+type Rejection struct {
+	Line    int             `json:"Line,omitempty"`
+	Produce *common.Produce `json:"Produce,omitempty"`
+	Errors  []string        `json:"Errors"`
+}
+
+// Result of AddBatch and AddFrom
+type AddResult struct {
+	Added    []common.Produce `json:"Produce,omitempty"`
+	Rejected []Rejection      `json:"Rejected Produce,omitempty"`
+}
+
+// A background import on the server - see GET /imports/:id
+type ImportJob struct {
+	ID         string     `json:"ID"`
+	Status     string     `json:"Status"`
+	Progress   float64    `json:"Progress"`
+	TotalBytes int64      `json:"Total Bytes"`
+	BytesRead  int64      `json:"Bytes Read"`
+	LinesRead  int        `json:"Lines Read"`
+	Added      int        `json:"Added"`
+	Rejected   int        `json:"Rejected"`
+	Err        string     `json:"Error,omitempty"`
+	Created    time.Time  `json:"Created"`
+	Started    *time.Time `json:"Started,omitempty"`
+	Finished   *time.Time `json:"Finished,omitempty"`
+}
+
+// Reports whether the import has finished (completed or failed)
+func (j ImportJob) Done() bool {
+	return j.Status == "completed" || j.Status == "failed"
+}
+
+// Server return structures
+type fetchMsg struct {
+	Err     string           `json:"Error,omitempty"`
+	Produce []common.Produce `json:"Produce,omitempty"`
+}
+
+type updateMsg struct {
+	Err     string          `json:"Error,omitempty"`
+	Errors  []string        `json:"Errors,omitempty"`
+	Produce *common.Produce `json:"Produce,omitempty"`
+}
+
+type importMsg struct {
+	Err    string     `json:"Error,omitempty"`
+	Import *ImportJob `json:"Import,omitempty"`
+}
+
+// Options for List
+type ListOptions struct {
+	Limit int    // Produce per page (DefaultPageSize if 0, at most 1000)
+	After string // Start after this Produce Code
+}
+
+// Pager walks the pages of a List, in Produce Code order:
+//
+//	pager := c.List(opts)
+//	for pager.Next(ctx) {
+//		for _, p := range pager.Page() { ... }
+//	}
+//	if err := pager.Err(); err != nil { ... }
+type Pager struct {
+	c    *Client
+	next string // Path of the next page ("" when there are no more)
+	page []common.Produce
+	err  error
+}
+
+// List Produce a page at a time
+func (c *Client) List(opts ListOptions) *Pager {
+	limit := opts.Limit
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(limit))
+	if opts.After != "" {
+		query.Set("after", opts.After)
+	}
+	return &Pager{c: c, next: "/produce?" + query.Encode()}
+}
+
+// Fetch the next page - returns false when there are no more pages or on an error
+func (p *Pager) Next(ctx context.Context) bool {
+	if p.err != nil || p.next == "" {
+		return false
+	}
+
+	var msg fetchMsg
+	resp, err := p.c.do(ctx, http.MethodGet, p.next, nil)
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.next = nextLink(resp.Header.Get("Link"))
+	if resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		p.page, p.next = nil, ""
+		return false
+	}
+	if err := decode(resp, &msg); err != nil {
+		p.err = err
+		return false
+	}
+	p.page = msg.Produce
+	return len(p.page) != 0
+}
+
+// Produce on the current page
+func (p *Pager) Page() []common.Produce {
+	return p.page
+}
+
+// The error that stopped Next, if any
+func (p *Pager) Err() error {
+	return p.err
+}
+
+// Path and query of the rel="next" target in a Link header ("" if there isn't one)
+func nextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				u, err := url.Parse(target[1 : len(target)-1])
+				if err != nil {
+					return ""
+				}
+				return u.RequestURI()
+			}
+		}
+	}
+	return ""
+}
+
+// Fetch all Produce, following every page
+func (c *Client) ListAll(ctx context.Context) ([]common.Produce, error) {
+	produceList := []common.Produce{}
+	pager := c.List(ListOptions{Limit: 1000})
+	for pager.Next(ctx) {
+		produceList = append(produceList, pager.Page()...)
+	}
+	return produceList, pager.Err()
+}
+
+// Fetch a Produce by Produce Code
+func (c *Client) Get(ctx context.Context, produceCode string) (common.Produce, error) {
+	var msg fetchMsg
+	resp, err := c.do(ctx, http.MethodGet, "/produce/"+url.PathEscape(produceCode), nil)
+	if err != nil {
+		return common.Produce{}, err
+	}
+	if err := decode(resp, &msg); err != nil {
+		return common.Produce{}, err
+	}
+	if len(msg.Produce) == 0 {
+		return common.Produce{}, &Error{StatusCode: http.StatusNotFound, Message: "Produce not found"}
+	}
+	return msg.Produce[0], nil
+}
+
+// Add a single Produce
+// A rejected Produce is returned as a 400 *Error carrying the reasons
+func (c *Client) Add(ctx context.Context, p common.Produce) (common.Produce, error) {
+	result, err := c.AddBatch(ctx, []common.Produce{p})
+	if err != nil {
+		return common.Produce{}, err
+	}
+	if len(result.Rejected) != 0 {
+		return common.Produce{}, &Error{StatusCode: http.StatusBadRequest, Message: "Produce rejected", Errors: result.Rejected[0].Errors}
+	}
+	if len(result.Added) == 0 {
+		return common.Produce{}, &Error{StatusCode: http.StatusBadRequest, Message: "Produce not added"}
+	}
+	return result.Added[0], nil
+}
+
+// Add several Produce
+// Some Produce may be rejected without an error being returned - check AddResult.Rejected
+func (c *Client) AddBatch(ctx context.Context, produce []common.Produce) (AddResult, error) {
+	b, err := jsonBody(produce)
+	if err != nil {
+		return AddResult{}, err
+	}
+	return c.add(ctx, b)
+}
+
+// Add Produce from CSV or NDJSON (MIMECSV or MIMENDJSON)
+// The body is streamed so the request is never retried
+func (c *Client) AddFrom(ctx context.Context, contentType string, r io.Reader) (AddResult, error) {
+	return c.add(ctx, &body{contentType: contentType, r: r})
+}
+
+func (c *Client) add(ctx context.Context, b *body) (AddResult, error) {
+	var result AddResult
+	resp, err := c.do(ctx, http.MethodPost, "/produce", b)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	// 206 and 400 still describe what was (not) added
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusBadRequest {
+		return result, errorFrom(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Update a Produce (matched by Produce Code)
+func (c *Client) Update(ctx context.Context, p common.Produce) (common.Produce, error) {
+	var msg updateMsg
+	b, err := jsonBody(p)
+	if err != nil {
+		return common.Produce{}, err
+	}
+	resp, err := c.do(ctx, http.MethodPut, "/produce/"+url.PathEscape(p.ProduceCode), b)
+	if err != nil {
+		return common.Produce{}, err
+	}
+	if err := decode(resp, &msg); err != nil {
+		return common.Produce{}, err
+	}
+	if msg.Produce == nil {
+		return common.Produce{}, fmt.Errorf("%w: no Produce in the response", ErrBadResponse)
+	}
+	return *msg.Produce, nil
+}
+
+// Delete a Produce by Produce Code
+func (c *Client) Delete(ctx context.Context, produceCode string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/produce/"+url.PathEscape(produceCode), nil)
+	if err != nil {
+		return err
+	}
+	return decode(resp, nil)
+}
+
+// Queue a CSV or NDJSON file to be imported in the background
+func (c *Client) Import(ctx context.Context, contentType string, r io.Reader) (ImportJob, error) {
+	var msg importMsg
+	resp, err := c.do(ctx, http.MethodPost, "/imports", &body{contentType: contentType, r: r})
+	if err != nil {
+		return ImportJob{}, err
+	}
+	if err := decode(resp, &msg); err != nil {
+		return ImportJob{}, err
+	}
+	if msg.Import == nil {
+		return ImportJob{}, fmt.Errorf("%w: no Import in the response", ErrBadResponse)
+	}
+	return *msg.Import, nil
+}
+
+// Fetch the progress of an import
+func (c *Client) ImportStatus(ctx context.Context, id string) (ImportJob, error) {
+	var msg importMsg
+	resp, err := c.do(ctx, http.MethodGet, "/imports/"+url.PathEscape(id), nil)
+	if err != nil {
+		return ImportJob{}, err
+	}
+	if err := decode(resp, &msg); err != nil {
+		return ImportJob{}, err
+	}
+	if msg.Import == nil {
+		return ImportJob{}, fmt.Errorf("%w: no Import in the response", ErrBadResponse)
+	}
+	return *msg.Import, nil
+}
+
+// Write an export archive of the catalog to w
+func (c *Client) Export(ctx context.Context, w io.Writer) error {
+	resp, err := c.do(ctx, http.MethodGet, "/admin/export", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errorFrom(resp)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
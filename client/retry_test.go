@@ -0,0 +1,137 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// retryTestStruct
+type retryTS struct {
+	method     string
+	statuses   []int // Status of each attempt - the last repeats
+	retryAfter string
+	expected   error // nil for success
+	attempts   int32
+}
+
+// retryTestStructs: test cases
+var retryTSs = []retryTS{
+	{http.MethodGet, []int{503, 502, 200}, "", nil, 3},
+	{http.MethodGet, []int{429, 200}, "0", nil, 2},
+	{http.MethodGet, []int{504}, "", ErrServer, 4},
+	{http.MethodGet, []int{503}, "", ErrUnavailable, 4},
+	{http.MethodGet, []int{429}, "", ErrRateLimited, 4},
+	{http.MethodGet, []int{500}, "", ErrServer, 1},
+	{http.MethodGet, []int{404}, "", ErrNotFound, 1},
+	{http.MethodGet, []int{401}, "", ErrUnauthorized, 1},
+	{http.MethodGet, []int{403}, "", ErrForbidden, 1},
+	{http.MethodGet, []int{413}, "", ErrTooLarge, 1},
+	{http.MethodPut, []int{503, 200}, "", nil, 2},
+	{http.MethodDelete, []int{503, 200}, "", nil, 2},
+	{http.MethodPost, []int{503, 200}, "", ErrUnavailable, 1},
+}
+
+// Test which requests are retried, how often, and the errors returned
+func TestRetries(t *testing.T) {
+	for _, tt := range retryTSs {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(atomic.AddInt32(&attempts, 1)) - 1
+			if n >= len(tt.statuses) {
+				n = len(tt.statuses) - 1
+			}
+			if tt.retryAfter != "" {
+				w.Header().Set("Retry-After", tt.retryAfter)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tt.statuses[n])
+			fmt.Fprint(w, `{"Error":"Try again"}`)
+		}))
+
+		c := New(server.URL)
+		c.RetryWait = time.Millisecond
+		c.RetryMaxWait = 4 * time.Millisecond
+		resp, err := c.do(context.Background(), tt.method, "/produce", &body{contentType: mimeJSON, b: []byte("{}")})
+		if err == nil {
+			err = decode(resp, nil)
+		}
+		server.Close()
+
+		if (tt.expected == nil && err != nil) || !errors.Is(err, tt.expected) {
+			t.Errorf("ERROR -- for (%v %v) expected (%v) but got (%v)\n", tt.method, tt.statuses, tt.expected, err)
+		}
+		if tt.attempts != attempts {
+			t.Errorf("ERROR -- for (%v %v) expected (%v) attempts but got (%v)\n", tt.method, tt.statuses, tt.attempts, attempts)
+		}
+	}
+}
+
+// Test every 5xx is a server error, as well as its own kind
+func TestErrorIs(t *testing.T) {
+	for _, tt := range []struct {
+		statusCode int
+		kind       error
+		server     bool
+	}{
+		{500, ErrServer, true},
+		{503, ErrUnavailable, true},
+		{599, ErrServer, true},
+		{429, ErrRateLimited, false},
+		{404, ErrNotFound, false},
+	} {
+		err := &Error{StatusCode: tt.statusCode}
+		if !errors.Is(err, tt.kind) || errors.Is(err, ErrServer) != tt.server {
+			t.Errorf("ERROR -- for (%v) expected (%v) and server error (%v) but got (%v)\n", tt.statusCode, tt.kind, tt.server, errors.Is(err, ErrServer))
+		}
+	}
+}
+
+// Test a cancelled context stops the retries
+func TestRetryCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := New(server.URL).Get(ctx, "A12T-4GH7-QPL9-3N4M")
+	if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Errorf("ERROR -- expected (%v) but got (%v) after (%v)\n", context.DeadlineExceeded, err, time.Since(start))
+	}
+}
+
+// Test the backoff grows and stays within RetryMaxWait
+func TestBackoff(t *testing.T) {
+	c := New("")
+	c.RetryWait = 100 * time.Millisecond
+	c.RetryMaxWait = time.Second
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		wait := c.backoff(attempt)
+		if wait < max/2 || wait > max {
+			t.Errorf("ERROR -- for attempt (%v) expected between (%v) and (%v) but got (%v)\n", attempt, max/2, max, wait)
+		}
+	}
+}
+
+// Test Retry-After in seconds and as a date
+func TestParseRetryAfter(t *testing.T) {
+	if d, ok := parseRetryAfter("3"); !ok || d != 3*time.Second {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", 3*time.Second, d)
+	}
+	if d, ok := parseRetryAfter(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)); !ok || d < 59*time.Minute {
+		t.Errorf("ERROR -- expected about (%v) but got (%v)\n", time.Hour, d)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Errorf("ERROR -- expected (soon) to be rejected\n")
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/produce_demo/common"
+)
+
+// Kinds of Event
+const (
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventRemoved = "removed"
+)
+
+// A change to the catalog seen by Watch
+type Event struct {
+	Event   string         `json:"Event"` // EventAdded, EventUpdated or EventRemoved
+	Produce common.Produce `json:"Produce"`
+}
+
+// Poll the catalog every interval and call fn with the changes since the previous check
+// fn is called after every check (the first reports every Produce as added) even when nothing changed.
+// Watch runs until ctx is done (returning ctx.Err()) or until a fetch or fn returns an error.
+func (c *Client) Watch(ctx context.Context, interval time.Duration, fn func([]Event) error) error {
+	previous := map[string]common.Produce{}
+	for first := true; ; first = false {
+		if !first {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		produceList, err := c.ListAll(ctx)
+		if err != nil {
+			return err
+		}
+		current := map[string]common.Produce{}
+		for _, p := range produceList {
+			current[strings.ToUpper(p.ProduceCode)] = p
+		}
+		if err := fn(Changes(previous, current)); err != nil {
+			return err
+		}
+		previous = current
+	}
+}
+
+// Events that turn previous into current (both keyed by upper case Produce Code), ordered by Produce Code
+func Changes(previous map[string]common.Produce, current map[string]common.Produce) []Event {
+	events := []Event{}
+	for key, p := range current {
+		old, ok := previous[key]
+		if !ok {
+			events = append(events, Event{Event: EventAdded, Produce: p})
+		} else if old != p {
+			events = append(events, Event{Event: EventUpdated, Produce: p})
+		}
+	}
+	for key, p := range previous {
+		if _, ok := current[key]; !ok {
+			events = append(events, Event{Event: EventRemoved, Produce: p})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Produce.ProduceCode < events[j].Produce.ProduceCode })
+	return events
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+	router "example.com/produce_demo/routers"
+)
+
+// Test paging through the catalog a few Produce at a time
+func TestPager(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+	c := New(server.URL)
+	ctx := context.Background()
+
+	all, err := c.ListAll(ctx)
+	if err != nil {
+		t.Fatalf("ERROR -- ListAll got (%v)\n", err)
+	}
+
+	pages := 0
+	paged := []common.Produce{}
+	pager := c.List(ListOptions{Limit: 2})
+	for pager.Next(ctx) {
+		if len(pager.Page()) > 2 {
+			t.Errorf("ERROR -- expected at most 2 produce but got (%v)\n", pager.Page())
+		}
+		paged = append(paged, pager.Page()...)
+		pages++
+	}
+	if pager.Err() != nil || len(paged) != len(all) || pages != (len(all)+1)/2 {
+		t.Fatalf("ERROR -- expected (%v) in (%v) pages but got (%v) in (%v) pages (%v)\n", all, (len(all)+1)/2, paged, pages, pager.Err())
+	}
+	for i := range all {
+		if all[i] != paged[i] {
+			t.Errorf("ERROR -- expected (%v) but got (%v)\n", all[i], paged[i])
+		}
+	}
+
+	// After the last Produce Code there is nothing to list
+	pager = c.List(ListOptions{After: all[len(all)-1].ProduceCode})
+	if pager.Next(ctx) || pager.Err() != nil {
+		t.Errorf("ERROR -- expected no pages but got (%v) (%v)\n", pager.Page(), pager.Err())
+	}
+
+	pager = c.List(ListOptions{Limit: 5000})
+	if pager.Next(ctx) || !errors.Is(pager.Err(), ErrBadRequest) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrBadRequest, pager.Err())
+	}
+}
+
+// Test nextLink finds the rel="next" target
+func TestNextLink(t *testing.T) {
+	for header, expected := range map[string]string{
+		`</produce?after=B&limit=2>; rel="next"`:                                         "/produce?after=B&limit=2",
+		`<http://h/produce?after=B>; rel="prev", <http://h/produce?after=C>; rel="next"`: "/produce?after=C",
+		`</produce?after=B>; rel="prev"`:                                                 "",
+		"":                                                                               "",
+	} {
+		if got := nextLink(header); got != expected {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", header, expected, got)
+		}
+	}
+}
+
+// Test Watch reports each change once
+func TestWatch(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+	c := New(server.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	checks := 0
+	seen := []string{}
+	errStop := errors.New("stop")
+	err := c.Watch(ctx, time.Millisecond, func(events []Event) error {
+		checks++
+		if checks > 1 {
+			for _, e := range events {
+				seen = append(seen, e.Event+" "+e.Produce.ProduceCode)
+			}
+		}
+		switch checks {
+		case 1:
+			_, err := c.Add(ctx, common.Produce{ProduceCode: "WTCH-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"})
+			return err
+		case 2:
+			return c.Delete(ctx, "WTCH-1111-2222-3333")
+		}
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("ERROR -- expected (%v) but got (%v)\n", errStop, err)
+	}
+	if len(seen) != 2 || seen[0] != "added WTCH-1111-2222-3333" || seen[1] != "removed WTCH-1111-2222-3333" {
+		t.Errorf("ERROR -- expected ([added WTCH-1111-2222-3333 removed WTCH-1111-2222-3333]) but got (%v)\n", seen)
+	}
+
+	// Cancelling the context ends the watch
+	cancel()
+	if err := c.Watch(ctx, time.Millisecond, func([]Event) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", context.Canceled, err)
+	}
+}
+
+// Test Changes reports the difference between checks
+func TestChanges(t *testing.T) {
+	events := Changes(
+		map[string]common.Produce{
+			"A12T-4GH7-QPL9-3N4M": {ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+			"E5T6-9UI3-TH15-QR88": {ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
+			"TQ4C-VV6T-75ZX-1RMR": {ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+		},
+		map[string]common.Produce{
+			"A12T-4GH7-QPL9-3N4M": {ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+			"E5T6-9UI3-TH15-QR88": {ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "3.19"},
+			"YRT6-72AS-K736-L4AR": {ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
+		})
+
+	expected := []string{"updated E5T6-9UI3-TH15-QR88", "removed TQ4C-VV6T-75ZX-1RMR", "added YRT6-72AS-K736-L4AR"}
+	if len(events) != len(expected) {
+		t.Fatalf("ERROR -- expected (%v) but got (%v)\n", expected, events)
+	}
+	for i, e := range events {
+		if e.Event+" "+e.Produce.ProduceCode != expected[i] {
+			t.Errorf("ERROR -- expected (%v) but got (%v)\n", expected[i], e)
+		}
+	}
+}
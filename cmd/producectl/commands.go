@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/produce_demo/client"
+	"example.com/produce_demo/common"
+)
+
+// Client configured from the global flags
+func (c *cli) client() *client.Client {
+	cl := client.New(c.server)
+	cl.Token = c.token
+	cl.APIKey = c.apiKey
+	return cl
+}
+
+// producectl list
+func listCommand(c *cli, args []string) int {
+	fs := c.flags("list", "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	produceList, err := c.client().ListAll(context.Background())
+	if err != nil {
+		return c.fail(err)
+	}
+	if err := writeProduce(c.stdout, c.output, produceList); err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+// producectl get <code>...
+func getCommand(c *cli, args []string) int {
+	fs := c.flags("get", "<code>...")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cl := c.client()
+	produceList := []common.Produce{}
+	for _, produceCode := range fs.Args() {
+		p, err := cl.Get(context.Background(), produceCode)
+		if err != nil {
+			return c.fail(fmt.Errorf("%s: %w", produceCode, err))
+		}
+		produceList = append(produceList, p)
+	}
+	if err := writeProduce(c.stdout, c.output, produceList); err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+// producectl add -code C -name N -price P | add -f <file>
+func addCommand(c *cli, args []string) int {
+	fs := c.flags("add", "(-code C -name N -price P | -f <file>)")
+	produceCode := fs.String("code", "", "Produce Code")
+	name := fs.String("name", "", "Name")
+	unitPrice := fs.String("price", "", "Unit Price")
+	file := fs.String("f", "", "file of produce (.json, .csv or .ndjson, \"-\" for stdin)")
+	fileType := fs.String("type", "", "file type when it can't be told from the extension: json, csv or ndjson")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || (*file == "") == (*produceCode == "") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var result client.AddResult
+	var err error
+	if *file == "" {
+		result, err = c.client().AddBatch(context.Background(), []common.Produce{{ProduceCode: *produceCode, Name: *name, UnitPrice: *unitPrice}})
+	} else {
+		var r io.ReadCloser
+		var contentType string
+		r, contentType, err = c.openInput(*file, *fileType)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer r.Close()
+		result, err = c.client().AddFrom(context.Background(), contentType, r)
+	}
+	if err != nil {
+		return c.fail(err)
+	}
+
+	if err := writeProduce(c.stdout, c.output, result.Added); err != nil {
+		return c.fail(err)
+	}
+	for _, rejected := range result.Rejected {
+		fmt.Fprintf(c.stderr, "rejected: %s\n", describeRejection(rejected))
+	}
+	if len(result.Rejected) != 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+// producectl update <code> [-name N] [-price P]
+func updateCommand(c *cli, args []string) int {
+	fs := c.flags("update", "<code> [-name N] [-price P]")
+	name := fs.String("name", "", "new Name")
+	unitPrice := fs.String("price", "", "new Unit Price")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fs.Usage()
+		return exitUsage
+	}
+	produceCode := args[0]
+	if err := fs.Parse(args[1:]); err != nil || fs.NArg() != 0 || (*name == "" && *unitPrice == "") {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cl := c.client()
+	p, err := cl.Get(context.Background(), produceCode)
+	if err != nil {
+		return c.fail(fmt.Errorf("%s: %w", produceCode, err))
+	}
+	if *name != "" {
+		p.Name = *name
+	}
+	if *unitPrice != "" {
+		p.UnitPrice = *unitPrice
+	}
+	p, err = cl.Update(context.Background(), p)
+	if err != nil {
+		return c.fail(fmt.Errorf("%s: %w", produceCode, err))
+	}
+	if err := writeProduce(c.stdout, c.output, []common.Produce{p}); err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+// producectl delete <code>...
+func deleteCommand(c *cli, args []string) int {
+	fs := c.flags("delete", "<code>...")
+	if err := fs.Parse(args); err != nil || fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cl := c.client()
+	code := exitOK
+	for _, produceCode := range fs.Args() {
+		if err := cl.Delete(context.Background(), produceCode); err != nil {
+			code = c.fail(fmt.Errorf("%s: %w", produceCode, err))
+			continue
+		}
+		fmt.Fprintf(c.stdout, "Produce %s deleted\n", produceCode)
+	}
+	return code
+}
+
+// producectl import [-wait] <file>
+func importCommand(c *cli, args []string) int {
+	fs := c.flags("import", "[-wait] <file>")
+	wait := fs.Bool("wait", false, "wait for the import to finish")
+	interval := fs.Duration("interval", time.Second, "how often to check progress with -wait")
+	fileType := fs.String("type", "", "file type when it can't be told from the extension: csv or ndjson")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	r, contentType, err := c.openInput(fs.Arg(0), *fileType)
+	if err != nil {
+		return c.fail(err)
+	}
+	defer r.Close()
+
+	cl := c.client()
+	job, err := cl.Import(context.Background(), contentType, r)
+	if err != nil {
+		return c.fail(err)
+	}
+	for *wait && !job.Done() {
+		time.Sleep(*interval)
+		if job, err = cl.ImportStatus(context.Background(), job.ID); err != nil {
+			return c.fail(err)
+		}
+	}
+
+	if err := writeImportJob(c.stdout, c.output, job); err != nil {
+		return c.fail(err)
+	}
+	if job.Status == "failed" || (job.Done() && job.Rejected != 0) {
+		return exitError
+	}
+	return exitOK
+}
+
+// producectl export [-f <file>]
+func exportCommand(c *cli, args []string) int {
+	fs := c.flags("export", "[-f <file>]")
+	file := fs.String("f", "-", "file to write the archive to (\"-\" for stdout)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	w := c.stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := c.client().Export(context.Background(), w); err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+// producectl watch [-interval D]
+func watchCommand(c *cli, args []string) int {
+	fs := c.flags("watch", "[-interval D]")
+	interval := fs.Duration("interval", 2*time.Second, "how often to check for changes")
+	count := fs.Int("count", 0, "stop after this many checks (0 - until interrupted)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *interval <= 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ew := newEventWriter(c.stdout, c.output)
+	checks := 0
+	err := c.client().Watch(ctx, *interval, func(events []client.Event) error {
+		for _, e := range events {
+			if err := ew.write(e); err != nil {
+				return err
+			}
+		}
+		if checks++; *count != 0 && checks >= *count {
+			return errWatchDone
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errWatchDone) && !errors.Is(err, context.Canceled) {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+// Stops a watch after -count checks
+var errWatchDone = errors.New("watch done")
+
+// Open a file of produce and determine its Content-Type from fileType or the file extension
+func (c *cli) openInput(file string, fileType string) (io.ReadCloser, string, error) {
+	if fileType == "" {
+		fileType = strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	}
+	contentType, ok := map[string]string{
+		"json":   "application/json",
+		"csv":    client.MIMECSV,
+		"ndjson": client.MIMENDJSON,
+		"jsonl":  client.MIMENDJSON,
+	}[fileType]
+	if !ok {
+		return nil, "", errors.New("can't tell the type of " + file + " - use -type")
+	}
+
+	if file == "-" {
+		return io.NopCloser(c.stdin), contentType, nil
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, contentType, nil
+}
+
+// One line description of a rejected produce item
+func describeRejection(r client.Rejection) string {
+	s := ""
+	if r.Line != 0 {
+		s = fmt.Sprintf("line %d: ", r.Line)
+	}
+	if r.Produce != nil {
+		s += r.Produce.ProduceCode + ": "
+	}
+	return s + strings.Join(r.Errors, "; ")
+}
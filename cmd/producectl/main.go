@@ -0,0 +1,129 @@
+// producectl - command-line client for the Produce Demo API
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const usage = `Usage: producectl [flags] <command> [command flags] [args]
+
+Commands:
+  list                                 List all produce
+  get <code>...                        Show produce by Produce Code
+  add -code C -name N -price P         Add a produce item
+  add -f <file>                        Add produce from a .json, .csv or .ndjson file ("-" for stdin with -type)
+  update <code> [-name N] [-price P]   Change the name and/or unit price of a produce item
+  delete <code>...                     Delete produce by Produce Code
+  import [-wait] <file>                Import a .csv or .ndjson file in the background
+  export [-f <file>]                   Download a catalog export archive (stdout by default)
+  watch [-interval D]                  Print produce as it is added, updated and removed
+
+Flags:
+`
+
+// Exit codes
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// Main Function
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// Settings shared by every command
+type cli struct {
+	server string
+	token  string
+	apiKey string
+	output string
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// A command - returns the exit code
+type command func(c *cli, args []string) int
+
+var commands = map[string]command{
+	"list":   listCommand,
+	"get":    getCommand,
+	"add":    addCommand,
+	"update": updateCommand,
+	"delete": deleteCommand,
+	"import": importCommand,
+	"export": exportCommand,
+	"watch":  watchCommand,
+}
+
+// Parse the global flags and run the command
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+
+	fs := flag.NewFlagSet("producectl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.server, "server", envOr("PRODUCECTL_SERVER", ""), "server URL (env PRODUCECTL_SERVER, default http://127.0.0.1:8080)")
+	fs.StringVar(&c.token, "token", os.Getenv("PRODUCECTL_TOKEN"), "bearer token (env PRODUCECTL_TOKEN)")
+	fs.StringVar(&c.apiKey, "api-key", os.Getenv("PRODUCECTL_API_KEY"), "API key (env PRODUCECTL_API_KEY)")
+	fs.StringVar(&c.output, "o", envOr("PRODUCECTL_OUTPUT", formatTable), "output format: table, json or csv (env PRODUCECTL_OUTPUT)")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if !validOutput(c.output) {
+		fmt.Fprintf(stderr, "producectl: unknown output format (%s)\n", c.output)
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		names := []string{}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(stderr, "producectl: unknown command (%s) - expected one of %s\n", fs.Arg(0), strings.Join(names, ", "))
+		return exitUsage
+	}
+	return cmd(c, fs.Args()[1:])
+}
+
+// Environment variable or a default
+func envOr(name string, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// Report an error and return the error exit code
+func (c *cli) fail(err error) int {
+	fmt.Fprintf(c.stderr, "producectl: %s\n", err)
+	return exitError
+}
+
+// New flag set for a command
+func (c *cli) flags(name string, argsUsage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: producectl %s %s\n", name, argsUsage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
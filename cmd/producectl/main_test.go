@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	router "example.com/produce_demo/routers"
+)
+
+// Helper function to run producectl against a server
+func runCLI(t *testing.T, server string, stdin string, args ...string) (int, string, string) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := run(append([]string{"-server", server}, args...), strings.NewReader(stdin), stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+// cliTestStruct
+type cliTS struct {
+	args           []string
+	stdin          string
+	expected       int
+	expectedStdout string
+	expectedStderr string // Expected to be contained in stderr
+}
+
+// cliTestStructs: test cases - run in order against the same server
+var cliTSs = []cliTS{
+	{[]string{"get", "A12T-4GH7-QPL9-3N4M"}, "", exitOK,
+		"PRODUCE CODE         NAME     UNIT PRICE\nA12T-4GH7-QPL9-3N4M  Lettuce  3.46\n", ""},
+	{[]string{"-o", "csv", "get", "a12t-4gh7-qpl9-3n4m", "E5T6-9UI3-TH15-QR88"}, "", exitOK,
+		"Produce Code,Name,Unit Price,Category\nA12T-4GH7-QPL9-3N4M,Lettuce,3.46,\nE5T6-9UI3-TH15-QR88,Peach,2.99,\n", ""},
+	{[]string{"get", "ZZZZ-4GH7-QPL9-3N4M"}, "", exitError, "", "ZZZZ-4GH7-QPL9-3N4M: 404 Produce not found"},
+	{[]string{"add", "-code", "CTLA-1111-2222-3333", "-name", "Pizza Pie", "-price", "200.6"}, "", exitOK,
+		"PRODUCE CODE         NAME       UNIT PRICE\nCTLA-1111-2222-3333  Pizza Pie  200.6\n", ""},
+	{[]string{"-o", "json", "add", "-f", "-", "-type", "csv"}, "CTLA-1111-2222-4444,Celery,.45\nCTLA-1111-2222-3333,Pizza Pie,200.6\n", exitError,
+		"[\n  {\n    \"Produce Code\": \"CTLA-1111-2222-4444\",\n    \"Name\": \"Celery\",\n    \"Unit Price\": \".45\"\n  }\n]\n",
+		"rejected: line 2: CTLA-1111-2222-3333: CTLA-1111-2222-3333 already exists"},
+	{[]string{"add", "-f", "produce.txt"}, "", exitError, "", "can't tell the type of produce.txt"},
+	{[]string{"-o", "csv", "update", "ctla-1111-2222-3333", "-price", "199.99"}, "", exitOK,
+		"Produce Code,Name,Unit Price,Category\nCTLA-1111-2222-3333,Pizza Pie,199.99,\n", ""},
+	{[]string{"update", "CTLA-1111-2222-3333", "-price", "199.999"}, "", exitError, "",
+		"400 Invalid Produce: Detected error for Produce Unit Price (199.999)"},
+	{[]string{"delete", "CTLA-1111-2222-3333", "CTLA-1111-2222-4444", "CTLA-1111-2222-5555"}, "", exitError,
+		"Produce CTLA-1111-2222-3333 deleted\nProduce CTLA-1111-2222-4444 deleted\n", "CTLA-1111-2222-5555: 404 Produce not found"},
+	{[]string{"import", "-wait", "-interval", "10ms", "-type", "ndjson", "-"},
+		"{\"Produce Code\": \"CTLA-1111-2222-6666\", \"Name\": \"Corn\", \"Unit Price\": \".5\"}\n", exitOK, "", ""},
+	{[]string{"-o", "csv", "watch", "-count", "1"}, "", exitOK,
+		"Event,Produce Code,Name,Unit Price,Category\nadded,A12T-4GH7-QPL9-3N4M,Lettuce,3.46,\nadded,CTLA-1111-2222-6666,Corn,.5,\n" +
+			"added,E5T6-9UI3-TH15-QR88,Peach,2.99,\nadded,TQ4C-VV6T-75ZX-1RMR,Gala Apple,3.59,\nadded,YRT6-72AS-K736-L4AR,Green Pepper,0.79,\n", ""},
+	{[]string{"-o", "yaml", "list"}, "", exitUsage, "", "unknown output format (yaml)"},
+	{[]string{"frobnicate"}, "", exitUsage, "", "unknown command (frobnicate)"},
+	{[]string{"get"}, "", exitUsage, "", "Usage: producectl get"},
+	{[]string{"add", "-code", "CTLA-1111-2222-3333", "-f", "produce.csv"}, "", exitUsage, "", "Usage: producectl add"},
+	{[]string{"update", "CTLA-1111-2222-3333"}, "", exitUsage, "", "Usage: producectl update"},
+}
+
+// Test producectl commands against a server
+func TestCommands(t *testing.T) {
+	server := httptest.NewServer(router.New())
+	defer server.Close()
+
+	for _, tt := range cliTSs {
+		code, stdout, stderr := runCLI(t, server.URL, tt.stdin, tt.args...)
+		if tt.expected != code {
+			t.Errorf("ERROR -- for (%v) expected exit (%v) but got (%v) stderr is (%v)\n", tt.args, tt.expected, code, stderr)
+		}
+		if tt.expectedStdout != "" && tt.expectedStdout != stdout {
+			t.Errorf("ERROR -- for (%v) expected stdout (%q) but got (%q)\n", tt.args, tt.expectedStdout, stdout)
+		}
+		if !strings.Contains(stderr, tt.expectedStderr) {
+			t.Errorf("ERROR -- for (%v) expected stderr to contain (%q) but got (%q)\n", tt.args, tt.expectedStderr, stderr)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"example.com/produce_demo/client"
+	"example.com/produce_demo/common"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func validOutput(format string) bool {
+	return format == formatTable || format == formatJSON || format == formatCSV
+}
+
+// Column names - the same as the API's
+var produceColumns = []string{"Produce Code", "Name", "Unit Price", "Category"}
+
+// Write a list of produce in the output format
+func writeProduce(w io.Writer, format string, produceList []common.Produce) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(produceList)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(produceColumns)
+		for _, p := range produceList {
+			cw.Write([]string{p.ProduceCode, p.Name, p.UnitPrice, p.Category})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "PRODUCE CODE\tNAME\tUNIT PRICE")
+		for _, p := range produceList {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.ProduceCode, p.Name, p.UnitPrice)
+		}
+		return tw.Flush()
+	}
+}
+
+// Write an import job in the output format
+func writeImportJob(w io.Writer, format string, job client.ImportJob) error {
+	switch format {
+	case formatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(job)
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"ID", "Status", "Progress", "Lines Read", "Added", "Rejected", "Error"})
+		cw.Write([]string{job.ID, job.Status, strconv.FormatFloat(job.Progress, 'f', 1, 64),
+			strconv.Itoa(job.LinesRead), strconv.Itoa(job.Added), strconv.Itoa(job.Rejected), job.Err})
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tPROGRESS\tLINES READ\tADDED\tREJECTED")
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t%d\t%d\t%d\n", job.ID, job.Status, job.Progress, job.LinesRead, job.Added, job.Rejected)
+		if job.Err != "" {
+			fmt.Fprintf(tw, "error: %s\n", job.Err)
+		}
+		return tw.Flush()
+	}
+}
+
+// Writes watch events as they happen in the output format
+type eventWriter struct {
+	w      io.Writer
+	format string
+	header bool // Header still to be written
+}
+
+func newEventWriter(w io.Writer, format string) *eventWriter {
+	return &eventWriter{w: w, format: format, header: format != formatJSON}
+}
+
+func (ew *eventWriter) write(e client.Event) error {
+	switch ew.format {
+	case formatJSON:
+		return json.NewEncoder(ew.w).Encode(e)
+	case formatCSV:
+		cw := csv.NewWriter(ew.w)
+		if ew.header {
+			cw.Write(append([]string{"Event"}, produceColumns...))
+			ew.header = false
+		}
+		cw.Write([]string{e.Event, e.Produce.ProduceCode, e.Produce.Name, e.Produce.UnitPrice, e.Produce.Category})
+		cw.Flush()
+		return cw.Error()
+	default:
+		// NOTE: fixed widths - a tabwriter would hold lines back until the watch ends
+		if ew.header {
+			fmt.Fprintf(ew.w, "%-8s  %-19s  %-24s  %s\n", "EVENT", "PRODUCE CODE", "NAME", "UNIT PRICE")
+			ew.header = false
+		}
+		_, err := fmt.Fprintf(ew.w, "%-8s  %-19s  %-24s  %s\n", e.Event, e.Produce.ProduceCode, e.Produce.Name, e.Produce.UnitPrice)
+		return err
+	}
+}
@@ -2,10 +2,15 @@
 package common
 
 import (
-	"log"
 	"regexp"
+	"strconv"
+	"unicode/utf8"
+
+	"example.com/produce_demo/logging"
 )
 
+var logger = logging.For("common")
+
 // Common struct and variables
 // Since persistence layer and model match, we are using a single structure
 // If we want seperation of model and persistence - conversion method could be placed here
@@ -22,10 +27,12 @@ import (
 //       Using String at the moment, since we don't seem to be doing any arithmetic.
 
 // Produce structure used for both api and db
+// NOTE: XML element names cannot contain spaces, so the xml tags drop them
 type Produce struct {
-	ProduceCode string `json:"Produce Code"`
-	Name        string `json:"Name"`
-	UnitPrice   string `json:"Unit Price"`
+	ProduceCode string `json:"Produce Code" yaml:"Produce Code" xml:"ProduceCode"`
+	Name        string `json:"Name" yaml:"Name" xml:"Name"`
+	UnitPrice   string `json:"Unit Price" yaml:"Unit Price" xml:"UnitPrice"`
+	Category    string `json:"Category,omitempty" yaml:"Category,omitempty" xml:"Category,omitempty"` // ID of the Produce's category - empty for none
 }
 
 // Communication between api/handler and db
@@ -49,6 +56,29 @@ var validateNameRegEx string = "^[[:alnum:]]([[:alnum:]]| )+[[:alnum:]]$"
 // And may optionally start with a '$'
 var validateUnitPriceRegEx string = "^[$]{0,1}[[:digit:]]*[.][[:digit:]]{0,2}$"
 
+// Longest Produce Name and Unit Price accepted - set from the configuration
+var maxFieldLength = 256
+
+// Set the longest Produce Name and Unit Price accepted - ignored unless positive
+func SetMaxFieldLength(n int) {
+	if n > 0 {
+		maxFieldLength = n
+	}
+}
+
+// Reports whether a category exists - set by db so Produce may only be put in categories that do
+var categoryExists = func(string) bool { return false }
+
+// Set the check of whether a category exists
+func SetCategoryCheck(exists func(id string) bool) {
+	categoryExists = exists
+}
+
+// tests if a field is within maxFieldLength
+func validateLength(field string) bool {
+	return utf8.RuneCountInString(field) <= maxFieldLength
+}
+
 // tests if a Produce's Produce Code is valid
 func ValidateProduceCode(produceCode string) bool {
 	re := regexp.MustCompile(validateProduceCodeRegEx)
@@ -84,25 +114,54 @@ func fixUnitPrice(unitPrice string) string {
 	return unitPrice
 }
 
+// tests if a price, such as a supplier's cost, is valid - the same rules as a Unit Price
+func ValidatePrice(price string) bool {
+	return validateLength(price) && validateUnitPrice(price)
+}
+
+// fixes a valid price the same way as a Unit Price
+func FixPrice(price string) string {
+	return fixUnitPrice(price)
+}
+
 // Convenience Method to test all fields of a Produce
 func ValidateProduce(p Produce) (bool, []string) {
+	return ValidateProduceIn(p, categoryExists)
+}
+
+// Test all fields of a Produce, with its Category looked up by categoryExists rather than in the
+// categories served - for Produce that comes with categories of its own, such as in an archive
+func ValidateProduceIn(p Produce, categoryExists func(id string) bool) (bool, []string) {
 	ret := true
 	errorText := []string{}
 	if ValidateProduceCode(p.ProduceCode) != true {
-		log.Printf("ValidateProduceCode failed for produce(%v)", p)
+		logger.Debug("ValidateProduce - bad produce code", "produce", p)
 		errorText = append(errorText, "Detected error for Produce Code ("+p.ProduceCode+")")
 		ret = false
 	}
-	if validateName(p.Name) != true {
-		log.Printf("ValidateName failed for produce(%v)", p)
+	if validateLength(p.Name) != true {
+		logger.Debug("ValidateProduce - name too long", "length", len(p.Name))
+		errorText = append(errorText, "Produce Name is over the limit of "+strconv.Itoa(maxFieldLength)+" characters")
+		ret = false
+	} else if validateName(p.Name) != true {
+		logger.Debug("ValidateProduce - bad name", "produce", p)
 		errorText = append(errorText, "Detected error for Produce Name ("+p.Name+")")
 		ret = false
 	}
-	if validateUnitPrice(p.UnitPrice) != true {
-		log.Printf("ValidateUnitPrice failed for produce(%v)", p)
+	if validateLength(p.UnitPrice) != true {
+		logger.Debug("ValidateProduce - unit price too long", "length", len(p.UnitPrice))
+		errorText = append(errorText, "Produce Unit Price is over the limit of "+strconv.Itoa(maxFieldLength)+" characters")
+		ret = false
+	} else if validateUnitPrice(p.UnitPrice) != true {
+		logger.Debug("ValidateProduce - bad unit price", "produce", p)
 		errorText = append(errorText, "Detected error for Produce Unit Price ("+p.UnitPrice+")")
 		ret = false
 	}
+	if p.Category != "" && !categoryExists(p.Category) {
+		logger.Debug("ValidateProduce - unknown category", "produce", p)
+		errorText = append(errorText, "Produce Category ("+p.Category+") not found")
+		ret = false
+	}
 	return ret, errorText
 }
 
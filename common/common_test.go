@@ -1,6 +1,7 @@
 package common
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -158,10 +159,28 @@ var vpTSs = []vpTS{
 		input:          Produce{ProduceCode: "ABCD-ABCD-ABCD-ABCD", Name: "TEST", UnitPrice: "."},
 		expected:       true,
 		expectedErrors: []string{}},
+	{function: "ValidateProduce",
+		input:          Produce{ProduceCode: "ABCD-ABCD-ABCD-ABCD", Name: strings.Repeat("A", 257), UnitPrice: "1." + strings.Repeat("0", 255)},
+		expected:       false,
+		expectedErrors: []string{"Produce Name is over the limit of 256 characters", "Produce Unit Price is over the limit of 256 characters"}},
+	{function: "ValidateProduce",
+		input:          Produce{ProduceCode: "ABCD-ABCD-ABCD-ABCD", Name: strings.Repeat("A", 256), UnitPrice: "1.00"},
+		expected:       true,
+		expectedErrors: []string{}},
+	{function: "ValidateProduce",
+		input:          Produce{ProduceCode: "ABCD-ABCD-ABCD-ABCD", Name: "TEST", UnitPrice: "1.00", Category: "fruit"},
+		expected:       true,
+		expectedErrors: []string{}},
+	{function: "ValidateProduce",
+		input:          Produce{ProduceCode: "ABCD-ABCD-ABCD-ABCD", Name: "TEST", UnitPrice: "1.00", Category: "nuts"},
+		expected:       false,
+		expectedErrors: []string{"Produce Category (nuts) not found"}},
 }
 
 // Verify ValidateProduce
 func TestValidateProduce(t *testing.T) {
+	SetCategoryCheck(func(id string) bool { return id == "fruit" })
+	defer SetCategoryCheck(func(string) bool { return false })
 	var result bool
 	var resultErrors []string
 
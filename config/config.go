@@ -0,0 +1,937 @@
+// Layered configuration for the server
+//
+// Settings are applied in order, each layer overriding the one before:
+//  1. Defaults
+//  2. A YAML (.yaml, .yml) or TOML (.toml) config file given by --config or PRODUCE_DEMO_CONFIG
+//  3. Environment variables - PRODUCE_DEMO_ followed by the setting's key in upper case with
+//     dots replaced by underscores, e.g. storage.backend is PRODUCE_DEMO_STORAGE_BACKEND
+//  4. Command-line flags - the setting's key with dots replaced by dashes, e.g. --storage-backend
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of every environment variable
+const envPrefix = "PRODUCE_DEMO_"
+
+// Storage backends
+const (
+	BackendMemory = "memory" // Rows are lost when the server stops
+	BackendFile   = "file"   // Rows are kept in a JSON file at Storage.Path
+)
+
+// Log formats
+const (
+	LogText = "text"
+	LogJSON = "json"
+)
+
+// Trace exporters
+const (
+	TraceNone   = "none"
+	TraceStdout = "stdout"
+	TraceFile   = "file"
+	TraceOTLP   = "otlp"
+)
+
+// Log levels
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// Permissions a role may be given
+var permissions = []string{"produce:read", "produce:write", "produce:delete", "admin"}
+
+// Client certificate policies
+const (
+	ClientAuthNone    = "none"    // Clients are not asked for certificates
+	ClientAuthRequest = "request" // Clients are asked for a certificate, which is verified if given
+	ClientAuthRequire = "require" // Clients must give a certificate that verifies
+)
+
+// Prefix of a listen address naming a Unix domain socket
+const unixPrefix = "unix:"
+
+// TLS versions tls.min_version may name
+var tlsVersions = []string{"1.2", "1.3"}
+
+// Methods of the routes rate_limit.routes and cors.allow_methods may name
+var routeMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH", "HEAD"}
+
+// X-Frame-Options security_headers.frame_options may name
+var frameOptions = []string{"", "DENY", "SAMEORIGIN"}
+
+// Config is the complete server configuration
+type Config struct {
+	Listen          string          `yaml:"listen" toml:"listen"`                     // host:port, or unix: followed by the path of a socket
+	HTTP2           bool            `yaml:"http2" toml:"http2"`                       // Serve HTTP/2 - over TLS, or in the clear to clients that know to
+	ShutdownTimeout Duration        `yaml:"shutdown_timeout" toml:"shutdown_timeout"` // How long to drain requests and imports on shutdown
+	TLS             TLSConfig       `yaml:"tls" toml:"tls"`
+	Storage         StorageConfig   `yaml:"storage" toml:"storage"`
+	Log             LogConfig       `yaml:"log" toml:"log"`
+	Tracing         TracingConfig   `yaml:"tracing" toml:"tracing"`
+	Auth            AuthConfig      `yaml:"auth" toml:"auth"`
+	CORS            CORSConfig      `yaml:"cors" toml:"cors"`
+	SecurityHeaders SecurityConfig  `yaml:"security_headers" toml:"security_headers"`
+	Limits          LimitsConfig    `yaml:"limits" toml:"limits"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Imports         ImportsConfig   `yaml:"imports" toml:"imports"`
+	Tenants         TenantsConfig   `yaml:"tenants" toml:"tenants"`
+	SeedFile        string          `yaml:"seed_file" toml:"seed_file"` // CSV, NDJSON or JSON file of Produce loaded into an empty store
+
+	PrintConfig bool `yaml:"-" toml:"-"` // --print-config: print the configuration and exit
+}
+
+type StorageConfig struct {
+	Backend       string   `yaml:"backend" toml:"backend"`               // BackendMemory or BackendFile
+	Path          string   `yaml:"path" toml:"path"`                     // File for BackendFile
+	FlushInterval Duration `yaml:"flush_interval" toml:"flush_interval"` // How often BackendFile writes changes
+}
+
+type LogConfig struct {
+	Level        string            `yaml:"level" toml:"level"`                   // debug, info, warn or error
+	Format       string            `yaml:"format" toml:"format"`                 // LogText or LogJSON
+	Levels       map[string]string `yaml:"levels" toml:"levels"`                 // Level by package, overriding Level
+	BodyMaxBytes int               `yaml:"body_max_bytes" toml:"body_max_bytes"` // Longest request body logged at debug - 0 logs none
+}
+
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" toml:"exporter"`         // TraceNone, TraceStdout, TraceFile or TraceOTLP
+	File        string  `yaml:"file" toml:"file"`                 // File for TraceFile
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"`         // Collector URL for TraceOTLP - empty to use OTEL_EXPORTER_OTLP_ENDPOINT
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"` // Fraction of new traces recorded
+}
+
+// TLS is served when CertFile is set
+type TLSConfig struct {
+	CertFile       string   `yaml:"cert_file" toml:"cert_file"`             // PEM certificate chain
+	KeyFile        string   `yaml:"key_file" toml:"key_file"`               // PEM private key of the certificate
+	ReloadInterval Duration `yaml:"reload_interval" toml:"reload_interval"` // How often the certificate and key files are checked for changes
+	MinVersion     string   `yaml:"min_version" toml:"min_version"`         // Oldest TLS version accepted: 1.2 or 1.3
+	ClientCAFile   string   `yaml:"client_ca_file" toml:"client_ca_file"`   // PEM certificates of the CAs that sign client certificates
+	ClientAuth     string   `yaml:"client_auth" toml:"client_auth"`         // ClientAuthNone, ClientAuthRequest or ClientAuthRequire
+}
+
+// Reports whether clients may authenticate with certificates
+func (t TLSConfig) ClientCerts() bool {
+	return t.CertFile != "" && t.ClientAuth != ClientAuthNone
+}
+
+// Requests must carry one of the Tokens or a JWT (Authorization: Bearer), or one of the APIKeys or
+// a key created through the admin endpoints (X-API-Key)
+// No authentication is required unless one of the settings is made
+type AuthConfig struct {
+	Tokens      []string `yaml:"tokens" toml:"tokens"`             // In the clear or sha256:<hex>
+	APIKeys     []string `yaml:"api_keys" toml:"api_keys"`         // In the clear or sha256:<hex>
+	KeysFile    string   `yaml:"keys_file" toml:"keys_file"`       // File keeping the keys created through the admin endpoints - empty keeps them in memory
+	JWTSecret   string   `yaml:"jwt_secret" toml:"jwt_secret"`     // HMAC secret for HS256/384/512 JWTs
+	JWKSFile    string   `yaml:"jwks_file" toml:"jwks_file"`       // JSON Web Key Set for RS*, PS* and ES* JWTs
+	JWTIssuer   string   `yaml:"jwt_issuer" toml:"jwt_issuer"`     // Required iss claim, if set
+	JWTAudience string   `yaml:"jwt_audience" toml:"jwt_audience"` // Required aud claim, if set
+
+	Roles       map[string][]string `yaml:"roles" toml:"roles"`               // Permissions of each role - settings override the roles they name
+	StaticRoles []string            `yaml:"static_roles" toml:"static_roles"` // Roles of the static Tokens and APIKeys
+	RolesClaim  string              `yaml:"roles_claim" toml:"roles_claim"`   // JWT claim holding the principal's roles
+	StoreClaim  string              `yaml:"store_claim" toml:"store_claim"`   // JWT claim holding the tenant the principal is bound to
+}
+
+// Reports whether requests must be authenticated
+func (a AuthConfig) Enabled() bool {
+	return len(a.Tokens) != 0 || len(a.APIKeys) != 0 || a.KeysFile != "" || a.JWTSecret != "" || a.JWKSFile != ""
+}
+
+// Cross-origin requests are refused unless their origin is listed ("*" allows any origin)
+type CORSConfig struct {
+	AllowOrigins     []string `yaml:"allow_origins" toml:"allow_origins"`
+	AllowMethods     []string `yaml:"allow_methods" toml:"allow_methods"`         // Methods a preflight allows
+	AllowHeaders     []string `yaml:"allow_headers" toml:"allow_headers"`         // Request headers a preflight allows
+	ExposeHeaders    []string `yaml:"expose_headers" toml:"expose_headers"`       // Response headers scripts may read
+	AllowCredentials bool     `yaml:"allow_credentials" toml:"allow_credentials"` // Let browsers send cookies and client certificates
+	MaxAge           Duration `yaml:"max_age" toml:"max_age"`                     // How long browsers may cache a preflight - 0 for their default
+}
+
+// Headers added to every response to harden browsers that show it
+type SecurityConfig struct {
+	Enabled               bool     `yaml:"enabled" toml:"enabled"`
+	ContentSecurityPolicy string   `yaml:"content_security_policy" toml:"content_security_policy"` // Empty sends none
+	FrameOptions          string   `yaml:"frame_options" toml:"frame_options"`                     // DENY or SAMEORIGIN - empty sends none
+	ReferrerPolicy        string   `yaml:"referrer_policy" toml:"referrer_policy"`                 // Empty sends none
+	HSTSMaxAge            Duration `yaml:"hsts_max_age" toml:"hsts_max_age"`                       // Strict-Transport-Security on HTTPS requests - 0 sends none
+}
+
+type LimitsConfig struct {
+	MaxBodyBytes     int64 `yaml:"max_body_bytes" toml:"max_body_bytes"`         // Largest request body accepted
+	MaxImportBytes   int64 `yaml:"max_import_bytes" toml:"max_import_bytes"`     // Largest upload to /imports accepted
+	MaxBatchItems    int   `yaml:"max_batch_items" toml:"max_batch_items"`       // Most Produce one POST /produce may add
+	MaxFieldLength   int   `yaml:"max_field_length" toml:"max_field_length"`     // Longest Produce Name and Unit Price accepted
+	MaxConcurrentOps int   `yaml:"max_concurrent_ops" toml:"max_concurrent_ops"` // Most store operations one request runs at the same time
+}
+
+// Token bucket limits on requests - a Rate left unset does not limit
+type RateLimitConfig struct {
+	PerKey Rate            `yaml:"per_key" toml:"per_key"` // Requests of each authenticated principal (API key, token or JWT subject)
+	PerIP  Rate            `yaml:"per_ip" toml:"per_ip"`   // Requests from each client IP
+	Routes map[string]Rate `yaml:"routes" toml:"routes"`   // Requests of each principal (or IP) on a route, by "METHOD /path/template"
+
+	// Proxies, as IPs or CIDRs, whose X-Forwarded-For is believed - client IPs are otherwise those of the connection
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// IP ranges of the trusted proxies - an IP is a range of one. Ones that do not parse are left out
+func (r RateLimitConfig) TrustedRanges() []*net.IPNet {
+	ranges := []*net.IPNet{}
+	for _, proxy := range r.TrustedProxies {
+		if ipRange, ok := parseIPRange(proxy); ok {
+			ranges = append(ranges, ipRange)
+		}
+	}
+	return ranges
+}
+
+// Parse an IP or CIDR as an IP range
+func parseIPRange(s string) (*net.IPNet, bool) {
+	if _, ipRange, err := net.ParseCIDR(s); err == nil {
+		return ipRange, true
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, false
+	}
+	bits := 8 * net.IPv6len
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, true
+}
+
+type ImportsConfig struct {
+	Workers int `yaml:"workers" toml:"workers"` // Imports run at the same time
+}
+
+type TenantsConfig struct {
+	MaxProduce int `yaml:"max_produce" toml:"max_produce"` // Quota of a tenant created without one - 0 for no limit
+}
+
+// Duration that reads and writes as a string such as "30s" in config files
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(b []byte) error {
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Rate of requests that reads and writes as a string such as "100/1m" (or "100/m") in config files
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Reports whether r limits anything
+func (r Rate) Enabled() bool {
+	return r.Limit > 0
+}
+
+func (r Rate) MarshalText() ([]byte, error) {
+	if !r.Enabled() {
+		return []byte{}, nil
+	}
+	return []byte(strconv.Itoa(r.Limit) + "/" + r.Period.String()), nil
+}
+
+// Unset, or a positive number of requests per positive period
+func (r Rate) valid() bool {
+	return r == Rate{} || (r.Limit > 0 && r.Period > 0)
+}
+
+func (r *Rate) UnmarshalText(b []byte) error {
+	s := strings.TrimSpace(string(b))
+	if s == "" {
+		*r = Rate{}
+		return nil
+	}
+	limit, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return fmt.Errorf("%s is not requests/period", s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil {
+		return fmt.Errorf("%s is not requests/period", s)
+	}
+	period = strings.TrimSpace(period)
+	d, err := time.ParseDuration(period)
+	if err != nil {
+		// A bare unit is one of it
+		if d, err = time.ParseDuration("1" + period); err != nil {
+			return fmt.Errorf("%s is not requests/period", s)
+		}
+	}
+	*r = Rate{Limit: n, Period: d}
+	return nil
+}
+
+// Configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Listen:          ":8080",
+		HTTP2:           true,
+		ShutdownTimeout: Duration(15 * time.Second),
+		Storage: StorageConfig{
+			Backend:       BackendMemory,
+			Path:          "produce.json",
+			FlushInterval: Duration(5 * time.Second),
+		},
+		TLS:     TLSConfig{ReloadInterval: Duration(10 * time.Second), MinVersion: "1.2", ClientAuth: ClientAuthNone},
+		Log:     LogConfig{Level: "info", Format: LogText, BodyMaxBytes: 512},
+		Tracing: TracingConfig{Exporter: TraceNone, File: "traces.json", SampleRatio: 1},
+		Auth: AuthConfig{
+			Roles: map[string][]string{
+				"cashier": {"produce:read"},
+				"buyer":   {"produce:read", "produce:write"},
+				"manager": {"produce:read", "produce:write", "produce:delete"},
+				"admin":   {"produce:read", "produce:write", "produce:delete", "admin"},
+			},
+			StaticRoles: []string{"admin"},
+			RolesClaim:  "roles",
+			StoreClaim:  "store",
+		},
+		CORS: CORSConfig{
+			AllowMethods: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"},
+			AllowHeaders: []string{"Accept", "Authorization", "Content-Type", "X-API-Key", "X-Request-ID"},
+			ExposeHeaders: []string{"Content-Disposition", "Link", "Location", "Retry-After", "X-Request-ID",
+				"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy"},
+			MaxAge: Duration(10 * time.Minute),
+		},
+		SecurityHeaders: SecurityConfig{
+			Enabled:               true,
+			ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+			FrameOptions:          "DENY",
+			ReferrerPolicy:        "no-referrer",
+			HSTSMaxAge:            Duration(365 * 24 * time.Hour),
+		},
+		Limits:  LimitsConfig{MaxBodyBytes: 32 << 20, MaxImportBytes: 256 << 20, MaxBatchItems: 1000, MaxFieldLength: 256, MaxConcurrentOps: 8},
+		Imports: ImportsConfig{Workers: 4},
+		Tenants: TenantsConfig{MaxProduce: 10000},
+	}
+}
+
+// A setting that can come from the environment or a flag
+type setting struct {
+	key   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+var settings = []setting{
+	{"listen", "address to listen on", func(c *Config, v string) error { c.Listen = v; return nil }},
+	{"http2", "serve HTTP/2 as well as HTTP/1.1", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.HTTP2 = b
+		return err
+	}},
+	{"tls.cert_file", "PEM certificate chain to serve TLS with", func(c *Config, v string) error { c.TLS.CertFile = v; return nil }},
+	{"tls.key_file", "PEM private key of the TLS certificate", func(c *Config, v string) error { c.TLS.KeyFile = v; return nil }},
+	{"tls.reload_interval", "how often the TLS certificate and key files are checked for changes", func(c *Config, v string) error {
+		return c.TLS.ReloadInterval.UnmarshalText([]byte(v))
+	}},
+	{"tls.min_version", "oldest TLS version accepted: 1.2 or 1.3", func(c *Config, v string) error { c.TLS.MinVersion = v; return nil }},
+	{"tls.client_ca_file", "PEM certificates of the CAs that sign client certificates", func(c *Config, v string) error { c.TLS.ClientCAFile = v; return nil }},
+	{"tls.client_auth", "client certificates: none, request or require", func(c *Config, v string) error { c.TLS.ClientAuth = v; return nil }},
+	{"shutdown_timeout", "how long to drain requests and imports on shutdown", func(c *Config, v string) error {
+		return c.ShutdownTimeout.UnmarshalText([]byte(v))
+	}},
+	{"storage.backend", "storage backend: memory or file", func(c *Config, v string) error { c.Storage.Backend = v; return nil }},
+	{"storage.path", "file for the file storage backend", func(c *Config, v string) error { c.Storage.Path = v; return nil }},
+	{"storage.flush_interval", "how often the file storage backend writes changes", func(c *Config, v string) error {
+		return c.Storage.FlushInterval.UnmarshalText([]byte(v))
+	}},
+	{"log.level", "log level: debug, info, warn or error", func(c *Config, v string) error { c.Log.Level = v; return nil }},
+	{"log.format", "log format: text or json", func(c *Config, v string) error { c.Log.Format = v; return nil }},
+	{"log.levels", "comma separated package=level pairs overriding the log level", func(c *Config, v string) error {
+		c.Log.Levels = map[string]string{}
+		for _, pair := range list(v) {
+			pkg, level, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%s is not package=level", pair)
+			}
+			c.Log.Levels[strings.TrimSpace(pkg)] = strings.TrimSpace(level)
+		}
+		return nil
+	}},
+	{"log.body_max_bytes", "longest request body logged at debug level, 0 logs none", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Log.BodyMaxBytes = n
+		return err
+	}},
+	{"tracing.exporter", "trace exporter: none, stdout, file or otlp", func(c *Config, v string) error { c.Tracing.Exporter = v; return nil }},
+	{"tracing.file", "file for the file trace exporter", func(c *Config, v string) error { c.Tracing.File = v; return nil }},
+	{"tracing.endpoint", "OTLP/HTTP collector URL for the otlp trace exporter", func(c *Config, v string) error { c.Tracing.Endpoint = v; return nil }},
+	{"tracing.sample_ratio", "fraction of new traces recorded, 0 to 1", func(c *Config, v string) error {
+		n, err := strconv.ParseFloat(v, 64)
+		c.Tracing.SampleRatio = n
+		return err
+	}},
+	{"auth.tokens", "comma separated bearer tokens accepted", func(c *Config, v string) error { c.Auth.Tokens = list(v); return nil }},
+	{"auth.api_keys", "comma separated API keys accepted", func(c *Config, v string) error { c.Auth.APIKeys = list(v); return nil }},
+	{"auth.keys_file", "file keeping the API keys created through the admin endpoints", func(c *Config, v string) error { c.Auth.KeysFile = v; return nil }},
+	{"auth.jwt_secret", "HMAC secret for HS256, HS384 and HS512 JWT bearer tokens", func(c *Config, v string) error { c.Auth.JWTSecret = v; return nil }},
+	{"auth.jwks_file", "JSON Web Key Set file for RSA and EC signed JWT bearer tokens", func(c *Config, v string) error { c.Auth.JWKSFile = v; return nil }},
+	{"auth.jwt_issuer", "iss claim JWT bearer tokens must have", func(c *Config, v string) error { c.Auth.JWTIssuer = v; return nil }},
+	{"auth.jwt_audience", "aud claim JWT bearer tokens must have", func(c *Config, v string) error { c.Auth.JWTAudience = v; return nil }},
+	{"auth.roles", "comma separated role=permissions pairs, permissions space separated, overriding the roles named", func(c *Config, v string) error {
+		if c.Auth.Roles == nil {
+			c.Auth.Roles = map[string][]string{}
+		}
+		for _, pair := range list(v) {
+			role, perms, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%s is not role=permissions", pair)
+			}
+			c.Auth.Roles[strings.TrimSpace(role)] = strings.Fields(perms)
+		}
+		return nil
+	}},
+	{"auth.static_roles", "comma separated roles of the static tokens and API keys", func(c *Config, v string) error {
+		c.Auth.StaticRoles = list(v)
+		return nil
+	}},
+	{"auth.roles_claim", "JWT claim holding the roles", func(c *Config, v string) error { c.Auth.RolesClaim = v; return nil }},
+	{"auth.store_claim", "JWT claim holding the store the principal is bound to", func(c *Config, v string) error { c.Auth.StoreClaim = v; return nil }},
+	{"cors.allow_origins", "comma separated origins allowed to make cross-origin requests", func(c *Config, v string) error {
+		c.CORS.AllowOrigins = list(v)
+		return nil
+	}},
+	{"cors.allow_methods", "comma separated methods preflight requests allow", func(c *Config, v string) error {
+		c.CORS.AllowMethods = list(v)
+		return nil
+	}},
+	{"cors.allow_headers", "comma separated request headers preflight requests allow", func(c *Config, v string) error {
+		c.CORS.AllowHeaders = list(v)
+		return nil
+	}},
+	{"cors.expose_headers", "comma separated response headers cross-origin scripts may read", func(c *Config, v string) error {
+		c.CORS.ExposeHeaders = list(v)
+		return nil
+	}},
+	{"cors.allow_credentials", "let cross-origin requests carry cookies and client certificates", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.CORS.AllowCredentials = b
+		return err
+	}},
+	{"cors.max_age", "how long browsers may cache a preflight response", func(c *Config, v string) error {
+		return c.CORS.MaxAge.UnmarshalText([]byte(v))
+	}},
+	{"security_headers.enabled", "add security headers to every response", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.SecurityHeaders.Enabled = b
+		return err
+	}},
+	{"security_headers.content_security_policy", "Content-Security-Policy header, empty sends none", func(c *Config, v string) error {
+		c.SecurityHeaders.ContentSecurityPolicy = v
+		return nil
+	}},
+	{"security_headers.frame_options", "X-Frame-Options header: DENY or SAMEORIGIN, empty sends none", func(c *Config, v string) error {
+		c.SecurityHeaders.FrameOptions = v
+		return nil
+	}},
+	{"security_headers.referrer_policy", "Referrer-Policy header, empty sends none", func(c *Config, v string) error {
+		c.SecurityHeaders.ReferrerPolicy = v
+		return nil
+	}},
+	{"security_headers.hsts_max_age", "max-age of the Strict-Transport-Security header on HTTPS requests, 0 sends none", func(c *Config, v string) error {
+		return c.SecurityHeaders.HSTSMaxAge.UnmarshalText([]byte(v))
+	}},
+	{"limits.max_body_bytes", "largest request body accepted", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		c.Limits.MaxBodyBytes = n
+		return err
+	}},
+	{"limits.max_import_bytes", "largest upload to /imports accepted", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		c.Limits.MaxImportBytes = n
+		return err
+	}},
+	{"limits.max_batch_items", "most produce one POST /produce may add", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Limits.MaxBatchItems = n
+		return err
+	}},
+	{"limits.max_field_length", "longest produce name and unit price accepted", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Limits.MaxFieldLength = n
+		return err
+	}},
+	{"limits.max_concurrent_ops", "most store operations one request runs at the same time", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Limits.MaxConcurrentOps = n
+		return err
+	}},
+	{"rate_limit.per_key", "requests/period of each authenticated principal, e.g. 100/1m", func(c *Config, v string) error {
+		return c.RateLimit.PerKey.UnmarshalText([]byte(v))
+	}},
+	{"rate_limit.per_ip", "requests/period from each client IP, e.g. 300/1m", func(c *Config, v string) error {
+		return c.RateLimit.PerIP.UnmarshalText([]byte(v))
+	}},
+	{"rate_limit.routes", "comma separated route=requests/period pairs, e.g. POST /produce=10/1s", func(c *Config, v string) error {
+		c.RateLimit.Routes = map[string]Rate{}
+		for _, pair := range list(v) {
+			route, rate, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("%s is not route=requests/period", pair)
+			}
+			r := Rate{}
+			if err := r.UnmarshalText([]byte(rate)); err != nil {
+				return err
+			}
+			c.RateLimit.Routes[strings.Join(strings.Fields(route), " ")] = r
+		}
+		return nil
+	}},
+	{"rate_limit.trusted_proxies", "comma separated IPs or CIDRs of proxies whose X-Forwarded-For is believed", func(c *Config, v string) error {
+		c.RateLimit.TrustedProxies = list(v)
+		return nil
+	}},
+	{"imports.workers", "imports run at the same time", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Imports.Workers = n
+		return err
+	}},
+	{"tenants.max_produce", "most produce a store created without a quota may hold, 0 for no limit", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.Tenants.MaxProduce = n
+		return err
+	}},
+	{"seed_file", "CSV, NDJSON or JSON file of produce loaded into an empty store", func(c *Config, v string) error { c.SeedFile = v; return nil }},
+}
+
+// Environment variable for a setting key
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// Flag name for a setting key
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, ".", "-"), "_", "-")
+}
+
+// Split a comma separated list, dropping blanks
+func list(v string) []string {
+	values := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// Build the configuration from the command-line args (without the program name) and the
+// environment (os.LookupEnv), then validate it
+// Returns flag.ErrHelp if -h was given
+func Load(args []string, lookupEnv func(string) (string, bool), output io.Writer) (*Config, error) {
+	c := Default()
+
+	// Flags are applied last but must be parsed first to find --config
+	type flagValue struct {
+		s setting
+		v string
+	}
+	flagValues := []flagValue{}
+	configFile, _ := lookupEnv(envPrefix + "CONFIG")
+
+	fs := flag.NewFlagSet("produce_demo", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.StringVar(&configFile, "config", configFile, "YAML or TOML config file (env "+envPrefix+"CONFIG)")
+	fs.BoolVar(&c.PrintConfig, "print-config", false, "print the configuration and exit")
+	for _, s := range settings {
+		s := s
+		fs.Func(flagName(s.key), s.usage+" (env "+envName(s.key)+")", func(v string) error {
+			flagValues = append(flagValues, flagValue{s, v})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("unexpected arguments (%s)", strings.Join(fs.Args(), " "))
+	}
+
+	if configFile != "" {
+		if err := c.readFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if v, ok := lookupEnv(envName(s.key)); ok {
+			if err := s.set(c, v); err != nil {
+				return nil, fmt.Errorf("bad %s (%s): %w", envName(s.key), v, err)
+			}
+		}
+	}
+	for _, fv := range flagValues {
+		if err := fv.s.set(c, fv.v); err != nil {
+			return nil, fmt.Errorf("bad --%s (%s): %w", flagName(fv.s.key), fv.v, err)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Apply a config file over c
+func (c *Config) readFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(b)))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(b), c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) != 0 {
+			return fmt.Errorf("%s: unknown setting (%s)", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: config file must be .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// ValidationError lists every problem found with a configuration
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Errors, "; ")
+}
+
+// Check the configuration - returns a *ValidationError
+func (c *Config) Validate() error {
+	errs := []string{}
+
+	if path, ok := strings.CutPrefix(c.Listen, unixPrefix); ok {
+		if path == "" {
+			errs = append(errs, "listen (unix:) must name the socket's path")
+		}
+	} else if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		errs = append(errs, fmt.Sprintf("listen (%s) must be host:port or unix:/path", c.Listen))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, "tls.cert_file and tls.key_file must be set together")
+	}
+	for _, file := range [][2]string{{"tls.cert_file", c.TLS.CertFile}, {"tls.key_file", c.TLS.KeyFile}, {"tls.client_ca_file", c.TLS.ClientCAFile}} {
+		if file[1] == "" {
+			continue
+		}
+		if info, err := os.Stat(file[1]); err != nil || info.IsDir() {
+			errs = append(errs, fmt.Sprintf("%s (%s) must be a readable file", file[0], file[1]))
+		}
+	}
+	if c.TLS.ReloadInterval < 0 {
+		errs = append(errs, "tls.reload_interval must not be negative")
+	}
+	if !contains(tlsVersions, c.TLS.MinVersion) {
+		errs = append(errs, fmt.Sprintf("tls.min_version (%s) must be one of %s", c.TLS.MinVersion, strings.Join(tlsVersions, ", ")))
+	}
+	switch c.TLS.ClientAuth {
+	case ClientAuthNone:
+	case ClientAuthRequest, ClientAuthRequire:
+		if c.TLS.CertFile == "" || c.TLS.ClientCAFile == "" {
+			errs = append(errs, fmt.Sprintf("tls.client_auth (%s) needs tls.cert_file and tls.client_ca_file", c.TLS.ClientAuth))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("tls.client_auth (%s) must be one of %s, %s, %s", c.TLS.ClientAuth, ClientAuthNone, ClientAuthRequest, ClientAuthRequire))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, "shutdown_timeout must be positive")
+	}
+
+	switch c.Storage.Backend {
+	case BackendMemory:
+	case BackendFile:
+		if c.Storage.Path == "" {
+			errs = append(errs, "storage.path must be set for the file backend")
+		}
+		if c.Storage.FlushInterval <= 0 {
+			errs = append(errs, "storage.flush_interval must be positive")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("storage.backend (%s) must be %s or %s", c.Storage.Backend, BackendMemory, BackendFile))
+	}
+
+	if !contains(logLevels, c.Log.Level) {
+		errs = append(errs, fmt.Sprintf("log.level (%s) must be one of %s", c.Log.Level, strings.Join(logLevels, ", ")))
+	}
+	if c.Log.Format != LogText && c.Log.Format != LogJSON {
+		errs = append(errs, fmt.Sprintf("log.format (%s) must be %s or %s", c.Log.Format, LogText, LogJSON))
+	}
+	pkgs := make([]string, 0, len(c.Log.Levels))
+	for pkg := range c.Log.Levels {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		if !contains(logLevels, c.Log.Levels[pkg]) {
+			errs = append(errs, fmt.Sprintf("log.levels %s (%s) must be one of %s", pkg, c.Log.Levels[pkg], strings.Join(logLevels, ", ")))
+		}
+	}
+	if c.Log.BodyMaxBytes < 0 {
+		errs = append(errs, "log.body_max_bytes must not be negative")
+	}
+
+	switch c.Tracing.Exporter {
+	case TraceNone, TraceStdout, TraceOTLP:
+	case TraceFile:
+		if c.Tracing.File == "" {
+			errs = append(errs, "tracing.file must be set for the file exporter")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("tracing.exporter (%s) must be one of %s, %s, %s, %s", c.Tracing.Exporter, TraceNone, TraceStdout, TraceFile, TraceOTLP))
+	}
+	if c.Tracing.Endpoint != "" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Sprintf("tracing.endpoint (%s) must be an http or https URL", c.Tracing.Endpoint))
+		}
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, "tracing.sample_ratio must be between 0 and 1")
+	}
+
+	for _, secret := range c.Auth.Tokens {
+		if !validSecret(secret) {
+			errs = append(errs, "auth.tokens must be in the clear or sha256: followed by 64 hex digits")
+			break
+		}
+	}
+	for _, secret := range c.Auth.APIKeys {
+		if !validSecret(secret) {
+			errs = append(errs, "auth.api_keys must be in the clear or sha256: followed by 64 hex digits")
+			break
+		}
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		errs = append(errs, "auth.jwt_secret must be at least 32 bytes")
+	}
+	if c.Auth.JWKSFile != "" {
+		if info, err := os.Stat(c.Auth.JWKSFile); err != nil || info.IsDir() {
+			errs = append(errs, fmt.Sprintf("auth.jwks_file (%s) must be a readable file", c.Auth.JWKSFile))
+		}
+	}
+	if (c.Auth.JWTIssuer != "" || c.Auth.JWTAudience != "") && c.Auth.JWTSecret == "" && c.Auth.JWKSFile == "" {
+		errs = append(errs, "auth.jwt_issuer and auth.jwt_audience need auth.jwt_secret or auth.jwks_file")
+	}
+
+	roles := make([]string, 0, len(c.Auth.Roles))
+	for role := range c.Auth.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		if strings.TrimSpace(role) == "" {
+			errs = append(errs, "auth.roles names must not be blank")
+		}
+		for _, permission := range c.Auth.Roles[role] {
+			if !contains(permissions, permission) {
+				errs = append(errs, fmt.Sprintf("auth.roles %s permission (%s) must be one of %s", role, permission, strings.Join(permissions, ", ")))
+			}
+		}
+	}
+	for _, role := range c.Auth.StaticRoles {
+		if _, ok := c.Auth.Roles[role]; !ok {
+			errs = append(errs, fmt.Sprintf("auth.static_roles (%s) must be one of auth.roles", role))
+		}
+	}
+	if c.Auth.RolesClaim == "" {
+		errs = append(errs, "auth.roles_claim must be set")
+	}
+	if c.Auth.StoreClaim == "" {
+		errs = append(errs, "auth.store_claim must be set")
+	}
+
+	for _, origin := range c.CORS.AllowOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Sprintf("cors.allow_origins (%s) must be * or scheme://host[:port]", origin))
+		}
+	}
+	for _, method := range c.CORS.AllowMethods {
+		if !contains(routeMethods, method) {
+			errs = append(errs, fmt.Sprintf("cors.allow_methods (%s) must be one of %s", method, strings.Join(routeMethods, ", ")))
+		}
+	}
+	for _, header := range append(append([]string{}, c.CORS.AllowHeaders...), c.CORS.ExposeHeaders...) {
+		if !validHeader(header) {
+			errs = append(errs, fmt.Sprintf("cors header (%s) must be a header name", header))
+		}
+	}
+	if c.CORS.AllowCredentials && contains(c.CORS.AllowOrigins, "*") {
+		errs = append(errs, "cors.allow_credentials needs cors.allow_origins listed rather than *")
+	}
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, "cors.max_age must not be negative")
+	}
+	if !contains(frameOptions, c.SecurityHeaders.FrameOptions) {
+		errs = append(errs, fmt.Sprintf("security_headers.frame_options (%s) must be DENY, SAMEORIGIN or empty", c.SecurityHeaders.FrameOptions))
+	}
+	if c.SecurityHeaders.HSTSMaxAge < 0 {
+		errs = append(errs, "security_headers.hsts_max_age must not be negative")
+	}
+
+	if !c.RateLimit.PerKey.valid() {
+		errs = append(errs, "rate_limit.per_key must be a positive number of requests per positive period")
+	}
+	if !c.RateLimit.PerIP.valid() {
+		errs = append(errs, "rate_limit.per_ip must be a positive number of requests per positive period")
+	}
+	routes := make([]string, 0, len(c.RateLimit.Routes))
+	for route := range c.RateLimit.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		if !contains(routeMethods, method) || !strings.HasPrefix(path, "/") {
+			errs = append(errs, fmt.Sprintf("rate_limit.routes (%s) must be METHOD /path", route))
+		}
+		if r := c.RateLimit.Routes[route]; !r.Enabled() || !r.valid() {
+			errs = append(errs, fmt.Sprintf("rate_limit.routes %s must be a positive number of requests per positive period", route))
+		}
+	}
+	for _, proxy := range c.RateLimit.TrustedProxies {
+		if _, ok := parseIPRange(proxy); !ok {
+			errs = append(errs, fmt.Sprintf("rate_limit.trusted_proxies (%s) must be an IP or CIDR", proxy))
+		}
+	}
+
+	if c.Limits.MaxBodyBytes <= 0 {
+		errs = append(errs, "limits.max_body_bytes must be positive")
+	}
+	if c.Limits.MaxImportBytes <= 0 {
+		errs = append(errs, "limits.max_import_bytes must be positive")
+	}
+	if c.Limits.MaxBatchItems <= 0 {
+		errs = append(errs, "limits.max_batch_items must be positive")
+	}
+	if c.Limits.MaxFieldLength <= 0 {
+		errs = append(errs, "limits.max_field_length must be positive")
+	}
+	if c.Limits.MaxConcurrentOps <= 0 {
+		errs = append(errs, "limits.max_concurrent_ops must be positive")
+	}
+	if c.Imports.Workers <= 0 {
+		errs = append(errs, "imports.workers must be positive")
+	}
+	if c.Tenants.MaxProduce < 0 {
+		errs = append(errs, "tenants.max_produce must not be negative")
+	}
+
+	if c.SeedFile != "" {
+		if info, err := os.Stat(c.SeedFile); err != nil || info.IsDir() {
+			errs = append(errs, fmt.Sprintf("seed_file (%s) must be a readable file", c.SeedFile))
+		}
+	}
+
+	if len(errs) != 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// Static secrets are given in the clear or as sha256:<64 hex digits>
+func validSecret(secret string) bool {
+	h, ok := strings.CutPrefix(secret, "sha256:")
+	if !ok {
+		return secret != ""
+	}
+	if len(h) != 64 {
+		return false
+	}
+	for _, r := range h {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Header names are tokens: letters, digits and a few symbols
+func validHeader(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Write the configuration as YAML with secrets masked
+func (c *Config) Write(w io.Writer) error {
+	masked := *c
+	masked.Auth.Tokens = mask(c.Auth.Tokens)
+	masked.Auth.APIKeys = mask(c.Auth.APIKeys)
+	if c.Auth.JWTSecret != "" {
+		masked.Auth.JWTSecret = "********"
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&masked); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func mask(secrets []string) []string {
+	masked := make([]string, len(secrets))
+	for i := range secrets {
+		masked[i] = "********"
+	}
+	return masked
+}
@@ -0,0 +1,243 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to write a config file into a temporary directory
+func writeConfig(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Helper function returning a lookupEnv over a map
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+}
+
+const yamlConfig = `
+listen: "127.0.0.1:9000"
+storage:
+  backend: file
+  path: /tmp/produce.json
+  flush_interval: 30s
+log:
+  level: debug
+  levels:
+    handlers: warn
+auth:
+  tokens: [file-token]
+cors:
+  allow_origins: ["https://shop.example.com"]
+  allow_credentials: true
+  max_age: 1h
+security_headers:
+  frame_options: SAMEORIGIN
+rate_limit:
+  per_key: 100/1m
+  routes:
+    POST /produce: 10/s
+`
+
+const tomlConfig = `
+listen = "127.0.0.1:9001"
+seed_file = ""
+
+[storage]
+backend = "memory"
+
+[log]
+format = "json"
+
+[imports]
+workers = 8
+
+[tracing]
+exporter = "otlp"
+endpoint = "http://collector:4318"
+sample_ratio = 0.25
+`
+
+// Test each layer overrides the one before
+func TestLoadLayers(t *testing.T) {
+	yamlPath := writeConfig(t, "produce.yaml", yamlConfig)
+
+	// Defaults
+	c, err := Load(nil, env(nil), io.Discard)
+	if err != nil || c.Listen != ":8080" || c.Storage.Backend != BackendMemory || c.Log.Level != "info" {
+		t.Errorf("ERROR -- expected the defaults but got (%+v) (%v)\n", c, err)
+	}
+
+	// File
+	c, err = Load([]string{"--config", yamlPath}, env(nil), io.Discard)
+	if err != nil || c.Listen != "127.0.0.1:9000" || c.Storage.Backend != BackendFile ||
+		time.Duration(c.Storage.FlushInterval) != 30*time.Second || c.Log.Level != "debug" || c.Log.Format != LogText ||
+		len(c.Auth.Tokens) != 1 || c.Auth.Tokens[0] != "file-token" || c.Log.Levels["handlers"] != "warn" ||
+		c.RateLimit.PerKey != (Rate{100, time.Minute}) || c.RateLimit.Routes["POST /produce"] != (Rate{10, time.Second}) || c.RateLimit.PerIP.Enabled() ||
+		!c.CORS.AllowCredentials || time.Duration(c.CORS.MaxAge) != time.Hour || len(c.CORS.AllowMethods) != 6 ||
+		c.SecurityHeaders.FrameOptions != "SAMEORIGIN" || !c.SecurityHeaders.Enabled {
+		t.Errorf("ERROR -- expected the YAML settings but got (%+v) (%v)\n", c, err)
+	}
+
+	// Environment over the file (also found through PRODUCE_DEMO_CONFIG)
+	c, err = Load(nil, env(map[string]string{
+		"PRODUCE_DEMO_CONFIG":          yamlPath,
+		"PRODUCE_DEMO_LOG_LEVEL":       "warn",
+		"PRODUCE_DEMO_AUTH_TOKENS":     "a, b,,",
+		"PRODUCE_DEMO_IMPORTS_WORKERS": "2",
+		"PRODUCE_DEMO_LOG_LEVELS":      "db=debug, http = error",
+		"PRODUCE_DEMO_AUTH_ROLES":      "cashier=produce:read produce:write, auditor=",
+	}), io.Discard)
+	if err != nil || c.Listen != "127.0.0.1:9000" || c.Log.Level != "warn" || len(c.Log.Levels) != 2 ||
+		c.Log.Levels["db"] != "debug" || c.Log.Levels["http"] != "error" ||
+		strings.Join(c.Auth.Tokens, "|") != "a|b" || c.Imports.Workers != 2 ||
+		strings.Join(c.Auth.Roles["cashier"], "|") != "produce:read|produce:write" || len(c.Auth.Roles["auditor"]) != 0 ||
+		len(c.Auth.Roles) != 5 {
+		t.Errorf("ERROR -- expected the environment settings but got (%+v) (%v)\n", c, err)
+	}
+
+	// Flags over the environment
+	c, err = Load([]string{"--config", yamlPath, "--log-level", "error", "--storage-flush-interval", "1m", "--print-config"},
+		env(map[string]string{"PRODUCE_DEMO_LOG_LEVEL": "warn"}), io.Discard)
+	if err != nil || c.Log.Level != "error" || time.Duration(c.Storage.FlushInterval) != time.Minute || !c.PrintConfig {
+		t.Errorf("ERROR -- expected the flag settings but got (%+v) (%v)\n", c, err)
+	}
+
+	// A Unix socket without HTTP/2
+	c, err = Load([]string{"--listen", "unix:/run/produce_demo.sock", "--http2=false"}, env(nil), io.Discard)
+	if err != nil || c.Listen != "unix:/run/produce_demo.sock" || c.HTTP2 {
+		t.Errorf("ERROR -- expected the Unix socket settings but got (%+v) (%v)\n", c, err)
+	}
+
+	// TOML
+	c, err = Load([]string{"--config", writeConfig(t, "produce.toml", tomlConfig)}, env(nil), io.Discard)
+	if err != nil || c.Listen != "127.0.0.1:9001" || c.Log.Format != LogJSON || c.Imports.Workers != 8 ||
+		c.Tracing.Exporter != TraceOTLP || c.Tracing.Endpoint != "http://collector:4318" || c.Tracing.SampleRatio != 0.25 {
+		t.Errorf("ERROR -- expected the TOML settings but got (%+v) (%v)\n", c, err)
+	}
+}
+
+// loadTestStruct
+type loadTS struct {
+	args     []string
+	env      map[string]string
+	expected string // Expected to be contained in the error
+}
+
+// loadTestStructs: test cases
+var loadTSs = []loadTS{
+	{[]string{"--listen", "8080"}, nil, "listen (8080) must be host:port"},
+	{[]string{"--listen", "unix:"}, nil, "listen (unix:) must name the socket's path"},
+	{[]string{"--http2", "maybe"}, nil, "bad --http2 (maybe)"},
+	{[]string{"--tls-cert-file", "/no/such/cert.pem"}, nil,
+		"tls.cert_file and tls.key_file must be set together; tls.cert_file (/no/such/cert.pem) must be a readable file"},
+	{[]string{"--tls-client-auth", "require"}, nil, "tls.client_auth (require) needs tls.cert_file and tls.client_ca_file"},
+	{[]string{"--tls-min-version", "1.1", "--tls-client-auth", "maybe", "--tls-reload-interval", "-1s"}, nil,
+		"tls.reload_interval must not be negative; tls.min_version (1.1) must be one of 1.2, 1.3; tls.client_auth (maybe) must be one of none, request, require"},
+	{[]string{"--storage-backend", "postgres"}, nil, "storage.backend (postgres) must be memory or file"},
+	{[]string{"--storage-backend", "file", "--storage-path", ""}, nil, "storage.path must be set"},
+	{[]string{"--log-level", "loud", "--log-format", "xml"}, nil, "log.level (loud) must be one of debug, info, warn, error; log.format (xml)"},
+	{[]string{"--log-levels", "db=loud"}, nil, "log.levels db (loud) must be one of"},
+	{[]string{"--log-levels", "db"}, nil, "bad --log-levels (db): db is not package=level"},
+	{[]string{"--log-body-max-bytes", "-1"}, nil, "log.body_max_bytes must not be negative"},
+	{[]string{"--tracing-exporter", "jaeger"}, nil, "tracing.exporter (jaeger) must be one of none, stdout, file, otlp"},
+	{[]string{"--tracing-exporter", "file", "--tracing-file", ""}, nil, "tracing.file must be set"},
+	{[]string{"--tracing-endpoint", "localhost:4318", "--tracing-sample-ratio", "2"}, nil,
+		"tracing.endpoint (localhost:4318) must be an http or https URL; tracing.sample_ratio must be between 0 and 1"},
+	{[]string{"--cors-allow-origins", "shop.example.com"}, nil, "cors.allow_origins (shop.example.com) must be"},
+	{[]string{"--cors-allow-methods", "GET,OPTIONS", "--cors-allow-headers", "X-API-Key,Bad Header", "--cors-max-age", "-1s"}, nil,
+		"cors.allow_methods (OPTIONS) must be one of GET, POST, PUT, DELETE, PATCH, HEAD; cors header (Bad Header) must be a header name; cors.max_age must not be negative"},
+	{[]string{"--cors-allow-origins", "*", "--cors-allow-credentials", "true"}, nil, "cors.allow_credentials needs cors.allow_origins listed rather than *"},
+	{[]string{"--security-headers-frame-options", "ALLOW", "--security-headers-hsts-max-age", "-1h"}, nil,
+		"security_headers.frame_options (ALLOW) must be DENY, SAMEORIGIN or empty; security_headers.hsts_max_age must not be negative"},
+	{[]string{"--limits-max-body-bytes", "0", "--limits-max-import-bytes", "-1"}, nil, "limits.max_body_bytes must be positive; limits.max_import_bytes must be positive"},
+	{[]string{"--limits-max-batch-items", "0", "--limits-max-field-length", "-1", "--limits-max-concurrent-ops", "0"}, nil,
+		"limits.max_batch_items must be positive; limits.max_field_length must be positive; limits.max_concurrent_ops must be positive"},
+	{[]string{"--rate-limit-per-key", "100"}, nil, "bad --rate-limit-per-key (100): 100 is not requests/period"},
+	{[]string{"--rate-limit-per-ip", "0/1m"}, nil, "rate_limit.per_ip must be a positive number of requests per positive period"},
+	{[]string{"--rate-limit-routes", "FETCH /produce=1/s, POST /produce=1/-1s"}, nil,
+		"rate_limit.routes (FETCH /produce) must be METHOD /path; rate_limit.routes POST /produce must be a positive number"},
+	{[]string{"--rate-limit-trusted-proxies", "10.0.0.0/8, proxy.example.com"}, nil, "rate_limit.trusted_proxies (proxy.example.com) must be an IP or CIDR"},
+	{[]string{"--auth-roles", "cashier=produce:sell"}, nil, "auth.roles cashier permission (produce:sell) must be one of produce:read, produce:write, produce:delete, admin"},
+	{[]string{"--auth-roles", "cashier"}, nil, "bad --auth-roles (cashier): cashier is not role=permissions"},
+	{[]string{"--auth-static-roles", "owner", "--auth-roles-claim", ""}, nil, "auth.static_roles (owner) must be one of auth.roles; auth.roles_claim must be set"},
+	{[]string{"--auth-store-claim", ""}, nil, "auth.store_claim must be set"},
+	{[]string{"--auth-api-keys", "sha256:abc"}, nil, "auth.api_keys must be in the clear or sha256: followed by 64 hex digits"},
+	{[]string{"--auth-jwt-secret", "short"}, nil, "auth.jwt_secret must be at least 32 bytes"},
+	{[]string{"--auth-jwks-file", "/no/such/jwks.json"}, nil, "auth.jwks_file (/no/such/jwks.json) must be a readable file"},
+	{[]string{"--auth-jwt-issuer", "https://issuer.example.com"}, nil, "auth.jwt_issuer and auth.jwt_audience need auth.jwt_secret or auth.jwks_file"},
+	{nil, map[string]string{"PRODUCE_DEMO_IMPORTS_WORKERS": "many"}, "bad PRODUCE_DEMO_IMPORTS_WORKERS (many)"},
+	{[]string{"--tenants-max-produce", "-1"}, nil, "tenants.max_produce must not be negative"},
+	{[]string{"--storage-flush-interval", "soon"}, nil, "bad --storage-flush-interval (soon)"},
+	{[]string{"--seed-file", "/no/such/seed.csv"}, nil, "seed_file (/no/such/seed.csv) must be a readable file"},
+	{[]string{"--config", "/no/such/produce.yaml"}, nil, "no such file"},
+	{[]string{"--no-such-flag"}, nil, "flag provided but not defined"},
+	{[]string{"extra"}, nil, "unexpected arguments (extra)"},
+}
+
+// Test bad settings are rejected
+func TestLoadErrors(t *testing.T) {
+	for _, tt := range loadTSs {
+		_, err := Load(tt.args, env(tt.env), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("ERROR -- for (%v %v) expected (%v) but got (%v)\n", tt.args, tt.env, tt.expected, err)
+		}
+	}
+
+	if _, err := Load([]string{"-h"}, env(nil), io.Discard); !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", flag.ErrHelp, err)
+	}
+
+	// Unknown settings in a file are mistakes
+	for _, path := range []string{
+		writeConfig(t, "bad.yaml", "listen: \":8080\"\nlistne: \":9090\"\n"),
+		writeConfig(t, "bad.toml", "listne = \":9090\"\n"),
+		writeConfig(t, "bad.ini", "listen=:8080\n"),
+	} {
+		if _, err := Load([]string{"--config", path}, env(nil), io.Discard); err == nil {
+			t.Errorf("ERROR -- expected an error for (%v)\n", path)
+		}
+	}
+}
+
+// Test the printed configuration reads back the same, with secrets masked
+func TestWrite(t *testing.T) {
+	c := Default()
+	c.Auth.APIKeys = []string{"api-key-1"}
+	c.Storage.FlushInterval = Duration(90 * time.Second)
+	c.RateLimit.PerIP = Rate{300, time.Minute}
+
+	b := &bytes.Buffer{}
+	if err := c.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(b.String(), "api-key-1") || !strings.Contains(b.String(), "flush_interval: 1m30s") {
+		t.Errorf("ERROR -- unexpected configuration (%v)\n", b.String())
+	}
+
+	read, err := Load([]string{"--config", writeConfig(t, "printed.yaml", b.String())}, env(nil), io.Discard)
+	if err != nil || read.Listen != c.Listen || read.Storage != c.Storage || read.Limits != c.Limits || read.RateLimit.PerIP != c.RateLimit.PerIP {
+		t.Errorf("ERROR -- expected (%+v) but got (%+v) (%v)\n", c, read, err)
+	}
+
+	// The JWT secret is masked too
+	c.Auth.JWTSecret = "jwt-secret-jwt-secret-jwt-secret"
+	b.Reset()
+	if err := c.Write(b); err != nil || strings.Contains(b.String(), c.Auth.JWTSecret) {
+		t.Errorf("ERROR -- expected the JWT secret masked but got (%v) (%v)\n", b.String(), err)
+	}
+}
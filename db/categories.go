@@ -0,0 +1,311 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"example.com/produce_demo/common"
+)
+
+// Errors returned by CategoryTree operations
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("category already exists")
+	ErrParentNotFound   = errors.New("parent category not found")
+	ErrCategoryCycle    = errors.New("category would be its own ancestor")
+	ErrCategoryInUse    = errors.New("category has subcategories or produce")
+)
+
+// Category IDs are lower case letters, digits and dashes so they can appear in URLs and queries
+var categoryIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Reports whether id may be a Category ID
+func ValidCategoryID(id string) bool {
+	return categoryIDPattern.MatchString(id)
+}
+
+// Category groups Produce, such as Fruit > Stone Fruit > Peach
+type Category struct {
+	ID     string `json:"ID"`
+	Name   string `json:"Name"`
+	Parent string `json:"Parent,omitempty"` // ID of the category this is under - empty for a top-level category
+}
+
+// CategoryTree holds the categories shared by every store's catalog
+// With the file backend they are kept in a file beside Default's file - see sideFile
+type CategoryTree struct {
+	mutex      *sync.RWMutex
+	categories map[string]Category
+	path       string // File the categories are kept in - empty to keep them in memory
+}
+
+// Categories is the tree of categories served by the API
+var Categories = &CategoryTree{mutex: &sync.RWMutex{}, categories: map[string]Category{}}
+
+func init() {
+	common.SetCategoryCheck(Categories.Exists)
+}
+
+// Create a category under its Parent, if it has one
+// ErrCategoryExists if its ID is taken, ErrParentNotFound if its Parent does not exist
+func (t *CategoryTree) Create(c Category) (Category, error) {
+	if !ValidCategoryID(c.ID) {
+		return Category{}, errors.New("bad category ID (" + c.ID + ")")
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, ok := t.categories[c.ID]; ok {
+		return Category{}, ErrCategoryExists
+	}
+	if _, ok := t.categories[c.Parent]; c.Parent != "" && !ok {
+		return Category{}, ErrParentNotFound
+	}
+	t.categories[c.ID] = c
+	if err := t.save(); err != nil {
+		delete(t.categories, c.ID)
+		return Category{}, err
+	}
+	return c, nil
+}
+
+// The category with id - ErrCategoryNotFound if there is none
+func (t *CategoryTree) Get(id string) (Category, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	c, ok := t.categories[id]
+	if !ok {
+		return Category{}, ErrCategoryNotFound
+	}
+	return c, nil
+}
+
+// Reports whether there is a category with id
+func (t *CategoryTree) Exists(id string) bool {
+	_, err := t.Get(id)
+	return err == nil
+}
+
+// Every category, sorted by ID
+func (t *CategoryTree) List() []Category {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	categories := make([]Category, 0, len(t.categories))
+	for _, c := range t.categories {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+	return categories
+}
+
+// IDs of the categories from the top of the tree down to id - ErrCategoryNotFound if there is none
+func (t *CategoryTree) Path(id string) ([]string, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if _, ok := t.categories[id]; !ok {
+		return nil, ErrCategoryNotFound
+	}
+	path := []string{}
+	for ; id != ""; id = t.categories[id].Parent {
+		path = append([]string{id}, path...)
+	}
+	return path, nil
+}
+
+// IDs of the categories directly under id, sorted
+func (t *CategoryTree) Children(id string) []string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	children := []string{}
+	for _, c := range t.categories {
+		if c.Parent == id {
+			children = append(children, c.ID)
+		}
+	}
+	sort.Strings(children)
+	return children
+}
+
+// Set of id and every category under it - ErrCategoryNotFound if there is no category with id
+func (t *CategoryTree) Descendants(id string) (map[string]bool, error) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if _, ok := t.categories[id]; !ok {
+		return nil, ErrCategoryNotFound
+	}
+	descendants := map[string]bool{id: true}
+	for _, c := range t.categories {
+		if t.under(c.ID, id) {
+			descendants[c.ID] = true
+		}
+	}
+	return descendants, nil
+}
+
+// Reports whether id is ancestor or below it - the mutex must be held
+func (t *CategoryTree) under(id string, ancestor string) bool {
+	// Each step goes up a level, so a tree of n categories has at most n steps
+	for steps := 0; id != "" && steps <= len(t.categories); steps++ {
+		if id == ancestor {
+			return true
+		}
+		id = t.categories[id].Parent
+	}
+	return false
+}
+
+// Rename the category with c's ID and move it, with everything under it, to c's Parent
+// ErrCategoryNotFound if there is none, ErrParentNotFound if the Parent does not exist, and
+// ErrCategoryCycle if the Parent is the category or under it
+func (t *CategoryTree) Update(c Category) (Category, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	old, ok := t.categories[c.ID]
+	if !ok {
+		return Category{}, ErrCategoryNotFound
+	}
+	if c.Parent != "" {
+		if _, ok := t.categories[c.Parent]; !ok {
+			return Category{}, ErrParentNotFound
+		}
+		if t.under(c.Parent, c.ID) {
+			return Category{}, ErrCategoryCycle
+		}
+	}
+	t.categories[c.ID] = c
+	if err := t.save(); err != nil {
+		t.categories[c.ID] = old
+		return Category{}, err
+	}
+	return c, nil
+}
+
+// Delete the category with id - returns what was deleted
+// ErrCategoryNotFound if there is none, ErrCategoryInUse if a category is under it or Produce in
+// any store's catalog is in it
+func (t *CategoryTree) Delete(id string) (Category, error) {
+	// The category is taken out before the catalogs are looked through, so no Produce can be put
+	// in it meanwhile - Store.Add and Update check its Category exists holding the store's lock
+	t.mutex.Lock()
+	c, ok := t.categories[id]
+	if !ok {
+		t.mutex.Unlock()
+		return Category{}, ErrCategoryNotFound
+	}
+	for _, other := range t.categories {
+		if other.Parent == id {
+			t.mutex.Unlock()
+			return Category{}, ErrCategoryInUse
+		}
+	}
+	delete(t.categories, id)
+	t.mutex.Unlock()
+
+	inUse := false
+	for _, s := range append([]*Store{Default}, Tenants.stores()...) {
+		if inUse = s.inCategory(id); inUse {
+			break
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if inUse {
+		t.categories[id] = c
+		return Category{}, ErrCategoryInUse
+	}
+	if err := t.save(); err != nil {
+		t.categories[id] = c
+		return Category{}, err
+	}
+	return c, nil
+}
+
+// Reports whether any of the rows is in the category with id
+func (s *Store) inCategory(id string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, p := range s.rows {
+		if p.Category == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Replace every category with categories - the caller checks their IDs and parents
+// The categories are put back if they cannot be saved
+func (t *CategoryTree) Replace(categories []Category) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	old := t.categories
+	t.categories = make(map[string]Category, len(categories))
+	for _, c := range categories {
+		t.categories[c.ID] = c
+	}
+	if err := t.save(); err != nil {
+		t.categories = old
+		return err
+	}
+	return nil
+}
+
+// Keep the categories in the file at path, replacing the current categories with those in it if it exists
+func (t *CategoryTree) open(path string) error {
+	listed := []Category{}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &listed); err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.path = path
+	t.categories = map[string]Category{}
+	for _, c := range listed {
+		if !ValidCategoryID(c.ID) {
+			return errors.New(path + ": bad category ID (" + c.ID + ")")
+		}
+		t.categories[c.ID] = c
+	}
+	for _, c := range t.categories {
+		if _, ok := t.categories[c.Parent]; c.Parent != "" && (!ok || t.under(c.Parent, c.ID)) {
+			return errors.New(path + ": category " + c.ID + " has a bad parent (" + c.Parent + ")")
+		}
+	}
+	return t.save()
+}
+
+// Stop keeping the categories in a file - they stay in memory
+func (t *CategoryTree) close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.path = ""
+}
+
+// Write the categories, if they are kept in a file - the mutex must be held
+func (t *CategoryTree) save() error {
+	if t.path == "" {
+		return nil
+	}
+	categories := make([]Category, 0, len(t.categories))
+	for _, c := range t.categories {
+		categories = append(categories, c)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+	b, err := json.MarshalIndent(categories, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(t.path, b)
+}
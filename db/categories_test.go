@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+)
+
+// Remove every category
+func resetCategories() {
+	Categories.mutex.Lock()
+	defer Categories.mutex.Unlock()
+	Categories.categories = map[string]Category{}
+}
+
+// Test categories form a tree that can be walked, rearranged without cycles and pruned when empty
+func TestCategories(t *testing.T) {
+	resetCategories()
+	defer resetCategories()
+	resetRows()
+	defer resetRows()
+
+	for _, c := range []Category{{ID: "fruit", Name: "Fruit"}, {ID: "stone-fruit", Name: "Stone Fruit", Parent: "fruit"}, {ID: "peach", Name: "Peach", Parent: "stone-fruit"}, {ID: "veg", Name: "Vegetables"}} {
+		if _, err := Categories.Create(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Categories.Create(Category{ID: "fruit", Name: "Again"}); !errors.Is(err, ErrCategoryExists) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrCategoryExists, err)
+	}
+	if _, err := Categories.Create(Category{ID: "nut", Name: "Nut", Parent: "none"}); !errors.Is(err, ErrParentNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrParentNotFound, err)
+	}
+	if _, err := Categories.Create(Category{ID: "Nut", Name: "Nut"}); err == nil {
+		t.Errorf("ERROR -- expected an error for a bad category ID\n")
+	}
+
+	if path, _ := Categories.Path("peach"); !reflect.DeepEqual(path, []string{"fruit", "stone-fruit", "peach"}) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", []string{"fruit", "stone-fruit", "peach"}, path)
+	}
+	if children := Categories.Children(""); !reflect.DeepEqual(children, []string{"fruit", "veg"}) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", []string{"fruit", "veg"}, children)
+	}
+	expected := map[string]bool{"fruit": true, "stone-fruit": true, "peach": true}
+	if descendants, _ := Categories.Descendants("fruit"); !reflect.DeepEqual(descendants, expected) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", expected, descendants)
+	}
+
+	// A category cannot be moved under itself or anything under it
+	for _, parent := range []string{"stone-fruit", "peach"} {
+		if _, err := Categories.Update(Category{ID: "stone-fruit", Name: "Stone Fruit", Parent: parent}); !errors.Is(err, ErrCategoryCycle) {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", parent, ErrCategoryCycle, err)
+		}
+	}
+	if _, err := Categories.Update(Category{ID: "stone-fruit", Name: "Drupes", Parent: "veg"}); err != nil {
+		t.Fatal(err)
+	}
+	if path, _ := Categories.Path("peach"); !reflect.DeepEqual(path, []string{"veg", "stone-fruit", "peach"}) {
+		t.Errorf("ERROR -- expected the move to carry peach but got (%v)\n", path)
+	}
+
+	// Only empty categories can be deleted
+	if _, err := Categories.Delete("stone-fruit"); !errors.Is(err, ErrCategoryInUse) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrCategoryInUse, err)
+	}
+	ctx := context.Background()
+	Default.Update(ctx, common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99", Category: "peach"})
+	if _, err := Categories.Delete("peach"); !errors.Is(err, ErrCategoryInUse) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrCategoryInUse, err)
+	}
+	resetRows()
+	if _, err := Categories.Delete("peach"); err != nil {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", nil, err)
+	}
+	if _, err := Categories.Delete("peach"); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrCategoryNotFound, err)
+	}
+}
+
+// Test Produce cannot be put in a category as it is deleted - either the delete fails or the Produce does
+func TestCategoryDeleteRace(t *testing.T) {
+	resetCategories()
+	defer resetCategories()
+	resetRows()
+	defer resetRows()
+	ctx := context.Background()
+	peach := common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99", Category: "peach"}
+
+	for i := 0; i < 200; i++ {
+		Categories.Create(Category{ID: "peach", Name: "Peach"})
+		var deleteErr, updateErr error
+		wg := sync.WaitGroup{}
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, deleteErr = Categories.Delete("peach")
+		}()
+		go func() {
+			defer wg.Done()
+			_, updateErr = Default.Update(ctx, peach)
+		}()
+		wg.Wait()
+
+		p, _ := Default.Get(ctx, peach.ProduceCode)
+		switch {
+		case deleteErr == nil && (updateErr == nil || p.Category == "peach"):
+			t.Fatalf("ERROR -- for #%d expected the delete or the update to fail but got (%v) (%v) (%v)\n", i, deleteErr, updateErr, p)
+		case deleteErr == nil && !errors.Is(updateErr, ErrCategoryNotFound):
+			t.Fatalf("ERROR -- for #%d expected (%v) but got (%v)\n", i, ErrCategoryNotFound, updateErr)
+		case deleteErr != nil && !errors.Is(deleteErr, ErrCategoryInUse):
+			t.Fatalf("ERROR -- for #%d expected (%v) but got (%v)\n", i, ErrCategoryInUse, deleteErr)
+		}
+		peach.Category = ""
+		Default.Update(ctx, peach)
+		peach.Category = "peach"
+		Categories.Delete("peach")
+	}
+}
+
+// Test the file backend keeps the categories beside the default store
+func TestCategoryFiles(t *testing.T) {
+	resetCategories()
+	defer resetCategories()
+	resetRows()
+	defer resetRows()
+	path := filepath.Join(t.TempDir(), "produce.json")
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	Categories.Create(Category{ID: "fruit", Name: "Fruit"})
+	Categories.Create(Category{ID: "citrus", Name: "Citrus", Parent: "fruit"})
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resetCategories()
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	expected := []Category{{ID: "citrus", Name: "Citrus", Parent: "fruit"}, {ID: "fruit", Name: "Fruit"}}
+	if categories := Categories.List(); !reflect.DeepEqual(categories, expected) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", expected, categories)
+	}
+}
@@ -1,82 +1,107 @@
 package db
 
 import (
-	"example.com/produce_demo/common"
+	"context"
+	"errors"
 	"strings"
-	"sync"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/metrics"
 )
 
-var mutex = &sync.Mutex{}
+// Default is the catalog served by the API
+var Default = New([]common.Produce{
+	common.Produce{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+	common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
+	common.Produce{ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
+	common.Produce{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+})
+
+func init() {
+	Default.rowsGauge = metrics.StoreRows
+}
+
+// The functions below adapt the channel-per-call API to Default while callers migrate to Store
 
-var rows = map[string]common.Produce{
-	"A12T-4GH7-QPL9-3N4M": common.Produce{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
-	"E5T6-9UI3-TH15-QR88": common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
-	"YRT6-72AS-K736-L4AR": common.Produce{ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
-	"TQ4C-VV6T-75ZX-1RMR": common.Produce{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+// Result for a Store operation's return values
+func result(p common.Produce, err error, notFound common.Produce) common.Result {
+	switch {
+	case errors.Is(err, ErrExists):
+		return common.Result{Prod: notFound, Err: strings.ToUpper(notFound.ProduceCode) + " already exists", Count: 0}
+	case err != nil:
+		return common.Result{Prod: notFound, Err: "Row not found", Count: 0}
+	}
+	return common.Result{Prod: p, Err: "", Count: 1}
 }
 
 // Concurrent Add of Produce
+//
+// Deprecated: use Default.Add
 func Add(p common.Produce, outputChannel chan<- common.Result) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	key := strings.ToUpper(p.ProduceCode)
-	_, ok := rows[key]
-	if ok {
-		// key exists
-		outputChannel <- common.Result{Prod: p, Err: key + " already exists", Count: 0}
-	} else {
-		rows[key] = p
-		outputChannel <- common.Result{Prod: rows[key], Err: "", Count: 1}
-	}
+	added, err := Default.Add(context.Background(), p)
+	outputChannel <- result(added, err, p)
+}
+
+// Concurrent Update of an existing Produce
+//
+// Deprecated: use Default.Update
+func Update(p common.Produce, outputChannel chan<- common.Result) {
+	updated, err := Default.Update(context.Background(), p)
+	outputChannel <- result(updated, err, p)
 }
 
 // Concurrent Delete
+//
+// Deprecated: use Default.Delete
 func Delete(produceCode string, outputChannel chan<- common.Result) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	key := strings.ToUpper(produceCode)
-	_, ok := rows[key]
-	if ok {
-		outputChannel <- common.Result{Prod: rows[key], Err: "", Count: 1}
-		delete(rows, key)
-	} else {
-		outputChannel <- common.Result{Prod: common.Produce{}, Err: "Row not found", Count: 0}
-	}
+	deleted, err := Default.Delete(context.Background(), produceCode)
+	outputChannel <- result(deleted, err, common.Produce{})
 }
 
 // Concurrent DeleteRow
+//
+// Deprecated: use Default.Delete
 func DeleteRow(row common.Produce, outputChannel chan<- common.Result) {
 	Delete(row.ProduceCode, outputChannel)
 }
 
 // Concurrent Fetch
+//
+// Deprecated: use Default.List
 func Fetch(outputChannel chan<- common.Result) {
-	mutex.Lock()
-	defer mutex.Unlock()
+	defer close(outputChannel)
 
-	if len(rows) == 0 {
+	produceList, _ := Default.List(context.Background())
+	if len(produceList) == 0 {
 		outputChannel <- common.Result{Prod: common.Produce{}, Err: "Row not found", Count: 0}
-	} else {
-		for k := range rows {
-			outputChannel <- common.Result{Prod: rows[k], Err: "", Count: 1}
-		}
 	}
-	close(outputChannel)
+	for _, p := range produceList {
+		outputChannel <- common.Result{Prod: p, Err: "", Count: 1}
+	}
 }
 
 // Concurrent FetchByProduceCode
+//
+// Deprecated: use Default.Get
 func FetchByProduceCode(produceCode string, outputChannel chan<- common.Result) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	key := strings.ToUpper(produceCode)
-	prod, ok := rows[key]
-	if ok {
-		outputChannel <- common.Result{Prod: prod, Err: "", Count: 1}
-	} else {
-		outputChannel <- common.Result{Prod: common.Produce{}, Err: "Row not found", Count: 0}
-	}
-	close(outputChannel)
+	defer close(outputChannel)
+
+	p, err := Default.Get(context.Background(), produceCode)
+	outputChannel <- result(p, err, common.Produce{})
+}
+
+// Consistent copy of every row, sorted by Produce Code
+//
+// Deprecated: use Default.List
+func Snapshot() []common.Produce {
+	produceList, _ := Default.List(context.Background())
+	return produceList
+}
+
+// Replace every row - returns the rows that were replaced, sorted by Produce Code
+//
+// Deprecated: use Default.Replace
+func Replace(produceList []common.Produce) []common.Produce {
+	oldList, _ := Default.Replace(context.Background(), produceList)
+	return oldList
 }
@@ -9,20 +9,20 @@ import (
 )
 
 func resetRows() {
-	mutex.Lock()
-	defer mutex.Unlock()
-	rows = map[string]common.Produce{
+	Default.mutex.Lock()
+	defer Default.mutex.Unlock()
+	Default.setRows(map[string]common.Produce{
 		"A12T-4GH7-QPL9-3N4M": common.Produce{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
 		"E5T6-9UI3-TH15-QR88": common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
 		"YRT6-72AS-K736-L4AR": common.Produce{ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
 		"TQ4C-VV6T-75ZX-1RMR": common.Produce{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
-	}
+	})
 }
 
 func emptyRows() {
-	mutex.Lock()
-	defer mutex.Unlock()
-	rows = map[string]common.Produce{}
+	Default.mutex.Lock()
+	defer Default.mutex.Unlock()
+	Default.setRows(map[string]common.Produce{})
 }
 
 // Allow sort by ProduceCode
@@ -437,3 +437,85 @@ func TestDeleteBadProduceCode(t *testing.T) {
 
 	verifyRows(t, len(expected), prows, expected)
 }
+
+// Tests Snapshot and Replace
+func TestSnapshotReplace(t *testing.T) {
+	resetRows()
+	var expected []common.Produce = []common.Produce{
+		common.Produce{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+		common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"},
+		common.Produce{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+		common.Produce{ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
+	}
+	var replaceRows []common.Produce = []common.Produce{
+		common.Produce{ProduceCode: "jklm-5678-JKLM-5678", Name: "Buns", UnitPrice: "12.01"},
+		common.Produce{ProduceCode: "ABCD-1234-ABCD-1234", Name: "Hamburger", UnitPrice: "505.46"},
+	}
+
+	// Snapshot is sorted by Produce Code
+	prows := Snapshot()
+	for i := range prows {
+		if prows[i] != expected[i] {
+			t.Errorf("ERROR -- expected(%+v) found (%+v) \n", expected[i], prows[i])
+		}
+	}
+
+	// Replace returns the old rows
+	prows = Replace(replaceRows)
+	verifyRows(t, len(expected), prows, expected)
+
+	prows = Snapshot()
+	if len(prows) != 2 || prows[0] != replaceRows[1] || prows[1] != replaceRows[0] {
+		t.Errorf("ERROR -- expected(%+v) found (%+v) \n", replaceRows, prows)
+	}
+
+	// Replaced rows are found case insensitively
+	outputChannel := make(chan common.Result, 2)
+	go FetchByProduceCode("JKLM-5678-jklm-5678", outputChannel)
+	for p := range outputChannel {
+		if p.Err != "" || p.Count != 1 {
+			t.Errorf("ERROR -- p(%v) does not have nil for Err or Count is not 1\n", p)
+		}
+	}
+}
+
+// Tests updating a row
+func TestUpdate(t *testing.T) {
+	resetRows()
+	var updateRow common.Produce = common.Produce{ProduceCode: "e5t6-9UI3-TH15-QR88", Name: "White Peach", UnitPrice: "3.19"}
+	var expected []common.Produce = []common.Produce{
+		common.Produce{ProduceCode: "A12T-4GH7-QPL9-3N4M", Name: "Lettuce", UnitPrice: "3.46"},
+		common.Produce{ProduceCode: "E5T6-9UI3-TH15-QR88", Name: "White Peach", UnitPrice: "3.19"},
+		common.Produce{ProduceCode: "YRT6-72AS-K736-L4AR", Name: "Green Pepper", UnitPrice: "0.79"},
+		common.Produce{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"},
+	}
+
+	outputChannel := make(chan common.Result, 2)
+	go Update(updateRow, outputChannel)
+	r := <-outputChannel
+
+	if r.Err != "" || r.Count != 1 || r.Prod != updateRow {
+		t.Errorf("ERROR - expected (%v) with Count == 1 and Err string empty. Got (%v)\n", updateRow, r)
+	}
+
+	// Test an error case
+	go Update(common.Produce{ProduceCode: "ABC6-9UI3-TH15-QR88", Name: "Peach", UnitPrice: "2.99"}, outputChannel)
+	r = <-outputChannel
+
+	if r.Err != "Row not found" || r.Count != 0 {
+		t.Errorf("ERROR - expected Count == 0 and Err string (Row not found). Got (%v)\n", r)
+	}
+
+	// Make sure all the rows look right
+	outputChannel = make(chan common.Result, 2)
+	go Fetch(outputChannel)
+
+	prows := []common.Produce{}
+	for p := range outputChannel {
+		// Could be lowercase - fix
+		p.Prod.ProduceCode = strings.ToUpper(p.Prod.ProduceCode)
+		prows = append(prows, p.Prod)
+	}
+
+	verifyRows(t, len(expected), prows, expected)
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/logging"
+)
+
+var logger = logging.For("db")
+
+// File backend for Default and the tenants' stores
+// Rows are read from a JSON array of Produce when a file is opened, then written back
+// every flush interval (if they changed) and on Close
+// The tenants are kept in a directory beside Default's file - see TenantsDir - and the
+// categories and suppliers in files beside it - see sideFile
+// Each store's inventory is written on every change to a file beside the store's - see inventoryFile
+var (
+	stopFlusher chan struct{} // Closed by Close to stop the flusher
+	flusherDone chan struct{} // Closed by the flusher once stopped
+)
+
+// The file a Store is kept in - guarded by the Store's mutex
+type storeFile struct {
+	path      string
+	flushed   uint64    // Store.writes at the last flush
+	lastFlush time.Time // When the file was last written
+	err       error     // Error from the last flush, if it failed
+}
+
+// Directory the tenants are kept in for Default's file at path: produce.json keeps them in produce-tenants
+func TenantsDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "-tenants"
+}
+
+// File kept beside Default's file at path: produce.json keeps the categories in produce-categories.json
+func sideFile(path string, name string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + "-" + name + ".json"
+}
+
+// Open the file backend at path, flushing changes every interval
+// Rows are loaded from the file if it exists, otherwise the current rows are written to a new file
+// Returns whether the file existed
+func OpenFile(path string, interval time.Duration) (bool, error) {
+	exists, err := Default.openFile(path)
+	if err != nil {
+		return exists, err
+	}
+	if err := Tenants.open(TenantsDir(path)); err != nil {
+		Default.closeFile()
+		return exists, err
+	}
+	if err := Categories.open(sideFile(path, "categories")); err != nil {
+		Default.closeFile()
+		Tenants.close()
+		return exists, err
+	}
+	if err := Suppliers.open(sideFile(path, "suppliers")); err != nil {
+		Default.closeFile()
+		Tenants.close()
+		Categories.close()
+		return exists, err
+	}
+
+	stopFlusher = make(chan struct{})
+	flusherDone = make(chan struct{})
+	go flusher(interval)
+	return exists, nil
+}
+
+// Keep s in the file at path, loading its rows from the file if it exists
+func (s *Store) openFile(path string) (bool, error) {
+	b, err := os.ReadFile(path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if exists {
+		produceList := []common.Produce{}
+		if err := json.Unmarshal(b, &produceList); err != nil {
+			return true, errors.New(path + ": " + err.Error())
+		}
+		s.Replace(context.Background(), produceList)
+	}
+	if err := s.inventory.open(inventoryFile(path)); err != nil {
+		return exists, err
+	}
+
+	s.mutex.Lock()
+	s.file = &storeFile{path: path}
+	s.mutex.Unlock()
+	return exists, s.flush()
+}
+
+// Write the rows of every store to their files if they changed since the last flush (nothing for the memory backend)
+func Flush() error {
+	err := Default.flush()
+	for _, s := range Tenants.stores() {
+		err = errors.Join(err, s.flush())
+	}
+	return err
+}
+
+// Write the rows to the file if they changed since the last flush
+func (s *Store) flush() error {
+	s.mutex.RLock()
+	if s.file == nil {
+		s.mutex.RUnlock()
+		return nil
+	}
+	path := s.file.path
+	count := s.writes
+	if count == s.file.flushed && fileExists(path) {
+		s.mutex.RUnlock()
+		return nil
+	}
+	produceList := s.snapshot()
+	s.mutex.RUnlock()
+
+	b, err := json.MarshalIndent(produceList, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = writeFile(path, b)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return err
+	}
+	s.file.err = err
+	if err == nil {
+		s.file.flushed = count
+		s.file.lastFlush = time.Now().UTC()
+	}
+	return err
+}
+
+// Stop keeping s in a file
+func (s *Store) closeFile() {
+	s.mutex.Lock()
+	s.file = nil
+	s.mutex.Unlock()
+	s.inventory.close()
+}
+
+// Stop the file backend, flushing any changes
+func Close() error {
+	Default.mutex.RLock()
+	open := Default.file != nil
+	Default.mutex.RUnlock()
+	if !open {
+		return nil
+	}
+	close(stopFlusher)
+	<-flusherDone
+	err := Flush()
+	Default.closeFile()
+	Tenants.close()
+	Categories.close()
+	Suppliers.close()
+	return err
+}
+
+// Flush every interval until Close
+func flusher(interval time.Duration) {
+	defer close(flusherDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopFlusher:
+			return
+		case <-ticker.C:
+			if err := Flush(); err != nil {
+				logger.Error("flusher - failed to write", "error", err)
+			}
+		}
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Replace the file atomically - a crash part way through leaves the old file intact
+func writeFile(path string, b []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+strings.TrimPrefix(filepath.Base(path), ".")+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
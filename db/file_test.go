@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+)
+
+// Helper function to read the rows written to a file
+func readFile(t *testing.T, path string) []common.Produce {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	produceList := []common.Produce{}
+	if err := json.Unmarshal(b, &produceList); err != nil {
+		t.Fatal(err)
+	}
+	return produceList
+}
+
+// Test the file backend writes new files, flushes changes and loads what it wrote
+func TestOpenFile(t *testing.T) {
+	resetRows()
+	defer resetRows()
+	path := filepath.Join(t.TempDir(), "produce.json")
+
+	// A new file gets the current rows
+	exists, err := OpenFile(path, time.Millisecond)
+	if err != nil || exists {
+		t.Fatalf("ERROR -- expected a new file but got (%v) (%v)\n", exists, err)
+	}
+	if produceList := readFile(t, path); len(produceList) != 4 {
+		t.Errorf("ERROR -- expected 4 rows but got (%v)\n", produceList)
+	}
+
+	// Changes are flushed by the flusher
+	outputChannel := make(chan common.Result, 1)
+	Delete("A12T-4GH7-QPL9-3N4M", outputChannel)
+	<-outputChannel
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readFile(t, path)) != 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if produceList := readFile(t, path); len(produceList) != 3 {
+		t.Errorf("ERROR -- expected 3 rows but got (%v)\n", produceList)
+	}
+
+	// and by Close
+	Add(common.Produce{ProduceCode: "FILE-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"}, outputChannel)
+	<-outputChannel
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if produceList := readFile(t, path); len(produceList) != 4 || produceList[1].ProduceCode != "FILE-1111-2222-3333" {
+		t.Errorf("ERROR -- expected FILE-1111-2222-3333 to be written but got (%v)\n", produceList)
+	}
+
+	// An existing file replaces the rows
+	resetRows()
+	exists, err = OpenFile(path, time.Hour)
+	if err != nil || !exists {
+		t.Fatalf("ERROR -- expected an existing file but got (%v) (%v)\n", exists, err)
+	}
+	Close()
+	if produceList := Snapshot(); len(produceList) != 4 || produceList[0].ProduceCode != "E5T6-9UI3-TH15-QR88" {
+		t.Errorf("ERROR -- expected the rows from the file but got (%v)\n", produceList)
+	}
+
+	// A corrupt file is an error
+	os.WriteFile(path, []byte("{"), 0o600)
+	if _, err := OpenFile(path, time.Hour); err == nil {
+		t.Errorf("ERROR -- expected an error for a corrupt file\n")
+	}
+}
+
+// Test the statistics and Ping follow the backend
+func TestStats(t *testing.T) {
+	resetRows()
+	defer resetRows()
+
+	if s := CurrentStats(); s.Backend != "memory" || s.Rows != 4 || s.Path != "" {
+		t.Errorf("ERROR -- unexpected memory stats (%+v)\n", s)
+	}
+
+	path := filepath.Join(t.TempDir(), "produce.json")
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	outputChannel := make(chan common.Result, 1)
+	Delete("A12T-4GH7-QPL9-3N4M", outputChannel)
+	<-outputChannel
+	if s := CurrentStats(); s.Backend != "file" || s.Rows != 3 || s.Path != path || !s.UnflushedWrite || s.LastFlush == nil {
+		t.Errorf("ERROR -- unexpected file stats (%+v)\n", s)
+	}
+
+	// A failed flush fails Ping until a flush succeeds
+	os.Remove(path)
+	os.Mkdir(path, 0o700)
+	if err := Flush(); err == nil || Ping(context.Background()) == nil || CurrentStats().FlushError == "" {
+		t.Errorf("ERROR -- expected the flush and Ping to fail\n")
+	}
+	os.Remove(path)
+	if err := Flush(); err != nil || Ping(context.Background()) != nil {
+		t.Errorf("ERROR -- expected the flush and Ping to succeed but got (%v) (%v)\n", err, Ping(context.Background()))
+	}
+	Close()
+}
@@ -0,0 +1,226 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reasons for a Movement
+const (
+	MovementReceipt     = "receipt"     // Received against a purchase order
+	MovementConsumption = "consumption" // Sold, used or thrown away
+)
+
+// Movement is a change to the quantity of a Produce Code on hand, in whole units
+type Movement struct {
+	ID          int       `json:"ID"` // Sequence of the movement within its store
+	ProduceCode string    `json:"Produce Code"`
+	Quantity    int       `json:"Quantity"` // Positive into stock, negative out of it
+	Reason      string    `json:"Reason"`
+	Reference   string    `json:"Reference,omitempty"` // What caused it, such as a purchase order's ID
+	Lot         string    `json:"Lot,omitempty"`       // Lot Number of the stock moved, if it is in a lot
+	Time        time.Time `json:"Time"`
+}
+
+// StockLevel is the quantity of a Produce Code on hand
+type StockLevel struct {
+	ProduceCode string `json:"Produce Code"`
+	OnHand      int    `json:"On Hand"`
+}
+
+// Inventory is the stock of a catalog: a ledger of movements, the quantities on hand they add up
+// to, the lots the stock was received in, and the purchase orders that bring stock in
+// With the file backend it is kept beside the catalog's file - see inventoryFile
+type Inventory struct {
+	mutex     *sync.RWMutex
+	movements []Movement
+	onHand    map[string]int // By Produce Code in upper case
+	lots      map[lotKey]*Lot
+	orders    map[string]*PurchaseOrder
+	lastOrder int    // Number of the last purchase order created
+	path      string // File the inventory is kept in - empty to keep it in memory
+}
+
+// InventorySnapshot is an inventory as it is kept in its file and in archives
+type InventorySnapshot struct {
+	Movements []Movement      `json:"Movements"`
+	Orders    []PurchaseOrder `json:"Orders"` // Sorted by ID
+	Lots      []Lot           `json:"Lots"`   // By Produce Code in the order they are consumed
+}
+
+func newInventory() *Inventory {
+	return &Inventory{mutex: &sync.RWMutex{}, onHand: map[string]int{}, lots: map[lotKey]*Lot{}, orders: map[string]*PurchaseOrder{}}
+}
+
+// File the inventory of the catalog kept at path is kept in: produce.json keeps it in produce.inventory.json
+// Tenant IDs have no dots, so it cannot be taken for a tenant's catalog
+func inventoryFile(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".inventory.json"
+}
+
+// Inventory of the catalog
+func (s *Store) Inventory() *Inventory {
+	return s.inventory
+}
+
+// Quantity of produceCode on hand
+func (inv *Inventory) OnHand(produceCode string) int {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	return inv.onHand[strings.ToUpper(produceCode)]
+}
+
+// Quantities on hand of every Produce Code with stock, sorted by Produce Code
+func (inv *Inventory) Levels() []StockLevel {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	levels := make([]StockLevel, 0, len(inv.onHand))
+	for produceCode, onHand := range inv.onHand {
+		if onHand != 0 {
+			levels = append(levels, StockLevel{ProduceCode: produceCode, OnHand: onHand})
+		}
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i].ProduceCode < levels[j].ProduceCode })
+	return levels
+}
+
+// Movements of produceCode, oldest first - every movement if produceCode is empty
+func (inv *Inventory) Movements(produceCode string) []Movement {
+	produceCode = strings.ToUpper(produceCode)
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	movements := []Movement{}
+	for _, m := range inv.movements {
+		if produceCode == "" || m.ProduceCode == produceCode {
+			movements = append(movements, m)
+		}
+	}
+	return movements
+}
+
+// Add m to the ledger and the quantity on hand - the mutex must be held
+func (inv *Inventory) post(m Movement) Movement {
+	m.ID = len(inv.movements) + 1
+	m.ProduceCode = strings.ToUpper(m.ProduceCode)
+	inv.movements = append(inv.movements, m)
+	inv.onHand[m.ProduceCode] += m.Quantity
+	return m
+}
+
+// Record the inventory as it is - the returned func puts it back, for a change that cannot be
+// saved. The mutex must be held
+func (inv *Inventory) checkpoint() func() {
+	movements := len(inv.movements)
+	lots := make(map[lotKey]Lot, len(inv.lots))
+	for key, lot := range inv.lots {
+		lots[key] = *lot
+	}
+	return func() {
+		for _, m := range inv.movements[movements:] {
+			inv.onHand[m.ProduceCode] -= m.Quantity
+		}
+		inv.movements = inv.movements[:movements]
+		inv.lots = make(map[lotKey]*Lot, len(lots))
+		for key, lot := range lots {
+			inv.lots[key] = &lot
+		}
+	}
+}
+
+// Copy of the inventory
+func (inv *Inventory) Snapshot() InventorySnapshot {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	return inv.snapshot()
+}
+
+// Copy of the inventory - the mutex must be held
+func (inv *Inventory) snapshot() InventorySnapshot {
+	return InventorySnapshot{Movements: append([]Movement{}, inv.movements...), Orders: inv.listOrders(""), Lots: inv.listLots("")}
+}
+
+// Replace the inventory with snap - the caller checks it. The inventory is put back if it cannot be saved
+func (inv *Inventory) Replace(snap InventorySnapshot) error {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	old := inv.snapshot()
+	inv.load(snap)
+	if err := inv.save(); err != nil {
+		inv.load(old)
+		return err
+	}
+	return nil
+}
+
+// Replace the inventory with content - the mutex must be held
+func (inv *Inventory) load(content InventorySnapshot) {
+	inv.movements = []Movement{}
+	inv.onHand = map[string]int{}
+	for _, m := range content.Movements {
+		inv.post(m)
+	}
+	inv.lots = map[lotKey]*Lot{}
+	for i := range content.Lots {
+		lot := content.Lots[i]
+		inv.lots[lot.key()] = &lot
+	}
+	inv.orders = map[string]*PurchaseOrder{}
+	inv.lastOrder = 0
+	for i := range content.Orders {
+		o := content.Orders[i].clone()
+		inv.orders[o.ID] = &o
+		if n := orderNumber(o.ID); n > inv.lastOrder {
+			inv.lastOrder = n
+		}
+	}
+}
+
+// Keep the inventory in the file at path, replacing the current inventory with the one in it if it exists
+func (inv *Inventory) open(path string) error {
+	content := InventorySnapshot{}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &content); err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.path = path
+	if err != nil {
+		// A new file starts with the inventory in memory
+		return inv.save()
+	}
+	inv.load(content)
+	return nil
+}
+
+// Stop keeping the inventory in a file - it stays in memory
+func (inv *Inventory) close() {
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	inv.path = ""
+}
+
+// Write the inventory, if it is kept in a file - the mutex must be held
+func (inv *Inventory) save() error {
+	if inv.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(inv.snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(inv.path, b)
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Errors returned by lot operations
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")                                 // Consume asked for more than is on hand
+	ErrLotConflict       = errors.New("lot was received before with other dates or origin") // A lot received again must match
+)
+
+// Layout of the dates of a Lot
+const DateLayout = "2006-01-02"
+
+// Lot is stock of a Produce Code received together, traced by its Lot Number for recalls
+// Dates are YYYY-MM-DD, so they sort as they read
+type Lot struct {
+	ProduceCode string `json:"Produce Code"`
+	LotNumber   string `json:"Lot Number"`
+	Harvested   string `json:"Harvested,omitempty"`
+	Received    string `json:"Received"`
+	BestBefore  string `json:"Best Before,omitempty"` // Left out for stock that does not expire
+	Origin      string `json:"Origin,omitempty"`      // Where it was grown, such as a farm or country
+	Quantity    int    `json:"Quantity"`              // Received in the lot
+	Remaining   int    `json:"Remaining"`             // Not yet consumed
+	Reference   string `json:"Reference,omitempty"`   // Purchase order it was received against
+}
+
+type lotKey struct {
+	produceCode string
+	lotNumber   string
+}
+
+func (l *Lot) key() lotKey {
+	return lotKey{produceCode: l.ProduceCode, lotNumber: l.LotNumber}
+}
+
+// ConsumeLine is a quantity of a Produce Code to take out of stock
+type ConsumeLine struct {
+	ProduceCode string `json:"Produce Code"`
+	Quantity    int    `json:"Quantity"`
+}
+
+// Reports whether lot a is consumed before lot b: first to expire first, then first received -
+// lots that do not expire go last
+func consumedBefore(a *Lot, b *Lot) bool {
+	if a.BestBefore != b.BestBefore {
+		if a.BestBefore == "" || b.BestBefore == "" {
+			return b.BestBefore == ""
+		}
+		return a.BestBefore < b.BestBefore
+	}
+	if a.Received != b.Received {
+		return a.Received < b.Received
+	}
+	return a.LotNumber < b.LotNumber
+}
+
+// Add line to its lot, creating the lot if it is new - the mutex must be held
+// ErrLotConflict if the lot was received before with other dates or origin
+func (inv *Inventory) receiveLot(line ReceiptLine, reference string, now time.Time) (*Lot, error) {
+	key := lotKey{produceCode: strings.ToUpper(line.ProduceCode), lotNumber: line.LotNumber}
+	lot, ok := inv.lots[key]
+	if !ok {
+		lot = &Lot{ProduceCode: key.produceCode, LotNumber: key.lotNumber, Harvested: line.Harvested, Received: now.Format(DateLayout),
+			BestBefore: line.BestBefore, Origin: line.Origin, Reference: reference}
+		inv.lots[key] = lot
+	} else if lot.Harvested != line.Harvested || lot.BestBefore != line.BestBefore || lot.Origin != line.Origin {
+		return nil, ErrLotConflict
+	}
+	lot.Quantity += line.Quantity
+	lot.Remaining += line.Quantity
+	return lot, nil
+}
+
+// Lots of produceCode in the order they are consumed - every lot, by Produce Code, if produceCode is empty
+func (inv *Inventory) Lots(produceCode string) []Lot {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	return inv.listLots(strings.ToUpper(produceCode))
+}
+
+// Lots of produceCode in the order they are consumed - the mutex must be held
+func (inv *Inventory) listLots(produceCode string) []Lot {
+	lots := []Lot{}
+	for _, lot := range inv.lots {
+		if produceCode == "" || lot.ProduceCode == produceCode {
+			lots = append(lots, *lot)
+		}
+	}
+	sort.Slice(lots, func(i, j int) bool {
+		if lots[i].ProduceCode != lots[j].ProduceCode {
+			return lots[i].ProduceCode < lots[j].ProduceCode
+		}
+		return consumedBefore(&lots[i], &lots[j])
+	})
+	return lots
+}
+
+// Lots with stock remaining that are best before date (YYYY-MM-DD) or sooner, already expired
+// included - sorted by Best Before then Produce Code
+func (inv *Inventory) Expiring(date string) []Lot {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	lots := []Lot{}
+	for _, lot := range inv.lots {
+		if lot.Remaining > 0 && lot.BestBefore != "" && lot.BestBefore <= date {
+			lots = append(lots, *lot)
+		}
+	}
+	sort.Slice(lots, func(i, j int) bool {
+		if lots[i].BestBefore != lots[j].BestBefore {
+			return lots[i].BestBefore < lots[j].BestBefore
+		}
+		if lots[i].ProduceCode != lots[j].ProduceCode {
+			return lots[i].ProduceCode < lots[j].ProduceCode
+		}
+		return lots[i].LotNumber < lots[j].LotNumber
+	})
+	return lots
+}
+
+// Take lines out of stock first-expiry-first-out, posting a consumption movement for each lot
+// drawn from - stock on hand that is in no lot is taken last. Lots best before today are skipped
+// unless includeExpired is set, such as to throw them away. Returns the movements posted
+// ErrInsufficientStock, with nothing taken, if any line asks for more than is on hand to be taken
+func (inv *Inventory) Consume(lines []ConsumeLine, reference string, includeExpired bool) ([]Movement, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+	today := now.Format(DateLayout)
+	usable := func(lot *Lot) bool {
+		return includeExpired || lot.BestBefore == "" || lot.BestBefore >= today
+	}
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	wanted := map[string]int{}
+	for _, line := range lines {
+		wanted[strings.ToUpper(line.ProduceCode)] += line.Quantity
+	}
+	available := map[string]int{}
+	for produceCode := range wanted {
+		available[produceCode] = inv.onHand[produceCode]
+	}
+	for _, lot := range inv.lots {
+		if _, ok := available[lot.ProduceCode]; ok && !usable(lot) {
+			available[lot.ProduceCode] -= lot.Remaining
+		}
+	}
+	for produceCode, quantity := range wanted {
+		if available[produceCode] < quantity {
+			return nil, ErrInsufficientStock
+		}
+	}
+
+	restore := inv.checkpoint()
+	movements := []Movement{}
+	for _, line := range lines {
+		produceCode := strings.ToUpper(line.ProduceCode)
+		left := line.Quantity
+		lots := []*Lot{}
+		for _, lot := range inv.lots {
+			if lot.ProduceCode == produceCode && lot.Remaining > 0 && usable(lot) {
+				lots = append(lots, lot)
+			}
+		}
+		sort.Slice(lots, func(i, j int) bool { return consumedBefore(lots[i], lots[j]) })
+		for _, lot := range lots {
+			if left == 0 {
+				break
+			}
+			taken := min(left, lot.Remaining)
+			lot.Remaining -= taken
+			left -= taken
+			movements = append(movements, inv.post(Movement{ProduceCode: produceCode, Quantity: -taken, Reason: MovementConsumption, Reference: reference, Lot: lot.LotNumber, Time: now}))
+		}
+		if left > 0 {
+			movements = append(movements, inv.post(Movement{ProduceCode: produceCode, Quantity: -left, Reason: MovementConsumption, Reference: reference, Time: now}))
+		}
+	}
+	if err := inv.save(); err != nil {
+		restore()
+		return nil, err
+	}
+	return movements, nil
+}
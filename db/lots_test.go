@@ -0,0 +1,141 @@
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Receive lines into inv against a new purchase order
+func receive(t *testing.T, inv *Inventory, lines ...ReceiptLine) PurchaseOrder {
+	orderLines := []OrderLine{}
+	for _, line := range lines {
+		orderLines = append(orderLines, OrderLine{ProduceCode: line.ProduceCode, Ordered: line.Quantity})
+	}
+	order, _ := inv.CreateOrder("orchard", orderLines)
+	inv.SubmitOrder(order.ID)
+	order, err := inv.ReceiveOrder(order.ID, lines, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// Test stock is received in lots and consumed first-expiry-first-out
+func TestLots(t *testing.T) {
+	addOrderSuppliers(t)
+	inv := New(nil).Inventory()
+	day := func(days int) string { return time.Now().UTC().AddDate(0, 0, days).Format(DateLayout) }
+	gala := "TQ4C-VV6T-75ZX-1RMR"
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 5, LotNumber: "LATE", BestBefore: day(20), Origin: "Yakima"})
+	order := receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 4, BestBefore: day(3), Harvested: day(-10)}, ReceiptLine{ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: 2})
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 3, LotNumber: "SOON", BestBefore: day(1)})
+
+	lots := inv.Lots(gala)
+	if len(lots) != 3 || lots[0].LotNumber != "SOON" || lots[1].LotNumber != order.ID+"-1" || lots[2].LotNumber != "LATE" || lots[2].Origin != "Yakima" {
+		t.Errorf("ERROR -- expected SOON, %v-1 and LATE but got (%v)\n", order.ID, lots)
+	}
+	if expiring := inv.Expiring(day(3)); len(expiring) != 2 || expiring[0].LotNumber != "SOON" {
+		t.Errorf("ERROR -- expected 2 lots expiring but got (%v)\n", expiring)
+	}
+
+	// More than is on hand takes nothing
+	if _, err := inv.Consume([]ConsumeLine{{ProduceCode: gala, Quantity: 1}, {ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: 3}}, "", false); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrInsufficientStock, err)
+	}
+	if onHand := inv.OnHand(gala); onHand != 12 {
+		t.Errorf("ERROR -- expected (%v) on hand but got (%v)\n", 12, onHand)
+	}
+
+	movements, err := inv.Consume([]ConsumeLine{{ProduceCode: "tq4c-vv6t-75zx-1rmr", Quantity: 5}}, "sale 1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken := map[string]int{}
+	for _, m := range movements {
+		taken[m.Lot] = m.Quantity
+	}
+	if expected := map[string]int{"SOON": -3, order.ID + "-1": -2}; !reflect.DeepEqual(taken, expected) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", expected, taken)
+	}
+	if expiring := inv.Expiring(day(3)); len(expiring) != 1 || expiring[0].Remaining != 2 {
+		t.Errorf("ERROR -- expected the used up lot no longer expiring but got (%v)\n", expiring)
+	}
+	if onHand := inv.OnHand(gala); onHand != 7 {
+		t.Errorf("ERROR -- expected (%v) on hand but got (%v)\n", 7, onHand)
+	}
+}
+
+// Test stock on hand that is in no lot is consumed after the lots
+func TestConsumeUntracked(t *testing.T) {
+	addOrderSuppliers(t)
+	inv := New(nil).Inventory()
+	gala := "TQ4C-VV6T-75ZX-1RMR"
+	inv.post(Movement{ProduceCode: gala, Quantity: 2, Reason: MovementReceipt})
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 1, LotNumber: "L1"})
+
+	movements, err := inv.Consume([]ConsumeLine{{ProduceCode: gala, Quantity: 3}}, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements) != 2 || movements[0].Lot != "L1" || movements[1].Lot != "" || movements[1].Quantity != -2 {
+		t.Errorf("ERROR -- expected L1 then the stock in no lot but got (%v)\n", movements)
+	}
+}
+
+// Test lots past their Best Before are only consumed when asked for
+func TestConsumeExpired(t *testing.T) {
+	addOrderSuppliers(t)
+	inv := New(nil).Inventory()
+	day := func(days int) string { return time.Now().UTC().AddDate(0, 0, days).Format(DateLayout) }
+	gala := "TQ4C-VV6T-75ZX-1RMR"
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 3, LotNumber: "OLD", BestBefore: day(-1)})
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 2, LotNumber: "TODAY", BestBefore: day(0)})
+
+	movements, err := inv.Consume([]ConsumeLine{{ProduceCode: gala, Quantity: 2}}, "sale 1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements) != 1 || movements[0].Lot != "TODAY" || movements[0].Quantity != -2 {
+		t.Errorf("ERROR -- expected 2 from TODAY but got (%v)\n", movements)
+	}
+	if _, err := inv.Consume([]ConsumeLine{{ProduceCode: gala, Quantity: 1}}, "sale 2", false); !errors.Is(err, ErrInsufficientStock) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrInsufficientStock, err)
+	}
+
+	movements, err = inv.Consume([]ConsumeLine{{ProduceCode: gala, Quantity: 3}}, "spoilage", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements) != 1 || movements[0].Lot != "OLD" || movements[0].Quantity != -3 || inv.OnHand(gala) != 0 {
+		t.Errorf("ERROR -- expected 3 from OLD but got (%v)\n", movements)
+	}
+}
+
+// Test a lot received again must have the dates and origin it was received with
+func TestLotConflict(t *testing.T) {
+	addOrderSuppliers(t)
+	inv := New(nil).Inventory()
+	gala := "TQ4C-VV6T-75ZX-1RMR"
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 5, LotNumber: "L1", BestBefore: "2031-01-10", Origin: "Yakima"})
+	receive(t, inv, ReceiptLine{ProduceCode: gala, Quantity: 2, LotNumber: "L1", BestBefore: "2031-01-10", Origin: "Yakima"})
+
+	for _, line := range []ReceiptLine{
+		{ProduceCode: gala, Quantity: 1, LotNumber: "L1", BestBefore: "2031-01-20", Origin: "Yakima"},
+		{ProduceCode: gala, Quantity: 1, LotNumber: "L1", BestBefore: "2031-01-10", Origin: "Wenatchee"},
+		{ProduceCode: gala, Quantity: 1, LotNumber: "L1", BestBefore: "2031-01-10", Origin: "Yakima", Harvested: "2030-12-20"},
+	} {
+		order, _ := inv.CreateOrder("orchard", []OrderLine{{ProduceCode: gala, Ordered: 1}})
+		inv.SubmitOrder(order.ID)
+		if _, err := inv.ReceiveOrder(order.ID, []ReceiptLine{line}, "", false); !errors.Is(err, ErrLotConflict) {
+			t.Errorf("ERROR -- for (%+v) expected (%v) but got (%v)\n", line, ErrLotConflict, err)
+		}
+		if order, _ := inv.Order(order.ID); order.Status != OrderSubmitted || order.Lines[0].Received != 0 {
+			t.Errorf("ERROR -- expected nothing received but got (%+v)\n", order)
+		}
+	}
+	if lots := inv.Lots(gala); len(lots) != 1 || lots[0].Quantity != 7 || lots[0].Origin != "Yakima" || inv.OnHand(gala) != 7 {
+		t.Errorf("ERROR -- expected one lot of 7 from Yakima but got (%v)\n", lots)
+	}
+}
@@ -0,0 +1,304 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by purchase order operations
+var (
+	ErrOrderNotFound = errors.New("purchase order not found")
+	ErrOrderStatus   = errors.New("purchase order status does not allow it")
+	ErrNotOrdered    = errors.New("produce is not on the purchase order")
+)
+
+// Statuses of a PurchaseOrder - an order goes from draft to submitted, is received in one or more
+// receipts, and ends received or cancelled
+const (
+	OrderDraft             = "draft"
+	OrderSubmitted         = "submitted"
+	OrderPartiallyReceived = "partially received"
+	OrderReceived          = "received"
+	OrderCancelled         = "cancelled"
+)
+
+// OrderLine is a quantity of a Produce Code ordered and how much of it has been received
+type OrderLine struct {
+	ProduceCode string `json:"Produce Code"`
+	Ordered     int    `json:"Ordered"`
+	Received    int    `json:"Received"`
+	Cost        string `json:"Cost,omitempty"` // Cost of each unit, usually the supplier's
+}
+
+// ReceiptLine is a quantity of a Produce Code received, in a lot
+type ReceiptLine struct {
+	ProduceCode string `json:"Produce Code"`
+	Quantity    int    `json:"Quantity"`
+	LotNumber   string `json:"Lot Number,omitempty"`  // Left out for the order's ID and the receipt's number, such as PO-000001-2
+	Harvested   string `json:"Harvested,omitempty"`   // Date as YYYY-MM-DD
+	BestBefore  string `json:"Best Before,omitempty"` // Date as YYYY-MM-DD
+	Origin      string `json:"Origin,omitempty"`
+}
+
+// Receipt is a delivery received against a purchase order
+type Receipt struct {
+	Lines []ReceiptLine `json:"Lines"`
+	Note  string        `json:"Note,omitempty"`
+	Time  time.Time     `json:"Time"`
+}
+
+// Discrepancy is a Produce Code received in a different quantity than ordered, recorded when the
+// order is received in full or closed
+type Discrepancy struct {
+	ProduceCode string    `json:"Produce Code"`
+	Ordered     int       `json:"Ordered"`
+	Received    int       `json:"Received"`
+	Difference  int       `json:"Difference"` // Received less Ordered - negative when short
+	Time        time.Time `json:"Time"`
+}
+
+// PurchaseOrder is Produce ordered from a supplier for a catalog's stock
+type PurchaseOrder struct {
+	ID            string        `json:"ID"`
+	Supplier      string        `json:"Supplier"`
+	Status        string        `json:"Status"`
+	Lines         []OrderLine   `json:"Lines"`
+	Receipts      []Receipt     `json:"Receipts,omitempty"`
+	Discrepancies []Discrepancy `json:"Discrepancies,omitempty"`
+	Created       time.Time     `json:"Created"`
+	Updated       time.Time     `json:"Updated"`
+}
+
+// Copy of o that shares nothing with it
+func (o *PurchaseOrder) clone() PurchaseOrder {
+	c := *o
+	c.Lines = append([]OrderLine(nil), o.Lines...)
+	c.Receipts = make([]Receipt, len(o.Receipts))
+	for i, r := range o.Receipts {
+		c.Receipts[i] = r
+		c.Receipts[i].Lines = append([]ReceiptLine(nil), r.Lines...)
+	}
+	if len(c.Receipts) == 0 {
+		c.Receipts = nil
+	}
+	c.Discrepancies = append([]Discrepancy(nil), o.Discrepancies...)
+	return c
+}
+
+// Number of the purchase order with id, such as 12 for PO-000012 - 0 if it has none
+func orderNumber(id string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(id, "PO-"))
+	if err != nil || !strings.HasPrefix(id, "PO-") {
+		return 0
+	}
+	return n
+}
+
+// Produce Codes in upper case, as Produce Codes are case insensitive
+func orderLines(lines []OrderLine) []OrderLine {
+	fixed := make([]OrderLine, len(lines))
+	for i, line := range lines {
+		fixed[i] = OrderLine{ProduceCode: strings.ToUpper(line.ProduceCode), Ordered: line.Ordered, Cost: line.Cost}
+	}
+	return fixed
+}
+
+// Create a draft purchase order from supplier for lines - the caller checks the Produce Codes and
+// the quantities. ErrSupplierNotFound if the supplier does not exist
+func (inv *Inventory) CreateOrder(supplier string, lines []OrderLine) (PurchaseOrder, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	var created PurchaseOrder
+	err := Suppliers.holding(supplier, func() error {
+		inv.mutex.Lock()
+		defer inv.mutex.Unlock()
+		inv.lastOrder++
+		o := &PurchaseOrder{ID: fmt.Sprintf("PO-%06d", inv.lastOrder), Supplier: supplier, Status: OrderDraft, Lines: orderLines(lines), Created: now, Updated: now}
+		inv.orders[o.ID] = o
+		if err := inv.save(); err != nil {
+			delete(inv.orders, o.ID)
+			inv.lastOrder--
+			return err
+		}
+		created = o.clone()
+		return nil
+	})
+	return created, err
+}
+
+// The purchase order with id - ErrOrderNotFound if there is none
+func (inv *Inventory) Order(id string) (PurchaseOrder, error) {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	o, ok := inv.orders[id]
+	if !ok {
+		return PurchaseOrder{}, ErrOrderNotFound
+	}
+	return o.clone(), nil
+}
+
+// Purchase orders with status, sorted by ID - every purchase order if status is empty
+func (inv *Inventory) Orders(status string) []PurchaseOrder {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	return inv.listOrders(status)
+}
+
+// Purchase orders with status, sorted by ID - the mutex must be held
+func (inv *Inventory) listOrders(status string) []PurchaseOrder {
+	orders := []PurchaseOrder{}
+	for _, o := range inv.orders {
+		if status == "" || o.Status == status {
+			orders = append(orders, o.clone())
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool { return orders[i].ID < orders[j].ID })
+	return orders
+}
+
+// Change the order with id, with change - ErrOrderNotFound if there is none and ErrOrderStatus
+// if change refuses its status. The order is restored if it cannot be saved
+func (inv *Inventory) changeOrder(id string, change func(o *PurchaseOrder, now time.Time) error) (PurchaseOrder, error) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	inv.mutex.Lock()
+	defer inv.mutex.Unlock()
+	o, ok := inv.orders[id]
+	if !ok {
+		return PurchaseOrder{}, ErrOrderNotFound
+	}
+	old := o.clone()
+	restore := inv.checkpoint()
+	if err := change(o, now); err != nil {
+		*o = old
+		restore()
+		return PurchaseOrder{}, err
+	}
+	o.Updated = now
+	if err := inv.save(); err != nil {
+		*o = old
+		restore()
+		return PurchaseOrder{}, err
+	}
+	return o.clone(), nil
+}
+
+// Replace the supplier and lines of a draft purchase order - ErrOrderStatus once it is submitted,
+// ErrSupplierNotFound if the supplier does not exist
+func (inv *Inventory) UpdateOrder(id string, supplier string, lines []OrderLine) (PurchaseOrder, error) {
+	var updated PurchaseOrder
+	err := Suppliers.holding(supplier, func() error {
+		var err error
+		updated, err = inv.changeOrder(id, func(o *PurchaseOrder, now time.Time) error {
+			if o.Status != OrderDraft {
+				return ErrOrderStatus
+			}
+			o.Supplier = supplier
+			o.Lines = orderLines(lines)
+			return nil
+		})
+		return err
+	})
+	return updated, err
+}
+
+// Submit a draft purchase order to its supplier - ErrOrderStatus unless it is a draft
+func (inv *Inventory) SubmitOrder(id string) (PurchaseOrder, error) {
+	return inv.changeOrder(id, func(o *PurchaseOrder, now time.Time) error {
+		if o.Status != OrderDraft {
+			return ErrOrderStatus
+		}
+		o.Status = OrderSubmitted
+		return nil
+	})
+}
+
+// Cancel a purchase order nothing has been received against - ErrOrderStatus otherwise
+func (inv *Inventory) CancelOrder(id string) (PurchaseOrder, error) {
+	return inv.changeOrder(id, func(o *PurchaseOrder, now time.Time) error {
+		if o.Status != OrderDraft && o.Status != OrderSubmitted {
+			return ErrOrderStatus
+		}
+		o.Status = OrderCancelled
+		return nil
+	})
+}
+
+// Receive lines against a submitted purchase order into lots, posting a receipt movement into stock for each
+// The order is received once every line has been received in full, or when closed is set - any line
+// received in a different quantity than ordered is then recorded as a Discrepancy
+// ErrOrderStatus unless the order is submitted or partially received, ErrNotOrdered if a line's
+// Produce Code is not on the order, ErrLotConflict if a line's lot was received before with other
+// dates or origin
+func (inv *Inventory) ReceiveOrder(id string, lines []ReceiptLine, note string, closed bool) (PurchaseOrder, error) {
+	return inv.changeOrder(id, func(o *PurchaseOrder, now time.Time) error {
+		if o.Status != OrderSubmitted && o.Status != OrderPartiallyReceived {
+			return ErrOrderStatus
+		}
+		received := make([]ReceiptLine, 0, len(lines))
+		for _, line := range lines {
+			line.ProduceCode = strings.ToUpper(line.ProduceCode)
+			i := o.line(line.ProduceCode)
+			if i < 0 {
+				return ErrNotOrdered
+			}
+			o.Lines[i].Received += line.Quantity
+			received = append(received, line)
+		}
+		for i, line := range received {
+			if line.LotNumber == "" {
+				received[i].LotNumber = o.ID + "-" + strconv.Itoa(len(o.Receipts)+1)
+			}
+			lot, err := inv.receiveLot(received[i], o.ID, now)
+			if err != nil {
+				return err
+			}
+			inv.post(Movement{ProduceCode: line.ProduceCode, Quantity: line.Quantity, Reason: MovementReceipt, Reference: o.ID, Lot: lot.LotNumber, Time: now})
+		}
+		if len(received) > 0 || note != "" {
+			o.Receipts = append(o.Receipts, Receipt{Lines: received, Note: note, Time: now})
+		}
+
+		o.Status = OrderReceived
+		for _, line := range o.Lines {
+			if line.Received < line.Ordered {
+				o.Status = OrderPartiallyReceived
+			}
+		}
+		if closed || o.Status == OrderReceived {
+			o.Status = OrderReceived
+			for _, line := range o.Lines {
+				if line.Received != line.Ordered {
+					o.Discrepancies = append(o.Discrepancies, Discrepancy{ProduceCode: line.ProduceCode, Ordered: line.Ordered, Received: line.Received, Difference: line.Received - line.Ordered, Time: now})
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Reports whether any purchase order from supplier is a draft, submitted or partially received
+func (inv *Inventory) ordersOpenFrom(supplier string) bool {
+	inv.mutex.RLock()
+	defer inv.mutex.RUnlock()
+	for _, o := range inv.orders {
+		if o.Supplier == supplier && o.Status != OrderReceived && o.Status != OrderCancelled {
+			return true
+		}
+	}
+	return false
+}
+
+// Index of the line with produceCode - -1 if it is not on the order
+func (o *PurchaseOrder) line(produceCode string) int {
+	for i, line := range o.Lines {
+		if line.ProduceCode == produceCode {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"example.com/produce_demo/common"
+)
+
+// Add the suppliers the purchase order tests order from, removing them when t ends
+func addOrderSuppliers(t *testing.T) {
+	resetSuppliers()
+	t.Cleanup(resetSuppliers)
+	for _, id := range []string{"orchard", "valley"} {
+		if _, err := Suppliers.Create(Supplier{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Test a purchase order goes from draft to received, posting movements and recording discrepancies
+func TestPurchaseOrders(t *testing.T) {
+	addOrderSuppliers(t)
+	inv := New(nil).Inventory()
+	order, err := inv.CreateOrder("orchard", []OrderLine{{ProduceCode: "tq4c-vv6t-75zx-1rmr", Ordered: 10, Cost: "1.25"}, {ProduceCode: "E5T6-9UI3-TH15-QR88", Ordered: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.ID != "PO-000001" || order.Status != OrderDraft || order.Lines[0].ProduceCode != "TQ4C-VV6T-75ZX-1RMR" {
+		t.Errorf("ERROR -- expected a draft PO-000001 but got (%v)\n", order)
+	}
+	if _, err := inv.ReceiveOrder(order.ID, []ReceiptLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Quantity: 1}}, "", false); !errors.Is(err, ErrOrderStatus) {
+		t.Errorf("ERROR -- expected (%v) receiving a draft but got (%v)\n", ErrOrderStatus, err)
+	}
+	if _, err := inv.UpdateOrder(order.ID, "valley", []OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 12}, {ProduceCode: "E5T6-9UI3-TH15-QR88", Ordered: 4}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inv.SubmitOrder(order.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := inv.UpdateOrder(order.ID, "orchard", nil); !errors.Is(err, ErrOrderStatus) {
+		t.Errorf("ERROR -- expected (%v) changing a submitted order but got (%v)\n", ErrOrderStatus, err)
+	}
+
+	// A line not on the order is refused without receiving anything
+	if _, err := inv.ReceiveOrder(order.ID, []ReceiptLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Quantity: 5}, {ProduceCode: "YRT6-72AS-K736-L4AR", Quantity: 1}}, "", false); !errors.Is(err, ErrNotOrdered) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrNotOrdered, err)
+	}
+	if onHand := inv.OnHand("TQ4C-VV6T-75ZX-1RMR"); onHand != 0 {
+		t.Errorf("ERROR -- expected (%v) on hand but got (%v)\n", 0, onHand)
+	}
+
+	order, _ = inv.ReceiveOrder(order.ID, []ReceiptLine{{ProduceCode: "tq4c-vv6t-75zx-1rmr", Quantity: 7}}, "first truck", false)
+	if order.Status != OrderPartiallyReceived || order.Lines[0].Received != 7 || len(order.Discrepancies) != 0 {
+		t.Errorf("ERROR -- expected partially received but got (%v)\n", order)
+	}
+	if _, err := inv.CancelOrder(order.ID); !errors.Is(err, ErrOrderStatus) {
+		t.Errorf("ERROR -- expected (%v) cancelling a partially received order but got (%v)\n", ErrOrderStatus, err)
+	}
+	order, _ = inv.ReceiveOrder(order.ID, []ReceiptLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Quantity: 4}, {ProduceCode: "E5T6-9UI3-TH15-QR88", Quantity: 5}}, "", true)
+	if order.Status != OrderReceived || len(order.Receipts) != 2 {
+		t.Errorf("ERROR -- expected received but got (%v)\n", order)
+	}
+	discrepancies := []Discrepancy{
+		{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 12, Received: 11, Difference: -1},
+		{ProduceCode: "E5T6-9UI3-TH15-QR88", Ordered: 4, Received: 5, Difference: 1},
+	}
+	for i := range order.Discrepancies {
+		order.Discrepancies[i].Time = discrepancies[i].Time
+	}
+	if !reflect.DeepEqual(order.Discrepancies, discrepancies) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", discrepancies, order.Discrepancies)
+	}
+	if _, err := inv.ReceiveOrder(order.ID, []ReceiptLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Quantity: 1}}, "", false); !errors.Is(err, ErrOrderStatus) {
+		t.Errorf("ERROR -- expected (%v) receiving a received order but got (%v)\n", ErrOrderStatus, err)
+	}
+
+	expected := []StockLevel{{ProduceCode: "E5T6-9UI3-TH15-QR88", OnHand: 5}, {ProduceCode: "TQ4C-VV6T-75ZX-1RMR", OnHand: 11}}
+	if levels := inv.Levels(); !reflect.DeepEqual(levels, expected) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", expected, levels)
+	}
+	if movements := inv.Movements("TQ4C-VV6T-75ZX-1RMR"); len(movements) != 2 || movements[1].Quantity != 4 || movements[1].Reference != order.ID || movements[1].Reason != MovementReceipt {
+		t.Errorf("ERROR -- expected 2 receipts but got (%v)\n", movements)
+	}
+
+	// Drafts and submitted orders can be cancelled
+	other, _ := inv.CreateOrder("orchard", []OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 1}})
+	if other, err = inv.CancelOrder(other.ID); err != nil || other.Status != OrderCancelled || other.ID != "PO-000002" {
+		t.Errorf("ERROR -- expected PO-000002 cancelled but got (%v) (%v)\n", other, err)
+	}
+	if orders := inv.Orders(OrderReceived); len(orders) != 1 || orders[0].ID != order.ID {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", order.ID, orders)
+	}
+	if _, err := inv.SubmitOrder("PO-000009"); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrOrderNotFound, err)
+	}
+}
+
+// Test each store's inventory is kept beside its catalog
+func TestInventoryFiles(t *testing.T) {
+	addOrderSuppliers(t)
+	path := filepath.Join(t.TempDir(), "produce.json")
+	s := New([]common.Produce{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Name: "Gala Apple", UnitPrice: "3.59"}})
+	if _, err := s.openFile(path); err != nil {
+		t.Fatal(err)
+	}
+	order, _ := s.Inventory().CreateOrder("orchard", []OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 3}})
+	s.Inventory().SubmitOrder(order.ID)
+	order, _ = s.Inventory().ReceiveOrder(order.ID, []ReceiptLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Quantity: 3}}, "", false)
+	s.closeFile()
+
+	reopened := New(nil)
+	if _, err := reopened.openFile(path); err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.closeFile()
+	if onHand := reopened.Inventory().OnHand("TQ4C-VV6T-75ZX-1RMR"); onHand != 3 {
+		t.Errorf("ERROR -- expected (%v) on hand but got (%v)\n", 3, onHand)
+	}
+	if got, _ := reopened.Inventory().Order(order.ID); !reflect.DeepEqual(got, order) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", order, got)
+	}
+	if lots := reopened.Inventory().Lots(""); len(lots) != 1 || lots[0].LotNumber != order.ID+"-1" || lots[0].Remaining != 3 {
+		t.Errorf("ERROR -- expected the lot of (%v) but got (%v)\n", order.ID, lots)
+	}
+	if next, _ := reopened.Inventory().CreateOrder("orchard", []OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 1}}); next.ID != "PO-000002" {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", "PO-000002", next.ID)
+	}
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"example.com/produce_demo/health"
+	"example.com/produce_demo/metrics"
+)
+
+// Statistics reported by /status
+type Stats struct {
+	Backend        string     `json:"Backend"` // memory or file
+	Path           string     `json:"Path,omitempty"`
+	Rows           int        `json:"Rows"`
+	Writes         uint64     `json:"Writes"`
+	UnflushedWrite bool       `json:"Unflushed Writes,omitempty"`
+	LastFlush      *time.Time `json:"Last Flush,omitempty"`
+	FlushError     string     `json:"Flush Error,omitempty"`
+	Tenants        int        `json:"Tenants"`
+}
+
+func init() {
+	health.Register("store", Ping)
+	health.RegisterStats("store", func() interface{} { return CurrentStats() })
+	metrics.StoreRows.Set(float64(Default.Len()))
+}
+
+// Current statistics
+func CurrentStats() Stats {
+	tenants := len(Tenants.List())
+
+	Default.mutex.RLock()
+	defer Default.mutex.RUnlock()
+
+	s := Stats{Backend: "memory", Rows: len(Default.rows), Writes: Default.writes, Tenants: tenants}
+	if f := Default.file; f != nil {
+		s.Backend = "file"
+		s.Path = f.path
+		s.UnflushedWrite = Default.writes != f.flushed
+		if !f.lastFlush.IsZero() {
+			t := f.lastFlush
+			s.LastFlush = &t
+		}
+		if f.err != nil {
+			s.FlushError = f.err.Error()
+		}
+	}
+	return s
+}
+
+// Check the store can be used - the rows can be locked within ctx and the last flush of every store succeeded
+func Ping(ctx context.Context) error {
+	locked := make(chan error, 1)
+	go func() {
+		if err := Default.flushErr(); err != nil {
+			locked <- errors.New("last flush failed: " + err.Error())
+			return
+		}
+		for _, t := range Tenants.List() {
+			if _, s, err := Tenants.Get(t.ID); err == nil {
+				if err := s.flushErr(); err != nil {
+					locked <- errors.New("last flush of tenant " + t.ID + " failed: " + err.Error())
+					return
+				}
+			}
+		}
+		locked <- nil
+	}()
+
+	select {
+	case err := <-locked:
+		return err
+	case <-ctx.Done():
+		return errors.New("store is locked: " + ctx.Err().Error())
+	}
+}
+
+// Error from the last flush of s, if it failed
+func (s *Store) flushErr() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	return s.file.err
+}
@@ -0,0 +1,302 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Errors returned by Store operations - anything else is the context's error
+var (
+	ErrNotFound = errors.New("produce not found")
+	ErrExists   = errors.New("produce already exists")
+	ErrQuota    = errors.New("store is full")
+)
+
+var tracer = otel.Tracer("example.com/produce_demo/db")
+
+// Store is a catalog of Produce keyed by Produce Code (case insensitively)
+// Every operation takes a context - an operation whose context is done before it gets the
+// store is abandoned and returns the context's error
+//
+// Reads share the store and writes have it to themselves. The rows are also kept sorted, each
+// write patching just the row it changed, so List copies them rather than sorting and never
+// holds up writes for longer than the copy.
+type Store struct {
+	mutex     *sync.RWMutex
+	rows      map[string]common.Produce
+	sorted    []common.Produce // Rows sorted by Produce Code - patched by each write
+	writes    uint64           // Count of writes - lets the file backend skip flushes when nothing changed
+	rowsGauge prometheus.Gauge // Set to the number of rows after each write, if not nil
+	maxRows   int              // Most rows Add may leave - 0 for no limit
+	file      *storeFile       // File the rows are kept in - nil for the memory backend
+	inventory *Inventory       // Stock of the catalog
+}
+
+// Create a Store holding produceList
+func New(produceList []common.Produce) *Store {
+	s := &Store{mutex: &sync.RWMutex{}, rows: make(map[string]common.Produce, len(produceList)), inventory: newInventory()}
+	for _, p := range produceList {
+		s.rows[strings.ToUpper(p.ProduceCode)] = p
+	}
+	s.sorted = sortedRows(s.rows)
+	return s
+}
+
+// A Store operation - the op label of the store metrics and, with a "db." prefix, the span name
+type operation struct {
+	name     string
+	spanName string
+	write    bool // Needs the store to itself
+	lockWait prometheus.Observer
+	duration prometheus.Observer
+}
+
+func newOperation(name string, write bool) *operation {
+	return &operation{
+		name:     name,
+		spanName: "db." + name,
+		write:    write,
+		lockWait: metrics.StoreLockWait.WithLabelValues(name),
+		duration: metrics.StoreOperationDuration.WithLabelValues(name),
+	}
+}
+
+var (
+	opGet     = newOperation("fetch_one", false)
+	opList    = newOperation("fetch", false)
+	opAdd     = newOperation("add", true)
+	opUpdate  = newOperation("update", true)
+	opDelete  = newOperation("delete", true)
+	opReplace = newOperation("replace", true)
+)
+
+// Lock the rows for op within a span, recording the wait for the lock and the duration of the operation
+// Returns the span's context and the func that unlocks the rows and ends the span with the result of op
+func (s *Store) lock(ctx context.Context, op *operation, attrs ...attribute.KeyValue) (context.Context, func(error), error) {
+	ctx, span := tracer.Start(ctx, op.spanName, trace.WithAttributes(attrs...))
+	end := func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			if !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrExists) && !errors.Is(err, ErrQuota) && !errors.Is(err, ErrCategoryNotFound) {
+				span.SetStatus(codes.Error, err.Error())
+			}
+		}
+		span.End()
+	}
+
+	start := time.Now()
+	if err := ctx.Err(); err != nil {
+		end(err)
+		return ctx, nil, err
+	}
+	lock, unlock := s.mutex.RLock, s.mutex.RUnlock
+	if op.write {
+		lock, unlock = s.mutex.Lock, s.mutex.Unlock
+	}
+	lock()
+	wait := time.Since(start)
+	op.lockWait.Observe(wait.Seconds())
+	if span.IsRecording() {
+		span.SetAttributes(attribute.Int64("db.lock_wait_us", wait.Microseconds()))
+	}
+
+	// The caller may have gone while we waited
+	if err := ctx.Err(); err != nil {
+		unlock()
+		end(err)
+		return ctx, nil, err
+	}
+
+	return ctx, func(err error) {
+		if op.write && s.rowsGauge != nil {
+			s.rowsGauge.Set(float64(len(s.rows)))
+		}
+		unlock()
+		op.duration.Observe(time.Since(start).Seconds())
+		end(err)
+	}, nil
+}
+
+// Record a write of the row with key (upper case) - the mutex must be held for writing
+// The sorted rows have just that row added, changed or taken out, so they are never sorted again
+func (s *Store) changed(key string) {
+	s.writes++
+	i := sort.Search(len(s.sorted), func(i int) bool { return strings.ToUpper(s.sorted[i].ProduceCode) >= key })
+	found := i < len(s.sorted) && strings.ToUpper(s.sorted[i].ProduceCode) == key
+	p, ok := s.rows[key]
+	switch {
+	case ok && found:
+		s.sorted[i] = p
+	case ok:
+		s.sorted = append(s.sorted, common.Produce{})
+		copy(s.sorted[i+1:], s.sorted[i:])
+		s.sorted[i] = p
+	case found:
+		s.sorted = append(s.sorted[:i], s.sorted[i+1:]...)
+	}
+}
+
+// Record a write of every row - the mutex must be held for writing
+func (s *Store) setRows(rows map[string]common.Produce) {
+	s.writes++
+	s.rows = rows
+	s.sorted = sortedRows(rows)
+}
+
+// Copy of the rows sorted by Produce Code - the mutex must be held (for reading is enough)
+func (s *Store) snapshot() []common.Produce {
+	return append(make([]common.Produce, 0, len(s.sorted)), s.sorted...)
+}
+
+// Span attribute for a Produce Code
+func produceCodeAttr(produceCode string) attribute.KeyValue {
+	return attribute.String("produce.code", produceCode)
+}
+
+// Get the Produce with produceCode - ErrNotFound if there is none
+func (s *Store) Get(ctx context.Context, produceCode string) (p common.Produce, err error) {
+	_, unlock, err := s.lock(ctx, opGet, produceCodeAttr(produceCode))
+	if err != nil {
+		return common.Produce{}, err
+	}
+	defer func() { unlock(err) }()
+
+	p, ok := s.rows[strings.ToUpper(produceCode)]
+	if !ok {
+		return common.Produce{}, ErrNotFound
+	}
+	return p, nil
+}
+
+// Every Produce, sorted by Produce Code
+func (s *Store) List(ctx context.Context) (produceList []common.Produce, err error) {
+	_, unlock, err := s.lock(ctx, opList)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(nil)
+	return s.snapshot(), nil
+}
+
+// Add new Produce - ErrExists if its Produce Code is taken, ErrQuota if the store is full,
+// ErrCategoryNotFound if its Category does not exist
+func (s *Store) Add(ctx context.Context, p common.Produce) (_ common.Produce, err error) {
+	_, unlock, err := s.lock(ctx, opAdd, produceCodeAttr(p.ProduceCode))
+	if err != nil {
+		return common.Produce{}, err
+	}
+	defer func() { unlock(err) }()
+
+	key := strings.ToUpper(p.ProduceCode)
+	if _, ok := s.rows[key]; ok {
+		return common.Produce{}, ErrExists
+	}
+	if p.Category != "" && !Categories.Exists(p.Category) {
+		return common.Produce{}, ErrCategoryNotFound
+	}
+	if s.maxRows > 0 && len(s.rows) >= s.maxRows {
+		return common.Produce{}, ErrQuota
+	}
+	s.rows[key] = p
+	s.changed(key)
+	return p, nil
+}
+
+// Replace existing Produce - ErrNotFound if there is none with its Produce Code,
+// ErrCategoryNotFound if its Category does not exist
+func (s *Store) Update(ctx context.Context, p common.Produce) (_ common.Produce, err error) {
+	_, unlock, err := s.lock(ctx, opUpdate, produceCodeAttr(p.ProduceCode))
+	if err != nil {
+		return common.Produce{}, err
+	}
+	defer func() { unlock(err) }()
+
+	key := strings.ToUpper(p.ProduceCode)
+	if _, ok := s.rows[key]; !ok {
+		return common.Produce{}, ErrNotFound
+	}
+	if p.Category != "" && !Categories.Exists(p.Category) {
+		return common.Produce{}, ErrCategoryNotFound
+	}
+	s.rows[key] = p
+	s.changed(key)
+	return p, nil
+}
+
+// Delete the Produce with produceCode - returns what was deleted, or ErrNotFound
+func (s *Store) Delete(ctx context.Context, produceCode string) (_ common.Produce, err error) {
+	_, unlock, err := s.lock(ctx, opDelete, produceCodeAttr(produceCode))
+	if err != nil {
+		return common.Produce{}, err
+	}
+	defer func() { unlock(err) }()
+
+	key := strings.ToUpper(produceCode)
+	p, ok := s.rows[key]
+	if !ok {
+		return common.Produce{}, ErrNotFound
+	}
+	delete(s.rows, key)
+	s.changed(key)
+	return p, nil
+}
+
+// Replace every row - returns the rows that were replaced, sorted by Produce Code
+func (s *Store) Replace(ctx context.Context, produceList []common.Produce) (_ []common.Produce, err error) {
+	newRows := make(map[string]common.Produce, len(produceList))
+	for _, p := range produceList {
+		newRows[strings.ToUpper(p.ProduceCode)] = p
+	}
+
+	_, unlock, err := s.lock(ctx, opReplace, attribute.Int("produce.count", len(produceList)))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { unlock(err) }()
+
+	old := s.sorted
+	s.setRows(newRows)
+	return old, nil
+}
+
+// Set the most rows Add may leave - 0 for no limit
+func (s *Store) setMaxRows(n int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.maxRows = n
+}
+
+// Number of rows
+func (s *Store) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.rows)
+}
+
+// Rows as a list sorted by Produce Code - the Store's mutex must be held
+func sortedRows(r map[string]common.Produce) []common.Produce {
+	keys := make([]string, 0, len(r))
+	for k := range r {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	produceList := make([]common.Produce, 0, len(keys))
+	for _, k := range keys {
+		produceList = append(produceList, r[k])
+	}
+	return produceList
+}
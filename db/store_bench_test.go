@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"example.com/produce_demo/common"
+)
+
+// Rows in the benchmark Store
+const benchRows = 1000
+
+// Helper function returning a Store of benchRows rows
+func benchStore() *Store {
+	produceList := make([]common.Produce, 0, benchRows)
+	for i := 0; i < benchRows; i++ {
+		produceList = append(produceList, common.Produce{ProduceCode: fmt.Sprintf("BNCH-0000-0000-%04d", i), Name: "Kale", UnitPrice: "1.99"})
+	}
+	return New(produceList)
+}
+
+// The operations benchmarked
+type benchStorer interface {
+	Get(ctx context.Context, produceCode string) (common.Produce, error)
+	List(ctx context.Context) ([]common.Produce, error)
+	Update(ctx context.Context, p common.Produce) (common.Produce, error)
+}
+
+// Baseline - the Store as it was before reads shared it: every operation has the store to
+// itself and every List sorts the rows
+type mutexStore struct {
+	mutex sync.Mutex
+	s     *Store
+}
+
+func (m *mutexStore) Get(ctx context.Context, produceCode string) (common.Produce, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.s.Get(ctx, produceCode)
+}
+
+func (m *mutexStore) List(ctx context.Context) ([]common.Produce, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, unlock, err := m.s.lock(ctx, opList)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock(nil)
+	return sortedRows(m.s.rows), nil
+}
+
+func (m *mutexStore) Update(ctx context.Context, p common.Produce) (common.Produce, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.s.Update(ctx, p)
+}
+
+// Benchmark Store operations from parallel goroutines, against the mutex only baseline
+// Each mix is the share of Get, List and Update operations (in percent) - e.g. 89/1/10
+func BenchmarkStore(b *testing.B) {
+	for _, variant := range []struct {
+		name  string
+		store func() benchStorer
+	}{
+		{"mutex", func() benchStorer { return &mutexStore{s: benchStore()} }},
+		{"rwmutex", func() benchStorer { return benchStore() }},
+	} {
+		for _, mix := range []struct{ get, list, update int }{
+			{100, 0, 0},
+			{0, 100, 0},
+			{0, 0, 100},
+			{89, 1, 10},
+			{50, 0, 50},
+			{45, 5, 50},
+		} {
+			b.Run(fmt.Sprintf("%s/%d/%d/%d", variant.name, mix.get, mix.list, mix.update), func(b *testing.B) {
+				s := variant.store()
+				ctx := context.Background()
+				var seed atomic.Int64
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					n := int(seed.Add(7919))
+					for pb.Next() {
+						n++
+						p := common.Produce{ProduceCode: fmt.Sprintf("BNCH-0000-0000-%04d", n%benchRows), Name: "Kale", UnitPrice: "1.99"}
+						switch op := n % 100; {
+						case op < mix.get:
+							s.Get(ctx, p.ProduceCode)
+						case op < mix.get+mix.list:
+							s.List(ctx)
+						default:
+							s.Update(ctx, p)
+						}
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+)
+
+// Test each Store operation and its errors
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	kale := common.Produce{ProduceCode: "STOR-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"}
+	s := New([]common.Produce{kale})
+
+	if p, err := s.Get(ctx, "stor-1111-2222-3333"); err != nil || p != kale {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", kale, p, err)
+	}
+	if _, err := s.Get(ctx, "STOR-1111-2222-4444"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrNotFound, err)
+	}
+
+	leek := common.Produce{ProduceCode: "stor-1111-2222-0000", Name: "Leek", UnitPrice: ".89"}
+	if p, err := s.Add(ctx, leek); err != nil || p != leek {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", leek, p, err)
+	}
+	if _, err := s.Add(ctx, kale); !errors.Is(err, ErrExists) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrExists, err)
+	}
+	if produceList, err := s.List(ctx); err != nil || len(produceList) != 2 || produceList[0] != leek || produceList[1] != kale {
+		t.Errorf("ERROR -- expected the rows sorted by Produce Code but got (%v) (%v)\n", produceList, err)
+	}
+
+	kale.UnitPrice = "2.49"
+	if p, err := s.Update(ctx, kale); err != nil || p != kale {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", kale, p, err)
+	}
+	if _, err := s.Update(ctx, common.Produce{ProduceCode: "STOR-1111-2222-4444"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrNotFound, err)
+	}
+
+	if p, err := s.Delete(ctx, "STOR-1111-2222-0000"); err != nil || p != leek {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", leek, p, err)
+	}
+	if _, err := s.Delete(ctx, "STOR-1111-2222-0000"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrNotFound, err)
+	}
+
+	if old, err := s.Replace(ctx, []common.Produce{leek}); err != nil || len(old) != 1 || old[0] != kale || s.Len() != 1 {
+		t.Errorf("ERROR -- expected (%v) to be replaced but got (%v) (%v)\n", kale, old, err)
+	}
+}
+
+// Test operations are abandoned once their context is done
+func TestStoreCancel(t *testing.T) {
+	s := New(nil)
+	kale := common.Produce{ProduceCode: "STOR-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"}
+
+	// Before the operation starts
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := s.Add(ctx, kale); !errors.Is(err, context.Canceled) || s.Len() != 0 {
+		t.Errorf("ERROR -- expected (%v) and nothing added but got (%v) (%v)\n", context.Canceled, err, s.Len())
+	}
+
+	// While waiting for the store
+	s.mutex.Lock()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Add(ctx, kale)
+		done <- err
+	}()
+	<-ctx.Done()
+	s.mutex.Unlock()
+	if err := <-done; !errors.Is(err, context.DeadlineExceeded) || s.Len() != 0 {
+		t.Errorf("ERROR -- expected (%v) and nothing added but got (%v) (%v)\n", context.DeadlineExceeded, err, s.Len())
+	}
+}
+
+// Test List serves a snapshot that follows writes and cannot be changed by callers
+func TestStoreSnapshot(t *testing.T) {
+	ctx := context.Background()
+	kale := common.Produce{ProduceCode: "STOR-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"}
+	s := New([]common.Produce{kale})
+
+	produceList, _ := s.List(ctx)
+	produceList[0].Name = "Changed"
+	if produceList, _ := s.List(ctx); produceList[0] != kale {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", kale, produceList[0])
+	}
+
+	leek := common.Produce{ProduceCode: "STOR-1111-2222-0000", Name: "Leek", UnitPrice: ".89"}
+	s.Add(ctx, leek)
+	if produceList, _ := s.List(ctx); len(produceList) != 2 || produceList[0] != leek {
+		t.Errorf("ERROR -- expected (%v) first but got (%v)\n", leek, produceList)
+	}
+	s.Delete(ctx, leek.ProduceCode)
+	if produceList, _ := s.List(ctx); len(produceList) != 1 {
+		t.Errorf("ERROR -- expected 1 row but got (%v)\n", produceList)
+	}
+
+	// Writes keep the rows sorted, matching Produce Codes case insensitively
+	kale2 := common.Produce{ProduceCode: "stor-1111-2222-3333", Name: "Kale", UnitPrice: "2.49"}
+	s.Update(ctx, kale2)
+	if produceList, _ := s.List(ctx); len(produceList) != 1 || produceList[0] != kale2 {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", kale2, produceList)
+	}
+	s.Replace(ctx, []common.Produce{leek, kale})
+	if produceList, _ := s.List(ctx); len(produceList) != 2 || produceList[0] != leek || produceList[1] != kale {
+		t.Errorf("ERROR -- expected (%v) (%v) but got (%v)\n", leek, kale, produceList)
+	}
+}
+
+// Test reads and writes from many goroutines - run with -race
+func TestStoreConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := New(nil)
+	done := make(chan bool)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			p := common.Produce{ProduceCode: fmt.Sprintf("STOR-1111-2222-%04d", i), Name: "Kale", UnitPrice: "1.99"}
+			for j := 0; j < 100; j++ {
+				s.Add(ctx, p)
+				s.Get(ctx, p.ProduceCode)
+				s.List(ctx)
+				s.Delete(ctx, p.ProduceCode)
+			}
+			s.Add(ctx, p)
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		<-done
+	}
+	if produceList, _ := s.List(ctx); len(produceList) != 8 || s.Len() != 8 {
+		t.Errorf("ERROR -- expected 8 rows but got (%v)\n", produceList)
+	}
+}
@@ -0,0 +1,349 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors returned by SupplierDirectory operations
+var (
+	ErrSupplierNotFound     = errors.New("supplier not found")
+	ErrSupplierExists       = errors.New("supplier already exists")
+	ErrSupplierItemNotFound = errors.New("supplier item not found")
+	ErrSupplierInUse        = errors.New("supplier has open purchase orders")
+)
+
+// Supplier IDs are lower case letters, digits and dashes so they can appear in URLs
+var supplierIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Reports whether id may be a Supplier ID
+func ValidSupplierID(id string) bool {
+	return supplierIDPattern.MatchString(id)
+}
+
+// Supplier is a grower or wholesaler Produce is bought from
+type Supplier struct {
+	ID           string    `json:"ID"`
+	Name         string    `json:"Name"`
+	Contact      string    `json:"Contact,omitempty"` // Who to order from, such as a name, phone number or email
+	LeadTimeDays int       `json:"Lead Time Days"`    // Days from ordering to delivery
+	Created      time.Time `json:"Created"`
+}
+
+// SupplierItem is a Produce Code a supplier sells, under their own SKU and at their cost
+type SupplierItem struct {
+	Supplier    string `json:"Supplier"`
+	ProduceCode string `json:"Produce Code"`
+	SKU         string `json:"SKU,omitempty"`
+	Cost        string `json:"Cost"`
+}
+
+type supplierItemKey struct {
+	supplier    string
+	produceCode string // Upper case, as Produce Codes are case insensitive
+}
+
+// SupplierDirectory holds the suppliers and the items they sell, shared by every store
+// With the file backend they are kept in a file beside Default's file - see sideFile
+type SupplierDirectory struct {
+	mutex     *sync.RWMutex
+	suppliers map[string]Supplier
+	items     map[supplierItemKey]SupplierItem
+	path      string // File the suppliers are kept in - empty to keep them in memory
+}
+
+// Suppliers is the directory of suppliers served by the API
+var Suppliers = &SupplierDirectory{mutex: &sync.RWMutex{}, suppliers: map[string]Supplier{}, items: map[supplierItemKey]SupplierItem{}}
+
+// Layout of the suppliers' file
+type supplierFile struct {
+	Suppliers []Supplier     `json:"Suppliers"`
+	Items     []SupplierItem `json:"Items"`
+}
+
+// Create a supplier - ErrSupplierExists if its ID is taken
+func (d *SupplierDirectory) Create(s Supplier) (Supplier, error) {
+	if !ValidSupplierID(s.ID) {
+		return Supplier{}, errors.New("bad supplier ID (" + s.ID + ")")
+	}
+	s.Created = time.Now().UTC().Truncate(time.Second)
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.suppliers[s.ID]; ok {
+		return Supplier{}, ErrSupplierExists
+	}
+	d.suppliers[s.ID] = s
+	if err := d.save(); err != nil {
+		delete(d.suppliers, s.ID)
+		return Supplier{}, err
+	}
+	return s, nil
+}
+
+// The supplier with id - ErrSupplierNotFound if there is none
+func (d *SupplierDirectory) Get(id string) (Supplier, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	s, ok := d.suppliers[id]
+	if !ok {
+		return Supplier{}, ErrSupplierNotFound
+	}
+	return s, nil
+}
+
+// Every supplier, sorted by ID
+func (d *SupplierDirectory) List() []Supplier {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	suppliers := make([]Supplier, 0, len(d.suppliers))
+	for _, s := range d.suppliers {
+		suppliers = append(suppliers, s)
+	}
+	sort.Slice(suppliers, func(i, j int) bool { return suppliers[i].ID < suppliers[j].ID })
+	return suppliers
+}
+
+// Change the Name, Contact and Lead Time of the supplier with s's ID - ErrSupplierNotFound if there is none
+func (d *SupplierDirectory) Update(s Supplier) (Supplier, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	old, ok := d.suppliers[s.ID]
+	if !ok {
+		return Supplier{}, ErrSupplierNotFound
+	}
+	s.Created = old.Created
+	d.suppliers[s.ID] = s
+	if err := d.save(); err != nil {
+		d.suppliers[s.ID] = old
+		return Supplier{}, err
+	}
+	return s, nil
+}
+
+// Delete the supplier with id and the items it sells - returns what was deleted
+// ErrSupplierNotFound if there is none, ErrSupplierInUse if a store has a purchase order from it
+// that is not yet received or cancelled
+func (d *SupplierDirectory) Delete(id string) (Supplier, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	s, ok := d.suppliers[id]
+	if !ok {
+		return Supplier{}, ErrSupplierNotFound
+	}
+	for _, store := range append([]*Store{Default}, Tenants.stores()...) {
+		if store.Inventory().ordersOpenFrom(id) {
+			return Supplier{}, ErrSupplierInUse
+		}
+	}
+	items := map[supplierItemKey]SupplierItem{}
+	for key, item := range d.items {
+		if key.supplier == id {
+			items[key] = item
+			delete(d.items, key)
+		}
+	}
+	delete(d.suppliers, id)
+	if err := d.save(); err != nil {
+		d.suppliers[id] = s
+		for key, item := range items {
+			d.items[key] = item
+		}
+		return Supplier{}, err
+	}
+	return s, nil
+}
+
+// Add or replace the item a supplier sells - ErrSupplierNotFound if the supplier does not exist
+func (d *SupplierDirectory) SetItem(item SupplierItem) (SupplierItem, error) {
+	key := supplierItemKey{supplier: item.Supplier, produceCode: strings.ToUpper(item.ProduceCode)}
+	item.ProduceCode = key.produceCode
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, ok := d.suppliers[item.Supplier]; !ok {
+		return SupplierItem{}, ErrSupplierNotFound
+	}
+	old, existed := d.items[key]
+	d.items[key] = item
+	if err := d.save(); err != nil {
+		if existed {
+			d.items[key] = old
+		} else {
+			delete(d.items, key)
+		}
+		return SupplierItem{}, err
+	}
+	return item, nil
+}
+
+// The item with produceCode sold by supplier - ErrSupplierItemNotFound if it does not sell it
+func (d *SupplierDirectory) Item(supplier string, produceCode string) (SupplierItem, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	item, ok := d.items[supplierItemKey{supplier: supplier, produceCode: strings.ToUpper(produceCode)}]
+	if !ok {
+		return SupplierItem{}, ErrSupplierItemNotFound
+	}
+	return item, nil
+}
+
+// Stop a supplier selling the item with produceCode - returns what was deleted
+// ErrSupplierItemNotFound if it does not sell it
+func (d *SupplierDirectory) DeleteItem(supplier string, produceCode string) (SupplierItem, error) {
+	key := supplierItemKey{supplier: supplier, produceCode: strings.ToUpper(produceCode)}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	item, ok := d.items[key]
+	if !ok {
+		return SupplierItem{}, ErrSupplierItemNotFound
+	}
+	delete(d.items, key)
+	if err := d.save(); err != nil {
+		d.items[key] = item
+		return SupplierItem{}, err
+	}
+	return item, nil
+}
+
+// Run f holding the supplier with id, so it cannot be deleted until f returns
+// ErrSupplierNotFound, without running f, if there is none
+func (d *SupplierDirectory) holding(id string, f func() error) error {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if _, ok := d.suppliers[id]; !ok {
+		return ErrSupplierNotFound
+	}
+	return f()
+}
+
+// Items sold by supplier, sorted by Produce Code
+func (d *SupplierDirectory) ItemsFrom(supplier string) []SupplierItem {
+	return d.itemsWhere(func(key supplierItemKey) bool { return key.supplier == supplier })
+}
+
+// Items with produceCode, one for each supplier selling it, sorted by supplier
+func (d *SupplierDirectory) ItemsFor(produceCode string) []SupplierItem {
+	produceCode = strings.ToUpper(produceCode)
+	return d.itemsWhere(func(key supplierItemKey) bool { return key.produceCode == produceCode })
+}
+
+// Every item of every supplier, sorted by supplier then Produce Code
+func (d *SupplierDirectory) Items() []SupplierItem {
+	return d.itemsWhere(func(supplierItemKey) bool { return true })
+}
+
+// Replace every supplier and item with suppliers and items - the caller checks them, and that
+// each item's supplier is among suppliers. They are put back if they cannot be saved
+func (d *SupplierDirectory) Replace(suppliers []Supplier, items []SupplierItem) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	oldSuppliers, oldItems := d.suppliers, d.items
+	d.suppliers = make(map[string]Supplier, len(suppliers))
+	for _, s := range suppliers {
+		d.suppliers[s.ID] = s
+	}
+	d.items = make(map[supplierItemKey]SupplierItem, len(items))
+	for _, item := range items {
+		item.ProduceCode = strings.ToUpper(item.ProduceCode)
+		d.items[supplierItemKey{supplier: item.Supplier, produceCode: item.ProduceCode}] = item
+	}
+	if err := d.save(); err != nil {
+		d.suppliers, d.items = oldSuppliers, oldItems
+		return err
+	}
+	return nil
+}
+
+// Items whose key matches, sorted by supplier then Produce Code
+func (d *SupplierDirectory) itemsWhere(match func(supplierItemKey) bool) []SupplierItem {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	items := []SupplierItem{}
+	for key, item := range d.items {
+		if match(key) {
+			items = append(items, item)
+		}
+	}
+	sortSupplierItems(items)
+	return items
+}
+
+func sortSupplierItems(items []SupplierItem) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Supplier != items[j].Supplier {
+			return items[i].Supplier < items[j].Supplier
+		}
+		return items[i].ProduceCode < items[j].ProduceCode
+	})
+}
+
+// Keep the suppliers in the file at path, replacing the current suppliers with those in it if it exists
+func (d *SupplierDirectory) open(path string) error {
+	listed := supplierFile{}
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &listed); err != nil {
+			return errors.New(path + ": " + err.Error())
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.path = path
+	d.suppliers = map[string]Supplier{}
+	d.items = map[supplierItemKey]SupplierItem{}
+	for _, s := range listed.Suppliers {
+		if !ValidSupplierID(s.ID) {
+			return errors.New(path + ": bad supplier ID (" + s.ID + ")")
+		}
+		d.suppliers[s.ID] = s
+	}
+	for _, item := range listed.Items {
+		if _, ok := d.suppliers[item.Supplier]; !ok {
+			return errors.New(path + ": item " + item.ProduceCode + " has an unknown supplier (" + item.Supplier + ")")
+		}
+		item.ProduceCode = strings.ToUpper(item.ProduceCode)
+		d.items[supplierItemKey{supplier: item.Supplier, produceCode: item.ProduceCode}] = item
+	}
+	return d.save()
+}
+
+// Stop keeping the suppliers in a file - they stay in memory
+func (d *SupplierDirectory) close() {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.path = ""
+}
+
+// Write the suppliers and their items, if they are kept in a file - the mutex must be held
+func (d *SupplierDirectory) save() error {
+	if d.path == "" {
+		return nil
+	}
+	listed := supplierFile{Suppliers: make([]Supplier, 0, len(d.suppliers)), Items: make([]SupplierItem, 0, len(d.items))}
+	for _, s := range d.suppliers {
+		listed.Suppliers = append(listed.Suppliers, s)
+	}
+	sort.Slice(listed.Suppliers, func(i, j int) bool { return listed.Suppliers[i].ID < listed.Suppliers[j].ID })
+	for _, item := range d.items {
+		listed.Items = append(listed.Items, item)
+	}
+	sortSupplierItems(listed.Items)
+	b, err := json.MarshalIndent(listed, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(d.path, b)
+}
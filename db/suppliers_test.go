@@ -0,0 +1,153 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Remove every supplier
+func resetSuppliers() {
+	Suppliers.mutex.Lock()
+	defer Suppliers.mutex.Unlock()
+	Suppliers.suppliers = map[string]Supplier{}
+	Suppliers.items = map[supplierItemKey]SupplierItem{}
+}
+
+// Test suppliers can be kept with the items they sell, found by supplier or by Produce Code
+func TestSuppliers(t *testing.T) {
+	resetSuppliers()
+	defer resetSuppliers()
+
+	for _, s := range []Supplier{{ID: "orchard", Name: "Orchard Farms", LeadTimeDays: 3}, {ID: "valley", Name: "Valley Growers", Contact: "orders@valley.example.com"}} {
+		if _, err := Suppliers.Create(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Suppliers.Create(Supplier{ID: "orchard", Name: "Again"}); !errors.Is(err, ErrSupplierExists) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrSupplierExists, err)
+	}
+	if _, err := Suppliers.Create(Supplier{ID: "Orchard", Name: "Orchard"}); err == nil {
+		t.Errorf("ERROR -- expected an error for a bad supplier ID\n")
+	}
+	updated, err := Suppliers.Update(Supplier{ID: "orchard", Name: "Orchard Farms", LeadTimeDays: 5})
+	if err != nil || updated.LeadTimeDays != 5 || updated.Created.IsZero() {
+		t.Errorf("ERROR -- expected the lead time changed but got (%v) (%v)\n", updated, err)
+	}
+	if _, err := Suppliers.Update(Supplier{ID: "none", Name: "None"}); !errors.Is(err, ErrSupplierNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrSupplierNotFound, err)
+	}
+
+	gala := "tq4c-vv6t-75zx-1rmr"
+	Suppliers.SetItem(SupplierItem{Supplier: "valley", ProduceCode: gala, SKU: "V-100", Cost: "1.10"})
+	Suppliers.SetItem(SupplierItem{Supplier: "orchard", ProduceCode: gala, SKU: "GALA", Cost: "1.25"})
+	Suppliers.SetItem(SupplierItem{Supplier: "orchard", ProduceCode: "E5T6-9UI3-TH15-QR88", Cost: "0.90"})
+	if _, err := Suppliers.SetItem(SupplierItem{Supplier: "none", ProduceCode: gala, Cost: "1.00"}); !errors.Is(err, ErrSupplierNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrSupplierNotFound, err)
+	}
+
+	expected := []SupplierItem{{Supplier: "orchard", ProduceCode: "TQ4C-VV6T-75ZX-1RMR", SKU: "GALA", Cost: "1.25"}, {Supplier: "valley", ProduceCode: "TQ4C-VV6T-75ZX-1RMR", SKU: "V-100", Cost: "1.10"}}
+	if items := Suppliers.ItemsFor(gala); !reflect.DeepEqual(items, expected) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", expected, items)
+	}
+	if items := Suppliers.ItemsFrom("orchard"); len(items) != 2 || items[0].ProduceCode != "E5T6-9UI3-TH15-QR88" {
+		t.Errorf("ERROR -- expected 2 items from orchard but got (%v)\n", items)
+	}
+
+	// Deleting a supplier deletes the items it sells
+	if _, err := Suppliers.DeleteItem("valley", gala); err != nil {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", nil, err)
+	}
+	if _, err := Suppliers.Item("valley", gala); !errors.Is(err, ErrSupplierItemNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrSupplierItemNotFound, err)
+	}
+	if _, err := Suppliers.Delete("orchard"); err != nil {
+		t.Fatal(err)
+	}
+	if items := Suppliers.ItemsFor(gala); len(items) != 0 {
+		t.Errorf("ERROR -- expected no items but got (%v)\n", items)
+	}
+	if _, err := Suppliers.Delete("orchard"); !errors.Is(err, ErrSupplierNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrSupplierNotFound, err)
+	}
+}
+
+// Test a supplier with open purchase orders in any store cannot be deleted
+func TestSupplierInUse(t *testing.T) {
+	addOrderSuppliers(t)
+	saved := Default.inventory
+	Default.inventory = newInventory()
+	defer func() { Default.inventory = saved }()
+
+	order, _ := Default.Inventory().CreateOrder("orchard", []OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 1}})
+	for _, status := range []string{OrderDraft, OrderSubmitted} {
+		if _, err := Suppliers.Delete("orchard"); !errors.Is(err, ErrSupplierInUse) {
+			t.Errorf("ERROR -- for a %v order expected (%v) but got (%v)\n", status, ErrSupplierInUse, err)
+		}
+		Default.Inventory().SubmitOrder(order.ID)
+	}
+	Default.Inventory().CancelOrder(order.ID)
+	if _, err := Suppliers.Delete("orchard"); err != nil {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", nil, err)
+	}
+
+	// Nor can orders be created from a supplier that is gone
+	if _, err := Default.Inventory().CreateOrder("orchard", []OrderLine{{ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Ordered: 1}}); !errors.Is(err, ErrSupplierNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrSupplierNotFound, err)
+	}
+}
+
+// Test the file backend keeps the suppliers and their items beside the default store
+func TestSupplierFiles(t *testing.T) {
+	resetSuppliers()
+	defer resetSuppliers()
+	resetRows()
+	defer resetRows()
+	path := filepath.Join(t.TempDir(), "produce.json")
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	supplier, _ := Suppliers.Create(Supplier{ID: "orchard", Name: "Orchard Farms", LeadTimeDays: 3})
+	item, _ := Suppliers.SetItem(SupplierItem{Supplier: "orchard", ProduceCode: "TQ4C-VV6T-75ZX-1RMR", SKU: "GALA", Cost: "1.25"})
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resetSuppliers()
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer Close()
+	if suppliers := Suppliers.List(); !reflect.DeepEqual(suppliers, []Supplier{supplier}) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", supplier, suppliers)
+	}
+	if items := Suppliers.ItemsFrom("orchard"); !reflect.DeepEqual(items, []SupplierItem{item}) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", item, items)
+	}
+}
+
+// Test suppliers' items can be set while they are read
+func TestSuppliersConcurrent(t *testing.T) {
+	resetSuppliers()
+	defer resetSuppliers()
+	Suppliers.Create(Supplier{ID: "orchard", Name: "Orchard Farms"})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				Suppliers.SetItem(SupplierItem{Supplier: "orchard", ProduceCode: "TQ4C-VV6T-75ZX-1RMR", Cost: "1.25"})
+				Suppliers.ItemsFor("TQ4C-VV6T-75ZX-1RMR")
+			}
+		}()
+	}
+	wg.Wait()
+	if items := Suppliers.ItemsFrom("orchard"); len(items) != 1 {
+		t.Errorf("ERROR -- expected (%v) items but got (%v)\n", 1, len(items))
+	}
+}
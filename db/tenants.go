@@ -0,0 +1,226 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Errors returned by TenantRegistry operations
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantExists   = errors.New("tenant already exists")
+)
+
+// Tenant IDs are lower case letters, digits and dashes so they can name files and appear in URLs
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// Reports whether id may be a Tenant ID
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// Tenant is a store with its own catalog, such as one grocery location
+type Tenant struct {
+	ID         string    `json:"ID"`
+	Name       string    `json:"Name"`
+	MaxProduce int       `json:"Max Produce"` // Most Produce the catalog may hold - 0 for no limit
+	Created    time.Time `json:"Created"`
+}
+
+type tenant struct {
+	Tenant
+	store *Store
+}
+
+// TenantRegistry holds the tenants and their catalogs
+// With the file backend the tenants are listed in tenants.json in a directory that also holds
+// each tenant's catalog in <ID>.json
+type TenantRegistry struct {
+	mutex   *sync.RWMutex
+	tenants map[string]*tenant
+	dir     string // Directory the tenants are kept in - empty to keep them in memory
+}
+
+// Tenants is the registry of tenants served by the API
+var Tenants = &TenantRegistry{mutex: &sync.RWMutex{}, tenants: map[string]*tenant{}}
+
+// Create a tenant with an empty catalog, Created now unless it is set - ErrTenantExists if its ID is taken
+func (r *TenantRegistry) Create(t Tenant) (Tenant, error) {
+	if !ValidTenantID(t.ID) {
+		return Tenant{}, errors.New("bad tenant ID (" + t.ID + ")")
+	}
+	if t.Created.IsZero() {
+		t.Created = time.Now().UTC().Truncate(time.Second)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.tenants[t.ID]; ok {
+		return Tenant{}, ErrTenantExists
+	}
+	entry := &tenant{Tenant: t, store: New(nil)}
+	entry.store.maxRows = t.MaxProduce
+	if r.dir != "" {
+		if _, err := entry.store.openFile(r.catalogPath(t.ID)); err != nil {
+			return Tenant{}, err
+		}
+	}
+	r.tenants[t.ID] = entry
+	if err := r.save(); err != nil {
+		delete(r.tenants, t.ID)
+		os.Remove(r.catalogPath(t.ID))
+		os.Remove(inventoryFile(r.catalogPath(t.ID)))
+		return Tenant{}, err
+	}
+	return t, nil
+}
+
+// Create the tenant t with an empty catalog, or give the tenant with its ID the Name, Max Produce
+// and Created of t, keeping its catalog - for restoring a tenant as it was
+func (r *TenantRegistry) Put(t Tenant) (Tenant, error) {
+	r.mutex.Lock()
+	entry, ok := r.tenants[t.ID]
+	if !ok {
+		r.mutex.Unlock()
+		return r.Create(t)
+	}
+	defer r.mutex.Unlock()
+	old := entry.Tenant
+	entry.Tenant = t
+	if err := r.save(); err != nil {
+		entry.Tenant = old
+		return Tenant{}, err
+	}
+	entry.store.setMaxRows(t.MaxProduce)
+	return t, nil
+}
+
+// The tenant with id and its catalog - ErrTenantNotFound if there is none
+func (r *TenantRegistry) Get(id string) (Tenant, *Store, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	entry, ok := r.tenants[id]
+	if !ok {
+		return Tenant{}, nil, ErrTenantNotFound
+	}
+	return entry.Tenant, entry.store, nil
+}
+
+// Every tenant, sorted by ID
+func (r *TenantRegistry) List() []Tenant {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, entry := range r.tenants {
+		tenants = append(tenants, entry.Tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	return tenants
+}
+
+// Delete the tenant with id and its catalog - returns what was deleted, or ErrTenantNotFound
+func (r *TenantRegistry) Delete(id string) (Tenant, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entry, ok := r.tenants[id]
+	if !ok {
+		return Tenant{}, ErrTenantNotFound
+	}
+	delete(r.tenants, id)
+	if err := r.save(); err != nil {
+		r.tenants[id] = entry
+		return Tenant{}, err
+	}
+	if r.dir != "" {
+		entry.store.closeFile()
+		for _, path := range []string{r.catalogPath(id), inventoryFile(r.catalogPath(id))} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				logger.Warn("Delete - failed to remove the tenant's catalog", "tenant", id, "path", path, "error", err)
+			}
+		}
+	}
+	return entry.Tenant, nil
+}
+
+// Catalogs of every tenant
+func (r *TenantRegistry) stores() []*Store {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	stores := make([]*Store, 0, len(r.tenants))
+	for _, entry := range r.tenants {
+		stores = append(stores, entry.store)
+	}
+	return stores
+}
+
+// Keep the tenants in dir, replacing the current tenants with those listed there if it exists
+func (r *TenantRegistry) open(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	listed := []Tenant{}
+	b, err := os.ReadFile(filepath.Join(dir, "tenants.json"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &listed); err != nil {
+			return errors.New(filepath.Join(dir, "tenants.json") + ": " + err.Error())
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.dir = dir
+	r.tenants = map[string]*tenant{}
+	for _, t := range listed {
+		if !ValidTenantID(t.ID) {
+			return errors.New(filepath.Join(dir, "tenants.json") + ": bad tenant ID (" + t.ID + ")")
+		}
+		entry := &tenant{Tenant: t, store: New(nil)}
+		entry.store.maxRows = t.MaxProduce
+		if _, err := entry.store.openFile(r.catalogPath(t.ID)); err != nil {
+			return err
+		}
+		r.tenants[t.ID] = entry
+	}
+	return r.save()
+}
+
+// Stop keeping the tenants in files - they stay in memory
+func (r *TenantRegistry) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.dir = ""
+	for _, entry := range r.tenants {
+		entry.store.closeFile()
+	}
+}
+
+func (r *TenantRegistry) catalogPath(id string) string {
+	return filepath.Join(r.dir, id+".json")
+}
+
+// Write the list of tenants, if they are kept in files - the mutex must be held
+func (r *TenantRegistry) save() error {
+	if r.dir == "" {
+		return nil
+	}
+	tenants := make([]Tenant, 0, len(r.tenants))
+	for _, entry := range r.tenants {
+		tenants = append(tenants, entry.Tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i].ID < tenants[j].ID })
+	b, err := json.MarshalIndent(tenants, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(r.dir, "tenants.json"), b)
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/common"
+)
+
+// Test tenants have catalogs of their own, within their quota
+func TestTenants(t *testing.T) {
+	if _, err := Tenants.Create(Tenant{ID: "north", Name: "North", MaxProduce: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer Tenants.Delete("north")
+	if _, err := Tenants.Create(Tenant{ID: "north", Name: "North again"}); !errors.Is(err, ErrTenantExists) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrTenantExists, err)
+	}
+	if _, err := Tenants.Create(Tenant{ID: "../south", Name: "South"}); err == nil {
+		t.Errorf("ERROR -- expected an error for a bad tenant ID\n")
+	}
+
+	ctx := context.Background()
+	_, north, err := Tenants.Get("north")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kale := common.Produce{ProduceCode: "TNNT-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"}
+	if _, err := north.Add(ctx, kale); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := north.Add(ctx, common.Produce{ProduceCode: "TNNT-1111-2222-4444", Name: "Leek", UnitPrice: "0.99"}); !errors.Is(err, ErrQuota) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrQuota, err)
+	}
+	if _, err := Default.Get(ctx, kale.ProduceCode); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ERROR -- expected the tenant's Produce kept out of the default store but got (%v)\n", err)
+	}
+
+	if tenants := Tenants.List(); len(tenants) != 1 || tenants[0].ID != "north" || tenants[0].MaxProduce != 1 {
+		t.Errorf("ERROR -- expected north listed but got (%v)\n", tenants)
+	}
+	if _, err := Tenants.Delete("north"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Tenants.Get("north"); !errors.Is(err, ErrTenantNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrTenantNotFound, err)
+	}
+	if _, err := Tenants.Delete("north"); !errors.Is(err, ErrTenantNotFound) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrTenantNotFound, err)
+	}
+}
+
+// Test the file backend keeps the tenants and their catalogs beside the default store
+func TestTenantFiles(t *testing.T) {
+	resetRows()
+	defer resetRows()
+	path := filepath.Join(t.TempDir(), "produce.json")
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	created, err := Tenants.Create(Tenant{ID: "east", Name: "East", MaxProduce: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, east, _ := Tenants.Get("east")
+	kale := common.Produce{ProduceCode: "TNNT-1111-2222-3333", Name: "Kale", UnitPrice: "1.99"}
+	east.Add(context.Background(), kale)
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if produceList := readFile(t, filepath.Join(TenantsDir(path), "east.json")); !reflect.DeepEqual(produceList, []common.Produce{kale}) {
+		t.Errorf("ERROR -- expected (%v) written but got (%v)\n", kale, produceList)
+	}
+
+	// Reopening loads them
+	Tenants.Delete("east")
+	if _, err := OpenFile(path, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		Tenants.Delete("east")
+		Close()
+	}()
+	tenant, east, err := Tenants.Get("east")
+	if err != nil || tenant != created {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) (%v)\n", created, tenant, err)
+	}
+	if produceList, _ := east.List(context.Background()); !reflect.DeepEqual(produceList, []common.Produce{kale}) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", kale, produceList)
+	}
+}
@@ -0,0 +1,198 @@
+// Health checks and process status
+//
+// Subsystems register readiness checks and statistics by name:
+//
+//	health.Register("store", func(ctx context.Context) error { ... })
+//	health.RegisterStats("store", func() interface{} { return Stats() })
+package health
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Version of the server - set at build time with
+// -ldflags "-X example.com/produce_demo/health.Version=1.2.3"
+var Version = "dev"
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Longest a single check may take before it is failed
+const checkTimeout = 2 * time.Second
+
+// Check reports an error if the subsystem is not ready to serve
+type Check func(ctx context.Context) error
+
+// Outcome of a Check
+type Result struct {
+	Status   string `json:"Status"`
+	Error    string `json:"Error,omitempty"`
+	Duration string `json:"Duration"`
+}
+
+// Build information from the binary
+type Build struct {
+	GoVersion    string `json:"Go Version"`
+	Revision     string `json:"Revision,omitempty"`
+	RevisionTime string `json:"Revision Time,omitempty"`
+	Modified     bool   `json:"Modified,omitempty"` // Built from a tree with uncommitted changes
+}
+
+// Detailed status of the process
+type Status struct {
+	Status  string                 `json:"Status"` // StatusOK if every check passed
+	Version string                 `json:"Version"`
+	Started time.Time              `json:"Started"`
+	Uptime  string                 `json:"Uptime"`
+	Build   Build                  `json:"Build"`
+	Checks  map[string]Result      `json:"Checks"`
+	Stats   map[string]interface{} `json:"Stats"`
+}
+
+var (
+	registryMutex = &sync.Mutex{}
+	checks        = map[string]Check{}
+	stats         = map[string]func() interface{}{}
+	started       = time.Now().UTC()
+)
+
+// Register a readiness check - a later check with the same name replaces it
+func Register(name string, check Check) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	checks[name] = check
+}
+
+// Register a source of statistics for Status - a later source with the same name replaces it
+func RegisterStats(name string, source func() interface{}) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	stats[name] = source
+}
+
+// Remove a check and statistics source
+func Unregister(name string) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	delete(checks, name)
+	delete(stats, name)
+}
+
+// Run every check concurrently - returns whether all of them passed, and each Result
+func Ready(ctx context.Context) (bool, map[string]Result) {
+	registryMutex.Lock()
+	toRun := make(map[string]Check, len(checks))
+	for name, check := range checks {
+		toRun[name] = check
+	}
+	registryMutex.Unlock()
+
+	resultsMutex := &sync.Mutex{}
+	results := make(map[string]Result, len(toRun))
+	ready := true
+	wg := sync.WaitGroup{}
+	for name, check := range toRun {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			result := run(ctx, check)
+
+			resultsMutex.Lock()
+			defer resultsMutex.Unlock()
+			results[name] = result
+			if result.Status != StatusOK {
+				ready = false
+			}
+		}(name, check)
+	}
+	wg.Wait()
+	return ready, results
+}
+
+// Run a single check with checkTimeout
+// A check that ignores its context is abandoned (and failed) when the timeout passes
+func run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := Result{Status: StatusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Run every check and gather the statistics
+func Current(ctx context.Context) Status {
+	ready, results := Ready(ctx)
+
+	registryMutex.Lock()
+	names := make([]string, 0, len(stats))
+	for name := range stats {
+		names = append(names, name)
+	}
+	sources := make([]func() interface{}, 0, len(stats))
+	sort.Strings(names)
+	for _, name := range names {
+		sources = append(sources, stats[name])
+	}
+	registryMutex.Unlock()
+
+	status := Status{
+		Status:  StatusOK,
+		Version: Version,
+		Started: started,
+		Uptime:  time.Since(started).Round(time.Second).String(),
+		Build:   buildInfo(),
+		Checks:  results,
+		Stats:   make(map[string]interface{}, len(names)),
+	}
+	if !ready {
+		status.Status = StatusFail
+	}
+	for i, name := range names {
+		status.Stats[name] = sources[i]()
+	}
+	return status
+}
+
+// Build information embedded by the go tool
+func buildInfo() Build {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return Build{}
+	}
+	build := Build{GoVersion: info.GoVersion}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			build.Revision = setting.Value
+		case "vcs.time":
+			build.RevisionTime = setting.Value
+		case "vcs.modified":
+			build.Modified = setting.Value == "true"
+		}
+	}
+	return build
+}
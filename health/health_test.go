@@ -0,0 +1,56 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test Ready runs every check and fails on errors and timeouts
+func TestReady(t *testing.T) {
+	Register("pass", func(ctx context.Context) error { return nil })
+	Register("fail", func(ctx context.Context) error { return errors.New("broken") })
+	Register("slow", func(ctx context.Context) error { time.Sleep(time.Second); return nil })
+	defer func() {
+		Unregister("pass")
+		Unregister("fail")
+		Unregister("slow")
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	ready, results := Ready(ctx)
+	if ready || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("ERROR -- expected not ready without waiting for the slow check but got (%v) after (%v)\n", ready, time.Since(start))
+	}
+	for name, expected := range map[string]Result{
+		"pass": {Status: StatusOK},
+		"fail": {Status: StatusFail, Error: "broken"},
+		"slow": {Status: StatusFail, Error: context.DeadlineExceeded.Error()},
+	} {
+		if results[name].Status != expected.Status || results[name].Error != expected.Error {
+			t.Errorf("ERROR -- for (%v) expected (%+v) but got (%+v)\n", name, expected, results[name])
+		}
+	}
+
+	Unregister("fail")
+	Unregister("slow")
+	if ready, results := Ready(context.Background()); !ready || len(results) != 1 {
+		t.Errorf("ERROR -- expected ready but got (%v) (%v)\n", ready, results)
+	}
+}
+
+// Test Current reports the version, checks and statistics
+func TestCurrent(t *testing.T) {
+	Register("pass", func(ctx context.Context) error { return nil })
+	RegisterStats("pass", func() interface{} { return 42 })
+	defer Unregister("pass")
+
+	status := Current(context.Background())
+	if status.Status != StatusOK || status.Version != Version || status.Checks["pass"].Status != StatusOK ||
+		status.Stats["pass"] != 42 || status.Started.After(time.Now()) || status.Build.GoVersion == "" {
+		t.Errorf("ERROR -- unexpected status (%+v)\n", status)
+	}
+}
@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"context"
+	"fmt"
+
+	"example.com/produce_demo/health"
+)
+
+// Statistics reported by /status
+type Stats struct {
+	Workers int            `json:"Workers"`
+	Running int            `json:"Running Workers"`
+	Queued  int            `json:"Queued"`
+	Jobs    map[string]int `json:"Jobs"` // Jobs kept for GET /imports/:id by Status
+}
+
+func init() {
+	health.Register("imports", Ping)
+	health.RegisterStats("imports", func() interface{} { return CurrentStats() })
+}
+
+// Current statistics
+func CurrentStats() Stats {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	s := Stats{Workers: workers, Running: int(running.Load()), Jobs: map[string]int{}}
+	if queue != nil {
+		s.Queued = len(queue)
+	}
+	for _, job := range jobs {
+		s.Jobs[job.Status]++
+	}
+	return s
+}
+
+// Check imports can be accepted - not shutting down and, once started, every worker is running
+// The workers start with the first import, so none running before then is fine
+func Ping(ctx context.Context) error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	if closing {
+		return ErrShuttingDown
+	}
+	if queue != nil {
+		if n := int(running.Load()); n != workers {
+			return fmt.Errorf("%d of %d import workers running", n, workers)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+// Streaming bulk import of Produce from CSV and NDJSON
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+	"example.com/produce_demo/metrics"
+)
+
+// Media types accepted for streamed imports
+const (
+	MIMECSV    = "text/csv"
+	MIMENDJSON = "application/x-ndjson"
+)
+
+// Longest NDJSON line accepted
+const maxLineBytes = 1024 * 1024
+
+// Reasons an imported line is rejected
+const (
+	ReasonParse      = "parse"      // Line could not be read as a Produce
+	ReasonValidation = "validation" // Produce failed common.ValidateProduce
+	ReasonExists     = "exists"     // Produce Code is already in the db
+	ReasonQuota      = "quota"      // Store is full
+)
+
+// A Produce read from an import along with its source line number
+// Errors is set when the line could not be parsed into a Produce
+type Record struct {
+	Line    int
+	Produce common.Produce
+	Errors  []string
+}
+
+// Outcome of importing a single Record
+// Reason is empty when the Produce was added
+type Outcome struct {
+	Record
+	Reason string
+}
+
+// Decoder reads one Record at a time and returns io.EOF when the input is exhausted
+// Any other error means the input could not be read and decoding must stop
+type Decoder interface {
+	Next() (Record, error)
+}
+
+// Returns a Decoder for the Content-Type, or nil if it is not a streamed import type
+func NewDecoder(contentType string, r io.Reader) Decoder {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	switch mediaType {
+	case MIMECSV, "application/csv":
+		return newCSVDecoder(r)
+	case MIMENDJSON, "application/ndjson", "application/jsonl":
+		return newNDJSONDecoder(r)
+	}
+	return nil
+}
+
+// Reports whether contentType is a streamed import type
+func Supported(contentType string) bool {
+	return NewDecoder(contentType, strings.NewReader("")) != nil
+}
+
+// Reads every Record from dec, validates it and adds valid Produce to store
+// The Outcome of each Record is passed to report in source order
+// Returns an error only if the input could not be read or ctx is done
+func Import(ctx context.Context, store *db.Store, dec Decoder, report func(Outcome)) error {
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		o, err := importRecord(ctx, store, rec)
+		if err != nil {
+			return err
+		}
+		if o.Reason != "" {
+			metrics.RejectedItems.WithLabelValues(o.Reason).Inc()
+		}
+		report(o)
+	}
+}
+
+// Validate and add a single Record
+// Returns an error only if ctx is done
+func importRecord(ctx context.Context, store *db.Store, rec Record) (Outcome, error) {
+	if len(rec.Errors) != 0 {
+		return Outcome{Record: rec, Reason: ReasonParse}, nil
+	}
+	if ok, validProduceError := common.ValidateProduce(rec.Produce); !ok {
+		rec.Errors = validProduceError
+		return Outcome{Record: rec, Reason: ReasonValidation}, nil
+	}
+
+	added, err := store.Add(ctx, rec.Produce)
+	if errors.Is(err, db.ErrExists) {
+		rec.Errors = []string{strings.ToUpper(rec.Produce.ProduceCode) + " already exists"}
+		return Outcome{Record: rec, Reason: ReasonExists}, nil
+	}
+	if errors.Is(err, db.ErrQuota) {
+		rec.Errors = []string{"Store is full"}
+		return Outcome{Record: rec, Reason: ReasonQuota}, nil
+	}
+	if errors.Is(err, db.ErrCategoryNotFound) { // Deleted since the Produce was validated
+		rec.Errors = []string{"Produce Category (" + rec.Produce.Category + ") not found"}
+		return Outcome{Record: rec, Reason: ReasonValidation}, nil
+	}
+	if err != nil {
+		return Outcome{}, err
+	}
+	rec.Produce = added
+	return Outcome{Record: rec}, nil
+}
+
+// CSV column names - the same as the JSON tags on common.Produce
+// The last, Category, is optional
+var csvColumns = []string{"Produce Code", "Name", "Unit Price", "Category"}
+
+// Columns every row must have
+const requiredCSVColumns = 3
+
+// CSV Decoder
+// The first row is treated as a header if it names the columns (in any order),
+// otherwise the columns are positional: Produce Code, Name, Unit Price and optionally Category
+type csvDecoder struct {
+	r       *csv.Reader
+	columns []int // Position of each of csvColumns in a row - -1 if the header leaves it out
+	fields  int   // Fields per row set by the header - 0 without one
+	first   bool  // Still need to look for the header
+}
+
+func newCSVDecoder(r io.Reader) *csvDecoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // NOTE: field count is checked per row so one bad row doesn't stop the import
+	cr.ReuseRecord = true
+	return &csvDecoder{r: cr, columns: []int{0, 1, 2, 3}, first: true}
+}
+
+func (d *csvDecoder) Next() (Record, error) {
+	for {
+		row, err := d.r.Read()
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			d.first = false
+			return Record{Line: parseError.StartLine, Errors: []string{"Failed to parse CSV: " + parseError.Err.Error()}}, nil
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		line, _ := d.r.FieldPos(0)
+
+		if d.first {
+			d.first = false
+			row[0] = strings.TrimPrefix(row[0], "\ufeff") // NOTE: spreadsheets like to start with a byte order mark
+			if d.readHeader(row) {
+				continue
+			}
+		}
+
+		if d.fields != 0 && len(row) != d.fields {
+			return Record{Line: line, Errors: []string{fmt.Sprintf("Expected %d fields", d.fields)}}, nil
+		}
+		if d.fields == 0 && len(row) != requiredCSVColumns && len(row) != len(csvColumns) {
+			return Record{Line: line, Errors: []string{"Expected 3 or 4 fields"}}, nil
+		}
+		p := common.Produce{
+			ProduceCode: row[d.columns[0]],
+			Name:        row[d.columns[1]],
+			UnitPrice:   row[d.columns[2]],
+		}
+		if i := d.columns[3]; i >= 0 && i < len(row) {
+			p.Category = row[i]
+		}
+		return Record{Line: line, Produce: p}, nil
+	}
+}
+
+// Use row as the header if it names every required column, and nothing but columns
+func (d *csvDecoder) readHeader(row []string) bool {
+	if len(row) < requiredCSVColumns || len(row) > len(csvColumns) {
+		return false
+	}
+	columns := make([]int, len(csvColumns))
+	named := 0
+	for i, column := range csvColumns {
+		columns[i] = -1
+		for j, field := range row {
+			if strings.EqualFold(strings.TrimSpace(field), column) {
+				columns[i] = j
+			}
+		}
+		if columns[i] != -1 {
+			named++
+		} else if i < requiredCSVColumns {
+			return false
+		}
+	}
+	if named != len(row) {
+		return false
+	}
+	d.columns = columns
+	d.fields = len(row)
+	return true
+}
+
+// NDJSON Decoder - one JSON Produce per line, blank lines are skipped
+type ndjsonDecoder struct {
+	s    *bufio.Scanner
+	line int
+}
+
+func newNDJSONDecoder(r io.Reader) *ndjsonDecoder {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineBytes)
+	return &ndjsonDecoder{s: s}
+}
+
+func (d *ndjsonDecoder) Next() (Record, error) {
+	for d.s.Scan() {
+		d.line++
+		b := d.s.Bytes()
+		if len(bytes.TrimSpace(b)) == 0 {
+			continue
+		}
+
+		var produce common.Produce
+		if err := json.Unmarshal(b, &produce); err != nil {
+			return Record{Line: d.line, Errors: []string{"Failed to unmarshal line"}}, nil
+		}
+		return Record{Line: d.line, Produce: produce}, nil
+	}
+	if err := d.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/db"
+)
+
+type errReader int
+
+func (errReader) Read(p []byte) (n int, err error) {
+	return 0, errors.New("test error")
+}
+
+// Helper function to read every Record from a Decoder
+func readAll(t *testing.T, dec Decoder) []Record {
+	records := []Record{}
+	for {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// decoderTestStruct
+type decTS struct {
+	contentType string
+	input       string
+	expected    []Record
+}
+
+// decoderTestStructs: test cases
+var decTSs = []decTS{
+	{"text/csv", "Produce Code,Name,Unit Price\nAAAA-1111-2222-3333,Pizza Pie,200.6\n",
+		[]Record{{Line: 2, Produce: common.Produce{ProduceCode: "AAAA-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"}}}},
+	{"text/csv; charset=utf-8", "\ufeffunit price,NAME,Produce Code\r\n200.6,Pizza Pie,AAAA-1111-2222-3333\r\n",
+		[]Record{{Line: 2, Produce: common.Produce{ProduceCode: "AAAA-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"}}}},
+	{"text/csv", "AAAA-1111-2222-3333,Pizza Pie,200.6\nBBBB-1111-2222-3333,Celery\n\"CCCC\"x,Corn,.5\nDDDD-1111-2222-3333,\"Sweet\nCorn\",.5\n",
+		[]Record{
+			{Line: 1, Produce: common.Produce{ProduceCode: "AAAA-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"}},
+			{Line: 2, Errors: []string{"Expected 3 or 4 fields"}},
+			{Line: 3, Errors: []string{"Failed to parse CSV: extraneous or missing \" in quoted-field"}},
+			{Line: 4, Produce: common.Produce{ProduceCode: "DDDD-1111-2222-3333", Name: "Sweet\nCorn", UnitPrice: ".5"}},
+		}},
+	{"text/csv", "Category,Produce Code,Name,Unit Price\nGreens,AAAA-1111-2222-3333,Kale,1.99\nBBBB-1111-2222-3333,Leek,.89\n",
+		[]Record{
+			{Line: 2, Produce: common.Produce{ProduceCode: "AAAA-1111-2222-3333", Name: "Kale", UnitPrice: "1.99", Category: "Greens"}},
+			{Line: 3, Errors: []string{"Expected 4 fields"}},
+		}},
+	{"text/csv", "AAAA-1111-2222-3333,Kale,1.99,Greens\nBBBB-1111-2222-3333,Leek,.89\n",
+		[]Record{
+			{Line: 1, Produce: common.Produce{ProduceCode: "AAAA-1111-2222-3333", Name: "Kale", UnitPrice: "1.99", Category: "Greens"}},
+			{Line: 2, Produce: common.Produce{ProduceCode: "BBBB-1111-2222-3333", Name: "Leek", UnitPrice: ".89"}},
+		}},
+	{"application/x-ndjson", "{\"Produce Code\": \"AAAA-1111-2222-3333\", \"Name\": \"Pizza Pie\", \"Unit Price\": \"200.6\"}\n\n{\"Produce Code\": \n{\"Name\": \"Corn\"}",
+		[]Record{
+			{Line: 1, Produce: common.Produce{ProduceCode: "AAAA-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"}},
+			{Line: 3, Errors: []string{"Failed to unmarshal line"}},
+			{Line: 4, Produce: common.Produce{Name: "Corn"}},
+		}},
+}
+
+// Verify the CSV and NDJSON decoders
+func TestDecoders(t *testing.T) {
+	for _, tt := range decTSs {
+		dec := NewDecoder(tt.contentType, strings.NewReader(tt.input))
+		if dec == nil {
+			t.Fatalf("ERROR -- no Decoder for (%v)\n", tt.contentType)
+		}
+		records := readAll(t, dec)
+		if !reflect.DeepEqual(tt.expected, records) {
+			t.Errorf("ERROR -- for (%v) expected (%+v) but got (%+v)\n", tt.contentType, tt.expected, records)
+		}
+	}
+}
+
+// Verify only streamed types get a Decoder
+func TestNewDecoder(t *testing.T) {
+	for _, contentType := range []string{"", "application/json", "text/plain", "text/csv;;"} {
+		if dec := NewDecoder(contentType, strings.NewReader("")); dec != nil {
+			t.Errorf("ERROR -- expected no Decoder for (%v)\n", contentType)
+		}
+	}
+}
+
+// Verify Import validates, adds and reports each line
+func TestImport(t *testing.T) {
+	input := "Produce Code,Name,Unit Price\n" +
+		"IMPT-1111-2222-3333,Pizza Pie,200.6\n" +
+		"IMPT-1111-2222-3333,Pizza Pie,200.6\n" +
+		"-IMPT-1111-2222-4444,Pizza Pie,200.6\n" +
+		"IMPT-1111-2222-5555,Pizza Pie\n"
+	expected := []Outcome{
+		{Record: Record{Line: 2, Produce: common.Produce{ProduceCode: "IMPT-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"}}},
+		{Record: Record{Line: 3, Produce: common.Produce{ProduceCode: "IMPT-1111-2222-3333", Name: "Pizza Pie", UnitPrice: "200.6"},
+			Errors: []string{"IMPT-1111-2222-3333 already exists"}}, Reason: ReasonExists},
+		{Record: Record{Line: 4, Produce: common.Produce{ProduceCode: "-IMPT-1111-2222-4444", Name: "Pizza Pie", UnitPrice: "200.6"},
+			Errors: []string{"Detected error for Produce Code (-IMPT-1111-2222-4444)"}}, Reason: ReasonValidation},
+		{Record: Record{Line: 5, Errors: []string{"Expected 3 fields"}}, Reason: ReasonParse},
+	}
+
+	outcomes := []Outcome{}
+	err := Import(context.Background(), db.Default, NewDecoder(MIMECSV, strings.NewReader(input)), func(o Outcome) {
+		outcomes = append(outcomes, o)
+	})
+	if err != nil {
+		t.Errorf("ERROR -- unexpected error (%v)\n", err)
+	}
+	if !reflect.DeepEqual(expected, outcomes) {
+		t.Errorf("ERROR -- expected (%+v) but got (%+v)\n", expected, outcomes)
+	}
+
+	// Failure condition - unreadable input
+	err = Import(context.Background(), db.Default, NewDecoder(MIMENDJSON, errReader(0)), func(o Outcome) {})
+	if err == nil {
+		t.Errorf("ERROR -- expected an error for an unreadable input\n")
+	}
+}
+
+// Verify Import rejects lines once the store is full
+func TestImportQuota(t *testing.T) {
+	if _, err := db.Tenants.Create(db.Tenant{ID: "import-quota", MaxProduce: 1}); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Tenants.Delete("import-quota")
+	_, store, _ := db.Tenants.Get("import-quota")
+
+	input := "IMPQ-1111-2222-3333,Pizza Pie,200.6\n" +
+		"IMPQ-1111-2222-4444,Pizza Pie,200.6\n"
+	reasons := []string{}
+	err := Import(context.Background(), store, NewDecoder(MIMECSV, strings.NewReader(input)), func(o Outcome) {
+		reasons = append(reasons, o.Reason)
+	})
+	if err != nil || !reflect.DeepEqual(reasons, []string{"", ReasonQuota}) {
+		t.Errorf("ERROR -- expected (%v) but got (%v) (%v)\n", []string{"", ReasonQuota}, reasons, err)
+	}
+	if _, err := db.Default.Get(context.Background(), "IMPQ-1111-2222-3333"); !errors.Is(err, db.ErrNotFound) {
+		t.Errorf("ERROR -- expected the tenant's Produce kept out of the default store but got (%v)\n", err)
+	}
+}
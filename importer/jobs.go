@@ -0,0 +1,348 @@
+package importer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"example.com/produce_demo/db"
+	"example.com/produce_demo/logging"
+)
+
+var logger = logging.For("importer")
+
+// Status of an import Job
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Default size of the worker pool and of the queue of Jobs waiting for a worker
+const (
+	defaultWorkers  = 4
+	defaultQueueLen = 100
+)
+
+// How long a finished Job is kept for GET /imports/:id
+const jobRetention = 24 * time.Hour
+
+// Errors returned by Submit
+var (
+	ErrUnsupportedType = errors.New("unsupported import type")
+	ErrQueueFull       = errors.New("import queue is full")
+	ErrShuttingDown    = errors.New("imports are shutting down")
+)
+
+// Errors recorded on Jobs stopped by Shutdown
+var (
+	errNotStarted  = errors.New("server shut down before the import started")
+	errInterrupted = errors.New("import interrupted by server shutdown")
+)
+
+// Job is a background import of an uploaded file
+// Returned by value - a snapshot of the Job at the time of the call
+type Job struct {
+	ID         string     `json:"ID"`
+	Store      string     `json:"Store,omitempty"` // Tenant whose catalog the Produce is added to - empty for the default catalog
+	Status     string     `json:"Status"`
+	Progress   float64    `json:"Progress"` // Percent of the file read
+	TotalBytes int64      `json:"Total Bytes"`
+	BytesRead  int64      `json:"Bytes Read"`
+	LinesRead  int        `json:"Lines Read"`
+	Added      int        `json:"Added"`
+	Rejected   int        `json:"Rejected"`
+	Err        string     `json:"Error,omitempty"`
+	Created    time.Time  `json:"Created"`
+	Started    *time.Time `json:"Started,omitempty"`
+	Finished   *time.Time `json:"Finished,omitempty"`
+
+	store       *db.Store // Catalog the Produce is added to
+	contentType string
+	path        string        // Uploaded file waiting to be imported
+	bytesRead   *atomic.Int64 // Updated while reading, outside of jobsMutex
+	rejections  []Outcome     // Rejected lines for the rejection report
+}
+
+// Job registry and worker pool
+var (
+	jobsMutex   = &sync.Mutex{}
+	jobs        = map[string]*Job{}
+	queue       chan *Job
+	workers     = defaultWorkers
+	workersOnce sync.Once
+	workersWG   sync.WaitGroup
+	running     atomic.Int32  // Workers still running
+	closing     bool          // Set by Shutdown - no more Jobs are accepted or started
+	abort       chan struct{} // Closed by Shutdown to interrupt running Jobs
+)
+
+// Set the size of the worker pool - must be called before the first Submit
+func SetWorkers(n int) {
+	if n > 0 {
+		workers = n
+	}
+}
+
+// Start the worker pool (only the first call has any effect)
+func startWorkers() {
+	workersOnce.Do(func() {
+		queue = make(chan *Job, defaultQueueLen)
+		abort = make(chan struct{})
+		for i := 0; i < workers; i++ {
+			workersWG.Add(1)
+			running.Add(1)
+			go worker()
+		}
+	})
+}
+
+// Queue r (of the given Content-Type) to be imported into store, the catalog of the tenant storeID, in the background
+// r is copied to a temporary file so the caller may return immediately
+func Submit(store *db.Store, storeID string, r io.Reader, contentType string) (Job, error) {
+	if !Supported(contentType) {
+		return Job{}, ErrUnsupportedType
+	}
+	jobsMutex.Lock()
+	if closing {
+		jobsMutex.Unlock()
+		return Job{}, ErrShuttingDown
+	}
+	startWorkers()
+	jobsMutex.Unlock()
+
+	f, err := os.CreateTemp("", "produce-import-*")
+	if err != nil {
+		return Job{}, err
+	}
+	size, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:          newJobID(),
+		Status:      JobQueued,
+		TotalBytes:  size,
+		Created:     time.Now().UTC(),
+		Store:       storeID,
+		store:       store,
+		contentType: contentType,
+		path:        f.Name(),
+		bytesRead:   &atomic.Int64{},
+	}
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	if closing {
+		os.Remove(job.path)
+		return Job{}, ErrShuttingDown
+	}
+	pruneJobs()
+	select {
+	case queue <- job:
+	default:
+		os.Remove(job.path)
+		return Job{}, ErrQueueFull
+	}
+	jobs[job.ID] = job
+	return job.snapshot(), nil
+}
+
+// Fetch a Job by ID
+func Lookup(id string) (Job, bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	job, ok := jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.snapshot(), true
+}
+
+// Fetch the rejected lines of a Job by ID
+func Rejections(id string) ([]Outcome, bool) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	job, ok := jobs[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]Outcome{}, job.rejections...), true
+}
+
+// Copy of the Job with the current progress - jobsMutex must be held
+func (job *Job) snapshot() Job {
+	s := *job
+	s.rejections = nil
+	s.BytesRead = job.bytesRead.Load()
+	if s.TotalBytes > 0 {
+		s.Progress = float64(s.BytesRead) * 100 / float64(s.TotalBytes)
+	} else if s.Status == JobCompleted {
+		s.Progress = 100
+	}
+	return s
+}
+
+// Remove Jobs that finished longer ago than jobRetention - jobsMutex must be held
+func pruneJobs() {
+	for id, job := range jobs {
+		if job.Finished != nil && time.Since(*job.Finished) > jobRetention {
+			delete(jobs, id)
+		}
+	}
+}
+
+// Stop accepting Jobs and wait for the queued and running Jobs to finish
+// If ctx is done first, running Jobs are interrupted, Jobs still queued are failed
+// and ctx.Err() is returned.
+func Shutdown(ctx context.Context) error {
+	jobsMutex.Lock()
+	if closing {
+		jobsMutex.Unlock()
+		return nil
+	}
+	closing = true
+	started := queue != nil
+	if started {
+		close(queue)
+	}
+	jobsMutex.Unlock()
+	if !started {
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		workersWG.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		close(abort)
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Import queued Jobs until the queue is closed
+func worker() {
+	defer running.Add(-1)
+	defer workersWG.Done()
+	for job := range queue {
+		select {
+		case <-abort:
+			failJob(job, errNotStarted)
+		default:
+			runJob(job)
+		}
+	}
+}
+
+// Fail a Job without running it
+func failJob(job *Job, err error) {
+	os.Remove(job.path)
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	finished := time.Now().UTC()
+	job.Finished = &finished
+	job.Status = JobFailed
+	job.Err = err.Error()
+}
+
+// Import a single Job through the normal validation and db path
+func runJob(job *Job) {
+	defer os.Remove(job.path)
+
+	jobsMutex.Lock()
+	started := time.Now().UTC()
+	job.Status = JobRunning
+	job.Started = &started
+	jobsMutex.Unlock()
+
+	err := importFile(job)
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	finished := time.Now().UTC()
+	job.Finished = &finished
+	if err != nil {
+		logger.Error("runJob - import failed", "id", job.ID, "error", err)
+		job.Status = JobFailed
+		job.Err = err.Error()
+	} else {
+		job.Status = JobCompleted
+	}
+}
+
+// Read the Job's file and record the Outcome of each line
+func importFile(job *Job) error {
+	f, err := os.Open(job.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := &abortingDecoder{NewDecoder(job.contentType, &countingReader{r: f, n: job.bytesRead})}
+	return Import(context.Background(), job.store, dec, func(o Outcome) {
+		jobsMutex.Lock()
+		defer jobsMutex.Unlock()
+
+		job.LinesRead = o.Line
+		if o.Reason == "" {
+			job.Added++
+		} else {
+			job.Rejected++
+			job.rejections = append(job.rejections, o)
+		}
+	})
+}
+
+// Decoder that stops with errInterrupted once Shutdown gives up waiting
+type abortingDecoder struct {
+	dec Decoder
+}
+
+func (d *abortingDecoder) Next() (Record, error) {
+	select {
+	case <-abort:
+		return Record{}, errInterrupted
+	default:
+		return d.dec.Next()
+	}
+}
+
+// Random Job ID
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Reader that counts the bytes read so far
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
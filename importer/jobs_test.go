@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/db"
+)
+
+// Helper function to wait for a Job to finish
+func waitForJob(t *testing.T, id string) Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := Lookup(id)
+		if !ok {
+			t.Fatalf("ERROR -- job (%v) not found\n", id)
+		}
+		if job.Status == JobCompleted || job.Status == JobFailed {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("ERROR -- job (%v) did not finish\n", id)
+	return Job{}
+}
+
+// Verify a submitted Job is imported in the background
+func TestSubmit(t *testing.T) {
+	input := "{\"Produce Code\": \"JOBS-1111-2222-3333\", \"Name\": \"Pizza Pie\", \"Unit Price\": \"200.6\"}\n" +
+		"{\"Produce Code\": \"JOBS-1111-2222-3333\", \"Name\": \"Pizza Pie\", \"Unit Price\": \"200.6\"}\n" +
+		"{\"Produce Code\": \"JOBS-1111-2222-4444\", \"Name\": \"Celery\", \"Unit Price\": \".45\"}\n" +
+		"{\"Produce Code\": \"JOBS-1111-2222-5555\", \"Name\": \"Corn\", \"Unit Price\": \"5\"}\n"
+
+	job, err := Submit(db.Default, "", strings.NewReader(input), MIMENDJSON)
+	if err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+	if job.Status != JobQueued || job.ID == "" || job.TotalBytes != int64(len(input)) {
+		t.Errorf("ERROR -- unexpected submitted job (%+v)\n", job)
+	}
+
+	job = waitForJob(t, job.ID)
+	if job.Status != JobCompleted || job.Added != 2 || job.Rejected != 2 || job.LinesRead != 4 || job.Progress != 100 {
+		t.Errorf("ERROR -- unexpected finished job (%+v)\n", job)
+	}
+
+	rejections, ok := Rejections(job.ID)
+	if !ok || len(rejections) != 2 || rejections[0].Line != 2 || rejections[0].Reason != ReasonExists ||
+		rejections[1].Line != 4 || rejections[1].Reason != ReasonValidation {
+		t.Errorf("ERROR -- unexpected rejections (%+v)\n", rejections)
+	}
+
+	// Failure condition - unsupported type
+	_, err = Submit(db.Default, "", strings.NewReader(input), "application/json")
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrUnsupportedType, err)
+	}
+
+	// Failure condition - unknown job
+	if _, ok := Lookup("nope"); ok {
+		t.Errorf("ERROR -- expected unknown job not to be found\n")
+	}
+	if _, ok := Rejections("nope"); ok {
+		t.Errorf("ERROR -- expected unknown job not to be found\n")
+	}
+}
+
+// Verify Shutdown finishes queued Jobs and refuses new ones
+// NOTE: must be the last test to Submit - the worker pool can't be restarted
+func TestShutdown(t *testing.T) {
+	input := "{\"Produce Code\": \"JOBS-1111-2222-6666\", \"Name\": \"Kale\", \"Unit Price\": \"1.99\"}\n"
+	job, err := Submit(db.Default, "", strings.NewReader(input), MIMENDJSON)
+	if err != nil {
+		t.Fatalf("ERROR -- unexpected error (%v)\n", err)
+	}
+
+	if err := Ping(context.Background()); err != nil {
+		t.Errorf("ERROR -- expected the workers to be ready but got (%v)\n", err)
+	}
+
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("ERROR -- expected a clean shutdown but got (%v)\n", err)
+	}
+	if err := Ping(context.Background()); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrShuttingDown, err)
+	}
+	if s := CurrentStats(); s.Running != 0 || s.Jobs[JobCompleted] == 0 {
+		t.Errorf("ERROR -- unexpected stats (%+v)\n", s)
+	}
+	if job, _ = Lookup(job.ID); job.Status != JobCompleted || job.Added != 1 {
+		t.Errorf("ERROR -- expected the queued job to complete but got (%+v)\n", job)
+	}
+
+	if _, err := Submit(db.Default, "", strings.NewReader(input), MIMENDJSON); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", ErrShuttingDown, err)
+	}
+	if err := Shutdown(context.Background()); err != nil {
+		t.Errorf("ERROR -- expected a second shutdown to do nothing but got (%v)\n", err)
+	}
+}
+
+// Verify a Job is stopped once Shutdown gives up
+func TestAbortingDecoder(t *testing.T) {
+	saved := abort
+	defer func() { abort = saved }()
+	abort = make(chan struct{})
+
+	dec := &abortingDecoder{NewDecoder(MIMECSV, strings.NewReader("JOBS-1111-2222-7777,Kale,1.99\nJOBS-1111-2222-8888,Leek,.89\n"))}
+	if _, err := dec.Next(); err != nil {
+		t.Errorf("ERROR -- unexpected error (%v)\n", err)
+	}
+	close(abort)
+	if _, err := dec.Next(); !errors.Is(err, errInterrupted) {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", errInterrupted, err)
+	}
+}
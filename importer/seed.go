@@ -0,0 +1,89 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"example.com/produce_demo/common"
+)
+
+// Seed files are rejected after this many problems have been found
+const maxSeedErrors = 10
+
+// Read a seed file of Produce - CSV (.csv), NDJSON (.ndjson, .jsonl) or a JSON array (.json)
+// Every Produce must be valid and Produce Codes must be unique, otherwise nothing is returned
+// and the error lists the problems
+func ReadSeed(path string) ([]common.Produce, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dec Decoder
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		dec = newCSVDecoder(f)
+	case ".ndjson", ".jsonl":
+		dec = newNDJSONDecoder(f)
+	case ".json":
+		produceList := []common.Produce{}
+		if err := json.NewDecoder(f).Decode(&produceList); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		dec = &listDecoder{produceList: produceList}
+	default:
+		return nil, fmt.Errorf("%s: seed file must be .csv, .ndjson, .jsonl or .json", path)
+	}
+
+	produceList := []common.Produce{}
+	seen := map[string]int{}
+	problems := []string{}
+	for len(problems) < maxSeedErrors {
+		rec, err := dec.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(rec.Errors) == 0 {
+			if ok, validProduceError := common.ValidateProduce(rec.Produce); !ok {
+				rec.Errors = validProduceError
+			}
+		}
+		key := strings.ToUpper(rec.Produce.ProduceCode)
+		if line, ok := seen[key]; ok && len(rec.Errors) == 0 {
+			rec.Errors = []string{fmt.Sprintf("%s duplicates line %d", key, line)}
+		}
+		if len(rec.Errors) != 0 {
+			problems = append(problems, fmt.Sprintf("line %d: %s", rec.Line, strings.Join(rec.Errors, ", ")))
+			continue
+		}
+		seen[key] = rec.Line
+		produceList = append(produceList, rec.Produce)
+	}
+
+	if len(problems) != 0 {
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return produceList, nil
+}
+
+// Decoder over a JSON array that has already been read - Line is the position in the array from 1
+type listDecoder struct {
+	produceList []common.Produce
+	next        int
+}
+
+func (d *listDecoder) Next() (Record, error) {
+	if d.next == len(d.produceList) {
+		return Record{}, io.EOF
+	}
+	d.next++
+	return Record{Line: d.next, Produce: d.produceList[d.next-1]}, nil
+}
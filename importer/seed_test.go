@@ -0,0 +1,51 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// seedTestStruct
+type seedTS struct {
+	name     string
+	content  string
+	expected int    // Produce read
+	err      string // Expected to be contained in the error
+}
+
+// seedTestStructs: test cases
+var seedTSs = []seedTS{
+	{"seed.csv", "Produce Code,Name,Unit Price\nSEED-1111-2222-3333,Kale,1.99\nSEED-1111-2222-4444,Leek,.89\n", 2, ""},
+	{"seed.ndjson", "{\"Produce Code\":\"SEED-1111-2222-3333\",\"Name\":\"Kale\",\"Unit Price\":\"1.99\"}\n", 1, ""},
+	{"seed.json", "[{\"Produce Code\":\"SEED-1111-2222-3333\",\"Name\":\"Kale\",\"Unit Price\":\"1.99\"}]", 1, ""},
+	{"empty.json", "[]", 0, ""},
+	{"bad.csv", "SEED-1111-2222-3333,Kale,1.999\nSEED-1111-2222-4444,Leek\n", 0,
+		"line 1: Detected error for Produce Unit Price (1.999); line 2: Expected 3 or 4 fields"},
+	{"dup.csv", "SEED-1111-2222-3333,Kale,1.99\nseed-1111-2222-3333,Kale,1.99\n", 0, "line 2: SEED-1111-2222-3333 duplicates line 1"},
+	{"bad.json", "{}", 0, "cannot unmarshal"},
+	{"seed.txt", "", 0, "seed file must be"},
+}
+
+// Test reading seed files
+func TestReadSeed(t *testing.T) {
+	dir := t.TempDir()
+	for _, tt := range seedTSs {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		produceList, err := ReadSeed(path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || len(produceList) != tt.expected {
+			t.Errorf("ERROR -- for (%v) expected (%v) produce but got (%v) (%v)\n", tt.name, tt.expected, produceList, err)
+		}
+	}
+}
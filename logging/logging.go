@@ -0,0 +1,176 @@
+// Leveled, structured logging with a level per package
+//
+// Each package logs through its own logger, whose records carry the package name and,
+// when logged with a request's context, the request ID, principal and trace:
+//
+//	var logger = logging.For("handlers")
+//	logger.InfoContext(c.Request().Context(), "AddProduce - added", "count", n)
+//
+// Loggers may be created before Setup - they write through whatever Setup last installed.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+var (
+	output       atomic.Pointer[slog.Handler] // Where every logger writes
+	defaultLevel = &slog.LevelVar{}           // Level of packages without their own
+	levelsMutex  = &sync.RWMutex{}
+	levels       = map[string]slog.Level{} // Per-package levels
+)
+
+func init() {
+	Setup(os.Stderr, FormatText, slog.LevelInfo, nil)
+}
+
+// Install the output format and levels for every logger
+// The standard log package and slog.Default are sent through the "main" logger
+func Setup(w io.Writer, format string, level slog.Level, packageLevels map[string]slog.Level) {
+	// Filtering is done per package by Enabled, so the output accepts everything
+	options := &slog.HandlerOptions{Level: slog.Level(-8)}
+	var handler slog.Handler = slog.NewTextHandler(w, options)
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	output.Store(&handler)
+
+	defaultLevel.Set(level)
+	levelsMutex.Lock()
+	levels = map[string]slog.Level{}
+	for pkg, l := range packageLevels {
+		levels[pkg] = l
+	}
+	levelsMutex.Unlock()
+
+	slog.SetDefault(For("main"))
+}
+
+// Logger for a package
+func For(pkg string) *slog.Logger {
+	return slog.New(&handler{pkg: pkg})
+}
+
+// Level a package logs at
+func Level(pkg string) slog.Level {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+	if l, ok := levels[pkg]; ok {
+		return l
+	}
+	return defaultLevel.Level()
+}
+
+// Set the level of a package - an empty pkg sets the default level
+func SetLevel(pkg string, level slog.Level) {
+	if pkg == "" {
+		defaultLevel.Set(level)
+		return
+	}
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+	levels[pkg] = level
+}
+
+// Remove a package's own level so it follows the default level
+func ResetLevel(pkg string) {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+	delete(levels, pkg)
+}
+
+// Default level and the packages with their own level
+func Levels() (slog.Level, map[string]slog.Level) {
+	levelsMutex.RLock()
+	defer levelsMutex.RUnlock()
+	packageLevels := make(map[string]slog.Level, len(levels))
+	for pkg, l := range levels {
+		packageLevels[pkg] = l
+	}
+	return defaultLevel.Level(), packageLevels
+}
+
+// Parse a level name: debug, info, warn or error
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	switch strings.ToLower(s) {
+	case "debug", "info", "warn", "error":
+		return level, level.UnmarshalText([]byte(s))
+	}
+	return level, fmt.Errorf("unknown log level (%s)", s)
+}
+
+// Parse per-package levels written as package=level
+func ParseLevels(packageLevels map[string]string) (map[string]slog.Level, error) {
+	pkgs := make([]string, 0, len(packageLevels))
+	for pkg := range packageLevels {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	parsed := make(map[string]slog.Level, len(packageLevels))
+	for _, pkg := range pkgs {
+		l, err := ParseLevel(packageLevels[pkg])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pkg, err)
+		}
+		parsed[pkg] = l
+	}
+	return parsed, nil
+}
+
+// Handler for one package - checks the package's level then writes to the current output
+type handler struct {
+	pkg string
+	ops []func(slog.Handler) slog.Handler // WithAttrs and WithGroup calls, replayed on the output
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= Level(h.pkg)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	attrs := []slog.Attr{slog.String("package", h.pkg)}
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if principal := Principal(ctx); principal != "" {
+		attrs = append(attrs, slog.String("principal", principal))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+	}
+	out := (*output.Load()).WithAttrs(attrs)
+	for _, op := range h.ops {
+		out = op(out)
+	}
+	return out.Handle(ctx, r)
+}
+
+func (h *handler) with(op func(slog.Handler) slog.Handler) slog.Handler {
+	return &handler{pkg: h.pkg, ops: append(h.ops[:len(h.ops):len(h.ops)], op)}
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(out slog.Handler) slog.Handler { return out.WithGroup(name) })
+}
@@ -0,0 +1,162 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Helper function to send logs to a buffer as JSON until the test ends
+func capture(t *testing.T, level slog.Level, packageLevels map[string]slog.Level) *bytes.Buffer {
+	b := &bytes.Buffer{}
+	Setup(b, FormatJSON, level, packageLevels)
+	t.Cleanup(func() { Setup(os.Stderr, FormatText, slog.LevelInfo, nil) })
+	return b
+}
+
+// Helper function to decode each logged record
+func records(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	list := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		record := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("ERROR -- bad record (%v) (%v)\n", line, err)
+		}
+		list = append(list, record)
+	}
+	return list
+}
+
+// Test each package logs at its own level, or the default level
+func TestLevels(t *testing.T) {
+	b := capture(t, slog.LevelWarn, map[string]slog.Level{"db": slog.LevelDebug})
+
+	// Loggers created before Setup follow it too
+	db, handlers := For("db"), For("handlers").With("key", "value")
+	db.Debug("db debug")
+	handlers.Info("handlers info")
+	handlers.Warn("handlers warn")
+	log.Printf("standard log")
+
+	SetLevel("handlers", slog.LevelInfo)
+	handlers.Info("handlers info again")
+	ResetLevel("handlers")
+	handlers.Info("handlers info dropped")
+
+	got := records(t, b)
+	expected := []string{"db debug", "handlers warn", "handlers info again"}
+	if len(got) != len(expected) {
+		t.Fatalf("ERROR -- expected (%v) but got (%v)\n", expected, got)
+	}
+	for i, msg := range expected {
+		if got[i]["msg"] != msg {
+			t.Errorf("ERROR -- expected (%v) but got (%v)\n", msg, got[i])
+		}
+	}
+	if got[0]["package"] != "db" || got[1]["package"] != "handlers" || got[1]["key"] != "value" {
+		t.Errorf("ERROR -- unexpected attributes (%v)\n", got)
+	}
+
+	level, packageLevels := Levels()
+	if level != slog.LevelWarn || len(packageLevels) != 1 || packageLevels["db"] != slog.LevelDebug {
+		t.Errorf("ERROR -- unexpected levels (%v) (%v)\n", level, packageLevels)
+	}
+
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Errorf("ERROR -- expected an error for an unknown level\n")
+	}
+	if _, err := ParseLevels(map[string]string{"db": "warn", "http": "loud"}); err == nil || !strings.Contains(err.Error(), "http") {
+		t.Errorf("ERROR -- expected an error for http but got (%v)\n", err)
+	}
+}
+
+// Test requests get an ID that is returned, logged, and carried by their context
+func TestMiddleware(t *testing.T) {
+	b := capture(t, slog.LevelInfo, nil)
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/produce/:ProduceCode", func(c echo.Context) error {
+		For("handlers").InfoContext(c.Request().Context(), "handled")
+		return c.String(http.StatusOK, RequestID(c.Request().Context()))
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+
+	// A usable ID is kept
+	req := httptest.NewRequest(echo.GET, "/produce/A12T-4GH7-QPL9-3N4M", nil)
+	req.Header.Set(echo.HeaderXRequestID, "client-id-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Header().Get(echo.HeaderXRequestID) != "client-id-1" || rec.Body.String() != "client-id-1" {
+		t.Errorf("ERROR -- expected (client-id-1) but got (%v) (%v)\n", rec.Header().Get(echo.HeaderXRequestID), rec.Body)
+	}
+
+	// Others are replaced
+	req = httptest.NewRequest(echo.GET, "/fail", nil)
+	req.Header.Set(echo.HeaderXRequestID, "has spaces")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	id := rec.Header().Get(echo.HeaderXRequestID)
+	if len(id) != 32 || rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("ERROR -- expected a generated ID and (%v) but got (%v) (%v)\n", http.StatusServiceUnavailable, id, rec.Code)
+	}
+
+	got := records(t, b)
+	if len(got) != 3 {
+		t.Fatalf("ERROR -- expected 3 records but got (%v)\n", got)
+	}
+	if got[0]["msg"] != "handled" || got[0]["request_id"] != "client-id-1" {
+		t.Errorf("ERROR -- expected the handler record to carry the ID but got (%v)\n", got[0])
+	}
+	if got[1]["package"] != "http" || got[1]["route"] != "/produce/:ProduceCode" || got[1]["status"] != float64(http.StatusOK) ||
+		got[1]["request_id"] != "client-id-1" || got[1]["level"] != "INFO" {
+		t.Errorf("ERROR -- unexpected request record (%v)\n", got[1])
+	}
+	if got[2]["status"] != float64(http.StatusServiceUnavailable) || got[2]["request_id"] != id || got[2]["level"] != "ERROR" {
+		t.Errorf("ERROR -- unexpected request record (%v)\n", got[2])
+	}
+
+	if RequestID(context.Background()) != "" {
+		t.Errorf("ERROR -- expected no ID\n")
+	}
+}
+
+// bodyTestStruct
+type bodyTS struct {
+	body     string
+	max      int
+	expected string
+}
+
+// bodyTestStructs: test cases
+var bodyTSs = []bodyTS{
+	{`{"Produce Code": "A12T-4GH7-QPL9-3N4M", "Password": "hunter2"}`, 512, `{"Password":"REDACTED","Produce Code":"A12T-4GH7-QPL9-3N4M"}`},
+	{`[{"api_key": "k", "Nested": {"Access-Token": "t"}}]`, 512, `[{"Nested":{"Access-Token":"REDACTED"},"api_key":"REDACTED"}]`},
+	{"A12T-4GH7-QPL9-3N4M,Lettuce,3.46\n", 4, "A12T... (33 bytes)"},
+	{"{", 512, "{"},
+	{"anything", 0, "(not logged)"},
+}
+
+// Test bodies are redacted and truncated
+func TestBody(t *testing.T) {
+	defer func(max int) { BodyMaxBytes = max }(BodyMaxBytes)
+	for _, tt := range bodyTSs {
+		BodyMaxBytes = tt.max
+		if got := Body([]byte(tt.body)); got != tt.expected {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", tt.body, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Longest request ID accepted from a client - longer ones are replaced
+const maxRequestIDLength = 128
+
+// Longest request body logged by Body - 0 stops bodies being logged
+var BodyMaxBytes = 512
+
+// Keys whose values Body replaces (matched case-insensitively, ignoring spaces, dashes and underscores)
+var redactedKeys = []string{"password", "secret", "token", "apikey", "authorization"}
+
+type requestIDKey struct{}
+
+// Context carrying a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// Request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+type principalKey struct{}
+
+// Context carrying the principal who made a request
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// Principal carried by ctx, or ""
+func Principal(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// Give every request an ID and log it once served
+// The ID is taken from the X-Request-ID header (or generated if missing or unusable), returned
+// in the X-Request-ID response header and added to records logged with the request's context
+func Middleware() echo.MiddlewareFunc {
+	logger := For("http")
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Request().Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			ctx := WithRequestID(c.Request().Context(), id)
+			c.SetRequest(c.Request().WithContext(ctx))
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			start := time.Now()
+			// Write a returned error now so the status logged is the one sent
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			level := levelFor(status)
+			if logger.Enabled(ctx, level) {
+				logger.Log(ctx, level, "request",
+					"method", c.Request().Method,
+					"path", c.Request().URL.Path,
+					"route", c.Path(),
+					"status", status,
+					"bytes", c.Response().Size,
+					"duration", time.Since(start),
+					"remote", c.RealIP())
+			}
+			return nil
+		}
+	}
+}
+
+// Server errors are logged as errors, everything else as info
+func levelFor(status int) slog.Level {
+	if status >= 500 {
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < '!' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Request body for logging: values of secret-looking JSON keys are redacted and the
+// result is cut to BodyMaxBytes
+func Body(b []byte) string {
+	if BodyMaxBytes <= 0 {
+		return "(not logged)"
+	}
+	var v interface{}
+	if json.Unmarshal(b, &v) == nil {
+		if redacted, err := json.Marshal(redact(v)); err == nil {
+			b = redacted
+		}
+	}
+	if len(b) <= BodyMaxBytes {
+		return string(b)
+	}
+	return string(b[:BodyMaxBytes]) + "... (" + strconv.Itoa(len(b)) + " bytes)"
+}
+
+// Replace the values of redactedKeys throughout a decoded JSON value
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if isRedacted(k) {
+				v[k] = "REDACTED"
+			} else {
+				v[k] = redact(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = redact(value)
+		}
+	}
+	return v
+}
+
+func isRedacted(key string) bool {
+	key = strings.NewReplacer(" ", "", "-", "", "_", "").Replace(strings.ToLower(key))
+	for _, redactedKey := range redactedKeys {
+		if strings.Contains(key, redactedKey) {
+			return true
+		}
+	}
+	return false
+}
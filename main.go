@@ -1,13 +1,205 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/config"
+	"example.com/produce_demo/db"
+	"example.com/produce_demo/health"
+	"example.com/produce_demo/importer"
+	"example.com/produce_demo/logging"
 	router "example.com/produce_demo/routers"
+	"example.com/produce_demo/server"
+	"example.com/produce_demo/tracing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Exit codes
+const (
+	exitOK      = 0 // Shut down cleanly
+	exitError   = 1 // Failed to start, or the server failed while running
+	exitUsage   = 2 // Bad flags or configuration
+	exitUnclean = 3 // Shutdown timed out or the store failed to flush - work may have been lost
 )
 
+var logger = logging.For("main")
+
+// Called with the address being listened on (for tests)
+var onListen = func(addr net.Addr) {}
+
 // Main Function
 func main() {
-	fmt.Println("Welcome to the webserver")
-	e := router.New()
-	e.Start(":8080")
+	// The first SIGINT/SIGTERM starts a graceful shutdown, a second one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// Run the server until ctx is done, then shut down - returns the exit code
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	cfg, err := config.Load(args, os.LookupEnv, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "produce_demo: %s\n", err)
+		return exitUsage
+	}
+	if cfg.PrintConfig {
+		if err := cfg.Write(stdout); err != nil {
+			return exitError
+		}
+		return exitOK
+	}
+
+	setupLogging(cfg.Log, stderr)
+	stopTracing, err := tracing.Setup(ctx, tracing.Options{
+		Exporter:    cfg.Tracing.Exporter,
+		File:        cfg.Tracing.File,
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+		Version:     health.Version,
+	}, stdout)
+	if err != nil {
+		logger.Error("run - failed to set up tracing", "error", err)
+		return exitError
+	}
+	if err := openStore(ctx, cfg); err != nil {
+		logger.Error("run - failed to open the store", "error", err)
+		stopTracing(context.Background())
+		return exitError
+	}
+	importer.SetWorkers(cfg.Imports.Workers)
+	if cfg.Auth.KeysFile != "" {
+		if err := auth.Keys.Open(cfg.Auth.KeysFile); err != nil {
+			logger.Error("run - failed to open the API keys", "error", err)
+			db.Close()
+			stopTracing(context.Background())
+			return exitError
+		}
+	}
+	e, err := router.NewWithConfig(cfg)
+	if err != nil {
+		logger.Error("run - failed to set up authentication", "error", err)
+		db.Close()
+		stopTracing(context.Background())
+		return exitError
+	}
+
+	srv, err := server.Listen(e, server.Options{
+		Listen:         cfg.Listen,
+		HTTP2:          cfg.HTTP2,
+		CertFile:       cfg.TLS.CertFile,
+		KeyFile:        cfg.TLS.KeyFile,
+		ReloadInterval: time.Duration(cfg.TLS.ReloadInterval),
+		MinVersion:     cfg.TLS.MinVersion,
+		ClientCAFile:   cfg.TLS.ClientCAFile,
+		ClientAuth:     cfg.TLS.ClientAuth,
+	})
+	if err != nil {
+		logger.Error("run - failed to listen", "error", err)
+		db.Close()
+		stopTracing(context.Background())
+		return exitError
+	}
+
+	// Echo shuts down the server it is given
+	e.Server = srv.Server
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve()
+	}()
+	onListen(srv.Addr())
+	fmt.Fprintf(stdout, "Welcome to the webserver (%s)\n", srv.Addr())
+
+	code := exitOK
+	select {
+	case err := <-serveErr:
+		logger.Error("run - server failed", "error", err)
+		code = exitError
+	case <-ctx.Done():
+		logger.Info("run - shutting down")
+	}
+	return shutdown(e, time.Duration(cfg.ShutdownTimeout), code, stopTracing)
+}
+
+// Stop accepting connections, drain in-flight requests and imports, flush and close the store,
+// then flush the spans
+// Everything shares the one timeout
+func shutdown(e *echo.Echo, timeout time.Duration, code int, stopTracing func(context.Context) error) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	unclean := false
+	if err := e.Shutdown(ctx); err != nil {
+		logger.Error("shutdown - requests did not finish", "error", err)
+		e.Close()
+		unclean = true
+	}
+	if err := importer.Shutdown(ctx); err != nil {
+		logger.Error("shutdown - imports did not finish", "error", err)
+		unclean = true
+	}
+	if err := db.Close(); err != nil {
+		logger.Error("shutdown - failed to flush the store", "error", err)
+		unclean = true
+	}
+	if err := stopTracing(ctx); err != nil {
+		logger.Error("shutdown - failed to flush the spans", "error", err)
+	}
+
+	if unclean && code == exitOK {
+		return exitUnclean
+	}
+	logger.Info("shutdown - complete")
+	return code
+}
+
+// Send log output to w at the configured levels and format
+func setupLogging(cfg config.LogConfig, w io.Writer) {
+	// The configuration has been validated
+	level, _ := logging.ParseLevel(cfg.Level)
+	packageLevels, _ := logging.ParseLevels(cfg.Levels)
+	logging.Setup(w, cfg.Format, level, packageLevels)
+	logging.BodyMaxBytes = cfg.BodyMaxBytes
+}
+
+// Open the storage backend and seed it
+// The seed file is loaded into the memory backend, or into the file backend when its file is new
+func openStore(ctx context.Context, cfg *config.Config) error {
+	var seed []common.Produce
+	if cfg.SeedFile != "" {
+		var err error
+		if seed, err = importer.ReadSeed(cfg.SeedFile); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Storage.Backend == config.BackendFile {
+		exists, err := db.OpenFile(cfg.Storage.Path, time.Duration(cfg.Storage.FlushInterval))
+		if err != nil || exists || seed == nil {
+			return err
+		}
+	}
+	if seed != nil {
+		if _, err := db.Default.Replace(ctx, seed); err != nil {
+			return err
+		}
+	}
+	return db.Flush()
 }
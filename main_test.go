@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test a server started by run is shut down cleanly and its store flushed
+func TestRunShutdown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "produce.json")
+	addrs := make(chan net.Addr, 1)
+	onListen = func(addr net.Addr) { addrs <- addr }
+	defer func() { onListen = func(net.Addr) {} }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	codes := make(chan int, 1)
+	go func() {
+		codes <- run(ctx, []string{"--listen", "127.0.0.1:0", "--storage-backend", "file", "--storage-path", path,
+			"--storage-flush-interval", "1h", "--log-level", "error"}, io.Discard, io.Discard)
+	}()
+
+	var addr net.Addr
+	select {
+	case addr = <-addrs:
+	case code := <-codes:
+		t.Fatalf("ERROR -- server exited with (%v)\n", code)
+	}
+
+	resp, err := http.Post("http://"+addr.String()+"/produce", "application/json",
+		strings.NewReader(`{"Produce Code": "MAIN-1111-2222-3333", "Name": "Kale", "Unit Price": "1.99"}`))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) (%v)\n", http.StatusOK, resp, err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	select {
+	case code := <-codes:
+		if code != exitOK {
+			t.Errorf("ERROR -- expected exit (%v) but got (%v)\n", exitOK, code)
+		}
+	case <-time.After(20 * time.Second):
+		t.Fatalf("ERROR -- server did not shut down\n")
+	}
+
+	// The change was flushed on shutdown despite the long flush interval
+	b, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(b, []byte("MAIN-1111-2222-3333")) {
+		t.Errorf("ERROR -- expected MAIN-1111-2222-3333 in (%s) (%v)\n", b, err)
+	}
+
+	// The server no longer accepts connections
+	if _, err := http.Get("http://" + addr.String() + "/produce"); err == nil {
+		t.Errorf("ERROR -- expected the server to be closed\n")
+	}
+}
+
+// runTestStruct
+type runTS struct {
+	args     []string
+	expected int
+	stdout   string // Expected to be contained in stdout
+}
+
+// Test the exit codes for runs that never serve
+func TestRunExitCodes(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	for _, tt := range []runTS{
+		{[]string{"--listen", "bad"}, exitUsage, ""},
+		{[]string{"--no-such-flag"}, exitUsage, ""},
+		{[]string{"-h"}, exitOK, ""},
+		{[]string{"--print-config"}, exitOK, "listen: :8080"},
+		{[]string{"--listen", busy.Addr().String(), "--log-level", "error"}, exitError, ""},
+	} {
+		stdout := &bytes.Buffer{}
+		if code := run(context.Background(), tt.args, stdout, io.Discard); code != tt.expected {
+			t.Errorf("ERROR -- for (%v) expected exit (%v) but got (%v)\n", tt.args, tt.expected, code)
+		}
+		if !strings.Contains(stdout.String(), tt.stdout) {
+			t.Errorf("ERROR -- for (%v) expected stdout to contain (%v) but got (%v)\n", tt.args, tt.stdout, stdout.String())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Prometheus metrics for the HTTP handlers and the store
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prefix of every metric name
+const namespace = "produce_demo"
+
+// Registry holds every metric served by Handler
+var Registry = prometheus.NewRegistry()
+
+// HTTP metrics - route is the route's path template (e.g. /produce/:ProduceCode)
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPRequestsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+)
+
+// Store metrics - op is the store operation (add, update, delete, fetch, ...)
+var (
+	StoreRows = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "store_rows",
+		Help:      "Produce rows in the store.",
+	})
+
+	StoreLockWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_lock_wait_seconds",
+		Help:      "Time spent waiting for the store lock by operation.",
+		Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"op"})
+
+	StoreOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_operation_duration_seconds",
+		Help:      "Store operation latency, including the lock wait, by operation.",
+		Buckets:   []float64{.00001, .00005, .0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+	}, []string{"op"})
+
+	RejectedItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rejected_items_total",
+		Help:      "Produce items rejected by adds and imports, by reason (parse, validation, exists or quota).",
+	}, []string{"reason"})
+)
+
+// Requests refused with 429, by the limit they exceeded (principal, ip or route)
+var RateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rate_limited_total",
+	Help:      "Requests refused by rate limiting, by the limit exceeded (principal, ip or route).",
+}, []string{"limit"})
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration, HTTPRequestsInFlight,
+		StoreRows, StoreLockWait, StoreOperationDuration, RejectedItems,
+		RateLimited,
+	)
+}
+
+// Serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Count and time every request
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			HTTPRequestsInFlight.Inc()
+			defer HTTPRequestsInFlight.Dec()
+
+			start := time.Now()
+			err := next(c)
+
+			// NOTE: a returned error is written after the middleware - predict its status
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				status = http.StatusInternalServerError
+				var httpError *echo.HTTPError
+				if errors.As(err, &httpError) {
+					status = httpError.Code
+				}
+			}
+
+			route := c.Path()
+			if route == "" || (status == http.StatusNotFound && route == "/*") {
+				route = "unmatched"
+			}
+			method := c.Request().Method
+			HTTPRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			HTTPRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
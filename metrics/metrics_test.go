@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// metricsTestStruct
+type metricsTS struct {
+	method string
+	target string
+	route  string
+	status string
+}
+
+// metricsTestStructs: test cases
+var metricsTSs = []metricsTS{
+	{http.MethodGet, "/produce/A12T-4GH7-QPL9-3N4M", "/produce/:ProduceCode", "200"},
+	{http.MethodGet, "/teapot", "/teapot", "418"},
+	{http.MethodGet, "/broken", "/broken", "500"},
+	{http.MethodGet, "/nowhere", "unmatched", "404"},
+}
+
+// Test requests are counted by method, route and status
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/produce/:ProduceCode", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	e.GET("/teapot", func(c echo.Context) error { return echo.NewHTTPError(http.StatusTeapot) })
+	e.GET("/broken", func(c echo.Context) error { return errors.New("broken") })
+
+	for _, tt := range metricsTSs {
+		before := testutil.ToFloat64(HTTPRequests.WithLabelValues(tt.method, tt.route, tt.status))
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, tt.target, nil))
+		after := testutil.ToFloat64(HTTPRequests.WithLabelValues(tt.method, tt.route, tt.status))
+		if after != before+1 {
+			t.Errorf("ERROR -- for (%v) expected (%v %v %v) to be counted\n", tt.target, tt.method, tt.route, tt.status)
+		}
+	}
+	if n := testutil.CollectAndCount(HTTPRequestDuration); n == 0 {
+		t.Errorf("ERROR -- expected request durations to be observed\n")
+	}
+	if v := testutil.ToFloat64(HTTPRequestsInFlight); v != 0 {
+		t.Errorf("ERROR -- expected no requests in flight but got (%v)\n", v)
+	}
+
+	// Everything is served in the text format
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	expected := `produce_demo_http_requests_total{method="GET",route="/teapot",status="418"}`
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), expected) || !strings.Contains(rec.Body.String(), "go_goroutines") {
+		t.Errorf("ERROR -- expected (%v) in (%v)\n", expected, rec.Body)
+	}
+}
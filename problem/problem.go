@@ -0,0 +1,34 @@
+// Problem details (RFC 9457) responses for errors raised outside the handlers, such as
+// authorization failures, so clients can handle them the same way wherever they come from
+package problem
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Content type of a problem response
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem describes why a request failed
+type Problem struct {
+	Type     string `json:"type"`             // URI identifying the kind of problem - about:blank when the status says it all
+	Title    string `json:"title"`            // Summary of the kind of problem
+	Status   int    `json:"status"`           // HTTP status
+	Detail   string `json:"detail,omitempty"` // What went wrong with this request
+	Instance string `json:"instance,omitempty"`
+}
+
+// Problem for status titled with its status text
+func New(status int, detail string) Problem {
+	return Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Send a problem for status with detail about the request c
+func Write(c echo.Context, status int, detail string) error {
+	p := New(status, detail)
+	p.Instance = c.Request().URL.Path
+	c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+	return c.JSON(status, p)
+}
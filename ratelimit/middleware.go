@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/logging"
+	"example.com/produce_demo/metrics"
+	"example.com/produce_demo/problem"
+
+	"github.com/labstack/echo/v4"
+)
+
+var logger = logging.For("ratelimit")
+
+// Response headers describing the bucket closest to running out
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// Rules applied to every request
+type Rules struct {
+	PerPrincipal Rule            // Bucket of each authenticated principal (API key, token or JWT subject)
+	PerIP        Rule            // Bucket of each client IP
+	Routes       map[string]Rule // Bucket of each principal (or IP when unauthenticated) on a route, by "METHOD /path/template"
+}
+
+// A bucket a request draws on
+type check struct {
+	name string // The limit label of the rate limited metric
+	key  string
+	rule Rule
+}
+
+// Context key of the Decision of the per IP bucket, once IPMiddleware has drawn on it
+const ipDecisionKey = "ratelimit.ip"
+
+// Limit the requests that skip does not pass by the per IP rule, with buckets kept by l
+// It goes before authentication, so requests with bad or no credentials are limited too -
+// Middleware, after authentication, then leaves the per IP bucket alone
+func IPMiddleware(l Limiter, rules Rules, skip func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skip != nil && skip(c) || !rules.PerIP.Enabled() {
+				return next(c)
+			}
+			d, limited, err := take(c, l, check{"ip", "ip:" + c.RealIP(), rules.PerIP})
+			if limited {
+				return err // Returns 429
+			}
+			if d != nil {
+				c.Set(ipDecisionKey, *d)
+				setHeaders(c, *d, rules.PerIP)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Limit the requests that skip does not pass by rules, with buckets kept by l
+// A request that finds any bucket empty gets a 429 problem with Retry-After
+// Every response describes the bucket closest to running out in the RateLimit-* headers
+func Middleware(l Limiter, rules Rules, skip func(echo.Context) bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skip != nil && skip(c) {
+				return next(c)
+			}
+			ctx := c.Request().Context()
+
+			// Authenticated requests are counted against the principal, others against the IP
+			var closest *Decision
+			var closestRule Rule
+			client := "ip:" + c.RealIP()
+			checks := []check{}
+			if d, ok := c.Get(ipDecisionKey).(Decision); ok {
+				closest, closestRule = &d, rules.PerIP
+			} else if rules.PerIP.Enabled() {
+				checks = append(checks, check{"ip", client, rules.PerIP})
+			}
+			if p, ok := auth.FromContext(ctx); ok {
+				client = "principal:" + p.Subject
+				if rules.PerPrincipal.Enabled() {
+					checks = append(checks, check{"principal", client, rules.PerPrincipal})
+				}
+			}
+			route := c.Request().Method + " " + c.Path()
+			if rule, ok := rules.Routes[route]; ok && rule.Enabled() {
+				checks = append(checks, check{"route", "route:" + route + " " + client, rule})
+			}
+
+			for _, ch := range checks {
+				d, limited, err := take(c, l, ch)
+				if limited {
+					return err // Returns 429
+				}
+				if d != nil && (closest == nil || d.Remaining < closest.Remaining) {
+					closest, closestRule = d, ch.rule
+				}
+			}
+			if closest != nil {
+				setHeaders(c, *closest, closestRule)
+			}
+			return next(c)
+		}
+	}
+}
+
+// Draw on the bucket of ch - reports whether it was empty, with the 429 problem written
+// The Decision is nil if the limiter failed, letting the request through
+func take(c echo.Context, l Limiter, ch check) (*Decision, bool, error) {
+	ctx := c.Request().Context()
+	d, err := l.Take(ctx, ch.key, ch.rule)
+	if err != nil {
+		logger.WarnContext(ctx, "Middleware - limiter failed, request let through", "limit", ch.name, "error", err)
+		return nil, false, nil
+	}
+	if !d.Allowed {
+		metrics.RateLimited.WithLabelValues(ch.name).Inc()
+		logger.InfoContext(ctx, "Middleware - rate limited", "limit", ch.name, "route", c.Request().Method+" "+c.Path(), "retryAfter", d.RetryAfter)
+		setHeaders(c, d, ch.rule)
+		c.Response().Header().Set(HeaderRetryAfter, strconv.Itoa(wholeSeconds(d.RetryAfter)))
+		return &d, true, problem.Write(c, http.StatusTooManyRequests, "Rate limit of "+strconv.Itoa(ch.rule.Limit)+" requests per "+ch.rule.Period.String()+" exceeded") // Returns 429
+	}
+	return &d, false, nil
+}
+
+func setHeaders(c echo.Context, d Decision, rule Rule) {
+	h := c.Response().Header()
+	h.Set(HeaderRateLimitLimit, strconv.Itoa(d.Limit))
+	h.Set(HeaderRateLimitRemaining, strconv.Itoa(d.Remaining))
+	h.Set(HeaderRateLimitReset, strconv.Itoa(wholeSeconds(d.Reset)))
+	h.Set(HeaderRateLimitPolicy, strconv.Itoa(rule.Limit)+";w="+strconv.Itoa(wholeSeconds(rule.Period)))
+}
+
+// Seconds rounded up, so a client waiting that long finds a token
+func wholeSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,120 @@
+// Token bucket rate limiting of requests per principal, per client IP and per route
+// The buckets are kept by a Limiter - Memory keeps them in the process, and a shared backend
+// (such as Redis) can implement Limiter so every replica draws on the same buckets
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rule lets Limit requests through each Period - a bucket holds up to Limit tokens and refills
+// at Limit per Period, so a burst of Limit requests is allowed after a quiet spell
+type Rule struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Reports whether r limits anything
+func (r Rule) Enabled() bool {
+	return r.Limit > 0 && r.Period > 0
+}
+
+// Tokens added per second
+func (r Rule) rate() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+// Decision is the outcome of taking a token from a bucket
+type Decision struct {
+	Allowed    bool
+	Limit      int           // Size of the bucket
+	Remaining  int           // Whole tokens left
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until a token is available, if not Allowed
+}
+
+// Limiter keeps the buckets, creating each full the first time its key is seen
+type Limiter interface {
+	// Take a token from the bucket for key, which refills by rule
+	// An error means the backend could not be reached - the request is let through
+	Take(ctx context.Context, key string, rule Rule) (Decision, error)
+}
+
+// How often Memory drops the buckets that have refilled
+const pruneInterval = time.Minute
+
+// Memory is a Limiter keeping the buckets in the process
+type Memory struct {
+	mutex     *sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time // When tokens was last brought up to date
+	full   time.Time // When the bucket will be full - it is dropped by the next prune after
+}
+
+// Create an empty Memory Limiter
+func NewMemory() *Memory {
+	return &Memory{mutex: &sync.Mutex{}, buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, rule Rule) (Decision, error) {
+	now := m.now()
+	limit := float64(rule.Limit)
+	rate := rule.rate()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.prune(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(limit, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	d := Decision{Limit: rule.Limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+	d.Remaining = int(b.tokens)
+	d.Reset = seconds((limit - b.tokens) / rate)
+	b.full = now.Add(d.Reset)
+	return d, nil
+}
+
+// Number of buckets held
+func (m *Memory) Len() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.buckets)
+}
+
+// Drop the buckets that are full - they would be created full again - the mutex must be held
+func (m *Memory) prune(now time.Time) {
+	if now.Sub(m.lastPrune) < pruneInterval {
+		return
+	}
+	m.lastPrune = now
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
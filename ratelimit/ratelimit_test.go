@@ -0,0 +1,197 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/problem"
+
+	"github.com/labstack/echo/v4"
+)
+
+// A clock moved by hand
+type testClock struct {
+	t time.Time
+}
+
+func (c *testClock) now() time.Time { return c.t }
+
+func newTestMemory() (*Memory, *testClock) {
+	clock := &testClock{t: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)}
+	m := NewMemory()
+	m.now = clock.now
+	return m, clock
+}
+
+// takeTestStruct: a Take after advancing the clock
+type takeTS struct {
+	advance  time.Duration
+	expected Decision
+}
+
+// takeTestStructs: 3 requests per 3 seconds - a token a second
+var takeTSs = []takeTS{
+	{0, Decision{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	{0, Decision{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+	{0, Decision{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+	{0, Decision{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+	{500 * time.Millisecond, Decision{Allowed: false, Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+	{500 * time.Millisecond, Decision{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+	{time.Hour, Decision{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+}
+
+// Test the token bucket allows bursts up to the limit and refills at the rate
+func TestMemoryTake(t *testing.T) {
+	m, clock := newTestMemory()
+	rule := Rule{Limit: 3, Period: 3 * time.Second}
+	for i, tt := range takeTSs {
+		clock.t = clock.t.Add(tt.advance)
+		d, err := m.Take(context.Background(), "key", rule)
+		if err != nil || d != tt.expected {
+			t.Errorf("ERROR -- for #%d expected (%+v) but got (%+v) (%v)\n", i, tt.expected, d, err)
+		}
+	}
+
+	// Other keys have buckets of their own
+	if d, _ := m.Take(context.Background(), "other", rule); !d.Allowed || d.Remaining != 2 {
+		t.Errorf("ERROR -- expected a full bucket for another key but got (%+v)\n", d)
+	}
+
+	// Buckets that have refilled are dropped
+	clock.t = clock.t.Add(2 * pruneInterval)
+	m.Take(context.Background(), "new", rule)
+	if m.Len() != 1 {
+		t.Errorf("ERROR -- expected 1 bucket after pruning but got (%v)\n", m.Len())
+	}
+}
+
+// A Limiter whose backend is down
+type failingLimiter struct{}
+
+func (failingLimiter) Take(ctx context.Context, key string, rule Rule) (Decision, error) {
+	return Decision{}, errors.New("backend unavailable")
+}
+
+func getLimitedEcho(l Limiter) *echo.Echo {
+	e := echo.New()
+	rules := Rules{
+		PerPrincipal: Rule{Limit: 2, Period: time.Minute},
+		PerIP:        Rule{Limit: 4, Period: time.Minute},
+		Routes:       map[string]Rule{"POST /produce": {Limit: 1, Period: time.Minute}},
+	}
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if subject := c.Request().Header.Get("X-Subject"); subject != "" {
+				c.SetRequest(c.Request().WithContext(auth.WithPrincipal(c.Request().Context(), auth.Principal{Subject: subject})))
+			}
+			return next(c)
+		}
+	})
+	e.Use(Middleware(l, rules, func(c echo.Context) bool { return c.Path() == "/healthz" }))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/produce", ok)
+	e.POST("/produce", ok)
+	e.GET("/healthz", ok)
+	return e
+}
+
+// middlewareTestStruct: run in order against one limiter
+type middlewareTS struct {
+	method    string
+	target    string
+	subject   string // Principal, if authenticated
+	expected  int
+	remaining string // Expected RateLimit-Remaining
+}
+
+// middlewareTestStructs: 2 a minute per principal, 4 per IP, 1 POST /produce each
+var middlewareTSs = []middlewareTS{
+	{http.MethodPost, "/produce", "alice", http.StatusOK, "0"},
+	{http.MethodPost, "/produce", "alice", http.StatusTooManyRequests, "0"},
+	{http.MethodPost, "/produce", "bob", http.StatusOK, "0"},
+	{http.MethodGet, "/produce", "bob", http.StatusOK, "0"},
+	{http.MethodGet, "/produce", "bob", http.StatusTooManyRequests, "0"},
+	{http.MethodGet, "/healthz", "bob", http.StatusOK, ""},
+	{http.MethodGet, "/produce", "", http.StatusTooManyRequests, "0"},
+}
+
+// Test requests are limited per principal, per IP and per route with RateLimit headers
+func TestMiddleware(t *testing.T) {
+	m, _ := newTestMemory()
+	e := getLimitedEcho(m)
+	for i, tt := range middlewareTSs {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.subject != "" {
+			req.Header.Set("X-Subject", tt.subject)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected || rec.Header().Get(HeaderRateLimitRemaining) != tt.remaining {
+			t.Errorf("ERROR -- for #%d (%v %v %v) expected (%v) (%v) but got (%v) (%v)\n", i, tt.method, tt.target, tt.subject, tt.expected, tt.remaining, rec.Code, rec.Header())
+		}
+		if rec.Code != http.StatusTooManyRequests {
+			continue
+		}
+		p := problem.Problem{}
+		json.Unmarshal(rec.Body.Bytes(), &p)
+		if rec.Header().Get(echo.HeaderContentType) != problem.MIMEApplicationProblemJSON || p.Status != http.StatusTooManyRequests ||
+			rec.Header().Get(HeaderRetryAfter) == "" || rec.Header().Get(HeaderRateLimitPolicy) == "" {
+			t.Errorf("ERROR -- for #%d expected a 429 problem with Retry-After but got (%v) (%v)\n", i, rec.Header(), rec.Body)
+		}
+	}
+
+	// A failing backend lets requests through
+	e = getLimitedEcho(failingLimiter{})
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/produce", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("ERROR -- expected (%v) but got (%v)\n", http.StatusOK, rec.Code)
+		}
+	}
+}
+
+// Test IPMiddleware limits requests before authentication, and Middleware after it leaves the
+// per IP bucket alone
+func TestIPMiddleware(t *testing.T) {
+	m, _ := newTestMemory()
+	rules := Rules{PerIP: Rule{Limit: 2, Period: time.Minute}}
+	e := echo.New()
+	e.Use(IPMiddleware(m, rules, nil))
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if c.Request().Header.Get("X-Subject") == "" {
+				return c.NoContent(http.StatusUnauthorized)
+			}
+			return next(c)
+		}
+	})
+	e.Use(Middleware(m, rules, nil))
+	e.GET("/produce", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	for i, tt := range []struct {
+		subject   string
+		expected  int
+		remaining string
+	}{
+		{"alice", http.StatusOK, "1"}, // Drawn on once, not twice
+		{"", http.StatusUnauthorized, "0"},
+		{"alice", http.StatusTooManyRequests, "0"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+		if tt.subject != "" {
+			req.Header.Set("X-Subject", tt.subject)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected || rec.Header().Get(HeaderRateLimitRemaining) != tt.remaining {
+			t.Errorf("ERROR -- for #%d expected (%v) (%v) but got (%v) (%v)\n", i, tt.expected, tt.remaining, rec.Code, rec.Header())
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"example.com/produce_demo/config"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Path parameters of a route template, e.g. :ProduceCode
+var routeParam = regexp.MustCompile(`:[^/]+|\*`)
+
+// corsTestStruct
+type corsTS struct {
+	origin  string
+	allowed bool
+}
+
+// corsTestStructs: test cases
+var corsTSs = []corsTS{
+	{"https://admin.example.com", true},
+	{"https://evil.example.com", false},
+	{"http://admin.example.com", false},
+}
+
+// Test every route answers preflight requests from the allowed origins, without credentials
+func TestCORSPreflight(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Tokens = []string{"token-1"}
+	cfg.CORS.AllowOrigins = []string{"https://admin.example.com"}
+	cfg.CORS.AllowCredentials = true
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := e.Routes()
+	if len(routes) == 0 {
+		t.Fatal("ERROR -- expected routes\n")
+	}
+	for _, route := range routes {
+		target := routeParam.ReplaceAllString(route.Path, "x")
+		for _, tt := range corsTSs {
+			req := httptest.NewRequest(http.MethodOptions, target, nil)
+			req.Header.Set(echo.HeaderOrigin, tt.origin)
+			req.Header.Set(echo.HeaderAccessControlRequestMethod, route.Method)
+			req.Header.Set(echo.HeaderAccessControlRequestHeaders, "Authorization, Content-Type")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			h := rec.Header()
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("ERROR -- for (%v %v) from (%v) expected (%v) but got (%v)\n", route.Method, route.Path, tt.origin, http.StatusNoContent, rec.Code)
+				continue
+			}
+			if !tt.allowed {
+				if h.Get(echo.HeaderAccessControlAllowOrigin) != "" {
+					t.Errorf("ERROR -- for (%v %v) expected (%v) refused but got (%v)\n", route.Method, route.Path, tt.origin, h)
+				}
+				continue
+			}
+			if h.Get(echo.HeaderAccessControlAllowOrigin) != tt.origin || h.Get(echo.HeaderAccessControlAllowCredentials) != "true" ||
+				!strings.Contains(h.Get(echo.HeaderAccessControlAllowMethods), route.Method) ||
+				h.Get(echo.HeaderAccessControlAllowHeaders) != strings.Join(cfg.CORS.AllowHeaders, ",") ||
+				h.Get(echo.HeaderAccessControlMaxAge) != "600" {
+				t.Errorf("ERROR -- for (%v %v) from (%v) unexpected headers (%v)\n", route.Method, route.Path, tt.origin, h)
+			}
+		}
+	}
+
+	// The response to the request itself may be read, 401 included, with its headers exposed
+	req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+	req.Header.Set(echo.HeaderOrigin, "https://admin.example.com")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get(echo.HeaderAccessControlAllowOrigin) != "https://admin.example.com" ||
+		!strings.Contains(rec.Header().Get(echo.HeaderAccessControlExposeHeaders), "X-Request-ID") {
+		t.Errorf("ERROR -- expected (%v) with CORS headers but got (%v) (%v)\n", http.StatusUnauthorized, rec.Code, rec.Header())
+	}
+
+	// Without allowed origins there is no CORS
+	rec = httptest.NewRecorder()
+	New().ServeHTTP(rec, req)
+	if rec.Header().Get(echo.HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("ERROR -- expected no CORS headers but got (%v)\n", rec.Header())
+	}
+}
+
+// Test the security headers are added to responses, HSTS only over HTTPS
+func TestSecurityHeaders(t *testing.T) {
+	expected := map[string]string{
+		echo.HeaderXContentTypeOptions:     "nosniff",
+		echo.HeaderXFrameOptions:           "DENY",
+		echo.HeaderContentSecurityPolicy:   "default-src 'none'; frame-ancestors 'none'",
+		echo.HeaderReferrerPolicy:          "no-referrer",
+		echo.HeaderStrictTransportSecurity: "",
+	}
+	rec := httptest.NewRecorder()
+	New().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/produce/NONE-1111-2222-3333", nil))
+	for header, value := range expected {
+		if rec.Header().Get(header) != value {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", header, value, rec.Header().Get(header))
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/healthz", nil)
+	// From a proxy on the private network that terminated TLS
+	req.RemoteAddr = "10.0.0.1:41000"
+	req.Header.Set(echo.HeaderXForwardedProto, "https")
+	rec = httptest.NewRecorder()
+	New().ServeHTTP(rec, req)
+	if hsts := rec.Header().Get(echo.HeaderStrictTransportSecurity); hsts != "max-age=31536000; includeSubdomains" {
+		t.Errorf("ERROR -- expected HSTS but got (%v)\n", hsts)
+	}
+
+	cfg := config.Default()
+	cfg.SecurityHeaders.Enabled = false
+	e, _ := NewWithConfig(cfg)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Header().Get(echo.HeaderXFrameOptions) != "" || rec.Header().Get(echo.HeaderXContentTypeOptions) != "" {
+		t.Errorf("ERROR -- expected no security headers but got (%v)\n", rec.Header())
+	}
+}
@@ -0,0 +1,190 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/config"
+	"example.com/produce_demo/problem"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// routePermissions: the permission guarding every route, by method and path template - empty for
+// routes that need no permission. A route missing from here fails TestRoles
+var routePermissions = map[string]string{
+	"GET /healthz":                                           "",
+	"GET /readyz":                                            "",
+	"GET /status":                                            "",
+	"GET /metrics":                                           "",
+	"GET /produce":                                           "produce:read",
+	"POST /produce":                                          "produce:write",
+	"GET /produce/:ProduceCode":                              "produce:read",
+	"PUT /produce/:ProduceCode":                              "produce:write",
+	"DELETE /produce/:ProduceCode":                           "produce:delete",
+	"GET /produce/:ProduceCode/suppliers":                    "produce:read",
+	"GET /stores/:storeId/produce":                           "produce:read",
+	"POST /stores/:storeId/produce":                          "produce:write",
+	"GET /stores/:storeId/produce/:ProduceCode":              "produce:read",
+	"PUT /stores/:storeId/produce/:ProduceCode":              "produce:write",
+	"DELETE /stores/:storeId/produce/:ProduceCode":           "produce:delete",
+	"POST /imports":                                          "produce:write",
+	"GET /imports/:ImportID":                                 "produce:read",
+	"GET /imports/:ImportID/rejections":                      "produce:read",
+	"GET /categories":                                        "produce:read",
+	"GET /categories/:CategoryID":                            "produce:read",
+	"POST /categories":                                       "produce:write",
+	"PUT /categories/:CategoryID":                            "produce:write",
+	"DELETE /categories/:CategoryID":                         "produce:delete",
+	"GET /admin/export":                                      "admin",
+	"POST /admin/restore":                                    "admin",
+	"GET /admin/log/levels":                                  "admin",
+	"PUT /admin/log/levels":                                  "admin",
+	"GET /admin/api-keys":                                    "admin",
+	"POST /admin/api-keys":                                   "admin",
+	"DELETE /admin/api-keys/:KeyID":                          "admin",
+	"GET /admin/stores":                                      "admin",
+	"POST /admin/stores":                                     "admin",
+	"DELETE /admin/stores/:storeId":                          "admin",
+	"GET /suppliers":                                         "produce:read",
+	"GET /suppliers/:SupplierID":                             "produce:read",
+	"POST /suppliers":                                        "admin",
+	"PUT /suppliers/:SupplierID":                             "admin",
+	"DELETE /suppliers/:SupplierID":                          "admin",
+	"GET /suppliers/:SupplierID/items":                       "produce:read",
+	"PUT /suppliers/:SupplierID/items/:ProduceCode":          "admin",
+	"DELETE /suppliers/:SupplierID/items/:ProduceCode":       "admin",
+	"GET /purchase-orders":                                   "produce:read",
+	"GET /purchase-orders/:OrderID":                          "produce:read",
+	"POST /purchase-orders":                                  "produce:write",
+	"PUT /purchase-orders/:OrderID":                          "produce:write",
+	"POST /purchase-orders/:OrderID/submit":                  "produce:write",
+	"POST /purchase-orders/:OrderID/cancel":                  "produce:write",
+	"POST /purchase-orders/:OrderID/receive":                 "produce:write",
+	"GET /inventory":                                         "produce:read",
+	"GET /inventory/movements":                               "produce:read",
+	"GET /inventory/lots":                                    "produce:read",
+	"GET /inventory/lots/expiring":                           "produce:read",
+	"POST /inventory/consume":                                "produce:write",
+	"GET /stores/:storeId/purchase-orders":                   "produce:read",
+	"GET /stores/:storeId/purchase-orders/:OrderID":          "produce:read",
+	"POST /stores/:storeId/purchase-orders":                  "produce:write",
+	"PUT /stores/:storeId/purchase-orders/:OrderID":          "produce:write",
+	"POST /stores/:storeId/purchase-orders/:OrderID/submit":  "produce:write",
+	"POST /stores/:storeId/purchase-orders/:OrderID/cancel":  "produce:write",
+	"POST /stores/:storeId/purchase-orders/:OrderID/receive": "produce:write",
+	"GET /stores/:storeId/inventory":                         "produce:read",
+	"GET /stores/:storeId/inventory/movements":               "produce:read",
+	"GET /stores/:storeId/inventory/lots":                    "produce:read",
+	"GET /stores/:storeId/inventory/lots/expiring":           "produce:read",
+	"POST /stores/:storeId/inventory/consume":                "produce:write",
+}
+
+// Values for path parameters that name nothing, so allowed requests change nothing
+var routeParamValues = map[string]string{
+	":ProduceCode": "ZZZZ-ZZZZ-ZZZZ-ZZZZ",
+	":storeId":     "no-such-store",
+}
+
+// Request target for a route template
+func routeTarget(path string) string {
+	return routeParam.ReplaceAllStringFunc(path, func(param string) string {
+		if value, ok := routeParamValues[param]; ok {
+			return value
+		}
+		return "no-such-" + strings.ToLower(strings.TrimPrefix(param, ":"))
+	})
+}
+
+// Permissions of each default role
+var rolePermissions = map[string][]string{
+	"cashier": {"produce:read"},
+	"buyer":   {"produce:read", "produce:write"},
+	"manager": {"produce:read", "produce:write", "produce:delete"},
+	"admin":   {"produce:read", "produce:write", "produce:delete", "admin"},
+	"":        {}, // A principal without roles
+}
+
+// Test each role against every endpoint
+func TestRoles(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "rbac-test-secret-rbac-test-secret"
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := e.Routes()
+	for _, route := range routes {
+		if _, ok := routePermissions[route.Method+" "+route.Path]; !ok {
+			t.Errorf("ERROR -- expected a permission listed for (%v %v)\n", route.Method, route.Path)
+		}
+	}
+
+	for role, permissions := range rolePermissions {
+		claims := jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix(), "roles": []string{role}}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.Auth.JWTSecret))
+
+		for _, route := range routes {
+			permission := routePermissions[route.Method+" "+route.Path]
+			if permission == "" {
+				continue
+			}
+			target := routeTarget(route.Path)
+			req := httptest.NewRequest(route.Method, target, strings.NewReader("{"))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			allowed := false
+			for _, p := range permissions {
+				allowed = allowed || p == permission
+			}
+			if allowed {
+				if rec.Code == http.StatusForbidden || rec.Code == http.StatusUnauthorized {
+					t.Errorf("ERROR -- for (%v) (%v %v) expected to be allowed but got (%v) (%v)\n", role, route.Method, target, rec.Code, rec.Body)
+				}
+				continue
+			}
+
+			p := problem.Problem{}
+			json.Unmarshal(rec.Body.Bytes(), &p)
+			if rec.Code != http.StatusForbidden || rec.Header().Get("Content-Type") != problem.MIMEApplicationProblemJSON ||
+				p.Status != http.StatusForbidden || !strings.Contains(p.Detail, permission) {
+				t.Errorf("ERROR -- for (%v) (%v %v) expected a 403 problem but got (%v) (%v) (%v)\n", role, route.Method, target, rec.Code, rec.Header(), rec.Body)
+			}
+		}
+	}
+}
+
+// Test the role mapping can be changed and static credentials get the static roles
+func TestRoleMapping(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.APIKeys = []string{"key-1"}
+	cfg.Auth.Roles["auditor"] = []string{"produce:read"}
+	cfg.Auth.Roles["cashier"] = []string{}
+	cfg.Auth.StaticRoles = []string{"auditor"}
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer New() // Restores the default roles
+
+	for _, tt := range []routerTS{
+		{http.MethodGet, "/produce", nil, "", http.StatusOK},
+		{http.MethodDelete, "/produce/ZZZZ-ZZZZ-ZZZZ-ZZZZ", nil, "", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Header.Set("X-API-Key", "key-1")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected {
+			t.Errorf("ERROR -- for (%v %v) expected (%v) but got (%v)\n", tt.method, tt.target, tt.expected, rec.Code)
+		}
+	}
+}
@@ -1,17 +1,146 @@
 package router
 
 import (
+	"time"
+
 	"example.com/produce_demo/api"
+	"example.com/produce_demo/api/handlers"
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/common"
+	"example.com/produce_demo/config"
+	"example.com/produce_demo/logging"
+	"example.com/produce_demo/metrics"
+	"example.com/produce_demo/ratelimit"
+	"example.com/produce_demo/tracing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 )
 
-// Create a new Echo and add the api routes
+// Create a new Echo with the default configuration and add the api routes
 func New() *echo.Echo {
+	e, _ := NewWithConfig(config.Default()) // The defaults need nothing read
+	return e
+}
+
+// Create a new Echo configured by cfg and add the api routes
+// Fails if a file the configuration names cannot be read
+func NewWithConfig(cfg *config.Config) (*echo.Echo, error) {
 	e := echo.New()
+	e.HideBanner = true
+	// Client IPs, as used by the rate limits and logs, come from the connection unless it is from a trusted proxy
+	e.IPExtractor = ipExtractor(cfg.RateLimit)
+
+	// set middleware
+	e.Use(tracing.Middleware())
+	e.Use(logging.Middleware())
+	e.Use(metrics.Middleware())
+	if sec := cfg.SecurityHeaders; sec.Enabled {
+		e.Use(middleware.SecureWithConfig(middleware.SecureConfig{
+			ContentTypeNosniff:    "nosniff",
+			XFrameOptions:         sec.FrameOptions,
+			ContentSecurityPolicy: sec.ContentSecurityPolicy,
+			ReferrerPolicy:        sec.ReferrerPolicy,
+			HSTSMaxAge:            int(time.Duration(sec.HSTSMaxAge).Seconds()),
+		}))
+	}
+	// Imports are spooled to disk so may be larger
+	e.Use(handlers.BodyLimit(cfg.Limits.MaxBodyBytes, map[string]int64{"/imports": cfg.Limits.MaxImportBytes}))
+	// Preflight requests are answered here, before they would need credentials
+	if cors := cfg.CORS; len(cors.AllowOrigins) != 0 {
+		e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
+			AllowOrigins:     cors.AllowOrigins,
+			AllowMethods:     cors.AllowMethods,
+			AllowHeaders:     cors.AllowHeaders,
+			ExposeHeaders:    cors.ExposeHeaders,
+			AllowCredentials: cors.AllowCredentials,
+			MaxAge:           int(time.Duration(cors.MaxAge).Seconds()),
+		}))
+	}
+	if err := auth.SetRoles(cfg.Auth.Roles); err != nil {
+		return nil, err
+	}
+	handlers.SetDefaultMaxProduce(cfg.Tenants.MaxProduce)
+	handlers.SetLimits(handlers.Limits{MaxBatchItems: cfg.Limits.MaxBatchItems, MaxConcurrentOps: cfg.Limits.MaxConcurrentOps})
+	common.SetMaxFieldLength(cfg.Limits.MaxFieldLength)
+	// Client IPs are limited before authentication, so failed attempts count too
+	rules := rateLimitRules(cfg.RateLimit)
+	limited := rules.PerPrincipal.Enabled() || rules.PerIP.Enabled() || len(rules.Routes) != 0
+	limiter := Limiter
+	if limited && limiter == nil {
+		limiter = ratelimit.NewMemory()
+	}
+	if limited {
+		e.Use(ratelimit.IPMiddleware(limiter, rules, func(c echo.Context) bool { return unauthenticated[c.Path()] }))
+	}
+	if cfg.Auth.Enabled() || cfg.TLS.ClientCerts() {
+		authenticator, err := auth.New(auth.Options{
+			Tokens:    cfg.Auth.Tokens,
+			APIKeys:   cfg.Auth.APIKeys,
+			Keys:      auth.Keys,
+			JWTSecret: cfg.Auth.JWTSecret,
+			JWKSFile:  cfg.Auth.JWKSFile,
+			Issuer:    cfg.Auth.JWTIssuer,
+			Audience:  cfg.Auth.JWTAudience,
+
+			StaticRoles: cfg.Auth.StaticRoles,
+			RolesClaim:  cfg.Auth.RolesClaim,
+			StoreClaim:  cfg.Auth.StoreClaim,
+
+			ClientCerts: cfg.TLS.ClientCerts(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		e.Use(auth.Middleware(authenticator, func(c echo.Context) bool { return unauthenticated[c.Path()] }))
+	}
+	if limited {
+		e.Use(ratelimit.Middleware(limiter, rules, func(c echo.Context) bool { return unauthenticated[c.Path()] }))
+	}
 
 	// set main routes
 	api.Produce(e)
+	api.Categories(e)
+	api.Suppliers(e)
+	api.PurchaseOrders(e)
+	api.Imports(e)
+	api.Admin(e)
+	api.Health(e)
+	api.Metrics(e)
 
-	return e
+	return e, nil
+}
+
+// Limiter keeps the rate limit buckets - set it to a shared backend before NewWithConfig so
+// every replica draws on the same buckets, otherwise each router keeps its own in memory
+var Limiter ratelimit.Limiter
+
+// Rules of the rate limit configuration
+func rateLimitRules(cfg config.RateLimitConfig) ratelimit.Rules {
+	rules := ratelimit.Rules{
+		PerPrincipal: ratelimit.Rule{Limit: cfg.PerKey.Limit, Period: cfg.PerKey.Period},
+		PerIP:        ratelimit.Rule{Limit: cfg.PerIP.Limit, Period: cfg.PerIP.Period},
+		Routes:       map[string]ratelimit.Rule{},
+	}
+	for route, rate := range cfg.Routes {
+		rules.Routes[route] = ratelimit.Rule{Limit: rate.Limit, Period: rate.Period}
+	}
+	return rules
 }
+
+// Extract the client IP from X-Forwarded-For when the request comes through a trusted proxy,
+// otherwise from the connection so the headers cannot be spoofed
+func ipExtractor(cfg config.RateLimitConfig) echo.IPExtractor {
+	ranges := cfg.TrustedRanges()
+	if len(ranges) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, ipRange := range ranges {
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// Probes open to orchestrators without credentials
+var unauthenticated = map[string]bool{"/healthz": true, "/readyz": true}
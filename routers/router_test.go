@@ -0,0 +1,192 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/auth"
+	"example.com/produce_demo/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// routerTestStruct
+type routerTS struct {
+	method   string
+	target   string
+	headers  map[string]string
+	body     string
+	expected int
+}
+
+// routerTestStructs: test cases
+var routerTSs = []routerTS{
+	{http.MethodGet, "/produce", nil, "", http.StatusUnauthorized},
+	{http.MethodGet, "/produce", map[string]string{"Authorization": "Bearer wrong"}, "", http.StatusUnauthorized},
+	{http.MethodGet, "/produce", map[string]string{"Authorization": "Bearer token-1"}, "", http.StatusOK},
+	{http.MethodGet, "/produce", map[string]string{"Authorization": "token-1"}, "", http.StatusUnauthorized},
+	{http.MethodGet, "/produce", map[string]string{"X-API-Key": "key-1"}, "", http.StatusOK},
+	{http.MethodGet, "/produce", map[string]string{"X-API-Key": "token-1"}, "", http.StatusUnauthorized},
+	{http.MethodGet, "/healthz", nil, "", http.StatusOK},
+	{http.MethodGet, "/readyz", nil, "", http.StatusOK},
+	{http.MethodGet, "/status", nil, "", http.StatusUnauthorized},
+	{http.MethodGet, "/status", map[string]string{"X-API-Key": "key-1"}, "", http.StatusOK},
+	{http.MethodPost, "/produce", map[string]string{"X-API-Key": "key-1", "Content-Type": "application/json"},
+		"[" + strings.Repeat(" ", 2048) + "]", http.StatusRequestEntityTooLarge},
+}
+
+// Test the configured middleware
+func TestNewWithConfig(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Tokens = []string{"token-1"}
+	cfg.Auth.APIKeys = []string{"key-1"}
+	cfg.Auth.JWTSecret = "router-test-secret-router-test-secret"
+	cfg.Limits.MaxBodyBytes = 1024
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range routerTSs {
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if tt.expected != rec.Code {
+			t.Errorf("ERROR -- for (%v %v %v) expected (%v) but got (%v)\n", tt.method, tt.target, tt.headers, tt.expected, rec.Code)
+		}
+	}
+
+	// Managed API keys and JWTs
+	_, secret, _ := auth.Keys.Create("router test", []string{"cashier"}, "")
+	defer func() {
+		for _, k := range auth.Keys.List() {
+			auth.Keys.Revoke(k.ID)
+		}
+	}()
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "roles": "cashier"}).SignedString([]byte(cfg.Auth.JWTSecret))
+	for header, value := range map[string]string{"X-API-Key": secret, "Authorization": "Bearer " + token} {
+		req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("ERROR -- for (%v) expected (%v) but got (%v)\n", header, http.StatusOK, rec.Code)
+		}
+	}
+
+	// A JWKS file that cannot be read is an error
+	cfg.Auth.JWKSFile = "/no/such/jwks.json"
+	if _, err := NewWithConfig(cfg); err == nil {
+		t.Errorf("ERROR -- expected an error for a missing JWKS file\n")
+	}
+
+	// Without auth settings no credentials are needed
+	rec := httptest.NewRecorder()
+	New().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/produce", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", http.StatusOK, rec.Code)
+	}
+
+	// Requests, including unauthorized ones, and store operations are measured
+	rec = httptest.NewRecorder()
+	New().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, expected := range []string{
+		`produce_demo_http_requests_total{method="GET",route="/produce",status="200"}`,
+		`produce_demo_http_requests_total{method="GET",route="/produce",status="401"}`,
+		`produce_demo_store_lock_wait_seconds_count{op="fetch"}`,
+		`produce_demo_store_rows 4`,
+	} {
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("ERROR -- expected (%v) in the metrics but got (%v) (%v)\n", expected, rec.Code, rec.Body)
+		}
+	}
+}
+
+// Test the configured rate limits refuse requests over them
+func TestRateLimit(t *testing.T) {
+	cfg := config.Default()
+	cfg.RateLimit.Routes = map[string]config.Rate{"GET /produce": {Limit: 2, Period: time.Minute}}
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/produce", nil))
+		if rec.Code != expected || rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("ERROR -- for #%d expected (%v) but got (%v) (%v)\n", i, expected, rec.Code, rec.Header())
+		}
+	}
+
+	// Other routes are not limited
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/produce/A12T-4GH7-QPL9-3N4M", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("ERROR -- expected (%v) without limits but got (%v) (%v)\n", http.StatusOK, rec.Code, rec.Header())
+	}
+}
+
+// Test client IPs are taken from X-Forwarded-For only when it comes from a trusted proxy
+func TestRateLimitClientIP(t *testing.T) {
+	for _, tt := range []struct {
+		trusted  []string
+		expected int
+	}{
+		{nil, http.StatusTooManyRequests},                  // Spoofed headers do not give new buckets
+		{[]string{"10.0.0.1"}, http.StatusTooManyRequests}, // Nor do they from a proxy that is not trusted
+		{[]string{"192.0.2.0/24"}, http.StatusOK},          // The proxy httptest requests come from
+	} {
+		cfg := config.Default()
+		cfg.RateLimit.PerIP = config.Rate{Limit: 1, Period: time.Minute}
+		cfg.RateLimit.TrustedProxies = tt.trusted
+		e, err := NewWithConfig(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		code := 0
+		for i, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+			req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+			req.Header.Set(echo.HeaderXForwardedFor, ip)
+			req.Header.Set(echo.HeaderXRealIP, ip)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if i == 0 && rec.Code != http.StatusOK {
+				t.Errorf("ERROR -- for %v expected (%v) but got (%v)\n", tt.trusted, http.StatusOK, rec.Code)
+			}
+			code = rec.Code
+		}
+		if code != tt.expected {
+			t.Errorf("ERROR -- for %v expected (%v) but got (%v)\n", tt.trusted, tt.expected, code)
+		}
+	}
+}
+
+// Test requests failing authentication still draw on the per IP limit
+func TestRateLimitUnauthenticated(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.Tokens = []string{"secret-token"}
+	cfg.RateLimit.PerIP = config.Rate{Limit: 2, Period: time.Minute}
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/produce", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer wrong-token")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != expected {
+			t.Errorf("ERROR -- for #%d expected (%v) but got (%v)\n", i, expected, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/produce_demo/config"
+	"example.com/produce_demo/db"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// A request made with credentials bound to a store, or to none
+type tenantTS struct {
+	store    string // Store the JWT is bound to
+	method   string
+	target   string
+	body     string
+	expected int
+	contains string // Expected in the response body, if set
+}
+
+var kale = `{"Produce Code": "TNNT-1111-2222-3333", "Name": "Kale", "Unit Price": "1.99"}`
+
+// tenantTestStructs: run in order - each store starts empty with room for one Produce
+var tenantTSs = []tenantTS{
+	{"", http.MethodPost, "/admin/stores", `{"ID": "north", "Name": "North", "Max Produce": 1}`, http.StatusCreated, ""},
+	{"", http.MethodPost, "/admin/stores", `{"ID": "south", "Name": "South", "Max Produce": 1}`, http.StatusCreated, ""},
+	{"", http.MethodPost, "/admin/stores", `{"ID": "south", "Name": "South"}`, http.StatusConflict, ""},
+	{"", http.MethodPost, "/admin/stores", `{"ID": "West Side", "Name": "West"}`, http.StatusBadRequest, ""},
+
+	// Catalogs are separate
+	{"", http.MethodPost, "/stores/north/produce", kale, http.StatusOK, "TNNT-1111-2222-3333"},
+	{"", http.MethodGet, "/stores/north/produce/TNNT-1111-2222-3333", "", http.StatusOK, "Kale"},
+	{"", http.MethodGet, "/stores/south/produce/TNNT-1111-2222-3333", "", http.StatusNoContent, ""},
+	{"", http.MethodGet, "/produce/TNNT-1111-2222-3333", "", http.StatusNoContent, ""},
+	{"", http.MethodGet, "/stores/east/produce", "", http.StatusNotFound, "east"},
+
+	// Quotas
+	{"", http.MethodPost, "/stores/north/produce", `{"Produce Code": "TNNT-1111-2222-4444", "Name": "Leek", "Unit Price": "0.99"}`, http.StatusPartialContent, "Store is full"},
+
+	// Bound credentials reach only their store, which /produce serves
+	{"south", http.MethodGet, "/stores/north/produce", "", http.StatusForbidden, "south"},
+	{"south", http.MethodPost, "/produce", kale, http.StatusOK, "TNNT-1111-2222-3333"},
+	{"south", http.MethodGet, "/stores/south/produce/TNNT-1111-2222-3333", "", http.StatusOK, "Kale"},
+	{"", http.MethodGet, "/produce/TNNT-1111-2222-3333", "", http.StatusNoContent, ""},
+
+	// Nor may they use the admin routes, which reach every store
+	{"south", http.MethodGet, "/admin/stores", "", http.StatusForbidden, "south"},
+	{"south", http.MethodDelete, "/admin/stores/north", "", http.StatusForbidden, "south"},
+	{"south", http.MethodGet, "/admin/export", "", http.StatusForbidden, "south"},
+	{"south", http.MethodPost, "/admin/restore", "", http.StatusForbidden, "south"},
+	{"south", http.MethodPut, "/admin/log/levels", `{"Package": "db", "Level": "debug"}`, http.StatusForbidden, "south"},
+	{"south", http.MethodPost, "/admin/api-keys", `{"Roles": ["admin"]}`, http.StatusForbidden, "south"},
+	{"south", http.MethodPost, "/suppliers", `{"ID": "orchard", "Name": "Orchard Farms"}`, http.StatusForbidden, "south"},
+
+	{"", http.MethodGet, "/admin/stores", "", http.StatusOK, `"Rows":1`},
+	{"", http.MethodDelete, "/admin/stores/north", "", http.StatusOK, `"Rows":1`},
+	{"", http.MethodDelete, "/admin/stores/north", "", http.StatusNotFound, ""},
+	{"", http.MethodGet, "/stores/north/produce", "", http.StatusNotFound, ""},
+	{"", http.MethodDelete, "/admin/stores/south", "", http.StatusOK, ""},
+	{"south", http.MethodGet, "/produce", "", http.StatusNotFound, "south"},
+}
+
+// Test stores have isolated catalogs reached by path or by the credentials' store claim
+func TestTenants(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "tenant-test-secret-tenant-test-secret"
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, tenant := range db.Tenants.List() {
+			db.Tenants.Delete(tenant.ID)
+		}
+	}()
+
+	for i, tt := range tenantTSs {
+		claims := jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix(), "roles": "admin"}
+		if tt.store != "" {
+			claims["store"] = tt.store
+		}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.Auth.JWTSecret))
+
+		req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Code != tt.expected || !strings.Contains(rec.Body.String(), tt.contains) {
+			t.Errorf("ERROR -- for #%d (%v %v %v) expected (%v) (%v) but got (%v) (%v)\n", i, tt.store, tt.method, tt.target, tt.expected, tt.contains, rec.Code, rec.Body)
+		}
+	}
+}
+
+// Test imports are seen only by credentials bound to the store they were made in, or to none
+func TestTenantImports(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret = "tenant-test-secret-tenant-test-secret"
+	e, err := NewWithConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"north", "south"} {
+		if _, err := db.Tenants.Create(db.Tenant{ID: id, Name: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, tenant := range db.Tenants.List() {
+			db.Tenants.Delete(tenant.ID)
+		}
+	}()
+
+	request := func(store, method, target, body string) *httptest.ResponseRecorder {
+		claims := jwt.MapClaims{"sub": "user", "exp": time.Now().Add(time.Hour).Unix(), "roles": "admin"}
+		if store != "" {
+			claims["store"] = store
+		}
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(cfg.Auth.JWTSecret))
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request("north", http.MethodPost, "/imports", "Produce Code,Name,Unit Price\nTNNT-1111-2222-3333,Kale,1.99\n")
+	location := rec.Header().Get("Location")
+	if rec.Code != http.StatusAccepted || !strings.Contains(rec.Body.String(), `"Store":"north"`) {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) (%v)\n", http.StatusAccepted, rec.Code, rec.Body)
+	}
+	for _, tt := range []struct {
+		store    string
+		expected int
+	}{
+		{"north", http.StatusOK},
+		{"", http.StatusOK},
+		{"south", http.StatusNotFound},
+	} {
+		for _, target := range []string{location, location + "/rejections"} {
+			if rec := request(tt.store, http.MethodGet, target, ""); rec.Code != tt.expected {
+				t.Errorf("ERROR -- for (%v %v) expected (%v) but got (%v) (%v)\n", tt.store, target, tt.expected, rec.Code, rec.Body)
+			}
+		}
+	}
+}
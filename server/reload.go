@@ -0,0 +1,81 @@
+package server
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+)
+
+// Serves a certificate and key from files, loading them again when either file changes
+// The files are checked on a handshake at most once per interval, so a renewed certificate is
+// served without a restart - if the new files cannot be loaded the old certificate is kept
+type certReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	now      func() time.Time
+
+	mutex    sync.Mutex
+	cert     *tls.Certificate
+	modified [2]time.Time // Of the certificate and key files when loaded
+	checked  time.Time
+}
+
+// Load the certificate and key, failing if they cannot be
+func newCertReloader(certFile string, keyFile string, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval, now: time.Now}
+	modified, err := r.modTimes()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modified); err != nil {
+		return nil, err
+	}
+	r.checked = r.now()
+	return r, nil
+}
+
+// Modification times of the certificate and key files
+func (r *certReloader) modTimes() ([2]time.Time, error) {
+	modified := [2]time.Time{}
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modified, err
+		}
+		modified[i] = info.ModTime()
+	}
+	return modified, nil
+}
+
+// Read the certificate and key - the mutex must be held, or r not yet shared
+func (r *certReloader) load(modified [2]time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modified = modified
+	return nil
+}
+
+// The certificate to present - for tls.Config.GetCertificate
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if now := r.now(); now.Sub(r.checked) >= r.interval {
+		r.checked = now
+		modified, err := r.modTimes()
+		if err != nil {
+			logger.Warn("getCertificate - failed to check the certificate files, keeping the loaded certificate", "error", err)
+		} else if modified != r.modified {
+			if err := r.load(modified); err != nil {
+				logger.Warn("getCertificate - failed to reload the certificate, keeping the loaded certificate", "error", err)
+			} else {
+				logger.Info("getCertificate - reloaded the certificate", "file", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
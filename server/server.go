@@ -0,0 +1,163 @@
+// HTTP server listeners
+//
+// The server listens on TCP (host:port) or a Unix domain socket (unix:/path/to.sock), serving
+// plain HTTP or TLS from a certificate and key that are reloaded when their files change
+// HTTP/2 is negotiated over TLS with ALPN, and spoken in the clear (h2c) by clients that know to
+// Clients can be asked for certificates signed by a CA - the verified chains reach handlers in
+// the request's TLS state, where auth maps them to principals
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"example.com/produce_demo/logging"
+)
+
+var logger = logging.For("server")
+
+// Prefix of a Listen address naming a Unix domain socket
+const unixPrefix = "unix:"
+
+// Client certificate policies
+const (
+	ClientAuthNone    = "none"    // Clients are not asked for certificates
+	ClientAuthRequest = "request" // Clients are asked for a certificate, which is verified if given
+	ClientAuthRequire = "require" // Clients must give a certificate that verifies
+)
+
+// TLS versions MinVersion may name
+var tlsVersions = map[string]uint16{"1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+
+// How the server listens
+type Options struct {
+	Listen string // host:port, or unix: followed by the path of a socket
+	HTTP2  bool   // Serve HTTP/2 as well as HTTP/1.1
+
+	CertFile       string        // PEM certificate chain - TLS is served when set
+	KeyFile        string        // PEM private key of the certificate
+	ReloadInterval time.Duration // Least time between checks of the certificate and key files for changes
+	MinVersion     string        // Oldest TLS version accepted, 1.2 or 1.3 - empty for 1.2
+	ClientCAFile   string        // PEM certificates of the CAs client certificates are verified against
+	ClientAuth     string        // ClientAuthNone, ClientAuthRequest or ClientAuthRequire - empty for none
+}
+
+// Reports whether options serves TLS
+func (o Options) TLS() bool {
+	return o.CertFile != ""
+}
+
+// Server is an http.Server with its listener
+type Server struct {
+	*http.Server
+	listener net.Listener
+	tls      bool
+}
+
+// Listen as options say, ready to serve handler
+// Fails if the address cannot be listened on or a certificate file cannot be read
+func Listen(handler http.Handler, options Options) (*Server, error) {
+	s := &Server{Server: &http.Server{Handler: handler, ReadHeaderTimeout: 30 * time.Second}, tls: options.TLS()}
+	s.Protocols = &http.Protocols{}
+	s.Protocols.SetHTTP1(true)
+	if options.HTTP2 {
+		s.Protocols.SetHTTP2(true)
+		s.Protocols.SetUnencryptedHTTP2(true)
+	}
+	if s.tls {
+		var err error
+		if s.TLSConfig, err = tlsConfig(options); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	if path, ok := strings.CutPrefix(options.Listen, unixPrefix); ok {
+		s.listener, err = listenUnix(path)
+	} else {
+		s.listener, err = net.Listen("tcp", options.Listen)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// TLS configuration for options, loading the certificate and the client CAs
+func tlsConfig(options Options) (*tls.Config, error) {
+	reloader, err := newCertReloader(options.CertFile, options.KeyFile, options.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{GetCertificate: reloader.getCertificate, MinVersion: tls.VersionTLS12}
+	if options.MinVersion != "" {
+		version, ok := tlsVersions[options.MinVersion]
+		if !ok {
+			return nil, errors.New("bad TLS version (" + options.MinVersion + ")")
+		}
+		config.MinVersion = version
+	}
+
+	switch options.ClientAuth {
+	case "", ClientAuthNone:
+		return config, nil
+	case ClientAuthRequest:
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, errors.New("bad client auth (" + options.ClientAuth + ")")
+	}
+	b, err := os.ReadFile(options.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	config.ClientCAs = x509.NewCertPool()
+	if !config.ClientCAs.AppendCertsFromPEM(b) {
+		return nil, errors.New(options.ClientCAFile + ": no PEM certificates")
+	}
+	return config, nil
+}
+
+// Listen on the Unix domain socket at path, replacing a socket left by a server that did not
+// stop cleanly - any other file there is an error
+// The socket is removed when the listener is closed
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New(path + ": socket in use")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// Address being listened on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Reports whether s serves TLS
+func (s *Server) TLS() bool {
+	return s.tls
+}
+
+// Serve requests until the server is shut down - returns http.ErrServerClosed then
+func (s *Server) Serve() error {
+	logger.Info("Serve - listening", "address", s.listener.Addr().String(), "tls", s.tls)
+	if s.tls {
+		// The certificate comes from TLSConfig.GetCertificate
+		return s.Server.ServeTLS(s.listener, "", "")
+	}
+	return s.Server.Serve(s.listener)
+}
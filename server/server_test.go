@@ -0,0 +1,310 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Certificate and key signed by a test CA
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// Create a certificate for cn, signed by ca - self-signed as a CA when ca is nil
+func newCert(t *testing.T, cn string, ca *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{"cashier"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// Write the certificate and key as PEM files in dir, dated modified
+func (c *testCert) write(t *testing.T, dir string, modified time.Time) (string, string) {
+	keyDER, _ := x509.MarshalECPrivateKey(c.key)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for path, block := range map[string]*pem.Block{certFile: {Type: "CERTIFICATE", Bytes: c.der}, keyFile: {Type: "EC PRIVATE KEY", Bytes: keyDER}} {
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modified, modified)
+	}
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+// Handler answering with the common name of the client's verified certificate, if any
+var whoami = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 {
+		io.WriteString(w, r.TLS.VerifiedChains[0][0].Subject.CommonName)
+	}
+})
+
+// Serve s until the test ends
+func serve(t *testing.T, s *Server) {
+	done := make(chan error, 1)
+	go func() { done <- s.Serve() }()
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+		if err := <-done; !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("ERROR -- expected (%v) but got (%v)\n", http.ErrServerClosed, err)
+		}
+	})
+}
+
+// Client trusting ca, presenting cert if it is not nil
+func tlsClient(ca *testCert, cert *testCert, http2 bool) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{cert.tlsCert()}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config, ForceAttemptHTTP2: http2}, Timeout: 10 * time.Second}
+}
+
+// listenTestStruct
+type listenTS struct {
+	name       string
+	http2      bool
+	clientAuth string
+	clientCert bool
+	expected   string // Expected body - empty when the request fails
+	proto      int
+}
+
+// listenTestStructs: test cases
+var listenTSs = []listenTS{
+	{"HTTP/2", true, ClientAuthNone, false, "", 2},
+	{"HTTP/1.1", false, ClientAuthNone, false, "", 1},
+	{"not asked for a certificate", true, ClientAuthNone, true, "", 2},
+	{"certificate requested", true, ClientAuthRequest, false, "", 2},
+	{"certificate requested and given", true, ClientAuthRequest, true, "till-7", 2},
+	{"certificate required and given", true, ClientAuthRequire, true, "till-7", 2},
+	{"certificate required", true, ClientAuthRequire, false, "", 0},
+}
+
+// Test TLS is served with HTTP/2 and client certificates as configured
+func TestListenTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "test CA", nil, 0)
+	certFile, keyFile := newCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth).write(t, dir, time.Now())
+	caFile := filepath.Join(dir, "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0o600)
+	client := newCert(t, "till-7", ca, x509.ExtKeyUsageClientAuth)
+
+	for _, tt := range listenTSs {
+		s, err := Listen(whoami, Options{Listen: "127.0.0.1:0", HTTP2: tt.http2, CertFile: certFile, KeyFile: keyFile,
+			ReloadInterval: time.Minute, ClientCAFile: caFile, ClientAuth: tt.clientAuth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, s)
+
+		var clientCert *testCert
+		if tt.clientCert {
+			clientCert = client
+		}
+		resp, err := tlsClient(ca, clientCert, true).Get("https://" + s.Addr().String() + "/")
+		if tt.proto == 0 {
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("ERROR -- for (%v) expected the handshake to fail\n", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ERROR -- for (%v) unexpected error (%v)\n", tt.name, err)
+			continue
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(b) != tt.expected || resp.ProtoMajor != tt.proto {
+			t.Errorf("ERROR -- for (%v) expected (%v HTTP/%v) but got (%s HTTP/%v)\n", tt.name, tt.expected, tt.proto, b, resp.ProtoMajor)
+		}
+	}
+
+	// Files that cannot be read, and settings that make no sense, are errors
+	for _, options := range []Options{
+		{Listen: "127.0.0.1:0", CertFile: filepath.Join(dir, "none.pem"), KeyFile: keyFile},
+		{Listen: "127.0.0.1:0", CertFile: certFile, KeyFile: caFile},
+		{Listen: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile, MinVersion: "1.1"},
+		{Listen: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire, ClientCAFile: keyFile},
+		{Listen: "127.0.0.1:0", CertFile: certFile, KeyFile: keyFile, ClientAuth: "maybe"},
+	} {
+		if _, err := Listen(whoami, options); err == nil {
+			t.Errorf("ERROR -- expected an error for (%+v)\n", options)
+		}
+	}
+}
+
+// Test a changed certificate is served without a restart, and a broken one is not
+func TestCertReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "test CA", nil, 0)
+	modified := time.Now().Add(-time.Minute)
+	certFile, keyFile := newCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth).write(t, dir, modified)
+	s, err := Listen(whoami, Options{Listen: "127.0.0.1:0", HTTP2: true, CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, s)
+
+	// Each request makes a new connection so a new handshake
+	served := func() string {
+		client := tlsClient(ca, nil, true)
+		client.Transport.(*http.Transport).DisableKeepAlives = true
+		resp, err := client.Get("https://" + s.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0].SerialNumber.String()
+	}
+	first := served()
+
+	renewed := newCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth)
+	renewed.write(t, dir, modified.Add(time.Second))
+	if got := served(); got == first || got != renewed.cert.SerialNumber.String() {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", renewed.cert.SerialNumber, got)
+	}
+
+	// A key that does not match is not loaded
+	os.WriteFile(keyFile, []byte("not a key"), 0o600)
+	os.Chtimes(keyFile, modified.Add(2*time.Second), modified.Add(2*time.Second))
+	if got := served(); got != renewed.cert.SerialNumber.String() {
+		t.Errorf("ERROR -- expected (%v) kept but got (%v)\n", renewed.cert.SerialNumber, got)
+	}
+}
+
+// Test the reloader checks the files no more often than its interval
+func TestCertReloadInterval(t *testing.T) {
+	dir := t.TempDir()
+	ca := newCert(t, "test CA", nil, 0)
+	modified := time.Now().Add(-time.Minute)
+	certFile, keyFile := newCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth).write(t, dir, modified)
+	r, err := newCertReloader(certFile, keyFile, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	r.checked = now
+	first, _ := r.getCertificate(nil)
+
+	newCert(t, "127.0.0.1", ca, x509.ExtKeyUsageServerAuth).write(t, dir, modified.Add(time.Second))
+	if cert, _ := r.getCertificate(nil); cert != first {
+		t.Errorf("ERROR -- expected the certificate kept until the interval passed\n")
+	}
+	now = now.Add(time.Minute)
+	if cert, _ := r.getCertificate(nil); cert == first {
+		t.Errorf("ERROR -- expected the certificate reloaded after the interval\n")
+	}
+}
+
+// Test HTTP/2 is spoken in the clear to clients that ask for it
+func TestListenH2C(t *testing.T) {
+	for _, http2 := range []bool{true, false} {
+		s, err := Listen(whoami, Options{Listen: "127.0.0.1:0", HTTP2: http2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serve(t, s)
+
+		protocols := &http.Protocols{}
+		protocols.SetUnencryptedHTTP2(true)
+		client := &http.Client{Transport: &http.Transport{Protocols: protocols}, Timeout: 10 * time.Second}
+		resp, err := client.Get("http://" + s.Addr().String() + "/")
+		if http2 && (err != nil || resp.ProtoMajor != 2) {
+			t.Errorf("ERROR -- expected HTTP/2 but got (%v) (%v)\n", resp, err)
+		}
+		if !http2 && err == nil {
+			t.Errorf("ERROR -- expected HTTP/2 refused but got (%v)\n", resp.Proto)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+	}
+}
+
+// Test serving on a Unix domain socket, replacing a stale one
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "produce.sock")
+
+	// A socket left behind by a server that did not stop cleanly
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	s, err := Listen(whoami, Options{Listen: "unix:" + path, HTTP2: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve(t, s)
+
+	client := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", path)
+	}}, Timeout: 10 * time.Second}
+	resp, err := client.Get("http://produce_demo/")
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("ERROR -- expected (%v) but got (%v) (%v)\n", http.StatusOK, resp, err)
+	}
+	resp.Body.Close()
+
+	// A socket in use, or another file, is not replaced
+	if _, err := Listen(whoami, Options{Listen: "unix:" + path}); err == nil {
+		t.Errorf("ERROR -- expected an error for a socket in use\n")
+	}
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0o600)
+	if _, err := Listen(whoami, Options{Listen: "unix:" + file}); err == nil {
+		t.Errorf("ERROR -- expected an error for a file\n")
+	}
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("example.com/produce_demo/tracing")
+
+// Serve every request in a server span, continuing the trace in its traceparent header
+// The span is named for the method and route template, e.g. "POST /produce"
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			ctx, span := tracer.Start(ctx, request.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(request.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(request.URL.Path),
+					semconv.ClientAddress(c.RealIP()),
+				))
+			defer span.End()
+			c.SetRequest(request.WithContext(ctx))
+
+			// Write a returned error now so the span records the status sent
+			if err := next(c); err != nil {
+				span.RecordError(err)
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status), attribute.Int64("http.response.body.size", c.Response().Size))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// OpenTelemetry tracing
+//
+// Packages start spans from their own tracer, which follows whatever provider Setup installs:
+//
+//	var tracer = otel.Tracer("example.com/produce_demo/db")
+//	ctx, span := tracer.Start(ctx, "db.Add")
+//	defer span.End()
+//
+// Until Setup is called (or with ExporterNone) spans are not recorded.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Name of the service on every span
+const ServiceName = "produce_demo"
+
+// Exporters
+const (
+	ExporterNone   = "none"   // Spans are not recorded
+	ExporterStdout = "stdout" // Spans are written to stdout as JSON
+	ExporterFile   = "file"   // Spans are written to Options.File as JSON
+	ExporterOTLP   = "otlp"   // Spans are sent to an OTLP/HTTP collector
+)
+
+// How spans are exported
+type Options struct {
+	Exporter    string
+	File        string  // File for ExporterFile - appended to
+	Endpoint    string  // Collector URL for ExporterOTLP, e.g. http://localhost:4318 - empty to use the OTEL_EXPORTER_OTLP_* environment
+	SampleRatio float64 // Fraction of new traces recorded - incoming sampled traces are always recorded
+	Version     string  // Version of the service
+}
+
+func init() {
+	// W3C trace context and baggage are read from requests even when spans are not recorded
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Install the tracer provider for options, writing ExporterStdout spans to stdout
+// Returns the func that flushes and stops the provider
+func Setup(ctx context.Context, options Options, stdout io.Writer) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	switch options.Exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	case ExporterFile:
+		file, err = os.OpenFile(options.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	case ExporterOTLP:
+		clientOptions := []otlptracehttp.Option{}
+		if options.Endpoint != "" {
+			clientOptions = append(clientOptions, otlptracehttp.WithEndpointURL(options.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, clientOptions...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter (%s)", options.Exporter)
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+		semconv.ServiceVersion(options.Version),
+	)
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(options.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Test requests are served in server spans that continue the caller's trace
+func TestMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	e := echo.New()
+	e.Use(Middleware())
+	e.GET("/produce/:ProduceCode", func(c echo.Context) error {
+		return c.String(http.StatusOK, trace.SpanContextFromContext(c.Request().Context()).TraceID().String())
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(echo.GET, "/produce/A12T-4GH7-QPL9-3N4M", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Body.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("ERROR -- expected the handler to see the incoming trace but got (%v)\n", rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/fail", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("ERROR -- expected (%v) but got (%v)\n", http.StatusInternalServerError, rec.Code)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("ERROR -- expected 2 spans but got (%v)\n", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "GET /produce/:ProduceCode" || span.SpanKind() != trace.SpanKindServer ||
+		span.Parent().SpanID().String() != "00f067aa0ba902b7" || span.Status().Code == codes.Error {
+		t.Errorf("ERROR -- unexpected span (%v) (%v) (%v) (%v)\n", span.Name(), span.SpanKind(), span.Parent().SpanID(), span.Status())
+	}
+	if !hasAttribute(span, string(semconv.HTTPResponseStatusCodeKey), "200") {
+		t.Errorf("ERROR -- expected the status code attribute but got (%v)\n", span.Attributes())
+	}
+	span = spans[1]
+	if span.Name() != "GET /fail" || span.Parent().IsValid() || span.Status().Code != codes.Error ||
+		!hasAttribute(span, string(semconv.HTTPResponseStatusCodeKey), "500") {
+		t.Errorf("ERROR -- unexpected span (%v) (%v) (%v)\n", span.Name(), span.Parent(), span.Status())
+	}
+}
+
+// Helper function reporting whether a span has an attribute
+func hasAttribute(span sdktrace.ReadOnlySpan, key string, value string) bool {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key && attr.Value.Emit() == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Test the exporters
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+
+	// No exporter records nothing
+	stop, err := Setup(ctx, Options{Exporter: ExporterNone}, io.Discard)
+	if err != nil || stop(ctx) != nil {
+		t.Errorf("ERROR -- expected no error but got (%v)\n", err)
+	}
+
+	if _, err := Setup(ctx, Options{Exporter: "jaeger"}, io.Discard); err == nil {
+		t.Errorf("ERROR -- expected an error for an unknown exporter\n")
+	}
+	if _, err := Setup(ctx, Options{Exporter: ExporterFile, File: filepath.Join(t.TempDir(), "missing", "traces.json")}, io.Discard); err == nil {
+		t.Errorf("ERROR -- expected an error for a file that cannot be created\n")
+	}
+
+	// Spans are written to the file when the provider stops
+	path := filepath.Join(t.TempDir(), "traces.json")
+	stop, err = Setup(ctx, Options{Exporter: ExporterFile, File: path, SampleRatio: 1, Version: "1.2.3"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer("test").Start(ctx, "db.Add")
+	span.End()
+	if err := stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(b), "\"db.Add\"") || !strings.Contains(string(b), "produce_demo") {
+		t.Errorf("ERROR -- expected the span in the file but got (%s) (%v)\n", b, err)
+	}
+}